@@ -5,11 +5,25 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+
+	"github.com/bdmorin/gristle/common"
 	"github.com/bdmorin/gristle/gristapi"
 	"github.com/bdmorin/gristle/gristtools"
 	"github.com/spf13/cobra"
 )
 
+// parseDocID accepts a document id or a Grist URL pointing to the document
+func parseDocID(arg string) string {
+	docID, err := common.ParseDocID(arg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid document: %s\n", err)
+		os.Exit(1)
+	}
+	return docID
+}
+
 var docCmd = &cobra.Command{
 	Use:   "doc",
 	Short: "Manage documents",
@@ -21,7 +35,7 @@ var docGetCmd = &cobra.Command{
 	Short: "Get document details",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		gristtools.DisplayDoc(args[0])
+		gristtools.DisplayDoc(parseDocID(args[0]))
 	},
 }
 
@@ -30,7 +44,7 @@ var docAccessCmd = &cobra.Command{
 	Short: "Get document access permissions",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		gristtools.DisplayDocAccess(args[0])
+		gristtools.DisplayDocAccess(parseDocID(args[0]))
 	},
 }
 
@@ -39,18 +53,18 @@ var docWebhooksCmd = &cobra.Command{
 	Short: "List document webhooks",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		gristtools.DisplayDocWebhooks(args[0])
+		gristtools.DisplayDocWebhooks(parseDocID(args[0]))
 	},
 }
 
 var docExportCmd = &cobra.Command{
 	Use:       "export <doc-id> <format>",
 	Short:     "Export document",
-	Long:      `Export document in the specified format: excel or grist`,
+	Long:      `Export document in the specified format: excel or grist, or json to write the records of every table to stdout`,
 	Args:      cobra.ExactArgs(2),
-	ValidArgs: []string{"excel", "grist"},
+	ValidArgs: []string{"excel", "grist", "json"},
 	Run: func(cmd *cobra.Command, args []string) {
-		docID := args[0]
+		docID := parseDocID(args[0])
 		format := args[1]
 
 		switch format {
@@ -58,18 +72,48 @@ var docExportCmd = &cobra.Command{
 			gristtools.ExportDocExcel(docID)
 		case "grist":
 			gristtools.ExportDocGrist(docID)
+		case "json":
+			if err := gristapi.ExportDocJSON(docID, os.Stdout, gristapi.ExportJSONOptions{Schema: jsonSchema}); err != nil {
+				fmt.Fprintf(os.Stderr, "Export failed: %s\n", err)
+				os.Exit(1)
+			}
 		default:
 			_ = cmd.Help()
 		}
 	},
 }
 
+var jsonSchema bool
+
+var (
+	csvDelimiter string
+	csvBOM       bool
+	csvCRLF      bool
+)
+
 var docTableCmd = &cobra.Command{
 	Use:   "table <doc-id> <table-name>",
 	Short: "Export table as CSV",
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		gristapi.GetTableContent(args[0], args[1])
+		docID := parseDocID(args[0])
+		if !cmd.Flags().Changed("delimiter") && !csvBOM && !csvCRLF {
+			gristtools.DisplayTableContent(docID, args[1])
+			return
+		}
+		delimiter := []rune(csvDelimiter)
+		if len(delimiter) != 1 {
+			fmt.Fprintf(os.Stderr, "Invalid delimiter %q: expected a single character\n", csvDelimiter)
+			os.Exit(1)
+		}
+		options := gristapi.CSVOptions{Delimiter: delimiter[0], BOM: csvBOM}
+		if csvCRLF {
+			options.LineEnding = "\r\n"
+		}
+		if _, err := gristapi.ExportTableCSV(docID, args[1], &options, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed: %s\n", err)
+			os.Exit(1)
+		}
 	},
 }
 
@@ -80,4 +124,8 @@ func init() {
 	docCmd.AddCommand(docWebhooksCmd)
 	docCmd.AddCommand(docExportCmd)
 	docCmd.AddCommand(docTableCmd)
+	docExportCmd.Flags().BoolVar(&jsonSchema, "schema", false, "Include the document schema under \"_schema\" in a json export")
+	docTableCmd.Flags().StringVar(&csvDelimiter, "delimiter", ",", "CSV field delimiter, e.g. ';' for Excel in European locales")
+	docTableCmd.Flags().BoolVar(&csvBOM, "bom", false, "Start with a UTF-8 byte order mark for Excel")
+	docTableCmd.Flags().BoolVar(&csvCRLF, "crlf", false, "End lines with CRLF")
 }
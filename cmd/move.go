@@ -29,7 +29,10 @@ var moveDocCmd = &cobra.Command{
 			fmt.Fprintf(os.Stderr, "Invalid workspace ID: %s\n", args[1])
 			os.Exit(1)
 		}
-		gristapi.MoveDoc(args[0], wsID)
+		if err := gristapi.MoveDoc(args[0], wsID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	},
 }
 
@@ -48,7 +51,10 @@ var moveDocsCmd = &cobra.Command{
 			fmt.Fprintf(os.Stderr, "Invalid to workspace ID: %s\n", args[1])
 			os.Exit(1)
 		}
-		gristapi.MoveAllDocs(fromID, toID)
+		if err := gristapi.MoveAllDocs(fromID, toID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	},
 }
 
@@ -37,7 +37,10 @@ var purgeDocCmd = &cobra.Command{
 			}
 		}
 
-		gristapi.PurgeDoc(docID, nbStates)
+		if err := gristapi.PurgeDoc(docID, nbStates); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	},
 }
 
@@ -7,7 +7,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/bdmorin/gristle/gristapi"
 	"github.com/bdmorin/gristle/gristtools"
 	"github.com/bdmorin/gristle/tui"
 	"github.com/spf13/cobra"
@@ -16,6 +18,7 @@ import (
 var (
 	outputFormat string
 	jsonOutput   bool
+	timeout      time.Duration
 	Version      = "dev" // Set via ldflags during build
 )
 
@@ -49,9 +52,33 @@ Run with no arguments to launch the interactive TUI.`,
 		} else {
 			gristtools.SetOutput("table")
 		}
+		if cmd.Flags().Changed("timeout") {
+			options := gristapi.DefaultConnectionOptions
+			options.Timeout = timeout
+			gristapi.SetConnectionOptions(options)
+		}
+		if needsConfig(cmd) {
+			if _, err := gristapi.GetConfig(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
 	},
 }
 
+// needsConfig tells whether a command talks to Grist, and thus needs
+// GRIST_URL and GRIST_TOKEN. The TUI and the config command help setting
+// them up, so they run without
+func needsConfig(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		switch c.Name() {
+		case "config", "version", "help", "completion":
+			return false
+		}
+	}
+	return cmd.HasParent()
+}
+
 // Execute runs the root command
 func Execute() error {
 	return rootCmd.Execute()
@@ -61,4 +88,5 @@ func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format: table or json")
 	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Output as JSON (shorthand for -o json)")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", gristapi.DefaultConnectionOptions.Timeout, "Timeout of each request to Grist, downloads excepted, 0 for none")
 }
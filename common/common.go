@@ -74,6 +74,61 @@ func IsValidEmail(mail string) bool {
 	return strings.Contains(mail, "@")
 }
 
+// Check if a string is a valid Grist identifier (table or column id): an
+// ASCII letter followed by ASCII letters, digits or underscores
+func IsValidGristIdentifier(id string) bool {
+	if id == "" {
+		return false
+	}
+	for i, r := range id {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (i == 0 || (r != '_' && (r < '0' || r > '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// Normalize an email before sending it to Grist, which compares emails
+// case-insensitively: trims whitespace and lowercases it
+func NormalizeEmail(mail string) string {
+	return strings.ToLower(strings.TrimSpace(mail))
+}
+
+// ASCIIMode reports whether status markers must be plain ASCII,
+// which is enabled by setting the GRISTCTL_ASCII environment variable
+func ASCIIMode() bool {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("GRISTCTL_ASCII")))
+	return value != "" && value != "0" && value != "false"
+}
+
+// StatusMarker returns the marker shown in status messages: an emoji by default,
+// or [OK]/[FAIL] in ASCII mode for terminals and CI logs that can't render emoji
+func StatusMarker(ok bool) string {
+	if ASCIIMode() {
+		if ok {
+			return "[OK]"
+		}
+		return "[FAIL]"
+	}
+	if ok {
+		return "✅"
+	}
+	return "❗️"
+}
+
+// PinnedMarker returns the marker of a pinned document in listings: a pin by
+// default, or [PINNED] in ASCII mode, and "" for a document that isn't pinned
+func PinnedMarker(pinned bool) string {
+	if !pinned {
+		return ""
+	}
+	if ASCIIMode() {
+		return "[PINNED]"
+	}
+	return "📌"
+}
+
 // Confirm a question
 func Confirm(question string) bool {
 	var response string
@@ -150,6 +205,44 @@ func NormalizeURL(input string) (string, error) {
 	return fmt.Sprintf("%s://%s", scheme, hostname), nil
 }
 
+// Grist document ids (and url ids) are alphanumeric; forks add "~" parts
+var docIDRegex = regexp.MustCompile(`^[A-Za-z0-9]+(~[A-Za-z0-9_]+)*$`)
+
+// ParseDocID extracts a document id from a Grist browser or API URL, e.g.
+// https://x.getgrist.com/doc/Abc123/p/2, https://host/o/org/Abc123/Doc-Name
+// or https://host/api/docs/Abc123. A bare id is returned unchanged
+func ParseDocID(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if docIDRegex.MatchString(input) {
+		return input, nil
+	}
+
+	parsedURL, err := url.Parse(input)
+	if err != nil || parsedURL.Host == "" {
+		return "", fmt.Errorf("not a document id nor a Grist URL: %q", input)
+	}
+	segments := []string{}
+	for _, segment := range strings.Split(parsedURL.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	// Organization prefix: /o/{org}/...
+	if len(segments) >= 2 && segments[0] == "o" {
+		segments = segments[2:]
+	}
+	switch {
+	case len(segments) >= 3 && segments[0] == "api" && segments[1] == "docs":
+		segments = segments[2:]
+	case len(segments) >= 2 && segments[0] == "doc":
+		segments = segments[1:]
+	}
+	if len(segments) == 0 || !docIDRegex.MatchString(segments[0]) || segments[0] == "ws" {
+		return "", fmt.Errorf("no document id found in URL %q", input)
+	}
+	return segments[0], nil
+}
+
 // Print an example command line
 func PrintCommand(txt string) {
 	stdout := colorable.NewColorableStdout()
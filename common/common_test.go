@@ -89,3 +89,108 @@ func TestNormalizeURL(t *testing.T) {
 		})
 	}
 }
+
+func TestStatusMarker(t *testing.T) {
+	t.Setenv("GRISTCTL_ASCII", "")
+	if StatusMarker(true) != "✅" || StatusMarker(false) != "❗️" {
+		t.Errorf("Expected emoji markers by default, got %q and %q", StatusMarker(true), StatusMarker(false))
+	}
+	if PinnedMarker(true) != "📌" || PinnedMarker(false) != "" {
+		t.Errorf("Expected a pin for pinned documents only, got %q and %q", PinnedMarker(true), PinnedMarker(false))
+	}
+
+	for _, value := range []string{"1", "true", "yes"} {
+		t.Setenv("GRISTCTL_ASCII", value)
+		for _, ok := range []bool{true, false} {
+			for _, marker := range []string{StatusMarker(ok), PinnedMarker(ok)} {
+				if utf8.RuneCountInString(marker) != len(marker) {
+					t.Errorf("GRISTCTL_ASCII=%s: marker %q contains multibyte characters", value, marker)
+				}
+			}
+		}
+	}
+	if StatusMarker(true) != "[OK]" || StatusMarker(false) != "[FAIL]" {
+		t.Errorf("Expected [OK]/[FAIL], got %q and %q", StatusMarker(true), StatusMarker(false))
+	}
+	if PinnedMarker(true) != "[PINNED]" || PinnedMarker(false) != "" {
+		t.Errorf("Expected [PINNED] for pinned documents only, got %q and %q", PinnedMarker(true), PinnedMarker(false))
+	}
+
+	t.Setenv("GRISTCTL_ASCII", "0")
+	if ASCIIMode() {
+		t.Error("GRISTCTL_ASCII=0 should not enable ASCII mode")
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"user@domain.fr", "user@domain.fr"},
+		{"User@Domain.FR", "user@domain.fr"},
+		{"  user@domain.fr\t", "user@domain.fr"},
+		{" MiXeD.Case@Example.Org ", "mixed.case@example.org"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeEmail(tt.input); got != tt.expected {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParseDocID(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"Abc123", "Abc123", false},
+		{"  Abc123 ", "Abc123", false},
+		{"https://x.getgrist.com/doc/Abc123", "Abc123", false},
+		{"https://x.getgrist.com/doc/Abc123/p/2", "Abc123", false},
+		{"https://docs.getgrist.com/Abc123/My-Doc/p/2", "Abc123", false},
+		{"https://grist.example.com/o/team/Abc123/My-Doc", "Abc123", false},
+		{"https://grist.example.com/o/team/doc/Abc123/p/4#a1.s8.r2.c3", "Abc123", false},
+		{"https://grist.example.com/api/docs/Abc123/tables", "Abc123", false},
+		{"https://grist.example.com/doc/Abc123~fork1~5", "Abc123~fork1~5", false},
+		{"https://grist.example.com/o/team/ws/12/", "", true},
+		{"https://grist.example.com/", "", true},
+		{"not a doc id", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDocID(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDocID(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ParseDocID(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestIsValidGristIdentifier(t *testing.T) {
+	tests := []struct {
+		id       string
+		expected bool
+	}{
+		{"Table1", true},
+		{"first_name", true},
+		{"A", true},
+		{"x_1_y", true},
+		{"", false},
+		{"1Table", false},
+		{"_hidden", false},
+		{"first name", false},
+		{" Name", false},
+		{"Name-2", false},
+		{"Prénom", false},
+		{"名前", false},
+	}
+	for _, tt := range tests {
+		if got := IsValidGristIdentifier(tt.id); got != tt.expected {
+			t.Errorf("IsValidGristIdentifier(%q) = %v, expected %v", tt.id, got, tt.expected)
+		}
+	}
+}
@@ -536,7 +536,7 @@ func createTestDocumentForValidation(t *testing.T, workspaceID int, name, descri
 		return ""
 	}
 
-	response, status := httpPost(url, string(bodyJSON))
+	response, status, _ := httpPost(url, string(bodyJSON))
 
 	if status != http.StatusOK {
 		t.Errorf("Failed to create document '%s': status %d, response: %s", name, status, response)
@@ -60,7 +60,7 @@ func TestFormulaAndDatatypeValidation(t *testing.T) {
 
 		bodyJSON, _ := json.Marshal(requestBody)
 		url := fmt.Sprintf("docs/%s/tables", formulasDoc)
-		resp, status := httpPost(url, string(bodyJSON))
+		resp, status, _ := httpPost(url, string(bodyJSON))
 		if status != 200 {
 			t.Fatalf("Failed to create formulas table: %d - %s", status, resp)
 		}
@@ -130,7 +130,7 @@ func TestFormulaAndDatatypeValidation(t *testing.T) {
 
 		bodyJSON, _ := json.Marshal(requestBody)
 		url := fmt.Sprintf("docs/%s/tables", datatypesDoc)
-		resp, status := httpPost(url, string(bodyJSON))
+		resp, status, _ := httpPost(url, string(bodyJSON))
 		if status != 200 {
 			t.Fatalf("Failed to create datatypes table: %d - %s", status, resp)
 		}
@@ -6,18 +6,37 @@
 package gristapi
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/rand/v2"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 
+	"github.com/bdmorin/gristle/common"
 	"github.com/joho/godotenv"
 )
 
@@ -35,7 +54,9 @@ type Org struct {
 	Id        int    `json:"id"`
 	Name      string `json:"name"`
 	Domain    string `json:"domain"`
+	Host      string `json:"host"` // Custom domain of the organization, if any
 	CreatedAt string `json:"createdAt"`
+	Access    string `json:"access"` // Caller's role in the organization, when returned by Grist
 }
 
 // Grist's workspace
@@ -44,12 +65,78 @@ type Workspace struct {
 	Name               string `json:"name"`
 	CreatedAt          string `json:"createdAt"`
 	Docs               []Doc  `json:"docs"`
-	IsSupportWorkspace string `json:"isSupportWorkspace"`
+	IsSupportWorkspace bool   `json:"isSupportWorkspace"`
 	OrgDomain          string `json:"orgDomain"`
 	Org                Org    `json:"org"`
 	Access             string `json:"access"`
 }
 
+// UnmarshalJSON decodes a workspace, accepting isSupportWorkspace
+// either as a boolean or as a string ("true"/"false")
+func (w *Workspace) UnmarshalJSON(data []byte) error {
+	type workspaceAlias Workspace
+	aux := struct {
+		*workspaceAlias
+		IsSupportWorkspace interface{} `json:"isSupportWorkspace"`
+	}{workspaceAlias: (*workspaceAlias)(w)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	switch value := aux.IsSupportWorkspace.(type) {
+	case bool:
+		w.IsSupportWorkspace = value
+	case string:
+		w.IsSupportWorkspace, _ = strconv.ParseBool(value)
+	default:
+		w.IsSupportWorkspace = false
+	}
+	return nil
+}
+
+// Role is an access level on an org, workspace or document
+type Role string
+
+// Roles known to Grist, from the strongest to the weakest: "members" and
+// "guests" only appear on orgs, and RoleNone stands for no access (null
+// in Grist's responses)
+const (
+	RoleOwners  Role = "owners"
+	RoleEditors Role = "editors"
+	RoleViewers Role = "viewers"
+	RoleMembers Role = "members"
+	RoleGuests  Role = "guests"
+	RoleNone    Role = ""
+)
+
+var roleRanks = map[Role]int{
+	RoleOwners:  5,
+	RoleEditors: 4,
+	RoleViewers: 3,
+	RoleMembers: 2,
+	RoleGuests:  1,
+}
+
+// RoleAtLeast reports whether have grants at least the access of required,
+// e.g. RoleAtLeast(RoleOwners, RoleEditors) is true. Unknown roles count as
+// RoleNone, and every role is at least RoleNone
+func RoleAtLeast(have Role, required Role) bool {
+	return roleRanks[have] >= roleRanks[required]
+}
+
+// EffectiveRole returns the access a user of an EntityAccess really has:
+// the strongest of its own access and of the access inherited from the
+// parent, the latter capped by the entity's maxInheritedRole
+func EffectiveRole(user User, maxInheritedRole string) Role {
+	inherited := Role(user.ParentAccess)
+	if !RoleAtLeast(Role(maxInheritedRole), inherited) {
+		inherited = Role(maxInheritedRole)
+	}
+	if RoleAtLeast(Role(user.Access), inherited) {
+		return Role(user.Access)
+	}
+	return inherited
+}
+
 type EntityAccess struct {
 	MaxInheritedRole string `json:"maxInheritedRole"`
 	Users            []User `json:"users"`
@@ -63,9 +150,57 @@ type Doc struct {
 	Workspace Workspace `json:"workspace"`
 }
 
+// Grist's document settings, which affect how dates and numbers are parsed
+type DocSettings struct {
+	Timezone string `json:"timezone"` // e.g. "Europe/Paris"
+	Locale   string `json:"locale"`   // e.g. "fr-FR"
+	Currency string `json:"currency"` // e.g. "EUR"; empty means the locale's currency
+}
+
 // Grist's table
 type Table struct {
-	Id string `json:"id"`
+	Id     string      `json:"id"`
+	Title  string      `json:"title,omitempty"` // User-facing name, filled by GetDocTableTitles
+	Fields TableFields `json:"fields"`
+}
+
+// Properties of a Grist's table
+type TableFields struct {
+	PrimaryViewId      int `json:"primaryViewId"`
+	RawViewSectionRef  int `json:"rawViewSectionRef"`
+	SummarySourceTable int `json:"summarySourceTable"`
+}
+
+// Grist's form, a form section backed by a table
+type Form struct {
+	Id        int    `json:"id"` // Id of the form section
+	Title     string `json:"title"`
+	TableId   string `json:"tableId"`
+	Published bool   `json:"published"`
+	ShareUrl  string `json:"shareUrl"` // Empty unless the form is published
+}
+
+// Grist's view, a page of widgets (sections)
+type DocView struct {
+	Id       int      `json:"id"`
+	Name     string   `json:"name"`
+	TableId  string   `json:"tableId"`  // Table the view is based on: the table whose primary view it is, else the table of its first widget
+	TableIds []string `json:"tableIds"` // Tables shown by the view's widgets, without duplicates
+}
+
+// List wraps the items returned by a list function with their count, for
+// callers rendering every list the same way. Items is never nil
+type List[T any] struct {
+	Items []T `json:"items"`
+	Count int `json:"count"`
+}
+
+// NewList wraps items in a List, an empty one when items is nil
+func NewList[T any](items []T) List[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return List[T]{Items: items, Count: len(items)}
 }
 
 // List of Grist's tables
@@ -75,7 +210,17 @@ type Tables struct {
 
 // Grist's table column
 type TableColumn struct {
-	Id string `json:"id"`
+	Id     string       `json:"id"`
+	Fields ColumnFields `json:"fields"`
+}
+
+// Properties of a Grist's table column
+type ColumnFields struct {
+	Label         string `json:"label"`
+	Type          string `json:"type"` // Text, Numeric, Int, Bool, Date, DateTime:<tz>, Ref:<table>, ...
+	IsFormula     bool   `json:"isFormula"`
+	Formula       string `json:"formula"`
+	WidgetOptions string `json:"widgetOptions"` // JSON-encoded display options
 }
 
 // List of Grist's table columns
@@ -88,10 +233,228 @@ type TableRows struct {
 	Id []uint `json:"id"`
 }
 
-// Record represents a single record with its fields
+// Record represents a single record with its fields.
+// A field set to null is present in Fields with a nil value, while a column
+// absent from the response is missing from Fields: use HasField to tell them
+// apart. When writing, a nil field clears the cell, a missing one is left as is
 type Record struct {
 	Id     int                    `json:"id,omitempty"`
 	Fields map[string]interface{} `json:"fields"`
+
+	// Exact JSON of the fields as returned by GetRecords, not sent on writes
+	RawFields json.RawMessage `json:"-"`
+}
+
+// HasField reports whether the record has the field, even if it is null
+func (r Record) HasField(field string) bool {
+	_, found := r.Fields[field]
+	return found
+}
+
+// GetInt returns a numeric field as an int64. Integers beyond 2^53 are only
+// exact when records are fetched with GetRecordsOptions.UseNumber
+func (r Record) GetInt(field string) (int64, bool) {
+	return integerValue(r.Fields[field])
+}
+
+// integerValue converts a decoded JSON number to an int64 if it is integral
+func integerValue(value interface{}) (int64, bool) {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i, true
+		}
+	case float64:
+		if value == float64(int64(value)) {
+			return int64(value), true
+		}
+	}
+	return 0, false
+}
+
+// GetFloat returns a numeric field as a float64
+func (r Record) GetFloat(field string) (float64, bool) {
+	switch value := r.Fields[field].(type) {
+	case json.Number:
+		if f, err := value.Float64(); err == nil {
+			return f, true
+		}
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+// GetString returns a text field
+func (r Record) GetString(field string) (string, bool) {
+	value, ok := r.Fields[field].(string)
+	return value, ok
+}
+
+// GetBool returns a toggle field
+func (r Record) GetBool(field string) (bool, bool) {
+	value, ok := r.Fields[field].(bool)
+	return value, ok
+}
+
+// GetTime returns a Date or DateTime field, which Grist stores as seconds
+// since the epoch, as a UTC time
+func (r Record) GetTime(field string) (time.Time, bool) {
+	seconds, ok := r.GetFloat(field)
+	if !ok {
+		return time.Time{}, false
+	}
+	return gristToTime(seconds), true
+}
+
+// FieldTypeError is returned by the strict getters of Record when a field
+// is missing or doesn't hold the expected type
+type FieldTypeError struct {
+	Field    string
+	Expected string // Type asked for
+	Actual   string // Go type of the value, "null" or "missing"
+}
+
+func (e *FieldTypeError) Error() string {
+	return fmt.Sprintf("field %s: expected %s, got %s", e.Field, e.Expected, e.Actual)
+}
+
+// fieldTypeError describes why a field could not be read as expected
+func (r Record) fieldTypeError(field string, expected string) error {
+	value, found := r.Fields[field]
+	actual := fmt.Sprintf("%T", value)
+	if !found {
+		actual = "missing"
+	} else if value == nil {
+		actual = "null"
+	} else if number, ok := value.(float64); ok && expected == "int" {
+		actual = fmt.Sprintf("non-integral number %v", number)
+	}
+	return &FieldTypeError{Field: field, Expected: expected, Actual: actual}
+}
+
+// GetStringStrict is GetString returning a *FieldTypeError on mismatch
+func (r Record) GetStringStrict(field string) (string, error) {
+	if value, ok := r.GetString(field); ok {
+		return value, nil
+	}
+	return "", r.fieldTypeError(field, "string")
+}
+
+// GetBoolStrict is GetBool returning a *FieldTypeError on mismatch
+func (r Record) GetBoolStrict(field string) (bool, error) {
+	if value, ok := r.GetBool(field); ok {
+		return value, nil
+	}
+	return false, r.fieldTypeError(field, "bool")
+}
+
+// GetIntStrict is GetInt returning a *FieldTypeError on mismatch
+func (r Record) GetIntStrict(field string) (int64, error) {
+	if value, ok := r.GetInt(field); ok {
+		return value, nil
+	}
+	return 0, r.fieldTypeError(field, "int")
+}
+
+// GetFloatStrict is GetFloat returning a *FieldTypeError on mismatch
+func (r Record) GetFloatStrict(field string) (float64, error) {
+	if value, ok := r.GetFloat(field); ok {
+		return value, nil
+	}
+	return 0, r.fieldTypeError(field, "float")
+}
+
+// GetTimeStrict is GetTime returning a *FieldTypeError on mismatch
+func (r Record) GetTimeStrict(field string) (time.Time, error) {
+	if value, ok := r.GetTime(field); ok {
+		return value, nil
+	}
+	return time.Time{}, r.fieldTypeError(field, "time")
+}
+
+// Grist encodes the values of ChoiceList and RefList columns as a list
+// prefixed by the "L" type code: ["L", "red", "blue"] or ["L", 1, 2].
+// An empty list is ["L"], while null leaves the cell empty
+const listTypeCode = "L"
+
+// ChoiceListValue encodes choices as the value of a ChoiceList field
+func ChoiceListValue(items ...string) []interface{} {
+	value := make([]interface{}, 0, len(items)+1)
+	value = append(value, listTypeCode)
+	for _, item := range items {
+		value = append(value, item)
+	}
+	return value
+}
+
+// RefListValue encodes record ids as the value of a RefList field
+func RefListValue(ids ...int) []interface{} {
+	value := make([]interface{}, 0, len(ids)+1)
+	value = append(value, listTypeCode)
+	for _, id := range ids {
+		value = append(value, id)
+	}
+	return value
+}
+
+// listItems returns the items of a value encoded as ["L", ...]
+func listItems(value interface{}) ([]interface{}, bool) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 || list[0] != listTypeCode {
+		return nil, false
+	}
+	return list[1:], true
+}
+
+// ParseChoiceList decodes the value of a ChoiceList field. ok is false if the
+// value is not an encoded list of strings; an empty cell (null) gives no items
+func ParseChoiceList(value interface{}) (items []string, ok bool) {
+	if value == nil {
+		return []string{}, true
+	}
+	list, ok := listItems(value)
+	if !ok {
+		return nil, false
+	}
+	items = make([]string, len(list))
+	for i, item := range list {
+		if items[i], ok = item.(string); !ok {
+			return nil, false
+		}
+	}
+	return items, true
+}
+
+// ParseRefList decodes the value of a RefList field. ok is false if the
+// value is not an encoded list of record ids; an empty cell (null) gives no ids
+func ParseRefList(value interface{}) (ids []int, ok bool) {
+	if value == nil {
+		return []int{}, true
+	}
+	list, ok := listItems(value)
+	if !ok {
+		return nil, false
+	}
+	ids = make([]int, len(list))
+	for i, item := range list {
+		id, ok := integerValue(item)
+		if !ok {
+			return nil, false
+		}
+		ids[i] = int(id)
+	}
+	return ids, true
+}
+
+// decodeJSON decodes a response body, keeping numbers as json.Number
+// instead of float64 when useNumber is set
+func decodeJSON(body string, v interface{}, useNumber bool) error {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	if useNumber {
+		decoder.UseNumber()
+	}
+	return decoder.Decode(v)
 }
 
 // RecordsList represents a list of records returned by GET /records
@@ -129,20 +492,36 @@ type RecordsDeleteRequest []int
 
 // GetRecordsOptions contains query parameters for fetching records
 type GetRecordsOptions struct {
-	Filter map[string][]interface{} // Filter by column values
+	Filter map[string][]interface{} // Filter by column values, ignoring columns without values
 	Sort   string                   // Column(s) to sort by, e.g. "name,-age"
 	Limit  int                      // Maximum records to return
 	Hidden bool                     // Include hidden columns
+
+	// Only fetch records whose UpdatedColumn is after UpdatedSince.
+	// The table must have a modification time column (e.g. a DateTime column
+	// with a trigger formula on update); the query then goes through the SQL endpoint
+	UpdatedSince  time.Time
+	UpdatedColumn string
+
+	// Decode numbers as json.Number rather than float64, so that integers
+	// beyond 2^53 keep their exact value (see Record.GetInt)
+	UseNumber bool
+
+	// Condition richer than Filter (comparisons, text search, Or), ANDed with it.
+	// See FilterExpr for how it is evaluated
+	Where *FilterExpr
 }
 
 // AddRecordsOptions contains query parameters for adding records
 type AddRecordsOptions struct {
 	NoParse bool // Don't parse strings into column types
+	RetryOptions
 }
 
 // UpdateRecordsOptions contains query parameters for updating records
 type UpdateRecordsOptions struct {
 	NoParse bool // Don't parse strings into column types
+	RetryOptions
 }
 
 // UpsertRecordsOptions contains query parameters for upserting records
@@ -152,6 +531,17 @@ type UpsertRecordsOptions struct {
 	NoUpdate          bool   // Don't update existing records
 	AllowEmptyRequire bool   // Allow matching all records with empty require
 	NoParse           bool   // Don't parse strings into column types
+	RetryOptions
+}
+
+// RetryOptions override the retry policy (see SetRetryPolicy) for one call
+type RetryOptions struct {
+	// Retry the call although its method isn't idempotent, when repeating it
+	// is known to be safe, e.g. updates setting absolute values
+	IdempotentRetry bool
+	NoRetry         bool // Never retry the call
+
+	retryable func(status int) bool // Statuses worth retrying, retryableStatus when nil
 }
 
 // Grist's user role
@@ -205,595 +595,5719 @@ type RestoreAttachmentsResponse struct {
 
 // GetAttachmentsOptions contains query parameters for listing attachments
 type GetAttachmentsOptions struct {
-	Filter map[string][]interface{} // Filter by column values
+	Filter map[string][]interface{} // Filter by column values, ignoring columns without values
 	Sort   string                   // Column to sort by
 	Limit  int                      // Maximum attachments to return
 }
 
-// Apply config and return the config file path
-func GetConfig() string {
+// ErrNotConfigured is returned when GRIST_URL or GRIST_TOKEN is not set
+var ErrNotConfigured = errors.New("grist is not configured: run `gristle config`, or set GRIST_URL and GRIST_TOKEN")
+
+// Apply config and return the config file path. The file is only read when
+// GRIST_URL or GRIST_TOKEN is not set in the environment. The error, an
+// ErrNotConfigured, tells that either is still missing
+func GetConfig() (string, error) {
 	home := os.Getenv("HOME")
 	configFile := filepath.Join(home, ".gristle")
-	if os.Getenv("GRIST_TOKEN") == "" || os.Getenv("GRIST_URL") == "" {
-		err := godotenv.Load(configFile)
-		if err != nil {
-			fmt.Printf("Error reading configuration file : %s\n", err)
+	if CheckConfig() == nil {
+		return configFile, nil
+	}
+	// Unlike godotenv.Load, variables set but empty are filled too
+	values, loadErr := godotenv.Read(configFile)
+	for name, value := range values {
+		if strings.TrimSpace(os.Getenv(name)) == "" {
+			os.Setenv(name, value)
+		}
+	}
+	if err := CheckConfig(); err != nil {
+		if loadErr != nil {
+			return configFile, fmt.Errorf("%w (reading %s: %v)", err, configFile, loadErr)
+		}
+		return configFile, err
+	}
+	return configFile, nil
+}
+
+// CheckConfig returns ErrNotConfigured, naming the missing variables, when
+// GRIST_URL or GRIST_TOKEN is not set. Requests are not sent in that case
+func CheckConfig() error {
+	missing := []string{}
+	for _, name := range []string{"GRIST_URL", "GRIST_TOKEN"} {
+		if strings.TrimSpace(os.Getenv(name)) == "" {
+			missing = append(missing, name)
 		}
 	}
-	return configFile
+	if len(missing) > 0 {
+		return fmt.Errorf("%w (%s not set)", ErrNotConfigured, strings.Join(missing, " and "))
+	}
+	return nil
 }
 
 func init() {
 	GetConfig()
 }
 
-// Sending an HTTP request to Grist's REST API
-// Action: GET, POST, PATCH, DELETE
-// Returns response body
-func httpRequest(action string, myRequest string, data *bytes.Buffer) (string, int) {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s/api/%s", os.Getenv("GRIST_URL"), myRequest)
-	bearer := "Bearer " + os.Getenv("GRIST_TOKEN")
+// gristBaseURL returns the configured GRIST_URL without trailing slash nor
+// "/api" suffix, which the requests add themselves: both "https://host" and
+// "https://host/api/" are accepted
+func gristBaseURL() string {
+	base := strings.TrimRight(strings.TrimSpace(os.Getenv("GRIST_URL")), "/")
+	return strings.TrimRight(strings.TrimSuffix(base, "/api"), "/")
+}
 
-	req, err := http.NewRequest(action, url, data)
-	if err != nil {
-		log.Fatalf("Error creating request %s: %s", url, err)
-	}
-	req.Header.Add("Authorization", bearer)
-	req.Header.Set("Content-Type", "application/json")
+var (
+	orgMutex   sync.RWMutex
+	orgContext string
+)
 
-	// Send the HTTP request
-	resp, err := client.Do(req)
-	if err != nil {
-		errMsg := fmt.Sprintf("Error sending request %s: %s", url, err)
-		return errMsg, -10
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Error closing response body: %v", err)
-		}
-	}()
-	// Read the HTTP response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response %s: %s", url, err)
-	}
-	return string(body), resp.StatusCode
+// SetOrg scopes the following requests to an organization, given by its
+// domain (e.g. "docs" for the personal org), by prefixing them with
+// /o/{domain} as Grist's web client does when orgs are not served on
+// subdomains; "" removes the scope.
+// Endpoints resolving an org from the request honor it: orgs/current/... and
+// the session endpoints. Endpoints addressing an entity by id ignore it,
+// except that Grist rejects documents and workspaces outside that org, which
+// disambiguates calls when a token spans several orgs
+func SetOrg(domain string) {
+	orgMutex.Lock()
+	defer orgMutex.Unlock()
+	orgContext = strings.Trim(strings.TrimSpace(domain), "/")
 }
 
-// Send an HTTP GET request to Grist's REST API
-// Returns the response body
-func httpGet(myRequest string, data string) (string, int) {
-	dataBody := bytes.NewBuffer([]byte(data))
-	body, status := httpRequest("GET", myRequest, dataBody)
-	// if status != http.StatusOK {
-	// 	fmt.Printf("Return code from %s : %d (%s)\n", myRequest, status, body)
-	// }
-	return body, status
+// apiURL returns the full URL of an API endpoint, scoped to the org set
+// with SetOrg if any
+func apiURL(endpoint string) string {
+	orgMutex.RLock()
+	org := orgContext
+	orgMutex.RUnlock()
+	return orgURL(gristBaseURL(), org, endpoint)
 }
 
-// Test Grist API connection
-func TestConnection() bool {
-	_, status := httpGet("orgs", "")
-	return status == http.StatusOK
+// orgURL returns the full URL of an API endpoint of the server at base,
+// scoped to the org domain unless it is ""
+func orgURL(base string, org string, endpoint string) string {
+	if org == "" {
+		return fmt.Sprintf("%s/api/%s", base, endpoint)
+	}
+	return fmt.Sprintf("%s/o/%s/api/%s", base, url.PathEscape(org), endpoint)
 }
 
-// Sends an HTTP POST request to Grist's REST API with a data load
-// Return the response body
-func httpPost(myRequest string, data string) (string, int) {
-	dataBody := bytes.NewBuffer([]byte(data))
-	body, status := httpRequest("POST", myRequest, dataBody)
-	return body, status
+// ConnectionOptions tunes the pool of connections kept open to Grist, and
+// the timeouts of requests.
+// Timeout limits a whole request, from sending it to reading the end of its
+// response, except for downloads (document exports), whose body may take
+// much longer to stream: they are only limited by ResponseHeaderTimeout,
+// which applies to every request, and the dial and TLS handshake timeouts
+// of Go's default transport (30s and 10s). Timeout is set as a deadline on
+// the request's context, so a context with an earlier deadline still ends the
+// request first: the shorter of the two wins. Requests running out of time
+// fail with ErrTimeout
+type ConnectionOptions struct {
+	MaxIdleConns          int           // Idle connections kept open, across all hosts
+	MaxIdleConnsPerHost   int           // Idle connections kept open to the Grist host
+	IdleConnTimeout       time.Duration // Time after which an idle connection is closed
+	Timeout               time.Duration // Limit on a whole request, downloads excepted; 0 for none
+	ResponseHeaderTimeout time.Duration // Limit on the wait for the response headers, downloads included; 0 for none
 }
 
-// Sends an HTTP PATCH request to Grist's REST API with a data load
-// Return the response body
-func httpPatch(myRequest string, data string) (string, int) {
-	dataBody := bytes.NewBuffer([]byte(data))
-	body, status := httpRequest("PATCH", myRequest, dataBody)
-	return body, status
+// DefaultConnectionOptions suit a single Grist host: Go's default of 2 idle
+// connections per host makes concurrent callers (e.g. GetDocsAccess) open and
+// close a connection, with its TLS handshake, for most requests.
+// Their timeouts keep a hung server from blocking callers forever, while
+// leaving large exports the time to download
+var DefaultConnectionOptions = ConnectionOptions{
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   16,
+	IdleConnTimeout:       90 * time.Second,
+	Timeout:               30 * time.Second,
+	ResponseHeaderTimeout: 2 * time.Minute,
 }
 
-// Send an HTTP DELETE request to Grist's REST API with a data load
-// Return the response body
-func httpDelete(myRequest string, data string) (string, int) {
-	dataBody := bytes.NewBuffer([]byte(data))
-	body, status := httpRequest("DELETE", myRequest, dataBody)
-	return body, status
+var (
+	clientMutex sync.RWMutex
+	httpClient  = NewHTTPClient(DefaultConnectionOptions)
+)
+
+// NewHTTPClient returns an HTTP client pooling connections with the given
+// options, for a Client needing its own pool. Like the shared client, it
+// drops the API key on redirects to another host
+func NewHTTPClient(options ConnectionOptions) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = options.MaxIdleConns
+	transport.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = options.IdleConnTimeout
+	transport.ResponseHeaderTimeout = options.ResponseHeaderTimeout
+	return &http.Client{
+		Transport:     &timeoutTransport{base: transport, timeout: options.Timeout},
+		CheckRedirect: checkRedirect,
+	}
 }
 
-// Send an HTTP PUT request to Grist's REST API with a data load
-// Return the response body
-func httpPut(myRequest string, data string) (string, int) {
-	dataBody := bytes.NewBuffer([]byte(data))
-	body, status := httpRequest("PUT", myRequest, dataBody)
-	return body, status
+// timeoutTransport sets a deadline on each request, kept until its response
+// body is closed, except for the requests of downloads.
+// Unlike http.Client.Timeout, it lets downloads stream for as long as needed
+type timeoutTransport struct {
+	base    *http.Transport
+	timeout time.Duration
 }
 
-// Retrieves the list of organizations
-func GetOrgs() []Org {
-	myOrgs := []Org{}
-	response, _ := httpGet("orgs", "")
-	json.Unmarshal([]byte(response), &myOrgs)
-	return myOrgs
+// noTimeoutKey marks the context of requests exempt from the timeout
+type noTimeoutKey struct{}
+
+// withoutTimeout exempts a request from the timeout of timeoutTransport
+func withoutTimeout(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), noTimeoutKey{}, true))
 }
 
-// Retrieves the organization whose identifier is passed in parameter
-func GetOrg(idOrg string) Org {
-	myOrg := Org{}
-	response, _ := httpGet("orgs/"+idOrg, "")
-	json.Unmarshal([]byte(response), &myOrg)
-	return myOrg
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 || req.Context().Value(noTimeoutKey{}) != nil {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
 }
 
-// Retrieves the list of users in the organization whose ID is passed in parameter
-func GetOrgAccess(idOrg string) []User {
-	var lstUsers EntityAccess
-	url := fmt.Sprintf("orgs/%s/access", idOrg)
-	response, _ := httpGet(url, "")
-	json.Unmarshal([]byte(response), &lstUsers)
-	return lstUsers.Users
+// CloseIdleConnections lets http.Client.CloseIdleConnections reach the pool
+func (t *timeoutTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
 }
 
-// Retrieves information on a specific organization
-func GetOrgWorkspaces(orgId int) []Workspace {
-	lstWorkspaces := []Workspace{}
-	response, _ := httpGet("orgs/"+strconv.Itoa(orgId)+"/workspaces", "")
-	json.Unmarshal([]byte(response), &lstWorkspaces)
-	return lstWorkspaces
+// cancelOnClose releases the deadline of a request once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
 }
 
-// Get a workspace
-func GetWorkspace(workspaceId int) Workspace {
-	workspace := Workspace{}
-	url := fmt.Sprintf("workspaces/%d", workspaceId)
-	response, returnCode := httpGet(url, "")
-	if returnCode == http.StatusOK {
-		json.Unmarshal([]byte(response), &workspace)
-	}
-	return workspace
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
 
-// Delete an organization
-func DeleteOrg(orgId int, orgName string) {
-	url := fmt.Sprintf("orgs/%d/%s", orgId, orgName)
-	response, status := httpDelete(url, "")
-	if status == http.StatusOK {
-		fmt.Printf("Organization %d : %s deleted\t✅\n", orgId, orgName)
+// Maximum number of redirects followed by a request
+const maxRedirects = 10
+
+// checkRedirect keeps the API key on redirects within the Grist host only.
+// Downloads may be redirected (303) to an external storage, whose signed URL
+// carries its own credentials: the key must not leak there
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	initial := via[0]
+	if req.URL.Host == initial.URL.Host && req.URL.Scheme == initial.URL.Scheme {
+		if auth := initial.Header.Get("Authorization"); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
 	} else {
-		fmt.Printf("Unable to delete organization %d : %s : %s ❗️\n", orgId, orgName, response)
+		req.Header.Del("Authorization")
 	}
+	return nil
 }
 
-// Delete a workspace
-func DeleteWorkspace(workspaceId int) {
-	url := fmt.Sprintf("workspaces/%d", workspaceId)
-	response, status := httpDelete(url, "")
-	if status == http.StatusOK {
-		fmt.Printf("Workspace %d deleted\t✅\n", workspaceId)
-	} else {
-		fmt.Printf("Unable to delete workspace %d : %s ❗️\n", workspaceId, response)
+// SetConnectionOptions replaces the HTTP client shared by all requests with
+// one using the given pool settings, closing the idle connections of the
+// previous one. Raise MaxIdleConnsPerHost to the number of concurrent
+// requests when sending many in parallel, as BenchmarkConcurrentRequests shows
+func SetConnectionOptions(options ConnectionOptions) {
+	clientMutex.Lock()
+	previous := httpClient
+	httpClient = NewHTTPClient(options)
+	clientMutex.Unlock()
+	previous.CloseIdleConnections()
+}
+
+// sharedClient returns the HTTP client shared by all requests, so that
+// connections to Grist are reused
+func sharedClient() *http.Client {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+	return httpClient
+}
+
+// Client sends requests to a Grist server with its own URL and API key,
+// independently of the GRIST_URL and GRIST_TOKEN environment variables, so
+// that several servers or accounts can be used at once.
+// Its methods mirror the package-level functions reading organizations,
+// documents, tables and records, adding, updating and deleting records, and
+// exporting documents; DoRaw reaches any other endpoint. The other
+// package-level functions (workspaces, access, webhooks, SCIM, dumps,
+// archives...) only use the default client, which reads the environment
+// variables and honors SetOrg, SetRetryPolicy, SetCircuitBreaker and
+// SetRetryBudget.
+// Each client has its own org, retry policy, circuit breaker and retry
+// budget, so that a failing server doesn't suspend the requests to another.
+// The Observer (SetObserver), SetExplain, SetMaxResponseBytes and the pool
+// of connections (SetConnectionOptions, used when HTTPClient is nil) are
+// shared by all clients
+type Client struct {
+	BaseURL    string       // URL of the Grist server, with or without the "/api" suffix
+	Token      string       // API key
+	Org        string       // Domain of the organization scoping the requests, see SetOrg; "" for none
+	HTTPClient *http.Client // HTTP client used, e.g. from NewHTTPClient; nil for the pool shared by all clients
+
+	// Retries of GET, HEAD, PUT and DELETE requests failing with HTTP 429,
+	// 502, 503 or 504, and the delay before the first one (see SetRetryPolicy)
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+
+	breaker circuitBreaker // See SetCircuitBreaker
+	retries retryBudget    // See SetRetryBudget
+
+	env bool // Whether the URL, API key and org come from the package settings
+}
+
+// NewClient returns a client for the Grist server at baseURL using the API key token
+func NewClient(baseURL string, token string) *Client {
+	return &Client{BaseURL: baseURL, Token: token}
+}
+
+// defaultClient is used by the package-level functions
+var defaultClient = &Client{env: true}
+
+// baseURL returns the server URL without trailing slash nor "/api" suffix
+func (c *Client) baseURL() string {
+	if c.env {
+		return gristBaseURL()
 	}
+	base := strings.TrimRight(strings.TrimSpace(c.BaseURL), "/")
+	return strings.TrimRight(strings.TrimSuffix(base, "/api"), "/")
 }
 
-// Delete a document
-func DeleteDoc(docId string) {
-	url := fmt.Sprintf("docs/%s", docId)
-	response, status := httpDelete(url, "")
-	if status == http.StatusOK {
-		fmt.Printf("Document %s deleted\t✅\n", docId)
-	} else {
-		fmt.Printf("Unable to delete document %s : %s ❗️", docId, response)
+func (c *Client) token() string {
+	if c.env {
+		return os.Getenv("GRIST_TOKEN")
 	}
+	return c.Token
 }
 
-// Delete a user
-func DeleteUser(userId int) {
-	url := fmt.Sprintf("users/%d", userId)
-	response, status := httpDelete(url, `{"name": ""}`)
+// url returns the full URL of an API endpoint
+func (c *Client) url(endpoint string) string {
+	if c.env {
+		return apiURL(endpoint)
+	}
+	return orgURL(c.baseURL(), strings.Trim(strings.TrimSpace(c.Org), "/"), endpoint)
+}
 
-	var message string
-	switch status {
-	case 200:
-		message = "The account has been deleted successfully"
-	case 400:
-		message = "The passed user name does not match the one retrieved from the database given the passed user id"
-	case 403:
-		message = "The caller is not allowed to delete this account"
-	case 404:
-		message = "The user is not found"
+// checkConfig returns ErrNotConfigured if the URL or API key is missing
+func (c *Client) checkConfig() error {
+	if c.env {
+		return CheckConfig()
 	}
-	fmt.Println(message)
-	if status != http.StatusOK {
-		fmt.Printf("ERREUR: %s\n", response)
+	missing := []string{}
+	if strings.TrimSpace(c.BaseURL) == "" {
+		missing = append(missing, "BaseURL")
+	}
+	if strings.TrimSpace(c.Token) == "" {
+		missing = append(missing, "Token")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w (%s not set)", ErrNotConfigured, strings.Join(missing, " and "))
 	}
+	return nil
 }
 
-// Workspace access rights query
-func GetWorkspaceAccess(workspaceId int) EntityAccess {
-	workspaceAccess := EntityAccess{}
-	url := fmt.Sprintf("workspaces/%d/access", workspaceId)
-	response, _ := httpGet(url, "")
-	json.Unmarshal([]byte(response), &workspaceAccess)
-	return workspaceAccess
+// send authenticates and sends a request
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if err := c.checkConfig(); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token())
+	client := c.HTTPClient
+	if client == nil {
+		client = sharedClient()
+	}
+	return c.sendRequest(client, req)
 }
 
-// Retrieves information about a specific document
-func GetDoc(docId string) Doc {
-	doc := Doc{}
-	url := "docs/" + docId
-	response, _ := httpGet(url, "")
-	json.Unmarshal([]byte(response), &doc)
-	return doc
+// RequestInfo describes a request sent to Grist, as reported to the Observer
+type RequestInfo struct {
+	Method        string
+	Path          string // Path relative to /api, with its query string
+	Status        int    // HTTP status, or -10 if the request could not be sent
+	BytesSent     int    // Size of the request body
+	BytesReceived int    // Size of the response body
+	Duration      time.Duration
 }
 
-// Retrieves the list of tables contained in a document
-func GetDocTables(docId string) Tables {
-	tables := Tables{}
-	url := "docs/" + docId + "/tables"
-	response, _ := httpGet(url, "")
-	json.Unmarshal([]byte(response), &tables)
+// Observer is called after each request sent to Grist
+type Observer func(RequestInfo)
 
-	return tables
-}
+// DefaultPayloadWarningBytes is the request body size above which a warning
+// is logged: bodies this large are likely to hit the server's limits
+const DefaultPayloadWarningBytes = 1 << 20
 
-// Retrieves a list of table columns
-func GetTableColumns(docId string, tableId string) TableColumns {
-	columns := TableColumns{}
-	url := "docs/" + docId + "/tables/" + tableId + "/columns"
-	response, _ := httpGet(url, "")
-	json.Unmarshal([]byte(response), &columns)
+var (
+	observerMutex       sync.RWMutex
+	observer            Observer
+	payloadWarningBytes = DefaultPayloadWarningBytes
+)
 
-	return columns
+// SetObserver registers a function called after each request with its
+// method, path, status, duration and payload sizes; nil removes it.
+// Useful to collect metrics or to right-size the batched helpers
+func SetObserver(o Observer) {
+	observerMutex.Lock()
+	defer observerMutex.Unlock()
+	observer = o
 }
 
-// Retrieves records from a table
-func GetTableRows(docId string, tableId string) TableRows {
-	rows := TableRows{}
-	url := "docs/" + docId + "/tables/" + tableId + "/data"
-	response, _ := httpGet(url, "")
-	json.Unmarshal([]byte(response), &rows)
+// SetPayloadWarningThreshold sets the request body size above which a
+// warning is logged; 0 disables the warning
+func SetPayloadWarningThreshold(bytes int) {
+	observerMutex.Lock()
+	defer observerMutex.Unlock()
+	payloadWarningBytes = bytes
+}
 
-	return rows
+// observeRequest warns about oversized requests and reports them to the Observer
+func observeRequest(info RequestInfo) {
+	observerMutex.RLock()
+	o, threshold := observer, payloadWarningBytes
+	observerMutex.RUnlock()
+	if threshold > 0 && info.BytesSent > threshold {
+		log.Printf("Warning: %s %s sent %d bytes, more than %d: consider smaller batches", info.Method, info.Path, info.BytesSent, threshold)
+	}
+	if o != nil {
+		o(info)
+	}
 }
 
-// Returns the list of users with access to the document
-func GetDocAccess(docId string) EntityAccess {
-	var lstUsers EntityAccess
-	url := fmt.Sprintf("docs/%s/access", docId)
-	response, _ := httpGet(url, "")
-	json.Unmarshal([]byte(response), &lstUsers)
-	return lstUsers
+// DefaultMaxResponseBytes is the largest response body read by default
+const DefaultMaxResponseBytes int64 = 256 << 20
+
+// ErrResponseTooLarge matches the errors of requests whose response body
+// exceeds the limit set with SetMaxResponseBytes
+var ErrResponseTooLarge = errors.New("response body too large")
+
+var maxResponseBytes atomic.Int64
+
+func init() {
+	maxResponseBytes.Store(DefaultMaxResponseBytes)
 }
 
-// Move all documents from a workspace to another
-func MoveAllDocs(fromWorkspaceId int, toWorkspaceId int) {
-	// Getting the workspaces
-	from_ws := GetWorkspace(fromWorkspaceId)
-	to_ws := GetWorkspace(toWorkspaceId)
-	if from_ws.Id == 0 {
-		fmt.Printf("❗️ Workspace %d not found ❗️\n", fromWorkspaceId)
-	} else if to_ws.Id == 0 {
-		fmt.Printf("❗️ Workspace %d not found ❗️\n", toWorkspaceId)
+// SetMaxResponseBytes sets the largest response body read from Grist, to
+// protect the process from pathological responses; n <= 0 removes the limit.
+// Larger responses fail with status -10 and an error matching
+// ErrResponseTooLarge. Downloads and exports (endpoints under /download) are
+// not limited, since their size is that of the documents
+func SetMaxResponseBytes(n int64) {
+	maxResponseBytes.Store(n)
+}
+
+// readResponseBody reads a response body, enforcing the response size limit
+// except for downloads. tooLarge is set if the body exceeds the limit
+func readResponseBody(endpoint string, body io.Reader) (content []byte, tooLarge bool, err error) {
+	limit := maxResponseBytes.Load()
+	if limit <= 0 || strings.Contains(endpoint, "/download") {
+		content, err = io.ReadAll(body)
+		return content, false, err
+	}
+	content, err = io.ReadAll(io.LimitReader(body, limit+1))
+	if int64(len(content)) > limit {
+		return nil, true, err
+	}
+	return content, false, err
+}
+
+// ErrCircuitOpen is returned without contacting Grist while the circuit
+// breaker set with SetCircuitBreaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open: Grist is failing, requests suspended")
+
+// circuitBreaker suspends requests after consecutive failures
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int // Consecutive failures opening the circuit, 0 to disable
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool // A request is testing whether Grist has recovered
+}
+
+// SetCircuitBreaker makes requests fail fast with ErrCircuitOpen (status -10)
+// for cooldown after threshold consecutive failures (transport errors or
+// HTTP 5xx), so that a failing Grist isn't hammered. After the cooldown, one
+// request is let through: its success closes the circuit, its failure opens
+// it for another cooldown. threshold <= 0 disables the breaker (the default).
+// A Client has its own breaker
+func SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	defaultClient.SetCircuitBreaker(threshold, cooldown)
+}
+
+// SetCircuitBreaker sets the circuit breaker of the client's requests, see SetCircuitBreaker
+func (c *Client) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	c.breaker.set(threshold, cooldown)
+}
+
+// set configures and closes the breaker
+func (b *circuitBreaker) set(threshold int, cooldown time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.threshold, b.cooldown = threshold, cooldown
+	b.failures, b.openUntil, b.probing = 0, time.Time{}, false
+}
+
+// allow tells whether a request may be sent
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record updates the breaker with the outcome of a request
+func (b *circuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// Tokens of the retry budget, as in gRPC's retry throttling
+const retryBudgetTokens = 10.0
+
+// retryBudget caps the retries of all the requests of a client together,
+// so that retries don't amplify an outage: each failed request takes a
+// token, each successful one gives back ratio tokens, and retries are only
+// allowed while more than half of the tokens are left
+type retryBudget struct {
+	mutex  sync.Mutex
+	ratio  float64 // 0 when the budget is disabled
+	tokens float64
+}
+
+// SetRetryBudget shares a retry budget between the requests of the
+// package-level functions, in the manner of gRPC's retry throttling: a
+// failed request (transport error, HTTP 429 or 5xx) costs one token out of
+// 10, a successful one gives back ratio tokens (e.g. 0.1), and requests are
+// only retried while more than 5 tokens are left. Whatever the per-request
+// retry limits, retries thus stop when failures outnumber successes by more
+// than ratio. The budget is accounted on every request but only limits the
+// retry logic itself, which checks it before each retry. ratio <= 0 removes
+// the budget (the default). A Client has its own budget
+func SetRetryBudget(ratio float64) {
+	defaultClient.SetRetryBudget(ratio)
+}
+
+// SetRetryBudget sets the retry budget of the client's requests, see SetRetryBudget
+func (c *Client) SetRetryBudget(ratio float64) {
+	c.retries.set(ratio)
+}
+
+// set configures and refills the budget
+func (b *retryBudget) set(ratio float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.ratio = math.Max(ratio, 0)
+	b.tokens = retryBudgetTokens
+}
+
+// record updates the budget with the outcome of a request
+func (b *retryBudget) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.ratio == 0 {
+		return
+	}
+	if success {
+		b.tokens = math.Min(b.tokens+b.ratio, retryBudgetTokens)
 	} else {
-		// Workspaces were found
-		for _, doc := range from_ws.Docs {
-			url := "docs/" + doc.Id + "/move"
-			data := fmt.Sprintf(`{"workspace": "%d"}`, toWorkspaceId)
-			_, status := httpPatch(url, data)
-			if status == http.StatusOK {
-				fmt.Printf("Document %s moved to workspace %d ✅\n", doc.Id, toWorkspaceId)
-			} else {
-				fmt.Printf("Unable to move document %s", doc.Id)
+		b.tokens = math.Max(b.tokens-1, 0)
+	}
+}
+
+// allowRetry tells whether a failed request may be retried
+func (b *retryBudget) allowRetry() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.ratio == 0 || b.tokens > retryBudgetTokens/2
+}
+
+var (
+	explainMutex  sync.Mutex
+	explainWriter io.Writer
+)
+
+// SetExplain writes the equivalent curl command of each request to w, to
+// reproduce calls outside of the tool; nil stops it. The API key is written
+// as $GRIST_TOKEN, and bodies other than JSON are left out
+func SetExplain(w io.Writer) {
+	explainMutex.Lock()
+	defer explainMutex.Unlock()
+	explainWriter = w
+}
+
+// shellQuote quotes a string for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// curlCommand returns the curl command sending the same request as req
+func curlCommand(req *http.Request) string {
+	parts := []string{"curl", "-X", req.Method, shellQuote(req.URL.String())}
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "Authorization" {
+			parts = append(parts, "-H", `"Authorization: Bearer $GRIST_TOKEN"`)
+			continue
+		}
+		for _, value := range req.Header[name] {
+			parts = append(parts, "-H", shellQuote(name+": "+value))
+		}
+	}
+	command := strings.Join(parts, " ")
+	if req.GetBody == nil || req.ContentLength == 0 {
+		return command
+	}
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		return fmt.Sprintf("%s --data-binary @body  # %s body of %d bytes not shown", command, req.Header.Get("Content-Type"), req.ContentLength)
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return command
+	}
+	content, _ := io.ReadAll(body)
+	return command + " --data-raw " + shellQuote(string(content))
+}
+
+// ErrTimeout is returned when Grist doesn't answer a request within the
+// timeouts of the HTTP client (see ConnectionOptions)
+var ErrTimeout = errors.New("request timed out")
+
+// timeoutError wraps the error of a request that ran out of time in ErrTimeout
+func timeoutError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// sendRequest sends a request through the client's circuit breaker
+func (c *Client) sendRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	explainMutex.Lock()
+	if explainWriter != nil {
+		fmt.Fprintln(explainWriter, curlCommand(req))
+	}
+	explainMutex.Unlock()
+	if !c.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := client.Do(req)
+	err = timeoutError(err)
+	c.breaker.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+	c.retries.record(err == nil && resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests)
+	return resp, err
+}
+
+// RequestError is returned when a request got no usable response from
+// Grist: it couldn't be created or sent, or its response couldn't be read.
+// The functions returning an HTTP status give -1 (not created) or -10 for it
+type RequestError struct {
+	Method string
+	Path   string // Endpoint, relative to /api
+	Err    error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Method, e.Path, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultRetryBaseDelay is the delay before the first retry of a request
+// when the retry policy doesn't set one
+const DefaultRetryBaseDelay = 500 * time.Millisecond
+
+// idempotentMethods are retried by the retry policy: repeating them has the
+// same effect as sending them once, unlike POST (e.g. adding records) or PATCH
+var idempotentMethods = map[string]bool{"GET": true, "HEAD": true, "PUT": true, "DELETE": true}
+
+// retryableStatus tells whether a request failing with status is worth
+// retrying: rate limiting (429) and a server or proxy temporarily unable to
+// answer (502, 503, 504)
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoffDelay returns the delay before a retry (0 for the first one): base
+// doubled on each retry, of which a random half is skipped so that clients
+// failing together don't retry together
+func backoffDelay(base time.Duration, retry int) time.Duration {
+	delay := base << min(retry, 16)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+var (
+	retryPolicyMutex sync.RWMutex
+	defaultRetries   int
+	defaultBaseDelay time.Duration
+)
+
+// SetRetryPolicy makes the package-level functions retry requests failing
+// with HTTP 429, 502, 503 or 504 up to maxRetries times, waiting baseDelay
+// (DefaultRetryBaseDelay when 0) before the first retry and twice as long
+// before each next one, with jitter, or as long as the Retry-After header of
+// the response asks (up to 2 minutes; longer, the request fails). Only GET, HEAD, PUT and DELETE requests
+// are retried: a POST (e.g. adding records) may have been applied despite
+// the error. The records functions taking RetryOptions can opt a call in or
+// out. Retries also stop when the retry budget is exhausted (see
+// SetRetryBudget). maxRetries <= 0 disables retries (the default).
+// A Client has its own MaxRetries and RetryBaseDelay
+func SetRetryPolicy(maxRetries int, baseDelay time.Duration) {
+	retryPolicyMutex.Lock()
+	defer retryPolicyMutex.Unlock()
+	defaultRetries, defaultBaseDelay = max(maxRetries, 0), baseDelay
+}
+
+// retryPolicy returns the maximum retries of a request and the delay before the first one
+func (c *Client) retryPolicy() (int, time.Duration) {
+	maxRetries, baseDelay := c.MaxRetries, c.RetryBaseDelay
+	if c.env {
+		retryPolicyMutex.RLock()
+		maxRetries, baseDelay = defaultRetries, defaultBaseDelay
+		retryPolicyMutex.RUnlock()
+	}
+	if baseDelay <= 0 {
+		baseDelay = DefaultRetryBaseDelay
+	}
+	return maxRetries, baseDelay
+}
+
+// Sending an HTTP request to Grist's REST API
+// Action: GET, POST, PATCH, DELETE
+// Returns response body and status. When no usable response is received,
+// the error is a *RequestError, the body describes it and the status is -1
+// (request not created) or -10. Transient failures are retried according to
+// the retry policy (see SetRetryPolicy)
+func httpRequest(action string, myRequest string, data *bytes.Buffer) (string, int, error) {
+	return defaultClient.request(action, myRequest, data)
+}
+
+// request sends an HTTP request to the API of the client's server, see httpRequest
+func (c *Client) request(action string, myRequest string, data *bytes.Buffer) (string, int, error) {
+	var payload []byte
+	if data != nil {
+		payload = data.Bytes()
+	}
+	return c.requestWith(action, myRequest, payload, RetryOptions{})
+}
+
+// requestWith sends a request, with the retry policy overridden by retry
+func (c *Client) requestWith(action string, myRequest string, payload []byte, retry RetryOptions) (string, int, error) {
+	maxRetries, baseDelay := c.retryPolicy()
+	if retry.NoRetry || (!idempotentMethods[action] && !retry.IdempotentRetry) {
+		maxRetries = 0
+	}
+	retryable := retryableStatus
+	if retry.retryable != nil {
+		retryable = retry.retryable
+	}
+	for retry := 0; ; retry++ {
+		response, status, header, err := c.requestOnce(action, myRequest, payload)
+		if !retryable(status) || retry >= maxRetries || !c.retries.allowRetry() {
+			return response, status, err
+		}
+		delay := backoffDelay(baseDelay, retry)
+		if wait, ok := retryAfter(header, time.Now()); ok {
+			if wait > maxRetryAfter {
+				return response, status, err
+			}
+			delay = max(delay, wait)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// Longest Retry-After honored: a request asked to wait longer fails at once
+var maxRetryAfter = 2 * time.Minute
+
+// retryAfter returns the delay asked by the Retry-After header of a
+// response, given in seconds or as an HTTP date
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// requestOnce sends a request without retrying it, also returning the
+// response headers
+func (c *Client) requestOnce(action string, myRequest string, payload []byte) (string, int, http.Header, error) {
+	url := c.url(myRequest)
+	info := RequestInfo{Method: action, Path: myRequest, BytesSent: len(payload)}
+	start := time.Now()
+	defer func() {
+		info.Duration = time.Since(start)
+		observeRequest(info)
+	}()
+
+	req, err := http.NewRequest(action, url, bytes.NewReader(payload))
+	if err != nil {
+		info.Status = -1
+		return fmt.Sprintf("Error creating request %s: %s", url, err), -1, nil, &RequestError{action, myRequest, err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Send the HTTP request
+	resp, err := c.send(req)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error sending request %s: %s", url, err)
+		info.Status = -10
+		return errMsg, -10, nil, &RequestError{action, myRequest, err}
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+	// Read the HTTP response body
+	body, tooLarge, err := readResponseBody(myRequest, resp.Body)
+	if tooLarge {
+		info.Status = -10
+		err = fmt.Errorf("%w: %s exceeds %d bytes (see SetMaxResponseBytes)", ErrResponseTooLarge, url, maxResponseBytes.Load())
+		return err.Error(), -10, resp.Header, &RequestError{action, myRequest, err}
+	}
+	info.Status, info.BytesReceived = resp.StatusCode, len(body)
+	if err != nil {
+		return string(body), resp.StatusCode, resp.Header, &RequestError{action, myRequest, fmt.Errorf("reading response: %w", timeoutError(err))}
+	}
+	return string(body), resp.StatusCode, resp.Header, nil
+}
+
+// APIError is returned when Grist answers a request with a non-success status
+type APIError struct {
+	Status  int    // HTTP status code returned by Grist
+	Message string // Response body sent by Grist
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("grist API error (HTTP %d)", e.Status)
+	}
+	if e.dataLimitExceeded() {
+		return fmt.Sprintf("grist API error (HTTP %d): %s (%s)", e.Status, e.Message, ErrDataLimitExceeded)
+	}
+	return fmt.Sprintf("grist API error (HTTP %d): %s", e.Status, e.Message)
+}
+
+// ErrUnauthorized matches the errors of requests rejected with HTTP 401,
+// usually because the API key is invalid or has expired. The legacy getters
+// returning only a value (GetOrgs, GetDocTables...) hide it behind an empty
+// result: their OK and WithError variants (GetDocOK, GetOrgsWithError...)
+// return it
+var ErrUnauthorized = errors.New("unauthorized: invalid or expired API key")
+
+// ErrDataLimitExceeded matches the errors of writes rejected because the
+// document exceeds its plan's data limits: Grist then only allows deletions
+// (see DataLimitStatus in GetOrgUsageSummary)
+var ErrDataLimitExceeded = errors.New("document over its data limits: delete rows or attachments, or upgrade the plan, to make it writable again")
+
+// dataLimitMessages are the fragments of Grist's messages rejecting writes
+// to a document over its data limits
+var dataLimitMessages = []string{"delete-only", "data limit", "limits exceeded"}
+
+// dataLimitExceeded reports whether the error is a write rejected because
+// of data limits
+func (e *APIError) dataLimitExceeded() bool {
+	if e.Status != http.StatusForbidden && e.Status != http.StatusRequestEntityTooLarge {
+		return false
+	}
+	message := strings.ToLower(e.Message)
+	for _, fragment := range dataLimitMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is makes errors.Is(err, ErrUnauthorized) true for HTTP 401 errors and
+// errors.Is(err, ErrDataLimitExceeded) true for writes rejected by data limits
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized
+	case ErrDataLimitExceeded:
+		return e.dataLimitExceeded()
+	}
+	return false
+}
+
+// IsUnauthorized reports whether err comes from a request rejected with
+// HTTP 401, so that the user can be asked to configure a new API key
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+// errorStatus returns the HTTP status of an *APIError, -1 for other errors
+func errorStatus(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return -1
+}
+
+// checkResponse returns the error of a request: err when no usable response
+// was received, else the *APIError of a non-success status
+func checkResponse(status int, body string, err error) error {
+	if err != nil {
+		return err
+	}
+	return checkStatus(status, body)
+}
+
+// checkStatus returns an *APIError when the status is not a 2xx code.
+// The message is the "error" field of a JSON body, or the body itself
+func checkStatus(status int, body string) error {
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	message := strings.TrimSpace(body)
+	gristError := struct {
+		Error string `json:"error"`
+	}{}
+	if json.Unmarshal([]byte(message), &gristError) == nil && gristError.Error != "" {
+		message = gristError.Error
+	}
+	return &APIError{Status: status, Message: message}
+}
+
+// Send an HTTP GET request to Grist's REST API
+// Returns the response body
+func httpGet(myRequest string, data string) (string, int, error) {
+	dataBody := bytes.NewBuffer([]byte(data))
+	return httpRequest("GET", myRequest, dataBody)
+}
+
+// Test Grist API connection. GetOrgsWithError tells why it fails
+func TestConnection() bool {
+	_, status, _ := httpGet("orgs", "")
+	return status == http.StatusOK
+}
+
+// Sends an HTTP POST request to Grist's REST API with a data load
+// Return the response body
+func httpPost(myRequest string, data string) (string, int, error) {
+	dataBody := bytes.NewBuffer([]byte(data))
+	return httpRequest("POST", myRequest, dataBody)
+}
+
+// httpGet sends a GET request with the client, see httpGet
+func (c *Client) httpGet(myRequest string, data string) (string, int, error) {
+	return c.request("GET", myRequest, bytes.NewBufferString(data))
+}
+
+// httpPost sends a POST request with the client, see httpPost
+func (c *Client) httpPost(myRequest string, data string) (string, int, error) {
+	return c.request("POST", myRequest, bytes.NewBufferString(data))
+}
+
+// Sends an HTTP PATCH request to Grist's REST API with a data load
+// Return the response body
+func httpPatch(myRequest string, data string) (string, int, error) {
+	dataBody := bytes.NewBuffer([]byte(data))
+	return httpRequest("PATCH", myRequest, dataBody)
+}
+
+// Send an HTTP DELETE request to Grist's REST API with a data load
+// Return the response body
+func httpDelete(myRequest string, data string) (string, int, error) {
+	dataBody := bytes.NewBuffer([]byte(data))
+	return httpRequest("DELETE", myRequest, dataBody)
+}
+
+// Send an HTTP PUT request to Grist's REST API with a data load
+// Return the response body
+func httpPut(myRequest string, data string) (string, int, error) {
+	dataBody := bytes.NewBuffer([]byte(data))
+	return httpRequest("PUT", myRequest, dataBody)
+}
+
+// Retrieves the list of organizations
+func GetOrgs() []Org {
+	return defaultClient.GetOrgs()
+}
+
+// GetOrgs retrieves the organizations of the client's server
+func (c *Client) GetOrgs() []Org {
+	myOrgs, _ := c.GetOrgsWithError()
+	return myOrgs
+}
+
+// GetOrgsWithError retrieves the list of organizations, also returning the
+// request error, e.g. one matching ErrUnauthorized for an invalid API key
+func GetOrgsWithError() ([]Org, error) {
+	return defaultClient.GetOrgsWithError()
+}
+
+// GetOrgsWithError retrieves the organizations of the client's server, see GetOrgsWithError
+func (c *Client) GetOrgsWithError() ([]Org, error) {
+	myOrgs := []Org{}
+	response, status, err := c.httpGet("orgs", "")
+	json.Unmarshal([]byte(response), &myOrgs)
+	if myOrgs == nil {
+		myOrgs = []Org{}
+	}
+	return myOrgs, checkResponse(status, response, err)
+}
+
+// OrgRole is an organization with the caller's role in it
+type OrgRole struct {
+	Org
+	Role Role
+}
+
+// GetOrgsWithRole returns the organizations of the caller with the caller's
+// role in each. Grist returns the role with the organizations; when it is
+// missing, it is looked up in the organization's access list by the caller's
+// email
+// GET /orgs
+func GetOrgsWithRole() ([]OrgRole, error) {
+	response, status, err := httpGet("orgs", "")
+	if err := checkResponse(status, response, err); err != nil {
+		return nil, err
+	}
+	orgs := []Org{}
+	if err := json.Unmarshal([]byte(response), &orgs); err != nil {
+		return nil, fmt.Errorf("invalid organizations: %w", err)
+	}
+	myEmail := ""
+	result := make([]OrgRole, 0, len(orgs))
+	for _, org := range orgs {
+		role := Role(org.Access)
+		if role == RoleNone {
+			if myEmail == "" {
+				email, err := currentUserEmail()
+				if err != nil {
+					return nil, err
+				}
+				myEmail = email
+			}
+			var err error
+			if role, err = orgRoleOf(org.Id, myEmail); err != nil {
+				return nil, err
 			}
 		}
+		result = append(result, OrgRole{Org: org, Role: role})
+	}
+	return result, nil
+}
+
+// currentUserEmail returns the normalized email of the caller
+// GET /profile/user
+func currentUserEmail() (string, error) {
+	response, status, err := httpGet("profile/user", "")
+	if err := checkResponse(status, response, err); err != nil {
+		return "", err
+	}
+	profile := User{}
+	if err := json.Unmarshal([]byte(response), &profile); err != nil || profile.Email == "" {
+		return "", fmt.Errorf("invalid user profile: %s", response)
+	}
+	return common.NormalizeEmail(profile.Email), nil
+}
+
+// orgRoleOf returns the role of the user with the given normalized email in an organization
+// GET /orgs/{orgId}/access
+func orgRoleOf(orgId int, email string) (Role, error) {
+	response, status, err := httpGet(fmt.Sprintf("orgs/%d/access", orgId), "")
+	if err := checkResponse(status, response, err); err != nil {
+		return RoleNone, err
+	}
+	access := EntityAccess{}
+	json.Unmarshal([]byte(response), &access)
+	for _, user := range access.Users {
+		if common.NormalizeEmail(user.Email) == email {
+			return Role(user.Access), nil
+		}
+	}
+	return RoleNone, nil
+}
+
+// Retrieves the organization whose identifier is passed in parameter
+func GetOrg(idOrg string) Org {
+	return defaultClient.GetOrg(idOrg)
+}
+
+// GetOrg retrieves an organization from the client's server
+func (c *Client) GetOrg(idOrg string) Org {
+	myOrg, _, _ := c.GetOrgOK(idOrg)
+	return myOrg
+}
+
+// GetOrgOK retrieves an organization, telling whether it was found.
+// A missing organization is not an error; other failures are
+func GetOrgOK(idOrg string) (Org, bool, error) {
+	return defaultClient.GetOrgOK(idOrg)
+}
+
+// GetOrgOK retrieves an organization, telling whether it was found, see GetOrgOK
+func (c *Client) GetOrgOK(idOrg string) (Org, bool, error) {
+	myOrg := Org{}
+	found, err := c.getEntity("orgs/"+idOrg, &myOrg)
+	if !found {
+		myOrg = Org{}
+	}
+	return myOrg, found, err
+}
+
+// getEntity fetches an entity into v: HTTP 404 gives found=false without
+// error, other failures an error
+func (c *Client) getEntity(path string, v interface{}) (found bool, err error) {
+	response, status, err := c.httpGet(path, "")
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	if err := checkResponse(status, response, err); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(response), v); err != nil {
+		return false, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// Retrieves the list of users in the organization whose ID is passed in parameter
+func GetOrgAccess(idOrg string) []User {
+	users, _ := GetOrgAccessWithError(idOrg)
+	return users
+}
+
+// GetOrgAccessWithError retrieves the users of an organization, also
+// returning the request error
+func GetOrgAccessWithError(idOrg string) ([]User, error) {
+	var lstUsers EntityAccess
+	url := fmt.Sprintf("orgs/%s/access", idOrg)
+	response, status, err := httpGet(url, "")
+	json.Unmarshal([]byte(response), &lstUsers)
+	if lstUsers.Users == nil {
+		lstUsers.Users = []User{}
+	}
+	return lstUsers.Users, checkResponse(status, response, err)
+}
+
+// Retrieves information on a specific organization
+func GetOrgWorkspaces(orgId int) []Workspace {
+	return GetOrgWorkspacesWithOptions(orgId, nil)
+}
+
+// GetOrgWorkspacesWithError retrieves the workspaces of an organization,
+// also returning the request error
+func GetOrgWorkspacesWithError(orgId int) ([]Workspace, error) {
+	workspaces, _, err := getOrgWorkspaces(orgId)
+	return workspaces, err
+}
+
+// GetWorkspacesOptions contains filters applied when listing workspaces
+type GetWorkspacesOptions struct {
+	ExcludeSupport bool // Skip the support/examples workspace
+	MinRole        Role // Skip workspaces where the caller's access is weaker
+}
+
+// Retrieves the workspaces of an organization, filtered by options
+func GetOrgWorkspacesWithOptions(orgId int, options *GetWorkspacesOptions) []Workspace {
+	lstWorkspaces, _, _ := getOrgWorkspaces(orgId)
+
+	if options == nil {
+		return lstWorkspaces
+	}
+	filtered := []Workspace{}
+	for _, ws := range lstWorkspaces {
+		if options.ExcludeSupport && ws.IsSupportWorkspace {
+			continue
+		}
+		if !RoleAtLeast(Role(ws.Access), options.MinRole) {
+			continue
+		}
+		filtered = append(filtered, ws)
+	}
+	return filtered
+}
+
+// GetWritableWorkspaces retrieves the workspaces of an organization where
+// the caller can create documents (editor or owner access)
+func GetWritableWorkspaces(orgId int) []Workspace {
+	return GetOrgWorkspacesWithOptions(orgId, &GetWorkspacesOptions{MinRole: RoleEditors})
+}
+
+// getOrgWorkspaces retrieves the workspaces of an organization, the HTTP
+// status and the request error
+func getOrgWorkspaces(orgId int) ([]Workspace, int, error) {
+	lstWorkspaces := []Workspace{}
+	response, status, err := httpGet("orgs/"+strconv.Itoa(orgId)+"/workspaces", "")
+	json.Unmarshal([]byte(response), &lstWorkspaces)
+	if lstWorkspaces == nil {
+		lstWorkspaces = []Workspace{}
+	}
+	return lstWorkspaces, status, checkResponse(status, response, err)
+}
+
+// ListPinnedDocs returns the pinned documents of all the workspaces of an
+// organization, each with a reference to its workspace (without its docs)
+func ListPinnedDocs(orgId int) ([]Doc, int) {
+	pinned := []Doc{}
+	workspaces, status, _ := getOrgWorkspaces(orgId)
+	if status != http.StatusOK {
+		return pinned, status
+	}
+	for _, workspace := range workspaces {
+		reference := workspace
+		reference.Docs = nil
+		for _, doc := range workspace.Docs {
+			if doc.IsPinned {
+				doc.Workspace = reference
+				pinned = append(pinned, doc)
+			}
+		}
+	}
+	return pinned, status
+}
+
+// Get a workspace
+func GetWorkspace(workspaceId int) Workspace {
+	workspace, _, _ := GetWorkspaceOK(workspaceId)
+	return workspace
+}
+
+// GetWorkspaceOK retrieves a workspace, telling whether it was found.
+// A missing workspace is not an error; other failures are
+func GetWorkspaceOK(workspaceId int) (Workspace, bool, error) {
+	workspace := Workspace{}
+	found, err := defaultClient.getEntity(fmt.Sprintf("workspaces/%d", workspaceId), &workspace)
+	if !found {
+		workspace = Workspace{}
+	}
+	return workspace, found, err
+}
+
+// Delete an organization, returning the request error
+func DeleteOrg(orgId int, orgName string) error {
+	url := fmt.Sprintf("orgs/%d/%s", orgId, orgName)
+	response, status, err := httpDelete(url, "")
+	if status == http.StatusOK {
+		fmt.Printf("Organization %d : %s deleted\t%s\n", orgId, orgName, common.StatusMarker(true))
+	} else {
+		fmt.Printf("Unable to delete organization %d : %s : %s %s\n", orgId, orgName, response, common.StatusMarker(false))
+	}
+	return checkResponse(status, response, err)
+}
+
+// Delete a workspace, returning the request error
+func DeleteWorkspace(workspaceId int) error {
+	url := fmt.Sprintf("workspaces/%d", workspaceId)
+	response, status, err := httpDelete(url, "")
+	if status == http.StatusOK {
+		fmt.Printf("Workspace %d deleted\t%s\n", workspaceId, common.StatusMarker(true))
+	} else {
+		fmt.Printf("Unable to delete workspace %d : %s %s\n", workspaceId, response, common.StatusMarker(false))
+	}
+	return checkResponse(status, response, err)
+}
+
+// Delete a document, returning the request error
+func DeleteDoc(docId string) error {
+	url := fmt.Sprintf("docs/%s", docId)
+	response, status, err := httpDelete(url, "")
+	if status == http.StatusOK {
+		fmt.Printf("Document %s deleted\t%s\n", docId, common.StatusMarker(true))
+	} else {
+		fmt.Printf("Unable to delete document %s : %s %s", docId, response, common.StatusMarker(false))
+	}
+	return checkResponse(status, response, err)
+}
+
+// Delete a user, returning the request error
+func DeleteUser(userId int) error {
+	url := fmt.Sprintf("users/%d", userId)
+	response, status, err := httpDelete(url, `{"name": ""}`)
+
+	var message string
+	switch status {
+	case 200:
+		message = "The account has been deleted successfully"
+	case 400:
+		message = "The passed user name does not match the one retrieved from the database given the passed user id"
+	case 403:
+		message = "The caller is not allowed to delete this account"
+	case 404:
+		message = "The user is not found"
+	}
+	fmt.Println(message)
+	if status != http.StatusOK {
+		fmt.Printf("ERREUR: %s\n", response)
+	}
+	return checkResponse(status, response, err)
+}
+
+// FindUserIDByEmail returns the id of the user with the given email, for the
+// functions taking a user id (DeleteUser, DisableUser...). The email is
+// normalized first. Users are searched with SCIM, which requires install
+// admin rights; when SCIM is unavailable (HTTP 401, 403, 404 or 501), the
+// access lists of the caller's orgs are searched instead, which only finds
+// users sharing an org with the caller
+func FindUserIDByEmail(email string) (int, bool, error) {
+	email = common.NormalizeEmail(email)
+	filter := url.QueryEscape(fmt.Sprintf("userName eq %q", email))
+	response, status, err := httpGet("scim/v2/Users?filter="+filter, "")
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusNotImplemented:
+		return findUserIDInOrgs(email)
+	}
+	if err := checkResponse(status, response, err); err != nil {
+		return 0, false, err
+	}
+	result := struct {
+		Resources []struct {
+			Id       string `json:"id"`
+			UserName string `json:"userName"`
+		} `json:"Resources"`
+	}{}
+	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		return 0, false, fmt.Errorf("invalid SCIM response: %w", err)
+	}
+	for _, user := range result.Resources {
+		if common.NormalizeEmail(user.UserName) != email {
+			continue
+		}
+		id, err := strconv.Atoi(user.Id)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid SCIM user id %q", user.Id)
+		}
+		return id, true, nil
+	}
+	return 0, false, nil
+}
+
+// findUserIDInOrgs searches a user in the access lists of the caller's orgs
+func findUserIDInOrgs(email string) (int, bool, error) {
+	response, status, err := httpGet("orgs", "")
+	if err := checkResponse(status, response, err); err != nil {
+		return 0, false, err
+	}
+	orgs := []Org{}
+	if err := json.Unmarshal([]byte(response), &orgs); err != nil {
+		return 0, false, fmt.Errorf("invalid orgs response: %w", err)
+	}
+	for _, org := range orgs {
+		response, status, err := httpGet(fmt.Sprintf("orgs/%d/access", org.Id), "")
+		if status == http.StatusForbidden {
+			// Only owners can read an org's access list
+			continue
+		}
+		if err := checkResponse(status, response, err); err != nil {
+			return 0, false, err
+		}
+		access := EntityAccess{}
+		if err := json.Unmarshal([]byte(response), &access); err != nil {
+			continue
+		}
+		for _, user := range access.Users {
+			if common.NormalizeEmail(user.Email) == email {
+				return user.Id, true, nil
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+// GetMyApiKey returns the API key of the authenticated user, "" if none
+// GET /profile/apikey
+func GetMyApiKey() (string, int) {
+	key, status, _ := GetMyApiKeyWithError()
+	return key, status
+}
+
+// GetMyApiKeyWithError returns the API key of the authenticated user, see
+// GetMyApiKey, also returning the request error
+func GetMyApiKeyWithError() (string, int, error) {
+	response, status, err := httpGet("profile/apikey", "")
+	if status != http.StatusOK {
+		return "", status, checkResponse(status, response, err)
+	}
+	return strings.TrimSpace(response), status, nil
+}
+
+// RegenerateMyApiKey replaces the API key of the authenticated user and
+// returns the new one.
+// Warning: the current key, usually the one used by this process, stops
+// working immediately. Store the new key (GRIST_TOKEN) before any other call
+// POST /profile/apikey
+func RegenerateMyApiKey() (string, int) {
+	key, status, _ := RegenerateMyApiKeyWithError()
+	return key, status
+}
+
+// RegenerateMyApiKeyWithError replaces the API key of the authenticated
+// user, see RegenerateMyApiKey, also returning the request error
+func RegenerateMyApiKeyWithError() (string, int, error) {
+	response, status, err := httpPost("profile/apikey", `{"force": true}`)
+	if status != http.StatusOK {
+		return "", status, checkResponse(status, response, err)
+	}
+	return strings.TrimSpace(response), status, nil
+}
+
+// DeleteMyApiKey deletes the API key of the authenticated user.
+// Warning: if it is the key used by this process, the following calls fail
+// with HTTP 401
+// DELETE /profile/apikey
+func DeleteMyApiKey() (int, error) {
+	response, status, err := httpDelete("profile/apikey", "")
+	return status, checkResponse(status, response, err)
+}
+
+// DisableUser disables a user account, which can then no longer log in
+// nor use its API key. Requires install admin rights
+// POST /users/{userId}/disable
+func DisableUser(userId int) (int, error) {
+	return setUserEnabled(userId, false)
+}
+
+// EnableUser enables a user account disabled with DisableUser
+// POST /users/{userId}/enable
+func EnableUser(userId int) (int, error) {
+	return setUserEnabled(userId, true)
+}
+
+func setUserEnabled(userId int, enabled bool) (int, error) {
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+	response, status, err := httpPost(fmt.Sprintf("users/%d/%s", userId, action), "")
+	return status, checkResponse(status, response, err)
+}
+
+// UserOpResult reports the outcome of the operation on one user in a batch
+type UserOpResult struct {
+	Id     int   // Id of the user
+	Status int   // HTTP status returned by Grist
+	Err    error // nil when the operation succeeded
+}
+
+// DisableUsers disables several user accounts, continuing past individual
+// failures. Returns one result per user id, and an error joining every
+// failure (nil when all accounts were disabled)
+func DisableUsers(userIds []int) ([]UserOpResult, error) {
+	return setUsersEnabled(userIds, false)
+}
+
+// EnableUsers enables several user accounts, continuing past individual
+// failures. Returns one result per user id, and an error joining every
+// failure (nil when all accounts were enabled)
+func EnableUsers(userIds []int) ([]UserOpResult, error) {
+	return setUsersEnabled(userIds, true)
+}
+
+func setUsersEnabled(userIds []int, enabled bool) ([]UserOpResult, error) {
+	results := make([]UserOpResult, 0, len(userIds))
+	var errs []error
+	for _, userId := range userIds {
+		status, err := setUserEnabled(userId, enabled)
+		if err != nil {
+			err = fmt.Errorf("user %d: %w", userId, err)
+			errs = append(errs, err)
+		}
+		results = append(results, UserOpResult{Id: userId, Status: status, Err: err})
+	}
+	return results, errors.Join(errs...)
+}
+
+// Workspace access rights query
+func GetWorkspaceAccess(workspaceId int) EntityAccess {
+	workspaceAccess, _ := GetWorkspaceAccessWithError(workspaceId)
+	return workspaceAccess
+}
+
+// GetWorkspaceAccessWithError retrieves the access rights of a workspace,
+// also returning the request error
+func GetWorkspaceAccessWithError(workspaceId int) (EntityAccess, error) {
+	workspaceAccess := EntityAccess{}
+	url := fmt.Sprintf("workspaces/%d/access", workspaceId)
+	response, status, err := httpGet(url, "")
+	json.Unmarshal([]byte(response), &workspaceAccess)
+	if workspaceAccess.Users == nil {
+		workspaceAccess.Users = []User{}
+	}
+	return workspaceAccess, checkResponse(status, response, err)
+}
+
+// Retrieves information about a specific document
+func GetDoc(docId string) Doc {
+	return defaultClient.GetDoc(docId)
+}
+
+// GetDoc retrieves a document from the client's server
+func (c *Client) GetDoc(docId string) Doc {
+	doc, _, _ := c.GetDocOK(docId)
+	return doc
+}
+
+// GetDocOK retrieves a document, telling whether it was found.
+// A missing document is not an error; other failures are
+func GetDocOK(docId string) (Doc, bool, error) {
+	return defaultClient.GetDocOK(docId)
+}
+
+// GetDocOK retrieves a document, telling whether it was found, see GetDocOK
+func (c *Client) GetDocOK(docId string) (Doc, bool, error) {
+	doc := Doc{}
+	found, err := c.getEntity("docs/"+docId, &doc)
+	if !found {
+		doc = Doc{}
+	}
+	return doc, found, err
+}
+
+// DocExists reports whether a document exists: a 2xx status means it exists,
+// 404 that it does not. Any other status is returned as an error
+func DocExists(docId string) (bool, error) {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return false, err
+	}
+	response, status, err := httpGet("docs/"+docId, "")
+	if err == nil && status == http.StatusNotFound {
+		return false, nil
+	}
+	if err := checkResponse(status, response, err); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// OrgWebURL returns the browser URL of an organization: its custom domain
+// if it has one, with the scheme of GRIST_URL, the /o/{domain} path of the
+// Grist home otherwise
+func OrgWebURL(org Org) string {
+	if org.Host != "" {
+		scheme := "https"
+		if base, err := url.Parse(gristBaseURL()); err == nil && base.Scheme != "" {
+			scheme = base.Scheme
+		}
+		return scheme + "://" + org.Host
+	}
+	if org.Domain == "" {
+		return gristBaseURL()
+	}
+	return fmt.Sprintf("%s/o/%s", gristBaseURL(), org.Domain)
+}
+
+// WorkspaceWebURL returns the browser URL of a workspace of an organization
+func WorkspaceWebURL(org Org, workspaceId int) string {
+	return fmt.Sprintf("%s/ws/%d/", OrgWebURL(org), workspaceId)
+}
+
+// DocWebURL returns the browser URL of a document, within its organization.
+// The organization is read from the document; if it cannot be retrieved,
+// the URL is relative to the Grist home, which redirects to the right organization
+func DocWebURL(docId string) string {
+	doc := GetDoc(docId)
+	return docWebURL(doc.Workspace.Org, docId)
+}
+
+func docWebURL(org Org, docId string) string {
+	return fmt.Sprintf("%s/doc/%s", OrgWebURL(org), docId)
+}
+
+// Retrieves the list of tables contained in a document
+func GetDocTables(docId string) Tables {
+	return defaultClient.GetDocTables(docId)
+}
+
+// GetDocTables retrieves the tables of a document
+func (c *Client) GetDocTables(docId string) Tables {
+	tables, _ := c.getDocTables(docId)
+	return tables
+}
+
+// GetDocTablesWithError retrieves the tables of a document, also returning
+// the request error
+func GetDocTablesWithError(docId string) (Tables, error) {
+	return defaultClient.getDocTables(docId)
+}
+
+// GetDocTablesWithError retrieves the tables of a document, see GetDocTablesWithError
+func (c *Client) GetDocTablesWithError(docId string) (Tables, error) {
+	return c.getDocTables(docId)
+}
+
+// getDocTables returns the tables of a document and the request error
+func (c *Client) getDocTables(docId string) (Tables, error) {
+	tables := Tables{}
+	url := "docs/" + docId + "/tables"
+	response, status, err := c.httpGet(url, "")
+	json.Unmarshal([]byte(response), &tables)
+	if tables.Tables == nil {
+		tables.Tables = []Table{}
+	}
+
+	return tables, checkResponse(status, response, err)
+}
+
+// GetDocTableTitles retrieves the tables of a document with their Title
+// filled from the document metadata, which takes two more requests than
+// GetDocTablesWithError
+func GetDocTableTitles(docId string) (Tables, error) {
+	return defaultClient.GetDocTableTitles(docId)
+}
+
+// GetDocTableTitles retrieves the tables of a document with their titles, see GetDocTableTitles
+func (c *Client) GetDocTableTitles(docId string) (Tables, error) {
+	tables, err := c.getDocTables(docId)
+	if err != nil {
+		return tables, err
+	}
+	return tables, c.setTableTitles(docId, tables.Tables)
+}
+
+// setTableTitles fills the titles of tables from the document metadata:
+// the title of the table's raw data section, else the name of its primary
+// page, else the table id. Metadata that cannot be read is skipped, and its
+// error returned
+func (c *Client) setTableTitles(docId string, tables []Table) error {
+	if len(tables) == 0 {
+		return nil
+	}
+	sectionTitles, err := c.metadataNames(docId, "_grist_Views_section", "title")
+	if err != nil {
+		sectionTitles = map[int]string{}
+	}
+	viewNames, viewErr := c.metadataNames(docId, "_grist_Views", "name")
+	if viewErr != nil {
+		viewNames = map[int]string{}
+	}
+
+	for i, table := range tables {
+		switch {
+		case sectionTitles[table.Fields.RawViewSectionRef] != "":
+			tables[i].Title = sectionTitles[table.Fields.RawViewSectionRef]
+		case viewNames[table.Fields.PrimaryViewId] != "":
+			tables[i].Title = viewNames[table.Fields.PrimaryViewId]
+		default:
+			tables[i].Title = table.Id
+		}
+	}
+	return errors.Join(err, viewErr)
+}
+
+// metadataNames returns a text column of a metadata table by row id. Only
+// that column is selected, through the SQL endpoint, or through the records
+// API when SQL is forbidden
+func (c *Client) metadataNames(docId string, tableId string, column string) (map[int]string, error) {
+	query := fmt.Sprintf("SELECT id, %s FROM %s", quoteIdentifier(column), quoteIdentifier(tableId))
+	records, status, err := c.querySQL(docId, query, nil, false)
+	if status == http.StatusForbidden || status == http.StatusNotFound {
+		records, _, err = c.getRecords(docId, tableId, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", tableId, err)
+	}
+	names := make(map[int]string, len(records.Records))
+	for _, record := range records.Records {
+		names[record.Id], _ = record.Fields[column].(string)
+	}
+	return names, nil
+}
+
+// Retrieves a list of table columns
+func GetTableColumns(docId string, tableId string) TableColumns {
+	return defaultClient.GetTableColumns(docId, tableId)
+}
+
+// GetTableColumns retrieves the columns of a table
+func (c *Client) GetTableColumns(docId string, tableId string) TableColumns {
+	columns, _, _ := c.getTableColumns(docId, tableId)
+	return columns
+}
+
+// GetTableColumnsWithError retrieves the columns of a table, also returning
+// the request error
+func GetTableColumnsWithError(docId string, tableId string) (TableColumns, error) {
+	return defaultClient.GetTableColumnsWithError(docId, tableId)
+}
+
+// GetTableColumnsWithError retrieves the columns of a table, see GetTableColumnsWithError
+func (c *Client) GetTableColumnsWithError(docId string, tableId string) (TableColumns, error) {
+	columns, _, err := c.getTableColumns(docId, tableId)
+	return columns, err
+}
+
+// Retrieves a list of table columns, the HTTP status and the request error
+func (c *Client) getTableColumns(docId string, tableId string) (TableColumns, int, error) {
+	columns := TableColumns{}
+	url := "docs/" + docId + "/tables/" + tableId + "/columns"
+	response, status, err := c.httpGet(url, "")
+	if status == http.StatusOK {
+		json.Unmarshal([]byte(response), &columns)
+	}
+	if columns.Columns == nil {
+		columns.Columns = []TableColumn{}
+	}
+
+	return columns, status, checkResponse(status, response, err)
+}
+
+// TypedField is a record field with the type of its column
+type TypedField struct {
+	Value interface{}
+	Type  string // Column type: Text, Numeric, Int, Bool, Date, DateTime:<tz>, Ref:<table>, ...
+}
+
+// BaseType returns the column type without its parameter: "Ref" for
+// "Ref:People", "DateTime" for "DateTime:Europe/Paris"
+func (f TypedField) BaseType() string {
+	base, _, _ := strings.Cut(f.Type, ":")
+	return base
+}
+
+// TypedRecord is a record whose fields carry their column type
+type TypedRecord struct {
+	Id     int
+	Fields map[string]TypedField
+}
+
+// TypedTable holds the columns and the typed records of a table
+type TypedTable struct {
+	Columns []TableColumn
+	Records []TypedRecord
+}
+
+// FetchTableTyped fetches the records of a table with the type of each
+// field. Grist's records endpoint doesn't return types, so they come from
+// a single fetch of the table's columns. Fields without a column (such as
+// hidden helper columns) have the type "Any"
+func FetchTableTyped(docId string, tableId string) (TypedTable, error) {
+	table := TypedTable{Columns: []TableColumn{}, Records: []TypedRecord{}}
+	if err := validateDocTable(docId, tableId); err != nil {
+		return table, err
+	}
+	columns, _, err := defaultClient.getTableColumns(docId, tableId)
+	if err != nil {
+		return table, err
+	}
+	records, _, err := defaultClient.getRecords(docId, tableId, nil)
+	if err != nil {
+		return table, err
+	}
+
+	table.Columns = columns.Columns
+	types := make(map[string]string, len(columns.Columns))
+	for _, column := range columns.Columns {
+		types[column.Id] = column.Fields.Type
+	}
+	for _, record := range records.Records {
+		typed := TypedRecord{Id: record.Id, Fields: make(map[string]TypedField, len(record.Fields))}
+		for colId, value := range record.Fields {
+			colType, found := types[colId]
+			if !found {
+				colType = "Any"
+			}
+			typed.Fields[colId] = TypedField{Value: value, Type: colType}
+		}
+		table.Records = append(table.Records, typed)
+	}
+	return table, nil
+}
+
+// ReorderColumns sets the order of a table's columns, given as the full
+// list of its column ids. Returns an error without changing anything if
+// order has unknown, duplicated or missing columns
+// PATCH /docs/{docId}/tables/{tableId}/columns (parentPos)
+func ReorderColumns(docId string, tableId string, order []string) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return -1, err
+	}
+	columns, status, err := defaultClient.getTableColumns(docId, tableId)
+	if err != nil {
+		return status, err
+	}
+	existing := make(map[string]bool, len(columns.Columns))
+	for _, column := range columns.Columns {
+		existing[column.Id] = true
+	}
+	seen := make(map[string]bool, len(order))
+	for _, colId := range order {
+		if !existing[colId] {
+			return -1, fmt.Errorf("unknown column %q in table %s", colId, tableId)
+		}
+		if seen[colId] {
+			return -1, fmt.Errorf("column %q is listed more than once", colId)
+		}
+		seen[colId] = true
+	}
+	if len(order) != len(existing) {
+		missing := []string{}
+		for _, column := range columns.Columns {
+			if !seen[column.Id] {
+				missing = append(missing, column.Id)
+			}
+		}
+		return -1, fmt.Errorf("missing columns in order: %s", strings.Join(missing, ", "))
+	}
+
+	updates := make([]map[string]interface{}, len(order))
+	for i, colId := range order {
+		updates[i] = map[string]interface{}{
+			"id":     colId,
+			"fields": map[string]interface{}{"parentPos": i + 1},
+		}
+	}
+	bodyJSON, err := json.Marshal(map[string]interface{}{"columns": updates})
+	if err != nil {
+		return -1, err
+	}
+	url := fmt.Sprintf("docs/%s/tables/%s/columns", docId, tableId)
+	response, status, err := httpPatch(url, string(bodyJSON))
+	return status, checkResponse(status, response, err)
+}
+
+// SetColumnOptions replaces the widget options of a column: its display
+// settings such as number or date format, alignment or choices and their
+// colors, e.g. {"numMode": "currency", "decimals": 2}
+// PATCH /docs/{docId}/tables/{tableId}/columns
+func SetColumnOptions(docId string, tableId string, colId string, options map[string]interface{}) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return -1, err
+	}
+	if err := validatePathSegment("colId", colId); err != nil {
+		return -1, err
+	}
+	// Grist stores the options as a JSON string
+	widgetOptions, err := json.Marshal(options)
+	if err != nil {
+		return -1, fmt.Errorf("invalid column options: %w", err)
+	}
+	column := map[string]interface{}{
+		"id":     colId,
+		"fields": map[string]interface{}{"widgetOptions": string(widgetOptions)},
+	}
+	bodyJSON, err := json.Marshal(map[string]interface{}{"columns": []interface{}{column}})
+	if err != nil {
+		return -1, err
+	}
+	url := fmt.Sprintf("docs/%s/tables/%s/columns", docId, tableId)
+	response, status, err := httpPatch(url, string(bodyJSON))
+	return status, checkResponse(status, response, err)
+}
+
+// columnPayload converts a column to the body expected by Grist, leaving
+// out the empty properties so that Grist applies its defaults
+func columnPayload(column TableColumn) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if column.Fields.Label != "" {
+		fields["label"] = column.Fields.Label
+	}
+	if column.Fields.Type != "" {
+		fields["type"] = column.Fields.Type
+	}
+	if column.Fields.IsFormula {
+		fields["isFormula"] = true
+		fields["formula"] = column.Fields.Formula
+	}
+	if column.Fields.WidgetOptions != "" {
+		fields["widgetOptions"] = column.Fields.WidgetOptions
+	}
+	return map[string]interface{}{"id": column.Id, "fields": fields}
+}
+
+// ErrDuplicateColumns is returned when columns to create share an id or a label
+var ErrDuplicateColumns = errors.New("duplicate columns")
+
+// ErrInvalidIdentifier is returned when a table or column id to create is not
+// a valid Grist identifier (see common.IsValidGristIdentifier)
+var ErrInvalidIdentifier = errors.New("invalid identifier")
+
+// validateIdentifier checks a table or column id to create
+func validateIdentifier(kind string, id string) error {
+	if !common.IsValidGristIdentifier(id) {
+		return fmt.Errorf("%w: %s id %q must start with a letter, followed by letters, digits or underscores", ErrInvalidIdentifier, kind, id)
+	}
+	return nil
+}
+
+// validateColumns checks that columns to create have valid ids and don't
+// share an id (compared case-insensitively, like SQLite and Grist do) or a
+// label. Empty ids and labels are left to Grist, which generates them
+func validateColumns(columns []TableColumn) error {
+	ids := map[string]int{}
+	labels := map[string]int{}
+	duplicates := []string{}
+	for _, column := range columns {
+		if column.Id != "" {
+			if err := validateIdentifier("column", column.Id); err != nil {
+				return err
+			}
+			id := strings.ToLower(column.Id)
+			ids[id]++
+			if ids[id] == 2 {
+				duplicates = append(duplicates, fmt.Sprintf("id %q", column.Id))
+			}
+		}
+		if column.Fields.Label != "" {
+			labels[column.Fields.Label]++
+			if labels[column.Fields.Label] == 2 {
+				duplicates = append(duplicates, fmt.Sprintf("label %q", column.Fields.Label))
+			}
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateColumns, strings.Join(duplicates, ", "))
+	}
+	return nil
+}
+
+// AddColumns adds columns to a table
+// POST /docs/{docId}/tables/{tableId}/columns
+func AddColumns(docId string, tableId string, columns []TableColumn) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return -1, err
+	}
+	if err := validateColumns(columns); err != nil {
+		return -1, err
+	}
+	payload := make([]map[string]interface{}, len(columns))
+	for i, column := range columns {
+		payload[i] = columnPayload(column)
+	}
+	bodyJSON, err := json.Marshal(map[string]interface{}{"columns": payload})
+	if err != nil {
+		return -1, err
+	}
+	url := fmt.Sprintf("docs/%s/tables/%s/columns", docId, tableId)
+	response, status, err := httpPost(url, string(bodyJSON))
+	return status, checkResponse(status, response, err)
+}
+
+// EnsureTable makes sure a table exists with the given columns: the table is
+// created if missing, otherwise its missing columns are added (existing
+// columns are left unchanged). created tells whether the table was created
+func EnsureTable(docId string, tableId string, columns []TableColumn) (created bool, err error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return false, err
+	}
+	if err := validateIdentifier("table", tableId); err != nil {
+		return false, err
+	}
+	if err := validateColumns(columns); err != nil {
+		return false, err
+	}
+	response, status, err := httpGet(fmt.Sprintf("docs/%s/tables", docId), "")
+	if err := checkResponse(status, response, err); err != nil {
+		return false, err
+	}
+	tables := Tables{}
+	json.Unmarshal([]byte(response), &tables)
+	for _, table := range tables.Tables {
+		if table.Id != tableId {
+			continue
+		}
+		existing, _, err := defaultClient.getTableColumns(docId, tableId)
+		if err != nil {
+			return false, err
+		}
+		known := map[string]bool{}
+		for _, column := range existing.Columns {
+			known[column.Id] = true
+		}
+		missing := []TableColumn{}
+		for _, column := range columns {
+			if !known[column.Id] {
+				missing = append(missing, column)
+			}
+		}
+		if len(missing) > 0 {
+			if _, err := AddColumns(docId, tableId, missing); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	payload := make([]map[string]interface{}, len(columns))
+	for i, column := range columns {
+		payload[i] = columnPayload(column)
+	}
+	body := map[string]interface{}{
+		"tables": []map[string]interface{}{{"id": tableId, "columns": payload}},
+	}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return false, err
+	}
+	response, status, err = httpPost(fmt.Sprintf("docs/%s/tables", docId), string(bodyJSON))
+	if err := checkResponse(status, response, err); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RenameTable changes the id of a table (not only its title). Grist updates
+// what refers to the table within the document: formulas, reference columns
+// and access rules. What refers to it from outside (API clients, SQL
+// queries, webhooks) must be updated by the caller.
+// newTableId must start with an uppercase letter followed by letters, digits
+// or underscores, and not be the id of another table: Grist would otherwise
+// change it silently
+// PATCH /docs/{docId}/tables
+func RenameTable(docId string, oldTableId string, newTableId string) (int, error) {
+	if err := validateDocTable(docId, oldTableId); err != nil {
+		return -1, err
+	}
+	// Grist capitalizes the first letter of table ids
+	if !common.IsValidGristIdentifier(newTableId) || !unicode.IsUpper(rune(newTableId[0])) {
+		return -1, fmt.Errorf("%w: table id %q must start with an uppercase letter, followed by letters, digits or underscores", ErrInvalidIdentifier, newTableId)
+	}
+	tables, err := defaultClient.getDocTables(docId)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			return apiErr.Status, err
+		}
+		return -1, err
+	}
+	found := false
+	for _, table := range tables.Tables {
+		if strings.EqualFold(table.Id, newTableId) && table.Id != oldTableId {
+			return -1, fmt.Errorf("table %s already exists in document %s", table.Id, docId)
+		}
+		found = found || table.Id == oldTableId
+	}
+	if !found {
+		return http.StatusNotFound, fmt.Errorf("table %s not found in document %s", oldTableId, docId)
+	}
+
+	body := map[string]interface{}{
+		"tables": []map[string]interface{}{{"id": oldTableId, "fields": map[string]interface{}{"tableId": newTableId}}},
+	}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return -1, err
+	}
+	response, status, err := httpPatch(fmt.Sprintf("docs/%s/tables", docId), string(bodyJSON))
+	return status, checkResponse(status, response, err)
+}
+
+// TableData holds a table's column schema together with its records
+type TableData struct {
+	TableId string        `json:"tableId"`
+	Columns []TableColumn `json:"columns"` // In the order returned by Grist (definition order)
+	Records []Record      `json:"records"`
+}
+
+// FetchTable retrieves a table's columns and records at once, so that exporters
+// can output fields in column order with their types.
+// Schema and records are fetched concurrently; the returned status is the
+// first non-200 status of the two calls, or 200
+func FetchTable(docId string, tableId string) (TableData, int) {
+	data := TableData{TableId: tableId, Columns: []TableColumn{}, Records: []Record{}}
+	if err := validateDocTable(docId, tableId); err != nil {
+		return data, -1
+	}
+
+	var columns TableColumns
+	var records RecordsList
+	var columnsStatus, recordsStatus int
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		columns, columnsStatus, _ = defaultClient.getTableColumns(docId, tableId)
+	}()
+	go func() {
+		defer wg.Done()
+		records, recordsStatus = GetRecords(docId, tableId, nil)
+	}()
+	wg.Wait()
+
+	if columnsStatus != http.StatusOK {
+		return data, columnsStatus
+	}
+	if recordsStatus != http.StatusOK {
+		return data, recordsStatus
+	}
+	data.Columns = columns.Columns
+	data.Records = records.Records
+	return data, http.StatusOK
+}
+
+// Retrieves records from a table
+func GetTableRows(docId string, tableId string) TableRows {
+	rows, _ := GetTableRowsWithError(docId, tableId)
+	return rows
+}
+
+// GetTableRowsWithError retrieves the records of a table, also returning
+// the request error
+func GetTableRowsWithError(docId string, tableId string) (TableRows, error) {
+	rows := TableRows{}
+	url := "docs/" + docId + "/tables/" + tableId + "/data"
+	response, status, err := httpGet(url, "")
+	json.Unmarshal([]byte(response), &rows)
+	if rows.Id == nil {
+		rows.Id = []uint{}
+	}
+
+	return rows, checkResponse(status, response, err)
+}
+
+// Returns the list of users with access to the document
+func GetDocAccess(docId string) EntityAccess {
+	lstUsers, _ := getDocAccess(docId)
+	return lstUsers
+}
+
+// GetDocAccessWithError returns the users with access to a document, also
+// returning the request error
+func GetDocAccessWithError(docId string) (EntityAccess, error) {
+	return getDocAccess(docId)
+}
+
+// Email of the pseudo-user through which Grist shares documents publicly
+const everyoneEmail = "everyone@getgrist.com"
+
+// GetUserDocAccess returns the effective role of a user on a document: the
+// strongest of its own access, of the access inherited from the workspace
+// and org (capped by the document's maxInheritedRole), and of the public
+// access if the document is shared with everyone. hasAccess is false when
+// the role is RoleNone
+func GetUserDocAccess(docId string, email string) (role Role, hasAccess bool, err error) {
+	access, err := getDocAccess(docId)
+	if err != nil {
+		return RoleNone, false, err
+	}
+	email = common.NormalizeEmail(email)
+	role = RoleNone
+	for _, user := range access.Users {
+		userEmail := common.NormalizeEmail(user.Email)
+		if userEmail != email && userEmail != everyoneEmail {
+			continue
+		}
+		if effective := EffectiveRole(user, access.MaxInheritedRole); !RoleAtLeast(role, effective) {
+			role = effective
+		}
+	}
+	return role, role != RoleNone, nil
+}
+
+// getDocAccess returns the users with access to the document and the request error
+func getDocAccess(docId string) (EntityAccess, error) {
+	var lstUsers EntityAccess
+	url := fmt.Sprintf("docs/%s/access", docId)
+	response, status, err := httpGet(url, "")
+	if status == http.StatusOK {
+		json.Unmarshal([]byte(response), &lstUsers)
+	}
+	if lstUsers.Users == nil {
+		lstUsers.Users = []User{}
+	}
+	return lstUsers, checkResponse(status, response, err)
+}
+
+// Number of concurrent requests sent by GetDocsAccess
+const docsAccessWorkers = 8
+
+// GetDocsAccess returns the users with access to each document, keyed by
+// document id. Documents are queried concurrently by a pool of workers.
+// Documents whose access cannot be read are missing from the map and their
+// errors are returned together
+func GetDocsAccess(docIds []string) (map[string]EntityAccess, error) {
+	type docAccess struct {
+		docId  string
+		access EntityAccess
+		err    error
+	}
+	jobs := make(chan string)
+	results := make(chan docAccess)
+	var wg sync.WaitGroup
+	for i := 0; i < min(docsAccessWorkers, len(docIds)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for docId := range jobs {
+				access, err := getDocAccess(docId)
+				results <- docAccess{docId, access, err}
+			}
+		}()
+	}
+	go func() {
+		for _, docId := range docIds {
+			jobs <- docId
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	accesses := make(map[string]EntityAccess, len(docIds))
+	var failures []error
+	for result := range results {
+		if result.err != nil {
+			failures = append(failures, fmt.Errorf("document %s: %w", result.docId, result.err))
+			continue
+		}
+		accesses[result.docId] = result.access
+	}
+	return accesses, errors.Join(failures...)
+}
+
+// DocDescription gathers what is known about a document
+type DocDescription struct {
+	Doc             Doc                `json:"doc"`
+	Tables          []TableDescription `json:"tables"`
+	Access          EntityAccess       `json:"access"`
+	WebhookCount    int                `json:"webhookCount"`
+	AttachmentCount int                `json:"attachmentCount"`
+	AttachmentBytes int64              `json:"attachmentBytes"`
+	Errors          map[string]string  `json:"errors,omitempty"` // Parts that could not be read, with their error
+}
+
+// TableDescription describes a table and its columns
+type TableDescription struct {
+	Id      string              `json:"id"`
+	Title   string              `json:"title"`
+	Columns []ColumnDescription `json:"columns"`
+}
+
+// ColumnDescription describes a column
+type ColumnDescription struct {
+	Id    string `json:"id"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+// DescribeDoc assembles a document's metadata, tables with their columns,
+// access list, webhook count and attachments total, fetched concurrently.
+// A part that cannot be read is left empty and noted in Errors; an error is
+// returned only if the document itself cannot be read
+func DescribeDoc(docId string) (DocDescription, error) {
+	description := DocDescription{Tables: []TableDescription{}, Access: EntityAccess{Users: []User{}}}
+	doc, found, err := GetDocOK(docId)
+	if err != nil {
+		return description, err
+	}
+	if !found {
+		return description, &APIError{Status: http.StatusNotFound, Message: "document " + docId + " not found"}
+	}
+	description.Doc = doc
+
+	var mutex sync.Mutex
+	failed := func(part string, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if description.Errors == nil {
+			description.Errors = map[string]string{}
+		}
+		description.Errors[part] = err.Error()
+	}
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		tables, err := defaultClient.getDocTables(docId)
+		if err != nil {
+			failed("tables", err)
+			return
+		}
+		if err := defaultClient.setTableTitles(docId, tables.Tables); err != nil {
+			failed("titles", err)
+		}
+		for _, table := range tables.Tables {
+			columns, _, err := defaultClient.getTableColumns(docId, table.Id)
+			if err != nil {
+				failed("columns of "+table.Id, err)
+			}
+			tableDescription := TableDescription{Id: table.Id, Title: table.Title, Columns: []ColumnDescription{}}
+			for _, column := range columns.Columns {
+				tableDescription.Columns = append(tableDescription.Columns, ColumnDescription{
+					Id:    column.Id,
+					Type:  column.Fields.Type,
+					Label: column.Fields.Label,
+				})
+			}
+			description.Tables = append(description.Tables, tableDescription)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		access, err := getDocAccess(docId)
+		if err != nil {
+			failed("access", err)
+			return
+		}
+		description.Access = access
+	}()
+	go func() {
+		defer wg.Done()
+		webhooks, _, err := GetWebhooksWithError(docId)
+		if err != nil {
+			failed("webhooks", err)
+			return
+		}
+		description.WebhookCount = len(webhooks.Webhooks)
+	}()
+	go func() {
+		defer wg.Done()
+		attachments, _, err := ListAttachmentsWithError(docId, nil)
+		if err != nil {
+			failed("attachments", err)
+			return
+		}
+		description.AttachmentCount = len(attachments.Records)
+		for _, attachment := range attachments.Records {
+			description.AttachmentBytes += attachment.FileSize
+		}
+	}()
+	wg.Wait()
+	return description, nil
+}
+
+// TableStat gives the size of a table
+type TableStat struct {
+	Id       string
+	RowCount int // -1 if the table could not be counted
+}
+
+// Maximum number of tables counted concurrently by GetDocTableStats
+const tableStatsWorkers = 4
+
+// GetDocTableStats lists the tables of a document with their row counts,
+// counted concurrently by a pool of workers with SQL COUNT queries
+func GetDocTableStats(docId string) ([]TableStat, int) {
+	stats, err := docTableStats(docId)
+	if err != nil {
+		return stats, errorStatus(err)
+	}
+	return stats, http.StatusOK
+}
+
+// docTableStats lists the tables of a document with their row counts, see
+// GetDocTableStats, returning the error of the tables request
+func docTableStats(docId string) ([]TableStat, error) {
+	stats := []TableStat{}
+	tables, err := defaultClient.getDocTables(docId)
+	if err != nil {
+		return stats, err
+	}
+
+	stats = make([]TableStat, len(tables.Tables))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(tableStatsWorkers, len(tables.Tables)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				tableId := tables.Tables[index].Id
+				count, _, err := countRecords(docId, tableId)
+				if err != nil {
+					count = -1
+				}
+				stats[index] = TableStat{Id: tableId, RowCount: count}
+			}
+		}()
+	}
+	for index := range tables.Tables {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+	return stats, nil
+}
+
+// DocUsage gives the size of a document, -1 for the values hidden from the caller
+type DocUsage struct {
+	RowCount             int
+	DataSizeBytes        int64 // Size of the data, excluding attachments; -1 if Estimated
+	AttachmentsSizeBytes int64
+	DataLimitStatus      string // "approachingLimit", "gracePeriod", "deleteOnly" or "" when within limits
+	Estimated            bool   // Computed from the tables and attachments: the usage endpoint is unavailable
+}
+
+// GetDocUsage returns the rows and bytes used by a document, as counted
+// towards its plan's limits. On Grist versions without the usage endpoint,
+// the row count and attachments size are computed from the tables and the
+// attachments, and the data size is unknown
+// GET /docs/{docId}/usage
+func GetDocUsage(docId string) (DocUsage, int) {
+	usage, status, _ := GetDocUsageWithError(docId)
+	return usage, status
+}
+
+// GetDocUsageWithError returns the rows and bytes used by a document, see
+// GetDocUsage, also returning the request error
+func GetDocUsageWithError(docId string) (DocUsage, int, error) {
+	usage := DocUsage{RowCount: -1, DataSizeBytes: -1, AttachmentsSizeBytes: -1}
+	if err := validatePathSegment("docId", docId); err != nil {
+		return usage, -1, err
+	}
+	response, status, err := httpGet(fmt.Sprintf("docs/%s/usage", docId), "")
+	if status == http.StatusNotFound {
+		// Missing endpoint, or missing document for which the estimate fails too
+		return estimateDocUsage(docId)
+	}
+	if err := checkResponse(status, response, err); err != nil {
+		return usage, status, err
+	}
+	result := struct {
+		Usage struct {
+			RowCount             interface{} `json:"rowCount"`
+			DataSizeBytes        interface{} `json:"dataSizeBytes"`
+			AttachmentsSizeBytes interface{} `json:"attachmentsSizeBytes"`
+			DataLimitStatus      string      `json:"dataLimitStatus"`
+		} `json:"usage"`
+	}{}
+	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		return usage, -1, fmt.Errorf("invalid usage response: %w", err)
+	}
+	usage.RowCount = int(usageValue(result.Usage.RowCount))
+	usage.DataSizeBytes = usageValue(result.Usage.DataSizeBytes)
+	usage.AttachmentsSizeBytes = usageValue(result.Usage.AttachmentsSizeBytes)
+	usage.DataLimitStatus = result.Usage.DataLimitStatus
+	return usage, status, nil
+}
+
+// usageValue reads a usage metric: a number, an object with a "total" (row
+// counts), or "hidden" when the caller can't see it (-1)
+func usageValue(value interface{}) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case map[string]interface{}:
+		return usageValue(v["total"])
+	}
+	return -1
+}
+
+// estimateDocUsage computes a document's usage from its tables and attachments
+func estimateDocUsage(docId string) (DocUsage, int, error) {
+	usage := DocUsage{DataSizeBytes: -1, Estimated: true}
+	stats, err := docTableStats(docId)
+	if err != nil {
+		return usage, errorStatus(err), err
+	}
+	for _, stat := range stats {
+		if stat.RowCount < 0 {
+			usage.RowCount = -1
+			break
+		}
+		usage.RowCount += stat.RowCount
+	}
+	attachments, status := ListAttachments(docId, nil)
+	if status != http.StatusOK {
+		usage.AttachmentsSizeBytes = -1
+		return usage, http.StatusOK, nil
+	}
+	for _, attachment := range attachments.Records {
+		usage.AttachmentsSizeBytes += attachment.FileSize
+	}
+	return usage, http.StatusOK, nil
+}
+
+// GetDocForms lists the forms of a document, read from the document's
+// metadata tables (form sections, pages and shares).
+// Forms require Grist 1.1.13 or later; older servers have no form sections
+// and an empty list is returned
+func GetDocForms(docId string) ([]Form, int) {
+	forms := []Form{}
+	sections, status := GetRecords(docId, "_grist_Views_section", &GetRecordsOptions{
+		Filter: map[string][]interface{}{"parentKey": {"form"}},
+	})
+	if status != http.StatusOK || len(sections.Records) == 0 {
+		return forms, status
+	}
+	metadata := map[string][]Record{}
+	for _, tableId := range []string{"_grist_Tables", "_grist_Pages", "_grist_Shares"} {
+		records, status := GetRecords(docId, tableId, nil)
+		if status != http.StatusOK {
+			return forms, status
+		}
+		metadata[tableId] = records.Records
+	}
+
+	tableIds := map[int]string{}
+	for _, table := range metadata["_grist_Tables"] {
+		tableIds[table.Id], _ = table.Fields["tableId"].(string)
+	}
+	viewShares := map[int]int{}
+	for _, page := range metadata["_grist_Pages"] {
+		viewShares[refId(page.Fields["viewRef"])] = refId(page.Fields["shareRef"])
+	}
+	shares := map[int]Record{}
+	for _, share := range metadata["_grist_Shares"] {
+		shares[share.Id] = share
+	}
+
+	for _, section := range sections.Records {
+		form := Form{
+			Id:      section.Id,
+			TableId: tableIds[refId(section.Fields["tableRef"])],
+		}
+		form.Title, _ = section.Fields["title"].(string)
+		share, shared := shares[viewShares[refId(section.Fields["parentId"])]]
+		if shared && isPublished(section.Fields["shareOptions"]) && isPublished(share.Fields["options"]) {
+			form.Published = true
+			linkId, _ := share.Fields["linkId"].(string)
+			form.ShareUrl = fmt.Sprintf("%s/forms/%s/%d", gristBaseURL(), linkId, section.Id)
+		}
+		forms = append(forms, form)
+	}
+	return forms, http.StatusOK
+}
+
+// GetDocViews lists the views of a document, read from the document's
+// metadata tables (views, their sections and tables)
+func GetDocViews(docId string) ([]DocView, int) {
+	views := []DocView{}
+	metadata := map[string][]Record{}
+	for _, tableId := range []string{"_grist_Views", "_grist_Views_section", "_grist_Tables"} {
+		records, status := GetRecords(docId, tableId, nil)
+		if status != http.StatusOK {
+			return views, status
+		}
+		metadata[tableId] = records.Records
+	}
+
+	tableIds := map[int]string{}
+	primaryTables := map[int]string{}
+	for _, table := range metadata["_grist_Tables"] {
+		tableIds[table.Id], _ = table.Fields["tableId"].(string)
+		if viewId := refId(table.Fields["primaryViewId"]); viewId != 0 {
+			primaryTables[viewId] = tableIds[table.Id]
+		}
+	}
+	sections := map[int][]Record{}
+	for _, section := range metadata["_grist_Views_section"] {
+		if viewId := refId(section.Fields["parentId"]); viewId != 0 {
+			sections[viewId] = append(sections[viewId], section)
+		}
+	}
+
+	for _, record := range metadata["_grist_Views"] {
+		view := DocView{Id: record.Id, TableId: primaryTables[record.Id], TableIds: []string{}}
+		view.Name, _ = record.Fields["name"].(string)
+		shown := map[string]bool{}
+		for _, section := range sections[record.Id] {
+			tableId := tableIds[refId(section.Fields["tableRef"])]
+			if tableId != "" && !shown[tableId] {
+				shown[tableId] = true
+				view.TableIds = append(view.TableIds, tableId)
+			}
+		}
+		if view.TableId == "" && len(view.TableIds) > 0 {
+			view.TableId = view.TableIds[0]
+		}
+		views = append(views, view)
+	}
+	return views, http.StatusOK
+}
+
+// refId converts a reference cell value to a row id (0 if empty)
+func refId(value interface{}) int {
+	if id, ok := value.(float64); ok {
+		return int(id)
+	}
+	return 0
+}
+
+// isPublished reports whether JSON-encoded share options have "publish" set
+func isPublished(value interface{}) bool {
+	encoded, ok := value.(string)
+	if !ok || encoded == "" {
+		return false
+	}
+	options := struct {
+		Publish bool `json:"publish"`
+	}{}
+	if err := json.Unmarshal([]byte(encoded), &options); err != nil {
+		return false
+	}
+	return options.Publish
+}
+
+// Move all documents from a workspace to another. Nothing is moved if
+// either workspace doesn't exist. Returns the request errors joined
+func MoveAllDocs(fromWorkspaceId int, toWorkspaceId int) error {
+	// Getting the workspaces
+	from_ws, found, err := GetWorkspaceOK(fromWorkspaceId)
+	if err != nil {
+		return fmt.Errorf("source workspace %d: %w", fromWorkspaceId, err)
+	}
+	if !found {
+		return fmt.Errorf("source workspace %d not found", fromWorkspaceId)
+	}
+	_, found, err = GetWorkspaceOK(toWorkspaceId)
+	if err != nil {
+		return fmt.Errorf("destination workspace %d: %w", toWorkspaceId, err)
+	}
+	if !found {
+		return fmt.Errorf("destination workspace %d not found", toWorkspaceId)
+	}
+
+	var errs []error
+	for _, doc := range from_ws.Docs {
+		status, err := moveDoc(doc.Id, toWorkspaceId)
+		if status == http.StatusOK {
+			fmt.Printf("Document %s moved to workspace %d %s\n", doc.Id, toWorkspaceId, common.StatusMarker(true))
+		} else {
+			fmt.Printf("Unable to move document %s", doc.Id)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("document %s: %w", doc.Id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Move a document in a workspace, returning the request error
+func MoveDoc(docId string, workspaceId int) error {
+	status, err := moveDoc(docId, workspaceId)
+	if status == http.StatusOK {
+		fmt.Printf("Document moved to workspace %d %s\n", workspaceId, common.StatusMarker(true))
+	} else {
+		fmt.Printf("Unable to move document")
+	}
+	return err
+}
+
+// moveDoc sends the move request shared by MoveDoc, MoveDocs and MoveAllDocs
+// PATCH /docs/{docId}/move
+func moveDoc(docId string, workspaceId int) (int, error) {
+	response, status, err := httpPatch("docs/"+docId+"/move", fmt.Sprintf(`{"workspace": %d}`, workspaceId))
+	return status, checkResponse(status, response, err)
+}
+
+// MoveResult reports the outcome of moving one document in a batch
+type MoveResult struct {
+	DocId  string
+	Status int   // HTTP status returned by Grist
+	Err    error // nil when the document was moved
+}
+
+// MoveDocs moves the given documents to a workspace, continuing past
+// individual failures. The destination is checked once beforehand: nothing
+// is moved if it doesn't exist. Returns one result per document, and an
+// error joining every failure (nil when all documents were moved)
+func MoveDocs(docIds []string, toWorkspaceId int) ([]MoveResult, error) {
+	_, found, err := GetWorkspaceOK(toWorkspaceId)
+	if err != nil {
+		return nil, fmt.Errorf("destination workspace %d: %w", toWorkspaceId, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("destination workspace %d not found", toWorkspaceId)
+	}
+
+	results := make([]MoveResult, 0, len(docIds))
+	var errs []error
+	for _, docId := range docIds {
+		status := -1
+		err := validatePathSegment("docId", docId)
+		if err == nil {
+			status, err = moveDoc(docId, toWorkspaceId)
+		}
+		if err != nil {
+			err = fmt.Errorf("document %s: %w", docId, err)
+			errs = append(errs, err)
+		}
+		results = append(results, MoveResult{DocId: docId, Status: status, Err: err})
+	}
+	return results, errors.Join(errs...)
+}
+
+// Purge a document's history, to retain only the last modifications.
+// Returns the request error
+func PurgeDoc(docId string, nbHisto int) error {
+	url := "docs/" + docId + "/states/remove"
+	data := fmt.Sprintf(`{"keep": "%d"}`, nbHisto)
+	response, status, err := httpPost(url, data)
+	if status == http.StatusOK {
+		fmt.Printf("History cleared (%d last states) %s\n", nbHisto, common.StatusMarker(true))
+	}
+	return checkResponse(status, response, err)
+}
+
+// Retrieves the settings of a document, stored in its _grist_DocInfo table
+func GetDocSettings(docId string) (DocSettings, int) {
+	settings := DocSettings{}
+	info, status := GetRecords(docId, "_grist_DocInfo", nil)
+	if status != http.StatusOK || len(info.Records) == 0 {
+		return settings, status
+	}
+	fields := info.Records[0].Fields
+	settings.Timezone, _ = fields["timezone"].(string)
+	if encoded, ok := fields["documentSettings"].(string); ok {
+		json.Unmarshal([]byte(encoded), &settings)
+	}
+	return settings, status
+}
+
+// Updates the settings of a document. Empty fields are left unchanged;
+// other document settings (e.g. the formula engine) are preserved
+func UpdateDocSettings(docId string, settings DocSettings) (int, error) {
+	info, status, err := defaultClient.getRecords(docId, "_grist_DocInfo", nil)
+	if err != nil {
+		return status, err
+	}
+	if len(info.Records) == 0 {
+		return -1, fmt.Errorf("document %s has no _grist_DocInfo record", docId)
+	}
+	record := info.Records[0]
+
+	documentSettings := map[string]interface{}{}
+	if encoded, ok := record.Fields["documentSettings"].(string); ok && encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &documentSettings); err != nil {
+			return -1, fmt.Errorf("invalid document settings: %w", err)
+		}
+	}
+	if settings.Locale != "" {
+		documentSettings["locale"] = settings.Locale
+	}
+	if settings.Currency != "" {
+		documentSettings["currency"] = settings.Currency
+	}
+	encoded, err := json.Marshal(documentSettings)
+	if err != nil {
+		return -1, err
+	}
+	fields := map[string]interface{}{"documentSettings": string(encoded)}
+	if settings.Timezone != "" {
+		fields["timezone"] = settings.Timezone
+	}
+
+	// Metadata tables are read-only through the records API: use a user action
+	action := []interface{}{"UpdateRecord", "_grist_DocInfo", record.Id, fields}
+	response, status, err := applyUserActions(docId, []UserAction{action})
+	return status, checkResponse(status, response, err)
+}
+
+// Memo identifying the access rule added by SetDocReadOnly
+const readOnlyRuleMemo = "gristle: read-only lock"
+
+// SetDocReadOnly locks a document against edits by anyone but its owners, or
+// removes that lock. Grist has no read-only switch, so the lock is a set of
+// access rules denying creations, updates and deletions to non-owners,
+// identified by their memo: one on the default resource, covering every
+// table, and one on each table or column resource having rules, since Grist
+// evaluates those before the default rules and would let their grants
+// through. Each lock rule comes before the other rules of its resource.
+// Rules added to a table or column after locking it aren't covered: lock the
+// document again after removing the lock.
+// Owners can still edit the document (e.g. to run a migration) and see the
+// rules in the access rules page. Locking a locked document does nothing
+// POST /docs/{docId}/apply (_grist_ACLRules)
+func SetDocReadOnly(docId string, readOnly bool) (int, error) {
+	rules, status, err := defaultClient.getRecords(docId, "_grist_ACLRules", nil)
+	if err != nil {
+		return status, err
+	}
+	lockIds := []interface{}{}
+	ruledResources := map[int]bool{}
+	firstPos := math.Inf(1)
+	for _, rule := range rules.Records {
+		if rule.Fields["memo"] == readOnlyRuleMemo {
+			lockIds = append(lockIds, rule.Id)
+		}
+		if resource, ok := rule.GetInt("resource"); ok {
+			ruledResources[int(resource)] = true
+		}
+		if pos, ok := rule.GetFloat("rulePos"); ok {
+			firstPos = math.Min(firstPos, pos)
+		}
+	}
+	if math.IsInf(firstPos, 1) {
+		firstPos = 0
+	}
+
+	if !readOnly {
+		if len(lockIds) == 0 {
+			return status, nil
+		}
+		response, status, err := applyUserActions(docId, []UserAction{{"BulkRemoveRecord", "_grist_ACLRules", lockIds}})
+		return status, checkResponse(status, response, err)
+	}
+	if len(lockIds) > 0 {
+		return status, nil
+	}
+
+	resources, status, err := defaultClient.getRecords(docId, "_grist_ACLResources", nil)
+	if err != nil {
+		return status, err
+	}
+	defaultId := 0
+	locks := []UserAction{}
+	lock := func(resourceId int, permissions string) {
+		locks = append(locks, UserAction{"AddRecord", "_grist_ACLRules", nil, map[string]interface{}{
+			"resource":        resourceId,
+			"aclFormula":      "user.Access != OWNER",
+			"permissionsText": permissions,
+			"memo":            readOnlyRuleMemo,
+			"rulePos":         firstPos - float64(len(locks)+1),
+		}})
+	}
+	for _, resource := range resources.Records {
+		tableId, _ := resource.GetString("tableId")
+		colIds, _ := resource.GetString("colIds")
+		switch {
+		case tableId == "*" && colIds == "*":
+			defaultId = resource.Id
+		case tableId == "" || strings.HasPrefix(tableId, "*") || !ruledResources[resource.Id]:
+			// User attributes and special permissions, or no rule to override
+		case colIds == "*":
+			lock(resource.Id, "-CUD")
+		default:
+			// Column rules only grant reads and updates
+			lock(resource.Id, "-U")
+		}
+	}
+	if defaultId == 0 {
+		if defaultId, status, err = addDefaultACLResource(docId); err != nil {
+			return status, err
+		}
+	}
+	lock(defaultId, "-CUD")
+	response, status, err := applyUserActions(docId, locks)
+	return status, checkResponse(status, response, err)
+}
+
+// addDefaultACLResource creates the access rules resource covering every
+// table and column, returning its id
+func addDefaultACLResource(docId string) (int, int, error) {
+	action := []interface{}{"AddRecord", "_grist_ACLResources", nil, map[string]interface{}{"tableId": "*", "colIds": "*"}}
+	response, status, err := applyUserActions(docId, []UserAction{action})
+	if err := checkResponse(status, response, err); err != nil {
+		return 0, status, err
+	}
+	result := struct {
+		RetValues []int `json:"retValues"`
+	}{}
+	if err := json.Unmarshal([]byte(response), &result); err != nil || len(result.RetValues) == 0 {
+		return 0, -1, fmt.Errorf("unexpected response creating the access rules resource: %s", response)
+	}
+	return result.RetValues[0], status, nil
+}
+
+// UserAction is a Grist user action: its name followed by its arguments,
+// e.g. ["UpdateRecord", "People", 3, {"Age": 41}]. AddRecord, UpdateRecord,
+// RemoveRecord and AddColumn build the common ones; any other action of
+// Grist's data engine (BulkAddRecord, RenameTable, ...) can be written as is
+type UserAction []interface{}
+
+// AddRecord adds a record to a table; its id is returned in the result of ApplyActions
+func AddRecord(tableId string, fields map[string]interface{}) UserAction {
+	return UserAction{"AddRecord", tableId, nil, fields}
+}
+
+// UpdateRecord updates the given fields of a record
+func UpdateRecord(tableId string, recordId int, fields map[string]interface{}) UserAction {
+	return UserAction{"UpdateRecord", tableId, recordId, fields}
+}
+
+// RemoveRecord removes a record
+func RemoveRecord(tableId string, recordId int) UserAction {
+	return UserAction{"RemoveRecord", tableId, recordId}
+}
+
+// AddColumn adds a column to a table; an empty label defaults to the column id
+func AddColumn(tableId string, colId string, fields ColumnFields) UserAction {
+	colInfo := map[string]interface{}{"type": fields.Type, "isFormula": fields.IsFormula, "formula": fields.Formula}
+	if fields.Type == "" {
+		colInfo["type"] = "Any"
+	}
+	if fields.Label != "" {
+		colInfo["label"] = fields.Label
+	}
+	if fields.WidgetOptions != "" {
+		colInfo["widgetOptions"] = fields.WidgetOptions
+	}
+	return UserAction{"AddColumn", tableId, colId, colInfo}
+}
+
+// ApplyActions applies user actions to a document in a single transaction:
+// if one fails, none is applied. The response holds the value returned by
+// each action in "retValues", e.g. the id of a record added with AddRecord
+// POST /docs/{docId}/apply
+func ApplyActions(docId string, actions []UserAction) (string, int) {
+	response, status, _ := applyUserActions(docId, actions)
+	return response, status
+}
+
+// applyUserActions applies a list of Grist user actions to a document
+// POST /docs/{docId}/apply
+func applyUserActions(docId string, actions []UserAction) (string, int, error) {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return err.Error(), -1, err
+	}
+	bodyJSON, err := json.Marshal(actions)
+	if err != nil {
+		return err.Error(), -1, err
+	}
+	url := fmt.Sprintf("docs/%s/apply", docId)
+	return httpPost(url, string(bodyJSON))
+}
+
+// ErrEmailDomainNotAllowed is returned when granting access to, or creating,
+// a user whose email is outside the domains set with SetAllowedEmailDomains
+var ErrEmailDomainNotAllowed = errors.New("email domain not allowed")
+
+var (
+	allowedDomainsMutex sync.RWMutex
+	allowedDomains      map[string]bool
+)
+
+// SetAllowedEmailDomains restricts the emails that can be granted access
+// (ImportUsers, UpdateDocAccess) or created with SCIM to the given domains,
+// e.g. "example.com", compared case-insensitively. Subdomains must be listed
+// too. Removing access is always possible. No domain lifts the restriction
+// (the default)
+func SetAllowedEmailDomains(domains []string) {
+	allowedDomainsMutex.Lock()
+	defer allowedDomainsMutex.Unlock()
+	allowedDomains = nil
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(common.NormalizeEmail(domain), "@")
+		if domain == "" {
+			continue
+		}
+		if allowedDomains == nil {
+			allowedDomains = map[string]bool{}
+		}
+		allowedDomains[domain] = true
+	}
+}
+
+// checkEmailDomains returns ErrEmailDomainNotAllowed, naming the emails
+// outside the allowed domains, if any
+func checkEmailDomains(emails ...string) error {
+	allowedDomainsMutex.RLock()
+	defer allowedDomainsMutex.RUnlock()
+	if allowedDomains == nil {
+		return nil
+	}
+	rejected := []string{}
+	for _, email := range emails {
+		email = common.NormalizeEmail(email)
+		at := strings.LastIndex(email, "@")
+		if at < 0 || !allowedDomains[email[at+1:]] {
+			rejected = append(rejected, email)
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("%w: %s", ErrEmailDomainNotAllowed, strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+// Import a list of user & role into a workspace
+// Search workspace by name in org. Returns the first error met
+func ImportUsers(orgId int, workspaceName string, users []UserRole) error {
+	emails := []string{}
+	for _, user := range users {
+		if user.Role != "" {
+			emails = append(emails, user.Email)
+		}
+	}
+	if err := checkEmailDomains(emails...); err != nil {
+		fmt.Printf("Unable to import users in workspace %s: %s\n", workspaceName, err)
+		return err
+	}
+
+	lstWorkspaces, err := GetOrgWorkspacesWithError(orgId)
+	if err != nil {
+		fmt.Printf("Unable to list the workspaces of organization %d: %s\n", orgId, err)
+		return err
+	}
+	idWorkspace := 0
+	for _, ws := range lstWorkspaces {
+		if ws.Name == workspaceName {
+			idWorkspace = ws.Id
+		}
+	}
+
+	if idWorkspace == 0 {
+		idWorkspace, err = CreateWorkspaceWithError(orgId, workspaceName)
+	}
+	if idWorkspace == 0 {
+		fmt.Printf("Unable to create workspace %s\n", workspaceName)
+		return err
+	}
+	url := fmt.Sprintf("workspaces/%d/access", idWorkspace)
+
+	roles := make(map[string]string)
+	for _, role := range users {
+		roles[role.Email] = role.Role
+	}
+	patch, err := accessDelta(roles)
+	if err != nil {
+		fmt.Printf("Unable to build access delta: %s\n", err)
+		return err
+	}
+
+	body, status, err := httpPatch(url, patch)
+
+	var result string
+	if status == http.StatusOK {
+		result = common.StatusMarker(true)
+	} else {
+		result = fmt.Sprintf("%s (%s)", common.StatusMarker(false), body)
+	}
+	fmt.Printf("Import %d users in workspace n°%d\t : %s\n", len(users), idWorkspace, result)
+	return checkResponse(status, body, err)
+}
+
+// accessDelta builds the body of an access PATCH request from a map of
+// emails to roles. Emails are normalized; an empty role removes the access.
+// Emails granted a role must be in the allowed domains (see SetAllowedEmailDomains)
+func accessDelta(users map[string]string) (string, error) {
+	delta := make(map[string]interface{}, len(users))
+	granted := []string{}
+	for email, role := range users {
+		if role == "" {
+			delta[common.NormalizeEmail(email)] = nil
+		} else {
+			delta[common.NormalizeEmail(email)] = role
+			granted = append(granted, email)
+		}
+	}
+	sort.Strings(granted)
+	if err := checkEmailDomains(granted...); err != nil {
+		return "", err
+	}
+	body := map[string]interface{}{"delta": map[string]interface{}{"users": delta}}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return string(bodyJSON), nil
+}
+
+// UpdateDocAccess grants, changes or removes users' access to a document.
+// users maps emails to roles ("owners", "editors", "viewers");
+// an empty role removes the user's access
+// PATCH /docs/{docId}/access
+func UpdateDocAccess(docId string, users map[string]string) (int, error) {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return -1, err
+	}
+	patch, err := accessDelta(users)
+	if err != nil {
+		return -1, err
+	}
+	url := fmt.Sprintf("docs/%s/access", docId)
+	response, status, err := httpPatch(url, patch)
+	return status, checkResponse(status, response, err)
+}
+
+// Create an organization
+func CreateOrg(orgName string, orgDomain string) int {
+	idOrg, _ := CreateOrgWithError(orgName, orgDomain)
+	return idOrg
+}
+
+// CreateOrgWithError creates an organization and returns its id, or 0 and
+// the request error
+func CreateOrgWithError(orgName string, orgDomain string) (int, error) {
+	url := fmt.Sprintf("orgs")
+	data := fmt.Sprintf(`{"name":"%s", "domain":"%s"}`, orgName, orgDomain)
+	body, status, err := httpPost(url, data)
+	return createdId(status, body, err)
+}
+
+// Create a workspace in an organization
+func CreateWorkspace(orgId int, workspaceName string) int {
+	idWorkspace, _ := CreateWorkspaceWithError(orgId, workspaceName)
+	return idWorkspace
+}
+
+// CreateWorkspaceWithError creates a workspace in an organization and
+// returns its id, or 0 and the request error
+func CreateWorkspaceWithError(orgId int, workspaceName string) (int, error) {
+	url := fmt.Sprintf("orgs/%d/workspaces", orgId)
+	data := fmt.Sprintf(`{"name":"%s"}`, workspaceName)
+	body, status, err := httpPost(url, data)
+	return createdId(status, body, err)
+}
+
+// createdId reads the id of an entity created by a request, or returns the
+// request error
+func createdId(status int, body string, err error) (int, error) {
+	if err := checkResponse(status, body, err); err != nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid id in response: %q", body)
+	}
+	return id, nil
+}
+
+// EnsureWorkspace returns the id of the workspace named workspaceName in an
+// organization, creating it if it does not exist yet. created tells whether
+// the workspace was created by this call
+func EnsureWorkspace(orgId int, workspaceName string) (workspaceId int, created bool, err error) {
+	workspaces, err := GetOrgWorkspacesWithError(orgId)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, workspace := range workspaces {
+		if workspace.Name == workspaceName {
+			return workspace.Id, false, nil
+		}
+	}
+	workspaceId, err = CreateWorkspaceWithError(orgId, workspaceName)
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to create workspace %q in organization %d: %w", workspaceName, orgId, err)
+	}
+	return workspaceId, true, nil
+}
+
+// CreateDoc creates an empty document in a workspace and returns its id
+// POST /workspaces/{workspaceId}/docs
+func CreateDoc(workspaceId int, docName string) (string, int) {
+	docId, status, _ := createDoc(workspaceId, docName)
+	return docId, status
+}
+
+// createDoc creates a document, also returning the request error
+func createDoc(workspaceId int, docName string) (string, int, error) {
+	bodyJSON, err := json.Marshal(map[string]string{"name": docName})
+	if err != nil {
+		return "", -1, err
+	}
+	url := fmt.Sprintf("workspaces/%d/docs", workspaceId)
+	response, status, err := httpPost(url, string(bodyJSON))
+	docId := ""
+	if status == http.StatusOK {
+		json.Unmarshal([]byte(response), &docId)
+	}
+	return docId, status, checkResponse(status, response, err)
+}
+
+// ProvisionProject creates a workspace seeded with an empty document.
+// The workspace is reused if it already exists, so re-runs are idempotent on it.
+// If the document cannot be created, a workspace created by this call is deleted
+func ProvisionProject(orgId int, workspaceName string, docName string) (workspaceId int, docId string, err error) {
+	workspaceId, created, err := EnsureWorkspace(orgId, workspaceName)
+	if err != nil {
+		return 0, "", err
+	}
+	docId, _, err = createDoc(workspaceId, docName)
+	if err == nil && docId != "" {
+		return workspaceId, docId, nil
+	}
+	if err == nil {
+		err = errors.New("no document id returned")
+	}
+
+	err = fmt.Errorf("unable to create document %q in workspace %d: %w", docName, workspaceId, err)
+	if created {
+		response, status, err := httpDelete(fmt.Sprintf("workspaces/%d", workspaceId), "")
+		if rollbackErr := checkResponse(status, response, err); rollbackErr != nil {
+			err = errors.Join(err, fmt.Errorf("rollback of workspace %d failed: %w", workspaceId, rollbackErr))
+		}
+	}
+	return 0, "", err
+}
+
+// CopyDoc copies a document into a workspace and returns the new document id
+// POST /docs/{docId}/copy
+// With asTemplate, only the structure is copied (no data nor history).
+// The copy is synchronous: Grist answers once the new document is complete,
+// without a job to poll, so the returned document can be used at once. A
+// failed or interrupted copy (e.g. on timeout, see ConnectionOptions) may
+// still have created the document: look for it by name before retrying
+func CopyDoc(docId string, workspaceId int, name string, asTemplate bool) (string, int) {
+	newDocId, status, _ := CopyDocWithError(docId, workspaceId, name, asTemplate)
+	return newDocId, status
+}
+
+// CopyDocWithError copies a document into a workspace, see CopyDoc, also
+// returning the request error
+func CopyDocWithError(docId string, workspaceId int, name string, asTemplate bool) (string, int, error) {
+	body := struct {
+		WorkspaceId  int    `json:"workspaceId"`
+		DocumentName string `json:"documentName"`
+		AsTemplate   bool   `json:"asTemplate"`
+	}{WorkspaceId: workspaceId, DocumentName: name, AsTemplate: asTemplate}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return "", -1, err
+	}
+
+	url := fmt.Sprintf("docs/%s/copy", docId)
+	response, status, err := httpPost(url, string(bodyJSON))
+	newDocId := ""
+	if status == http.StatusOK {
+		if err := json.Unmarshal([]byte(response), &newDocId); err != nil {
+			newDocId = strings.Trim(strings.TrimSpace(response), `"`)
+		}
+	}
+	return newDocId, status, checkResponse(status, response, err)
+}
+
+// CreateDocFromTemplate instantiates a Grist template (a public document
+// such as those of the templates gallery) as a new document in a workspace.
+// Templates are regular documents, so they are copied with their sample data
+// through the copy endpoint. Returns the new document id.
+func CreateDocFromTemplate(workspaceId int, templateId string, name string) (string, int) {
+	return CopyDoc(templateId, workspaceId, name, false)
+}
+
+// Export doc in Grist format (Sqlite) in fileName file
+func ExportDocGrist(docId string, fileName string) error {
+	return writeFile(fileName, 0o666, func(w io.Writer) error {
+		return ExportDocGristTo(docId, w)
+	})
+}
+
+// Export doc in Excel format (XLSX) in fileName file
+func ExportDocExcel(docId string, fileName string) error {
+	return writeFile(fileName, 0o666, func(w io.Writer) error {
+		return ExportDocExcelTo(docId, w)
+	})
+}
+
+// ExportDocGristTo streams the Grist (SQLite) export of a document to w as
+// it is downloaded, so that large documents aren't held in memory.
+// On error, w may have received part of the export
+// GET /docs/{docId}/download
+func ExportDocGristTo(docId string, w io.Writer) error {
+	return defaultClient.ExportDocGristTo(docId, w)
+}
+
+// ExportDocGristTo streams the Grist export of a document to w, see ExportDocGristTo
+func (c *Client) ExportDocGristTo(docId string, w io.Writer) error {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return err
+	}
+	_, err := c.download(fmt.Sprintf("docs/%s/download", docId), w)
+	return err
+}
+
+// ExportDocExcelTo streams the Excel (XLSX) export of a document to w, see
+// ExportDocGristTo
+// GET /docs/{docId}/download/xlsx
+func ExportDocExcelTo(docId string, w io.Writer) error {
+	return defaultClient.ExportDocExcelTo(docId, w)
+}
+
+// ExportDocExcelTo streams the Excel export of a document to w, see ExportDocExcelTo
+func (c *Client) ExportDocExcelTo(docId string, w io.Writer) error {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return err
+	}
+	_, err := c.download(fmt.Sprintf("docs/%s/download/xlsx", docId), w)
+	return err
+}
+
+// ExportTableExcel writes a single table of a document as an Excel workbook
+// with one sheet named after the table. Grist's xlsx download is asked for
+// the table only; if the server doesn't support it (HTTP 400 or 404), the
+// workbook is built from the table's columns and records, without formatting
+// GET /docs/{docId}/download/xlsx?tableId={tableId}
+func ExportTableExcel(docId string, tableId string, w io.Writer) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return -1, err
+	}
+	endpoint := fmt.Sprintf("docs/%s/download/xlsx?tableId=%s", docId, url.QueryEscape(tableId))
+	status, err := defaultClient.download(endpoint, w)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.Status == http.StatusBadRequest || apiErr.Status == http.StatusNotFound) {
+		return buildTableWorkbook(docId, tableId, w)
+	}
+	return status, err
+}
+
+// buildTableWorkbook writes a one-sheet workbook from a table's columns and records
+func buildTableWorkbook(docId string, tableId string, w io.Writer) (int, error) {
+	table, err := FetchTableTyped(docId, tableId)
+	if err != nil {
+		status := -1
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			status = apiErr.Status
+		}
+		return status, err
+	}
+	rows := make([][]interface{}, 0, len(table.Records)+1)
+	header := make([]interface{}, len(table.Columns))
+	for i, column := range table.Columns {
+		header[i] = column.Id
+		if column.Fields.Label != "" {
+			header[i] = column.Fields.Label
+		}
+	}
+	rows = append(rows, header)
+	for _, record := range table.Records {
+		row := make([]interface{}, len(table.Columns))
+		for i, column := range table.Columns {
+			row[i] = sheetValue(record.Fields[column.Id])
+		}
+		rows = append(rows, row)
+	}
+	return http.StatusOK, writeWorkbook(w, tableId, rows)
+}
+
+// sheetValue converts a field to a cell value: dates become text, lists
+// (ChoiceList, RefList) their comma-separated items
+func sheetValue(field TypedField) interface{} {
+	if items, ok := listItems(field.Value); ok {
+		texts := make([]string, len(items))
+		for i, item := range items {
+			texts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(texts, ", ")
+	}
+	seconds, isNumber := field.Value.(float64)
+	switch field.BaseType() {
+	case "Date":
+		if isNumber {
+			return gristToTime(seconds).Format("2006-01-02")
+		}
+	case "DateTime":
+		if isNumber {
+			return gristToTime(seconds).Format(time.RFC3339)
+		}
+	}
+	return field.Value
+}
+
+// Files of a minimal workbook, besides its sheet
+var workbookFiles = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// writeWorkbook writes rows as an xlsx workbook with a single sheet
+func writeWorkbook(w io.Writer, sheetName string, rows [][]interface{}) error {
+	archive := zip.NewWriter(w)
+	for _, file := range workbookFiles {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, file.content); err != nil {
+			return err
+		}
+	}
+
+	if len(sheetName) > 31 {
+		sheetName = sheetName[:31]
+	}
+	f, err := archive.Create("xl/workbook.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`, xmlEscape(sheetName)); err != nil {
+		return err
+	}
+
+	f, err = archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	sheet := bufio.NewWriter(f)
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(sheet, `<row r="%d">`, r+1)
+		for c, value := range row {
+			ref := fmt.Sprintf("%s%d", columnLetters(c), r+1)
+			switch v := value.(type) {
+			case nil:
+			case bool:
+				b := 0
+				if v {
+					b = 1
+				}
+				fmt.Fprintf(sheet, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+			case float64, int, int64, json.Number:
+				fmt.Fprintf(sheet, `<c r="%s"><v>%v</v></c>`, ref, v)
+			default:
+				fmt.Fprintf(sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(fmt.Sprint(v)))
+			}
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+	if err := sheet.Flush(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// columnLetters returns the letters of a spreadsheet column: A, B, ..., Z, AA...
+func columnLetters(index int) string {
+	letters := ""
+	for index >= 0 {
+		letters = string(rune('A'+index%26)) + letters
+		index = index/26 - 1
+	}
+	return letters
+}
+
+// xmlEscape escapes text for XML content and attributes
+func xmlEscape(text string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(text))
+	return escaped.String()
+}
+
+// writeFile creates fileName with the given permissions (before umask) and
+// fills it through a buffered writer, then flushes and syncs it. The flush,
+// sync and close errors are returned like the write errors, so that a
+// truncated file is never reported as written
+func writeFile(fileName string, perm os.FileMode, write func(w io.Writer) error) error {
+	// #nosec G304 - fileName is user-provided CLI argument for export destination
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	err = write(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// Export endpoints and file extensions of the archive formats
+var archiveFormats = map[string]struct{ endpoint, extension string }{
+	"grist": {"download", ".grist"},
+	"xlsx":  {"download/xlsx", ".xlsx"},
+}
+
+// ExportWorkspaceArchive exports every document of a workspace, in "grist"
+// or "xlsx" format, into a single zip archive written to w.
+// Files are named after the documents, with the document id added when
+// several documents share a name. Documents that fail to export are skipped;
+// their errors are returned together once the archive is complete
+func ExportWorkspaceArchive(workspaceId int, w io.Writer, format string) error {
+	exportFormat, ok := archiveFormats[format]
+	if !ok {
+		return fmt.Errorf("unsupported export format %q (expected grist or xlsx)", format)
+	}
+	workspace, found, err := GetWorkspaceOK(workspaceId)
+	if err != nil {
+		return fmt.Errorf("workspace %d: %w", workspaceId, err)
+	}
+	if !found {
+		return fmt.Errorf("workspace %d not found", workspaceId)
+	}
+
+	archive := zip.NewWriter(w)
+	names := map[string]int{}
+	for _, doc := range workspace.Docs {
+		names[archiveFileName(doc.Name)]++
+	}
+	var failures []error
+	for _, doc := range workspace.Docs {
+		name := archiveFileName(doc.Name)
+		if names[name] > 1 {
+			name += "-" + doc.Id
+		}
+		entry := &archiveEntry{archive: archive, name: name + exportFormat.extension}
+		_, err := defaultClient.download(fmt.Sprintf("docs/%s/%s", doc.Id, exportFormat.endpoint), entry)
+		if err == nil {
+			err = entry.create()
+		}
+		if err != nil && entry.file == nil && entry.err == nil {
+			failures = append(failures, fmt.Errorf("document %s (%s): %w", doc.Name, doc.Id, err))
+			continue
+		}
+		if err != nil {
+			// The archive can't be written, or holds a truncated file: it is unusable
+			return errors.Join(append(failures, fmt.Errorf("writing %s to the archive: %w", doc.Id, err))...)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		failures = append(failures, fmt.Errorf("closing the archive: %w", err))
+	}
+	return errors.Join(failures...)
+}
+
+// archiveEntry is a file of a zip archive created on the first write, so that
+// a document failing to export before sending any content leaves no empty file
+type archiveEntry struct {
+	archive *zip.Writer
+	name    string
+	file    io.Writer
+	err     error // Error adding the file to the archive
+}
+
+// create adds the file to the archive if it isn't there yet
+func (e *archiveEntry) create() error {
+	if e.file != nil {
+		return nil
+	}
+	e.file, e.err = e.archive.Create(e.name)
+	return e.err
+}
+
+func (e *archiveEntry) Write(p []byte) (int, error) {
+	if err := e.create(); err != nil {
+		return 0, err
+	}
+	return e.file.Write(p)
+}
+
+// ErrCorruptExport is returned when an exported file fails verification
+var ErrCorruptExport = errors.New("corrupt export")
+
+// Attempts made by ExportDocVerified by default, and at most
+const (
+	defaultExportAttempts = 3
+	maxExportAttempts     = 10
+)
+
+// Delay before retrying an export, multiplied by the number of failed attempts
+var exportRetryDelay = time.Second
+
+// ExportDocVerified exports a document in "grist" or "xlsx" format to
+// fileName, then reads the file back to verify it, retrying the whole export
+// when the download fails (transport error or HTTP 5xx) or the file is
+// corrupt, e.g. truncated by a dropped connection. attempts is capped at 10,
+// and defaults to 3 when not positive.
+// The export is written next to fileName and only renamed to it once
+// verified, so an existing file is never replaced by a corrupt one.
+// A fileName without extension gets that of the format (.grist or .xlsx)
+func ExportDocVerified(docId string, format string, fileName string, attempts int) error {
+	exportFormat, ok := archiveFormats[format]
+	if !ok {
+		return fmt.Errorf("unsupported export format %q (expected grist or xlsx)", format)
+	}
+	if err := validatePathSegment("docId", docId); err != nil {
+		return err
+	}
+	if attempts <= 0 {
+		attempts = defaultExportAttempts
+	}
+	attempts = min(attempts, maxExportAttempts)
+	if filepath.Ext(fileName) == "" {
+		fileName += exportFormat.extension
+	}
+	verify := ValidateGristFile
+	if format == "xlsx" {
+		verify = verifyXlsxFile
+	}
+
+	partFile := fileName + ".part"
+	defer os.Remove(partFile)
+	var failures []error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * exportRetryDelay)
+		}
+		status := 0
+		if err := writeFile(partFile, 0o666, func(w io.Writer) error {
+			var err error
+			status, err = defaultClient.download(fmt.Sprintf("docs/%s/%s", docId, exportFormat.endpoint), w)
+			return err
+		}); err != nil {
+			// Transport errors, including a connection dropped while
+			// copying the export (status 2xx), and 5xx are retried
+			if status != -10 && status < 500 && (status < 200 || status >= 300) {
+				return err
+			}
+			failures = append(failures, fmt.Errorf("attempt %d: %w", attempt, err))
+			continue
+		}
+		if err := verify(partFile); err != nil {
+			failures = append(failures, fmt.Errorf("attempt %d: %w", attempt, err))
+			continue
+		}
+		return os.Rename(partFile, fileName)
+	}
+	return fmt.Errorf("exporting %s failed after %d attempts: %w", docId, attempts, errors.Join(failures...))
+}
+
+// sqliteMagic starts the header of every SQLite database
+const sqliteMagic = "SQLite format 3\x00"
+
+var (
+	sqliteDriverMutex sync.RWMutex
+	sqliteDriver      string
+)
+
+// gristMetadataTables are tables found in every Grist document
+var gristMetadataTables = []string{"_grist_DocInfo", "_grist_Tables", "_grist_Tables_column"}
+
+// SetSQLiteDriver enables a deeper check of .grist files by ValidateGristFile,
+// and thus ExportDocVerified: they are opened with database/sql, must pass
+// SQLite's integrity check and contain Grist's metadata tables, which
+// guarantees a restorable backup.
+// name is that of a driver registered by importing it in the program, e.g.
+// "sqlite" for modernc.org/sqlite or "sqlite3" for github.com/mattn/go-sqlite3;
+// this package doesn't depend on one. "" (the default) disables the check
+func SetSQLiteDriver(name string) error {
+	if name != "" && !slices.Contains(sql.Drivers(), name) {
+		return fmt.Errorf("unknown SQL driver %q: import a SQLite driver registering it", name)
+	}
+	sqliteDriverMutex.Lock()
+	defer sqliteDriverMutex.Unlock()
+	sqliteDriver = name
+	return nil
+}
+
+// ValidateGristFile checks that a .grist file is a complete SQLite database:
+// its header must be valid and its size match the page count it records.
+// This catches truncated downloads without a SQLite driver, but doesn't check
+// the content of the pages: with a driver set with SetSQLiteDriver, the file
+// is also opened, must pass PRAGMA integrity_check and contain Grist's
+// metadata tables.
+// The error wraps ErrCorruptExport for an invalid file
+func ValidateGristFile(fileName string) error {
+	if err := verifySQLiteHeader(fileName); err != nil {
+		return err
+	}
+	sqliteDriverMutex.RLock()
+	driver := sqliteDriver
+	sqliteDriverMutex.RUnlock()
+	if driver == "" {
+		return nil
+	}
+	return verifyGristDatabase(driver, fileName)
+}
+
+// verifyGristDatabase opens a .grist file with a SQLite driver and checks the
+// integrity of its pages, then that it has Grist's metadata tables
+func verifyGristDatabase(driver string, fileName string) error {
+	db, err := sql.Open(driver, fileName)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", fileName, err)
+	}
+	defer db.Close()
+	if err := checkSQLiteIntegrity(db); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptExport, fileName, err)
+	}
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptExport, fileName, err)
+	}
+	defer rows.Close()
+	tables := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrCorruptExport, fileName, err)
+		}
+		tables[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptExport, fileName, err)
+	}
+	missing := []string{}
+	for _, table := range gristMetadataTables {
+		if !tables[table] {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s is not a Grist document (missing %s)", ErrCorruptExport, fileName, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkSQLiteIntegrity runs PRAGMA integrity_check, which reports "ok" as its
+// only row for a sound database, and its problems otherwise
+func checkSQLiteIntegrity(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	problems := []string{}
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return err
+		}
+		problems = append(problems, problem)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// verifySQLiteHeader checks the header and size of a SQLite database
+func verifySQLiteHeader(fileName string) error {
+	// #nosec G304 - fileName is the export being verified
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	content := make([]byte, 100)
+	if _, err := io.ReadFull(f, content); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	} else if err != nil || string(content[:16]) != sqliteMagic {
+		return fmt.Errorf("%w: %s is not a SQLite database", ErrCorruptExport, fileName)
+	}
+	pageSize := int64(content[16])<<8 | int64(content[17])
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("%w: %s has an invalid page size %d", ErrCorruptExport, fileName, pageSize)
+	}
+	size := info.Size()
+	if size%pageSize != 0 {
+		return fmt.Errorf("%w: %s is truncated (%d bytes for pages of %d bytes)", ErrCorruptExport, fileName, size, pageSize)
+	}
+	// The page count in the header is only valid when written by the same
+	// version as the change counter (SQLite 3.7.0 and later)
+	changeCounter := content[24:28]
+	validFor := content[92:96]
+	pageCount := int64(content[28])<<24 | int64(content[29])<<16 | int64(content[30])<<8 | int64(content[31])
+	if bytes.Equal(changeCounter, validFor) && pageCount != 0 && pageCount*pageSize != size {
+		return fmt.Errorf("%w: %s has %d bytes, expected %d pages of %d bytes", ErrCorruptExport, fileName, size, pageCount, pageSize)
+	}
+	return nil
+}
+
+// verifyXlsxFile checks that an .xlsx file is a complete workbook: its zip
+// central directory must be readable, every file must match its checksum and
+// the workbook part must be present
+func verifyXlsxFile(fileName string) error {
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptExport, fileName, err)
+	}
+	defer archive.Close()
+	hasWorkbook := false
+	for _, file := range archive.File {
+		hasWorkbook = hasWorkbook || file.Name == "xl/workbook.xml"
+		f, err := file.Open()
+		if err == nil {
+			// Reading to the end checks the CRC-32 of the file
+			_, err = io.Copy(io.Discard, f)
+			f.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: %s: %v", ErrCorruptExport, fileName, file.Name, err)
+		}
+	}
+	if !hasWorkbook {
+		return fmt.Errorf("%w: %s has no workbook", ErrCorruptExport, fileName)
+	}
+	return nil
+}
+
+// archiveFileName turns a document name into a safe file name
+func archiveFileName(docName string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(docName))
+	if name == "" {
+		return "document"
+	}
+	return name
+}
+
+// GetTableContent returns the content of a table as CSV, with the HTTP status
+// GET /docs/{docId}/download/csv?tableId={tableId}
+func GetTableContent(docId string, tableName string) (string, int) {
+	csvFile, status, _ := GetTableContentWithError(docId, tableName)
+	return csvFile, status
+}
+
+// GetTableContentWithError returns the content of a table as CSV, see
+// GetTableContent, also returning the request error
+func GetTableContentWithError(docId string, tableName string) (string, int, error) {
+	url := fmt.Sprintf("docs/%s/download/csv?tableId=%s", docId, url.QueryEscape(tableName))
+	csvFile, status, err := httpGet(url, "")
+	return csvFile, status, checkResponse(status, csvFile, err)
+}
+
+// CSVOptions controls how ExportTableCSV writes a table
+type CSVOptions struct {
+	Delimiter  rune   // Field delimiter, ',' when zero (';' suits Excel in many European locales)
+	BOM        bool   // Start with a UTF-8 byte order mark, so that Excel detects the encoding
+	LineEnding string // "\n" (the default when empty) or "\r\n"
+}
+
+// utf8BOM is the byte order mark Excel expects at the start of UTF-8 CSV files
+const utf8BOM = "\ufeff"
+
+// ExportTableCSV writes a table as CSV. Grist's CSV download is re-emitted
+// with the delimiter, BOM and line ending of options; nil options give
+// comma-delimited CSV without BOM
+// GET /docs/{docId}/download/csv?tableId={tableId}
+func ExportTableCSV(docId string, tableId string, options *CSVOptions, w io.Writer) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return -1, err
+	}
+	if options == nil {
+		options = &CSVOptions{}
+	}
+	if options.LineEnding != "" && options.LineEnding != "\n" && options.LineEnding != "\r\n" {
+		return -1, fmt.Errorf("unsupported line ending %q: use \"\\n\" or \"\\r\\n\"", options.LineEnding)
+	}
+	delimiter := ','
+	if options.Delimiter != 0 {
+		delimiter = options.Delimiter
+	}
+	// Checks the delimiter before anything is written
+	check := csv.NewWriter(io.Discard)
+	check.Comma = delimiter
+	if err := check.Write(nil); err != nil {
+		return -1, fmt.Errorf("delimiter %q: %w", delimiter, err)
+	}
+
+	content, status, err := httpGet(fmt.Sprintf("docs/%s/download/csv?tableId=%s", docId, url.QueryEscape(tableId)), "")
+	if err := checkResponse(status, content, err); err != nil {
+		return status, err
+	}
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(content, utf8BOM)))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return status, fmt.Errorf("invalid CSV from %s: %w", tableId, err)
+	}
+
+	if options.BOM {
+		if _, err := io.WriteString(w, utf8BOM); err != nil {
+			return status, err
+		}
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	writer.UseCRLF = options.LineEnding == "\r\n"
+	if err := writer.WriteAll(rows); err != nil {
+		return status, err
+	}
+	return status, nil
+}
+
+// ImportCSVOptions controls how ImportRecordsCSV reads and sends a CSV file
+type ImportCSVOptions struct {
+	Delimiter  rune     // Field delimiter, ',' when zero
+	NoParse    bool     // Store every value as text, without parsing it
+	RawColumns []string // Columns stored as text while the others are parsed, e.g. ZIP codes keeping their leading zeros
+}
+
+// ImportRecordsCSV adds the rows of a CSV file to a table and returns the ids
+// of the new records. The first row holds the column ids. Values are sent as
+// text, which Grist parses into the type of their column (e.g. "0123" into
+// 123 for a Numeric column) unless options.NoParse is set.
+// Grist can only skip parsing for a whole request, so when RawColumns is set
+// the records are added with the other columns parsed, then their raw
+// columns are filled by a second, unparsed, request on the new ids. The
+// import is thus not atomic: if the second request fails, the records stay
+// without their raw columns and the error gives their ids
+// POST /docs/{docId}/tables/{tableId}/records
+// PATCH /docs/{docId}/tables/{tableId}/records?noparse=true
+func ImportRecordsCSV(docId string, tableId string, r io.Reader, options *ImportCSVOptions) ([]int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &ImportCSVOptions{}
+	}
+	reader := csv.NewReader(r)
+	if options.Delimiter != 0 {
+		reader.Comma = options.Delimiter
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty CSV: a header row with the column ids is expected")
+	}
+	header := rows[0]
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], utf8BOM)
+	}
+	raw := map[string]bool{}
+	if !options.NoParse {
+		known := map[string]bool{}
+		for _, colId := range header {
+			known[colId] = true
+		}
+		for _, colId := range options.RawColumns {
+			if !known[colId] {
+				return nil, fmt.Errorf("raw column %s is not in the CSV header", colId)
+			}
+			raw[colId] = true
+		}
+	}
+
+	parsed := make([]map[string]interface{}, 0, len(rows)-1)
+	rawFields := make([]map[string]interface{}, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		fields := map[string]interface{}{}
+		rawRow := map[string]interface{}{}
+		for i, colId := range header {
+			if raw[colId] {
+				rawRow[colId] = row[i]
+			} else {
+				fields[colId] = row[i]
+			}
+		}
+		parsed = append(parsed, fields)
+		rawFields = append(rawFields, rawRow)
+	}
+	if len(parsed) == 0 {
+		return []int{}, nil
+	}
+
+	added, _, err := defaultClient.addRecords(docId, tableId, parsed, &AddRecordsOptions{NoParse: options.NoParse})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(added.Records))
+	for i, record := range added.Records {
+		ids[i] = record.Id
+	}
+	if len(raw) == 0 {
+		return ids, nil
+	}
+	if len(ids) != len(rawFields) {
+		return ids, fmt.Errorf("grist added %d records for %d rows: raw columns not set", len(ids), len(rawFields))
+	}
+	updates := make([]Record, len(ids))
+	for i, id := range ids {
+		updates[i] = Record{Id: id, Fields: rawFields[i]}
+	}
+	if _, _, err := updateRecords(docId, tableId, updates, &UpdateRecordsOptions{NoParse: true}); err != nil {
+		return ids, fmt.Errorf("records %d to %d added without their raw columns: %w", ids[0], ids[len(ids)-1], err)
+	}
+	return ids, nil
+}
+
+// Retrieves information on a specific organization
+func GetOrgUsageSummary(orgId string) OrgUsage {
+	usage, _ := GetOrgUsageSummaryWithError(orgId)
+	return usage
+}
+
+// GetOrgUsageSummaryWithError retrieves the usage of an organization, also
+// returning the request error
+func GetOrgUsageSummaryWithError(orgId string) (OrgUsage, error) {
+	usage := OrgUsage{}
+	response, status, err := httpGet("orgs/"+orgId+"/usage", "")
+	json.Unmarshal([]byte(response), &usage)
+	return usage, checkResponse(status, response, err)
+}
+
+// ErrInvalidPathSegment is returned when an identifier used to build a URL is empty or malformed
+var ErrInvalidPathSegment = errors.New("invalid path segment")
+
+// validatePathSegment checks that an identifier can safely be used as a URL path segment
+func validatePathSegment(name string, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("%w: %s must not be empty", ErrInvalidPathSegment, name)
+	}
+	if strings.ContainsAny(value, "/?#") {
+		return fmt.Errorf("%w: %s %q must not contain '/', '?' or '#'", ErrInvalidPathSegment, name, value)
+	}
+	return nil
+}
+
+// filterParam encodes a filter for the ?filter= parameter. Columns without
+// values are skipped, and "" is returned when no column is left, so that no
+// empty filter is sent. Returns an error for values that can't be encoded
+// as JSON
+func filterParam(filter map[string][]interface{}) (string, error) {
+	effective := make(map[string][]interface{}, len(filter))
+	for column, values := range filter {
+		if len(values) > 0 {
+			effective[column] = values
+		}
+	}
+	if len(effective) == 0 {
+		return "", nil
+	}
+	filterJSON, err := json.Marshal(effective)
+	if err != nil {
+		return "", fmt.Errorf("invalid filter: %w", err)
+	}
+	return string(filterJSON), nil
+}
+
+// validateDocTable checks the document and table ids used by the records endpoints
+func validateDocTable(docId string, tableId string) error {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return err
+	}
+	return validatePathSegment("tableId", tableId)
+}
+
+// buildRecordsQueryParams builds the query string for records API endpoints.
+// Values are percent-encoded, so a filter's JSON can hold any character, and
+// the parameters are sorted by key
+func buildRecordsQueryParams(params map[string]string) string {
+	values := url.Values{}
+	for key, value := range params {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// GetRecords fetches records from a table
+// GET /docs/{docId}/tables/{tableId}/records
+// Returns status -1 without sending anything if docId or tableId is invalid
+func GetRecords(docId string, tableId string, options *GetRecordsOptions) (RecordsList, int) {
+	return defaultClient.GetRecords(docId, tableId, options)
+}
+
+// GetRecords fetches records from a table, see GetRecords
+func (c *Client) GetRecords(docId string, tableId string, options *GetRecordsOptions) (RecordsList, int) {
+	records, status, _ := c.getRecords(docId, tableId, options)
+	return records, status
+}
+
+// getRecords fetches records, also returning the request error
+func (c *Client) getRecords(docId string, tableId string, options *GetRecordsOptions) (RecordsList, int, error) {
+	records := RecordsList{Records: []Record{}}
+	if err := validateDocTable(docId, tableId); err != nil {
+		return records, -1, err
+	}
+	if options != nil {
+		where, err := options.condition()
+		if err != nil {
+			return records, -1, err
+		}
+		if where != nil {
+			filter, ok := where.pushdown(options.Filter)
+			if !ok {
+				return c.getRecordsWhere(docId, tableId, options, *where)
+			}
+			pushed := *options
+			pushed.Filter, pushed.Where = filter, nil
+			options = &pushed
+		}
+	}
+	params := make(map[string]string)
+
+	if options != nil {
+		filter, err := filterParam(options.Filter)
+		if err != nil {
+			return records, -1, err
+		}
+		if filter != "" {
+			params["filter"] = filter
+		}
+		if options.Sort != "" {
+			params["sort"] = options.Sort
+		}
+		if options.Limit > 0 {
+			params["limit"] = strconv.Itoa(options.Limit)
+		}
+		if options.Hidden {
+			params["hidden"] = "true"
+		}
+	}
+
+	url := fmt.Sprintf("docs/%s/tables/%s/records%s", docId, tableId, buildRecordsQueryParams(params))
+	response, status, err := c.httpGet(url, "")
+	if status == http.StatusOK {
+		decodeJSON(response, &records, options != nil && options.UseNumber)
+		raw := struct {
+			Records []struct {
+				Fields json.RawMessage `json:"fields"`
+			} `json:"records"`
+		}{}
+		if json.Unmarshal([]byte(response), &raw) == nil && len(raw.Records) == len(records.Records) {
+			for i := range records.Records {
+				records.Records[i].RawFields = raw.Records[i].Fields
+			}
+		}
+	}
+	if records.Records == nil {
+		records.Records = []Record{}
+	}
+	return records, status, checkResponse(status, response, err)
+}
+
+// AddRecords adds records to a table
+// POST /docs/{docId}/tables/{tableId}/records
+// Returns status -1 without sending anything if docId or tableId is invalid
+// or the records can't be encoded as JSON, and -10 if no response was
+// received. Use AddRecordsBatched to get these failures as errors
+func AddRecords(docId string, tableId string, records []map[string]interface{}, options *AddRecordsOptions) (RecordsWithoutFields, int) {
+	return defaultClient.AddRecords(docId, tableId, records, options)
+}
+
+// AddRecords adds records to a table, see AddRecords
+func (c *Client) AddRecords(docId string, tableId string, records []map[string]interface{}, options *AddRecordsOptions) (RecordsWithoutFields, int) {
+	result, status, _ := c.addRecords(docId, tableId, records, options)
+	return result, status
+}
+
+// addRecords adds records, also returning the request error
+func (c *Client) addRecords(docId string, tableId string, records []map[string]interface{}, options *AddRecordsOptions) (RecordsWithoutFields, int, error) {
+	result := RecordsWithoutFields{}
+	if err := validateDocTable(docId, tableId); err != nil {
+		return result, -1, err
+	}
+	params := make(map[string]string)
+
+	if options != nil && options.NoParse {
+		params["noparse"] = "true"
+	}
+
+	// Build request body
+	body := struct {
+		Records []struct {
+			Fields map[string]interface{} `json:"fields"`
+		} `json:"records"`
+	}{}
+	for _, fields := range records {
+		body.Records = append(body.Records, struct {
+			Fields map[string]interface{} `json:"fields"`
+		}{Fields: fields})
+	}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return result, -1, fmt.Errorf("encoding records: %w", err)
+	}
+
+	retry := RetryOptions{}
+	if options != nil {
+		retry = options.RetryOptions
+	}
+	url := fmt.Sprintf("docs/%s/tables/%s/records%s", docId, tableId, buildRecordsQueryParams(params))
+	response, status, err := c.requestWith("POST", url, bodyJSON, retry)
+	if status == http.StatusOK {
+		json.Unmarshal([]byte(response), &result)
+	}
+	return result, status, checkResponse(status, response, err)
+}
+
+// labelSchema maps the column ids of a table to the keys used by the ByLabel
+// functions and back
+type labelSchema struct {
+	idToKey map[string]string
+	keyToId map[string]string
+}
+
+var (
+	labelSchemasMutex sync.Mutex
+	labelSchemas      = map[string]labelSchema{}
+)
+
+// tableLabelSchema returns the label mapping of a table, fetching its columns
+// on first use only
+func tableLabelSchema(docId string, tableId string) (labelSchema, int) {
+	cacheKey := docId + "/" + tableId
+	labelSchemasMutex.Lock()
+	schema, found := labelSchemas[cacheKey]
+	labelSchemasMutex.Unlock()
+	if found {
+		return schema, http.StatusOK
+	}
+
+	columns, status, err := defaultClient.getTableColumns(docId, tableId)
+	if err != nil {
+		return schema, status
+	}
+	labelCounts := map[string]int{}
+	for _, column := range columns.Columns {
+		labelCounts[column.Fields.Label]++
+	}
+	schema = labelSchema{idToKey: map[string]string{}, keyToId: map[string]string{}}
+	for _, column := range columns.Columns {
+		key := column.Fields.Label
+		if key == "" || labelCounts[key] > 1 {
+			key = column.Id
+		}
+		schema.idToKey[column.Id] = key
+		schema.keyToId[key] = column.Id
+	}
+	labelSchemasMutex.Lock()
+	labelSchemas[cacheKey] = schema
+	labelSchemasMutex.Unlock()
+	return schema, status
+}
+
+// ClearLabelCache forgets the column labels cached by the ByLabel functions,
+// to be called after renaming or adding columns
+func ClearLabelCache() {
+	labelSchemasMutex.Lock()
+	defer labelSchemasMutex.Unlock()
+	labelSchemas = map[string]labelSchema{}
+}
+
+// GetRecordsByLabel is GetRecords with the fields keyed by column label
+// ("First Name") instead of column id ("First_Name"). The options still use
+// column ids. Columns without a label, or sharing their label with another
+// column, keep their id as key so that no field is lost.
+// The labels are fetched once per table and cached (see ClearLabelCache)
+func GetRecordsByLabel(docId string, tableId string, options *GetRecordsOptions) (RecordsList, int) {
+	schema, status := tableLabelSchema(docId, tableId)
+	if status != http.StatusOK {
+		return RecordsList{Records: []Record{}}, status
+	}
+	records, status := GetRecords(docId, tableId, options)
+	for i, record := range records.Records {
+		fields := make(map[string]interface{}, len(record.Fields))
+		for colId, value := range record.Fields {
+			if key, found := schema.idToKey[colId]; found {
+				colId = key
+			}
+			fields[colId] = value
+		}
+		records.Records[i].Fields = fields
+	}
+	return records, status
+}
+
+// AddRecordsByLabel is AddRecords with the fields keyed by column label, as
+// returned by GetRecordsByLabel. Keys that are not labels are sent as is, so
+// column ids are accepted too and unknown keys are reported by Grist
+func AddRecordsByLabel(docId string, tableId string, records []map[string]interface{}, options *AddRecordsOptions) (RecordsWithoutFields, int) {
+	schema, status := tableLabelSchema(docId, tableId)
+	if status != http.StatusOK {
+		return RecordsWithoutFields{}, status
+	}
+	translated := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		translated[i] = make(map[string]interface{}, len(record))
+		for key, value := range record {
+			if colId, found := schema.keyToId[key]; found {
+				key = colId
+			}
+			translated[i][key] = value
+		}
+	}
+	return AddRecords(docId, tableId, translated, options)
+}
+
+// InvalidRecordIdsError is returned when updating records without a
+// positive id, which Grist would reject or ignore
+type InvalidRecordIdsError struct {
+	Indexes []int // Positions of the invalid records in the slice
+}
+
+func (e *InvalidRecordIdsError) Error() string {
+	indexes := make([]string, len(e.Indexes))
+	for i, index := range e.Indexes {
+		indexes[i] = strconv.Itoa(index)
+	}
+	return "records without a positive id at indexes " + strings.Join(indexes, ", ")
+}
+
+// validateRecordIds returns an *InvalidRecordIdsError if some records have
+// no positive id
+func validateRecordIds(records []Record) error {
+	invalid := []int{}
+	for i, record := range records {
+		if record.Id <= 0 {
+			invalid = append(invalid, i)
+		}
+	}
+	if len(invalid) > 0 {
+		return &InvalidRecordIdsError{Indexes: invalid}
+	}
+	return nil
+}
+
+// UpdateRecords modifies records in a table
+// PATCH /docs/{docId}/tables/{tableId}/records
+// Returns status -1 without sending anything if docId or tableId is invalid,
+// if a record has no positive id (the message lists their indexes) or if the
+// records can't be encoded as JSON; the response is then the error message.
+// Returns -10 if no response was received. Use UpdateRecordsBatched to get
+// these failures as errors
+func UpdateRecords(docId string, tableId string, records []Record, options *UpdateRecordsOptions) (string, int) {
+	return defaultClient.UpdateRecords(docId, tableId, records, options)
+}
+
+// UpdateRecords modifies records in a table, see UpdateRecords
+func (c *Client) UpdateRecords(docId string, tableId string, records []Record, options *UpdateRecordsOptions) (string, int) {
+	response, status, _ := c.updateRecords(docId, tableId, records, options)
+	return response, status
+}
+
+// updateRecords modifies records with the default client, see Client.updateRecords
+func updateRecords(docId string, tableId string, records []Record, options *UpdateRecordsOptions) (string, int, error) {
+	return defaultClient.updateRecords(docId, tableId, records, options)
+}
+
+// updateRecords modifies records, also returning the request error. When
+// nothing is sent, the response is the error message and the status -1
+func (c *Client) updateRecords(docId string, tableId string, records []Record, options *UpdateRecordsOptions) (string, int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return err.Error(), -1, err
+	}
+	if err := validateRecordIds(records); err != nil {
+		return err.Error(), -1, err
+	}
+	params := make(map[string]string)
+
+	if options != nil && options.NoParse {
+		params["noparse"] = "true"
+	}
+
+	// Build request body
+	body := struct {
+		Records []Record `json:"records"`
+	}{Records: records}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		err = fmt.Errorf("encoding records: %w", err)
+		return err.Error(), -1, err
+	}
+
+	retry := RetryOptions{}
+	if options != nil {
+		retry = options.RetryOptions
+	}
+	url := fmt.Sprintf("docs/%s/tables/%s/records%s", docId, tableId, buildRecordsQueryParams(params))
+	response, status, err := c.requestWith("PATCH", url, bodyJSON, retry)
+	return response, status, checkResponse(status, response, err)
+}
+
+// UpsertRecords adds or updates records in a table (upsert)
+// PUT /docs/{docId}/tables/{tableId}/records
+// Returns status -1 without sending anything if docId or tableId is invalid
+// or the records can't be encoded as JSON; the response is then the error
+// message. Returns -10 if no response was received. Use
+// UpsertRecordsWithResults to get these failures as errors
+func UpsertRecords(docId string, tableId string, records []RecordWithRequire, options *UpsertRecordsOptions) (string, int) {
+	response, status, _ := upsertRecords(docId, tableId, records, options)
+	return response, status
+}
+
+// upsertRecords adds or updates records, also returning the request error.
+// When nothing is sent, the response is the error message and the status -1
+func upsertRecords(docId string, tableId string, records []RecordWithRequire, options *UpsertRecordsOptions) (string, int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return err.Error(), -1, err
+	}
+	params := make(map[string]string)
+
+	if options != nil {
+		if options.OnMany != "" {
+			params["onmany"] = options.OnMany
+		}
+		if options.NoAdd {
+			params["noadd"] = "true"
+		}
+		if options.NoUpdate {
+			params["noupdate"] = "true"
+		}
+		if options.AllowEmptyRequire {
+			params["allow_empty_require"] = "true"
+		}
+		if options.NoParse {
+			params["noparse"] = "true"
+		}
+	}
+
+	// Build request body
+	body := struct {
+		Records []RecordWithRequire `json:"records"`
+	}{Records: records}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		err = fmt.Errorf("encoding records: %w", err)
+		return err.Error(), -1, err
+	}
+
+	retry := RetryOptions{}
+	if options != nil {
+		retry = options.RetryOptions
+	}
+	url := fmt.Sprintf("docs/%s/tables/%s/records%s", docId, tableId, buildRecordsQueryParams(params))
+	response, status, err := defaultClient.requestWith("PUT", url, bodyJSON, retry)
+	return response, status, checkResponse(status, response, err)
+}
+
+// UpsertOutcome tells what an upsert did with a record
+type UpsertOutcome string
+
+const (
+	UpsertAdded   UpsertOutcome = "added"   // No record matched: one was added
+	UpsertUpdated UpsertOutcome = "updated" // The matching record(s) were updated
+	UpsertSkipped UpsertOutcome = "skipped" // Left alone by NoAdd, NoUpdate or OnMany "none"
+	UpsertError   UpsertOutcome = "error"   // The upsert failed
+)
+
+// UpsertResult is the outcome of upserting one record
+type UpsertResult struct {
+	Require map[string]interface{} // Require values of the input record
+	Outcome UpsertOutcome
+	Matches int   // Records matching Require before the upsert
+	Err     error // Set when Outcome is UpsertError
+}
+
+// UpsertRecordsWithResults upserts records like UpsertRecords and reports,
+// per input record and in the same order, whether it was added, updated or
+// skipped. Grist doesn't return this, so the records matching each Require
+// are counted beforehand, with one request per distinct set of Require
+// columns, and the outcome follows from the
+// options; a concurrent change of the table between both requests can make it
+// inaccurate. When the upsert fails, every record gets UpsertError and the
+// error is returned too
+// PUT /docs/{docId}/tables/{tableId}/records
+func UpsertRecordsWithResults(docId string, tableId string, records []RecordWithRequire, options *UpsertRecordsOptions) ([]UpsertResult, error) {
+	results := make([]UpsertResult, len(records))
+	for i, record := range records {
+		results[i] = UpsertResult{Require: record.Require}
+	}
+	fail := func(err error) ([]UpsertResult, error) {
+		for i := range results {
+			results[i].Outcome, results[i].Err = UpsertError, err
+		}
+		return results, err
+	}
+
+	if options == nil {
+		options = &UpsertRecordsOptions{}
+	}
+	// An empty Require matches every record with AllowEmptyRequire, and
+	// always adds a record otherwise. Grist ANDs the filter across columns,
+	// so records are fetched once per distinct set of Require columns
+	filters := map[string]map[string][]interface{}{}
+	keys := make([]string, len(records))
+	matchesAll := false
+	for i, record := range records {
+		keys[i] = requireColumns(record.Require)
+		if len(record.Require) == 0 {
+			matchesAll = matchesAll || options.AllowEmptyRequire
+			continue
+		}
+		if filters[keys[i]] == nil {
+			filters[keys[i]] = map[string][]interface{}{}
+		}
+		for colId, value := range record.Require {
+			filters[keys[i]][colId] = append(filters[keys[i]][colId], value)
+		}
+	}
+	if matchesAll {
+		filters = map[string]map[string][]interface{}{"": nil}
+	}
+	existing := map[string][]Record{}
+	for key, filter := range filters {
+		candidates, _, err := defaultClient.getRecords(docId, tableId, &GetRecordsOptions{Filter: filter})
+		if err != nil {
+			return fail(err)
+		}
+		existing[key] = candidates.Records
+	}
+	if matchesAll {
+		for _, key := range keys {
+			existing[key] = existing[""]
+		}
+	}
+
+	if _, _, err := upsertRecords(docId, tableId, records, options); err != nil {
+		return fail(err)
+	}
+
+	for i, record := range records {
+		if len(record.Require) > 0 || options.AllowEmptyRequire {
+			for _, candidate := range existing[keys[i]] {
+				if requireMatches(record.Require, candidate) {
+					results[i].Matches++
+				}
+			}
+		}
+		switch {
+		case results[i].Matches == 0 && options.NoAdd:
+			results[i].Outcome = UpsertSkipped
+		case results[i].Matches == 0:
+			results[i].Outcome = UpsertAdded
+		case options.NoUpdate, results[i].Matches > 1 && options.OnMany == "none":
+			results[i].Outcome = UpsertSkipped
+		default:
+			results[i].Outcome = UpsertUpdated
+		}
+	}
+	return results, nil
+}
+
+// requireColumns is the sorted, comma-separated list of the require columns
+func requireColumns(require map[string]interface{}) string {
+	colIds := make([]string, 0, len(require))
+	for colId := range require {
+		colIds = append(colIds, colId)
+	}
+	sort.Strings(colIds)
+	return strings.Join(colIds, ",")
+}
+
+// requireMatches tells whether a record has all the require values
+func requireMatches(require map[string]interface{}, record Record) bool {
+	for colId, value := range require {
+		if !valuesEqual(record.Fields[colId], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// DocMetadataKeyColumn is the column of a document registry table holding the document id
+const DocMetadataKeyColumn = "DocId"
+
+// UpsertDocMetadata records metadata about a document (owner, project...) in
+// a registry table of another document, adding the document's row or
+// updating it. The registry table needs a Text column "DocId" (see
+// DocMetadataKeyColumn) holding the document id, which identifies rows, plus
+// a column for each field, e.g. DocId | Owner | Project
+// PUT /docs/{metaDocId}/tables/{metaTableId}/records
+func UpsertDocMetadata(metaDocId string, metaTableId string, docId string, fields map[string]interface{}) (int, error) {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return -1, err
+	}
+	if _, ok := fields[DocMetadataKeyColumn]; ok {
+		return -1, fmt.Errorf("fields must not set the key column %s", DocMetadataKeyColumn)
+	}
+	record := RecordWithRequire{
+		Require: map[string]interface{}{DocMetadataKeyColumn: docId},
+		Fields:  fields,
+	}
+	_, status, err := upsertRecords(metaDocId, metaTableId, []RecordWithRequire{record}, nil)
+	return status, err
+}
+
+// DeleteRecords deletes records from a table
+// POST /docs/{docId}/tables/{tableId}/records/delete
+// Returns status -1 without sending anything if docId or tableId is invalid.
+// Use DeleteRecordsBatched to get the failures as errors
+func DeleteRecords(docId string, tableId string, recordIds []int) (string, int) {
+	return defaultClient.DeleteRecords(docId, tableId, recordIds)
+}
+
+// DeleteRecords deletes records from a table, see DeleteRecords
+func (c *Client) DeleteRecords(docId string, tableId string, recordIds []int) (string, int) {
+	response, status, _ := c.deleteRecords(docId, tableId, recordIds)
+	return response, status
+}
+
+// deleteRecords deletes records, also returning the request error. When
+// nothing is sent, the response is the error message and the status -1
+func (c *Client) deleteRecords(docId string, tableId string, recordIds []int) (string, int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return err.Error(), -1, err
+	}
+	bodyJSON, err := json.Marshal(recordIds)
+	if err != nil {
+		return "", -1, err
+	}
+
+	url := fmt.Sprintf("docs/%s/tables/%s/records/delete", docId, tableId)
+	response, status, err := c.httpPost(url, string(bodyJSON))
+	return response, status, checkResponse(status, response, err)
+}
+
+// Batched record operations
+// Large loads are split into several requests to stay under Grist's payload limits
+
+// DefaultBatchSize is the number of records sent per request by the batched helpers
+const DefaultBatchSize = 500
+
+// BatchOptions contains settings for the batched record helpers
+type BatchOptions struct {
+	BatchSize int  // Records per request (DefaultBatchSize when <= 0)
+	NoParse   bool // Don't parse strings into column types
+
+	// Send the remaining batches after a failing one, instead of stopping.
+	// The returned error then joins the errors of every failed batch
+	ContinueOnError bool
+}
+
+// size returns the effective batch size
+func (o *BatchOptions) size() int {
+	if o == nil || o.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return o.BatchSize
+}
+
+// continueOnError tells whether to send the batches following a failed one
+func (o *BatchOptions) continueOnError() bool {
+	return o != nil && o.ContinueOnError
+}
+
+// batchError describes the failure of one batch
+func batchError(index int, start int, end int, err error) error {
+	return fmt.Errorf("batch %d (records %d to %d): %w", index, start, end-1, err)
+}
+
+// AddRecordsBatched adds records to a table, BatchSize records per request.
+// Stops at the first failing batch and returns the ids added so far, unless
+// ContinueOnError is set: the ids of every successful batch are then returned
+func AddRecordsBatched(docId string, tableId string, records []map[string]interface{}, options *BatchOptions) (RecordsWithoutFields, error) {
+	result := RecordsWithoutFields{}
+	if err := validateDocTable(docId, tableId); err != nil {
+		return result, err
+	}
+	var addOptions *AddRecordsOptions
+	if options != nil && options.NoParse {
+		addOptions = &AddRecordsOptions{NoParse: true}
+	}
+
+	var errs []error
+	size := options.size()
+	for start := 0; start < len(records); start += size {
+		end := min(start+size, len(records))
+		added, _, err := defaultClient.addRecords(docId, tableId, records[start:end], addOptions)
+		if err != nil {
+			errs = append(errs, batchError(start/size, start, end, err))
+			if !options.continueOnError() {
+				break
+			}
+			continue
+		}
+		result.Records = append(result.Records, added.Records...)
+	}
+	return result, errors.Join(errs...)
+}
+
+// UpdateRecordsBatched modifies records of a table, BatchSize records per request.
+// Stops at the first failing batch and returns the number of records updated so far,
+// unless ContinueOnError is set. Nothing is sent if a record has no positive id (see InvalidRecordIdsError)
+func UpdateRecordsBatched(docId string, tableId string, records []Record, options *BatchOptions) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return 0, err
+	}
+	if err := validateRecordIds(records); err != nil {
+		return 0, err
+	}
+	var updateOptions *UpdateRecordsOptions
+	if options != nil && options.NoParse {
+		updateOptions = &UpdateRecordsOptions{NoParse: true}
+	}
+
+	updated := 0
+	var errs []error
+	size := options.size()
+	for start := 0; start < len(records); start += size {
+		end := min(start+size, len(records))
+		if _, _, err := updateRecords(docId, tableId, records[start:end], updateOptions); err != nil {
+			errs = append(errs, batchError(start/size, start, end, err))
+			if !options.continueOnError() {
+				break
+			}
+			continue
+		}
+		updated += end - start
+	}
+	return updated, errors.Join(errs...)
+}
+
+// DeleteRecordsBatched deletes records from a table, BatchSize ids per request.
+// Stops at the first failing batch and returns the number of records deleted so far,
+// unless ContinueOnError is set
+func DeleteRecordsBatched(docId string, tableId string, recordIds []int, options *BatchOptions) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var errs []error
+	size := options.size()
+	for start := 0; start < len(recordIds); start += size {
+		end := min(start+size, len(recordIds))
+		if _, _, err := defaultClient.deleteRecords(docId, tableId, recordIds[start:end]); err != nil {
+			errs = append(errs, batchError(start/size, start, end, err))
+			if !options.continueOnError() {
+				break
+			}
+			continue
+		}
+		deleted += end - start
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// UnmatchedKeysError lists the key values that matched no record
+type UnmatchedKeysError struct {
+	KeyColumn string
+	Keys      []interface{}
+}
+
+func (e *UnmatchedKeysError) Error() string {
+	return fmt.Sprintf("%d record(s) matched nothing on %s: %v", len(e.Keys), e.KeyColumn, e.Keys)
+}
+
+// UpdateRecordsByKey modifies records identified by the value of keyColumn
+// (a business key such as an email) instead of their numeric id.
+// Ids are resolved with a single filtered GET, then the records are PATCHed.
+// Records whose key matches several rows update all of them. Records whose key
+// matches nothing are skipped and reported through an *UnmatchedKeysError.
+// Returns the number of rows updated
+func UpdateRecordsByKey(docId string, tableId string, keyColumn string, records []map[string]interface{}) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]interface{}, 0, len(records))
+	for _, fields := range records {
+		keys = append(keys, fields[keyColumn])
+	}
+	existing, _, err := defaultClient.getRecords(docId, tableId, &GetRecordsOptions{
+		Filter: map[string][]interface{}{keyColumn: keys},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("resolving ids on %s: %w", keyColumn, err)
+	}
+
+	idsByKey := make(map[string][]int)
+	for _, record := range existing.Records {
+		key := fmt.Sprint(record.Fields[keyColumn])
+		idsByKey[key] = append(idsByKey[key], record.Id)
+	}
+
+	updates := []Record{}
+	unmatched := []interface{}{}
+	for _, fields := range records {
+		ids, found := idsByKey[fmt.Sprint(fields[keyColumn])]
+		if !found {
+			unmatched = append(unmatched, fields[keyColumn])
+			continue
+		}
+		for _, id := range ids {
+			updates = append(updates, Record{Id: id, Fields: fields})
+		}
+	}
+
+	updated, err := UpdateRecordsBatched(docId, tableId, updates, nil)
+	if err != nil {
+		return updated, err
+	}
+	if len(unmatched) > 0 {
+		return updated, &UnmatchedKeysError{KeyColumn: keyColumn, Keys: unmatched}
+	}
+	return updated, nil
+}
+
+// TouchRecords rewrites records with their current values, to nudge
+// formula recalculation (e.g. trigger formulas) without changing data.
+// Current values are fetched first and only data columns are written back.
+// Side effects: the rewrite is recorded in the document history, and
+// webhooks watching the table fire for the touched records.
+// Returns the number of records rewritten; fails without writing anything
+// if some ids do not exist
+func TouchRecords(docId string, tableId string, ids []int) (int, error) {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	columns, _, err := defaultClient.getTableColumns(docId, tableId)
+	if err != nil {
+		return 0, fmt.Errorf("fetching columns: %w", err)
+	}
+	dataColumns := []string{}
+	for _, column := range columns.Columns {
+		if !column.Fields.IsFormula {
+			dataColumns = append(dataColumns, column.Id)
+		}
+	}
+
+	filterIds := make([]interface{}, len(ids))
+	for i, id := range ids {
+		filterIds[i] = id
+	}
+	current, _, err := defaultClient.getRecords(docId, tableId, &GetRecordsOptions{
+		Filter: map[string][]interface{}{"id": filterIds},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("fetching records: %w", err)
+	}
+	found := make(map[int]bool, len(current.Records))
+	records := make([]Record, 0, len(current.Records))
+	for _, record := range current.Records {
+		found[record.Id] = true
+		fields := make(map[string]interface{}, len(dataColumns))
+		for _, column := range dataColumns {
+			if value, ok := record.Fields[column]; ok {
+				fields[column] = value
+			}
+		}
+		records = append(records, Record{Id: record.Id, Fields: fields})
+	}
+	missing := []string{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, strconv.Itoa(id))
+		}
+	}
+	if len(missing) > 0 {
+		return 0, fmt.Errorf("records not found in %s: %s", tableId, strings.Join(missing, ", "))
+	}
+
+	// Values are sent as read, they must not be parsed again
+	return UpdateRecordsBatched(docId, tableId, records, &BatchOptions{NoParse: true})
+}
+
+// ReplaceRecordsOptions contains settings for ReplaceAllRecords
+type ReplaceRecordsOptions struct {
+	BatchSize int    // Records per request (DefaultBatchSize when <= 0)
+	KeyColumn string // When set, update records in place by matching this column instead of truncating
+}
+
+// ReplaceResult reports what ReplaceAllRecords changed
+type ReplaceResult struct {
+	Added   RecordsWithoutFields // Ids of the records added
+	Updated int                  // Number of records updated in place
+	Deleted int                  // Number of records deleted
+}
+
+// ReplaceAllRecords makes the content of a table match the given records.
+// By default, every existing record is deleted and the new set is added
+// (truncate then load). With KeyColumn, records are matched on that column:
+// changed ones are updated, missing ones added and the others deleted, which
+// keeps record ids stable.
+// This is not transactional: Grist applies each batch separately, so a failure
+// midway leaves the table partially replaced
+func ReplaceAllRecords(docId string, tableId string, records []map[string]interface{}, options *ReplaceRecordsOptions) (ReplaceResult, error) {
+	result := ReplaceResult{}
+	if err := validateDocTable(docId, tableId); err != nil {
+		return result, err
+	}
+	batchOptions := &BatchOptions{}
+	if options != nil {
+		batchOptions.BatchSize = options.BatchSize
+	}
+
+	existing, _, err := defaultClient.getRecords(docId, tableId, nil)
+	if err != nil {
+		return result, fmt.Errorf("fetching existing records: %w", err)
+	}
+
+	toAdd := records
+	toUpdate := []Record{}
+	toDelete := []int{}
+	if options != nil && options.KeyColumn != "" {
+		toAdd, toUpdate, toDelete = diffRecords(existing.Records, records, options.KeyColumn)
+	} else {
+		for _, record := range existing.Records {
+			toDelete = append(toDelete, record.Id)
+		}
+	}
+
+	if result.Deleted, err = DeleteRecordsBatched(docId, tableId, toDelete, batchOptions); err != nil {
+		return result, fmt.Errorf("deleting records: %w", err)
+	}
+	if result.Updated, err = UpdateRecordsBatched(docId, tableId, toUpdate, batchOptions); err != nil {
+		return result, fmt.Errorf("updating records: %w", err)
+	}
+	if result.Added, err = AddRecordsBatched(docId, tableId, toAdd, batchOptions); err != nil {
+		return result, fmt.Errorf("adding records: %w", err)
+	}
+	return result, nil
+}
+
+// SyncPlan lists the changes making a table match a desired set of records,
+// as computed by PlanSync, to be reviewed then executed with ApplyPlan
+type SyncPlan struct {
+	DocId     string
+	TableId   string
+	KeyColumn string
+	Add       []map[string]interface{} // Desired records matching no existing one
+	Update    []Record                 // Existing records, with only their changed fields
+	Delete    []Record                 // Existing records matching no desired one
+}
+
+// PlanSync compares desired records with the content of a table, matching
+// them on keyColumn, without changing anything
+func PlanSync(docId string, tableId string, keyColumn string, desired []map[string]interface{}) (SyncPlan, error) {
+	plan := SyncPlan{DocId: docId, TableId: tableId, KeyColumn: keyColumn}
+	if err := validateDocTable(docId, tableId); err != nil {
+		return plan, err
+	}
+	if keyColumn == "" {
+		return plan, errors.New("a key column is required")
+	}
+	existing, _, err := defaultClient.getRecords(docId, tableId, nil)
+	if err != nil {
+		return plan, fmt.Errorf("fetching existing records: %w", err)
+	}
+	var deleteIds []int
+	plan.Add, plan.Update, deleteIds = diffRecords(existing.Records, desired, keyColumn)
+	deleted := make(map[int]bool, len(deleteIds))
+	for _, id := range deleteIds {
+		deleted[id] = true
+	}
+	plan.Delete = []Record{}
+	for _, record := range existing.Records {
+		if deleted[record.Id] {
+			plan.Delete = append(plan.Delete, record)
+		}
+	}
+	return plan, nil
+}
+
+// ApplyPlan executes a plan computed by PlanSync with the batched helpers:
+// deletions, then updates, then additions. Like ReplaceAllRecords, it is not
+// transactional, and changes made to the table since the plan was computed
+// are not taken into account
+func ApplyPlan(plan SyncPlan) (ReplaceResult, error) {
+	result := ReplaceResult{}
+	deleteIds := make([]int, len(plan.Delete))
+	for i, record := range plan.Delete {
+		deleteIds[i] = record.Id
+	}
+	var err error
+	if result.Deleted, err = DeleteRecordsBatched(plan.DocId, plan.TableId, deleteIds, nil); err != nil {
+		return result, fmt.Errorf("deleting records: %w", err)
+	}
+	if result.Updated, err = UpdateRecordsBatched(plan.DocId, plan.TableId, plan.Update, nil); err != nil {
+		return result, fmt.Errorf("updating records: %w", err)
+	}
+	if result.Added, err = AddRecordsBatched(plan.DocId, plan.TableId, plan.Add, nil); err != nil {
+		return result, fmt.Errorf("adding records: %w", err)
+	}
+	return result, nil
+}
+
+// diffRecords matches desired records with existing ones on keyColumn and
+// returns the records to add, to update (with their existing id and their
+// changed fields only) and the ids to delete
+func diffRecords(existing []Record, desired []map[string]interface{}, keyColumn string) ([]map[string]interface{}, []Record, []int) {
+	byKey := make(map[string]Record, len(existing))
+	for _, record := range existing {
+		byKey[fmt.Sprint(record.Fields[keyColumn])] = record
+	}
+
+	toAdd := []map[string]interface{}{}
+	toUpdate := []Record{}
+	matched := make(map[int]bool, len(desired))
+	for _, fields := range desired {
+		current, found := byKey[fmt.Sprint(fields[keyColumn])]
+		if !found || matched[current.Id] {
+			toAdd = append(toAdd, fields)
+			continue
+		}
+		matched[current.Id] = true
+		if changed := changedFields(fields, current.Fields); len(changed) > 0 {
+			toUpdate = append(toUpdate, Record{Id: current.Id, Fields: changed})
+		}
+	}
+
+	toDelete := []int{}
+	for _, record := range existing {
+		if !matched[record.Id] {
+			toDelete = append(toDelete, record.Id)
+		}
+	}
+	return toAdd, toUpdate, toDelete
+}
+
+// changedFields returns the fields of want whose value differs in have
+func changedFields(want map[string]interface{}, have map[string]interface{}) map[string]interface{} {
+	changed := map[string]interface{}{}
+	for column, value := range want {
+		if !valuesEqual(value, have[column]) {
+			changed[column] = value
+		}
+	}
+	return changed
+}
+
+// RecordFieldsEqual reports whether two records' fields hold the same values,
+// as Grist stores them: numbers are equal whatever their Go type (int, float64,
+// json.Number), and a missing field equals a nil (null) one
+func RecordFieldsEqual(a map[string]interface{}, b map[string]interface{}) bool {
+	for column, value := range a {
+		if !valuesEqual(value, b[column]) {
+			return false
+		}
+	}
+	for column, value := range b {
+		if _, found := a[column]; !found && value != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesEqual compares two cell values after normalizing their numbers
+func valuesEqual(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(normalizeValue(a), normalizeValue(b))
+}
+
+// normalizeValue converts numbers to int64 when they are integers and to
+// float64 otherwise, recursively in lists and objects
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return normalizeFloat(float64(v))
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return normalizeFloat(float64(v))
+	case float32:
+		return normalizeFloat(float64(v))
+	case float64:
+		return normalizeFloat(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return normalizeFloat(f)
+		}
+		return v.String()
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized[i] = normalizeValue(item)
+		}
+		return normalized
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			normalized[key] = normalizeValue(item)
+		}
+		return normalized
 	}
+	return value
 }
 
-// Move a document in a workspace
-func MoveDoc(docId string, workspaceId int) {
-	url := "docs/" + docId + "/move"
-	data := fmt.Sprintf(`{"workspace": "%d"}`, workspaceId)
-	_, status := httpPatch(url, data)
-	if status == http.StatusOK {
-		fmt.Printf("Document moved to workspace %d ✅\n", workspaceId)
-	} else {
-		fmt.Printf("Unable to move document")
+func normalizeFloat(f float64) interface{} {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return int64(f)
 	}
+	return f
 }
 
-// Purge a document's history, to retain only the last modifications
-func PurgeDoc(docId string, nbHisto int) {
-	url := "docs/" + docId + "/states/remove"
-	data := fmt.Sprintf(`{"keep": "%d"}`, nbHisto)
-	_, status := httpPost(url, data)
-	if status == http.StatusOK {
-		fmt.Printf("History cleared (%d last states) ✅\n", nbHisto)
-	}
+// SQL APIs
+// Grist's /sql endpoint runs read-only SELECT statements on a document.
+// Values are best passed as "?" parameters; identifiers can't be, so safe
+// helpers build the clauses naming columns: OrderBy for sorting
+
+// QuerySQL runs a read-only SQL query on a document, with optional "?" parameters.
+// The "id" column, when selected, is returned as the record id
+// POST /docs/{docId}/sql
+func QuerySQL(docId string, query string, args []interface{}) (RecordsList, int) {
+	return defaultClient.QuerySQL(docId, query, args)
 }
 
-// Import a list of user & role into a workspace
-// Search workspace by name in org
-func ImportUsers(orgId int, workspaceName string, users []UserRole) {
-	lstWorkspaces := GetOrgWorkspaces(orgId)
-	idWorkspace := 0
-	for _, ws := range lstWorkspaces {
-		if ws.Name == workspaceName {
-			idWorkspace = ws.Id
-		}
+// QuerySQL runs a SQL query on a document, see QuerySQL
+func (c *Client) QuerySQL(docId string, query string, args []interface{}) (RecordsList, int) {
+	records, status, _ := c.querySQL(docId, query, args, false)
+	return records, status
+}
+
+// CountRecords returns the number of records of a table with a SQL COUNT
+// query, without downloading them
+func CountRecords(docId string, tableId string) (int, int) {
+	count, status, _ := countRecords(docId, tableId)
+	return count, status
+}
+
+// countRecords counts the records of a table, also returning the request error
+func countRecords(docId string, tableId string) (int, int, error) {
+	result, status, err := defaultClient.querySQL(docId, "SELECT COUNT(*) AS count FROM "+quoteIdentifier(tableId), nil, false)
+	if err != nil {
+		return 0, status, err
+	}
+	if len(result.Records) != 1 {
+		return 0, -1, errors.New("unexpected COUNT result")
 	}
+	count, ok := result.Records[0].GetInt("count")
+	if !ok {
+		return 0, -1, errors.New("unexpected COUNT result")
+	}
+	return int(count), status, nil
+}
 
-	if idWorkspace == 0 {
-		idWorkspace = CreateWorkspace(orgId, workspaceName)
+// querySQL runs a SQL query, optionally decoding numbers as json.Number,
+// also returning the request error
+func (c *Client) querySQL(docId string, query string, args []interface{}, useNumber bool) (RecordsList, int, error) {
+	records := RecordsList{Records: []Record{}}
+	if err := validatePathSegment("docId", docId); err != nil {
+		return records, -1, err
+	}
+	body := map[string]interface{}{"sql": query}
+	if len(args) > 0 {
+		body["args"] = args
+	}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return records, -1, err
 	}
-	if idWorkspace == 0 {
-		fmt.Printf("Unable to create workspace %s\n", workspaceName)
-	} else {
-		url := fmt.Sprintf("workspaces/%d/access", idWorkspace)
 
-		roleLine := []string{}
-		for _, role := range users {
-			roleLine = append(roleLine, fmt.Sprintf(`"%s": "%s"`, role.Email, role.Role))
+	url := fmt.Sprintf("docs/%s/sql", docId)
+	response, status, err := c.httpPost(url, string(bodyJSON))
+	if status == http.StatusOK {
+		result := struct {
+			Records []struct {
+				Fields map[string]interface{} `json:"fields"`
+			} `json:"records"`
+		}{}
+		decodeJSON(response, &result, useNumber)
+		for _, row := range result.Records {
+			record := Record{Fields: row.Fields}
+			if id, ok := record.GetInt("id"); ok {
+				record.Id = int(id)
+				delete(record.Fields, "id")
+			}
+			records.Records = append(records.Records, record)
 		}
-		patch := fmt.Sprintf(`{	"delta": { "users": {%s}}}`, strings.Join(roleLine, ","))
+	}
+	return records, status, checkResponse(status, response, err)
+}
 
-		body, status := httpPatch(url, patch)
+// quoteIdentifier quotes a table or column id for use in SQL
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
 
-		var result string
-		if status == http.StatusOK {
-			result = "✅"
+// sqlOrderBy converts a records API sort ("name,-age") to an ORDER BY clause
+func sqlOrderBy(sortSpec string) string {
+	terms := []string{}
+	for _, column := range strings.Split(sortSpec, ",") {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			continue
+		}
+		if strings.HasPrefix(column, "-") {
+			terms = append(terms, quoteIdentifier(column[1:])+" DESC")
 		} else {
-			result = fmt.Sprintf("❗️ (%s)", body)
+			terms = append(terms, quoteIdentifier(column))
 		}
-		fmt.Printf("Import %d users in workspace n°%d\t : %s\n", len(users), idWorkspace, result)
 	}
+	if len(terms) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
 
+// ErrUnknownColumn is returned by the safe query helpers for a column
+// missing from the table
+var ErrUnknownColumn = errors.New("unknown column")
+
+// SortColumn is a term of an ORDER BY clause built by OrderBy
+type SortColumn struct {
+	Column string
+	Desc   bool
 }
 
-// Create an organization
-func CreateOrg(orgName string, orgDomain string) int {
-	url := fmt.Sprintf("orgs")
-	data := fmt.Sprintf(`{"name":"%s", "domain":"%s"}`, orgName, orgDomain)
-	body, status := httpPost(url, data)
-	idOrg := 0
-	if status == http.StatusOK {
-		id, err := strconv.Atoi(body)
-		if err == nil {
-			idOrg = id
+// Asc sorts by a column in ascending order
+func Asc(column string) SortColumn {
+	return SortColumn{Column: column}
+}
+
+// Desc sorts by a column in descending order
+func Desc(column string) SortColumn {
+	return SortColumn{Column: column, Desc: true}
+}
+
+// OrderBy builds an ORDER BY clause (with a leading space) to append to a
+// query passed to QuerySQL, e.g.
+//
+//	orderBy, err := OrderBy(docId, "People", Desc("Age"), Asc("Name"))
+//	records, status := QuerySQL(docId, `SELECT * FROM "People"`+orderBy, nil)
+//
+// The columns are checked against the table's schema, so that they can't
+// inject SQL, and quoted: an unknown column gives ErrUnknownColumn. "id" and
+// "manualSort" are always accepted. No column gives ""
+func OrderBy(docId string, tableId string, columns ...SortColumn) (string, error) {
+	return defaultClient.OrderBy(docId, tableId, columns...)
+}
+
+// OrderBy builds an ORDER BY clause checked against a table, see OrderBy
+func (c *Client) OrderBy(docId string, tableId string, columns ...SortColumn) (string, error) {
+	if len(columns) == 0 {
+		return "", nil
+	}
+	if err := validateDocTable(docId, tableId); err != nil {
+		return "", err
+	}
+	schema, _, err := c.getTableColumns(docId, tableId)
+	if err != nil {
+		return "", err
+	}
+	known := map[string]bool{"id": true, "manualSort": true}
+	for _, column := range schema.Columns {
+		known[column.Id] = true
+	}
+	terms := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !known[column.Column] {
+			return "", fmt.Errorf("%w: %s has no column %q", ErrUnknownColumn, tableId, column.Column)
 		}
+		term := quoteIdentifier(column.Column)
+		if column.Desc {
+			term += " DESC"
+		}
+		terms = append(terms, term)
 	}
-	return idOrg
+	return " ORDER BY " + strings.Join(terms, ", "), nil
 }
 
-// Create a workspace in an organization
-func CreateWorkspace(orgId int, workspaceName string) int {
-	url := fmt.Sprintf("orgs/%d/workspaces", orgId)
-	data := fmt.Sprintf(`{"name":"%s"}`, workspaceName)
-	body, status := httpPost(url, data)
-	idWorkspace := 0
-	if status == http.StatusOK {
-		id, err := strconv.Atoi(body)
-		if err == nil {
-			idWorkspace = id
+// recordsSQL builds a SELECT of columns (all when empty) on a table applying
+// the filter, sort and limit of options, in addition to the given conditions
+func recordsSQL(tableId string, columns []string, options *GetRecordsOptions, conditions []string, args []interface{}) (string, []interface{}) {
+	if options != nil {
+		filtered := make([]string, 0, len(options.Filter))
+		for column := range options.Filter {
+			filtered = append(filtered, column)
+		}
+		sort.Strings(filtered)
+		for _, column := range filtered {
+			values := options.Filter[column]
+			if len(values) == 0 {
+				continue
+			}
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+			conditions = append(conditions, fmt.Sprintf("%s IN (%s)", quoteIdentifier(column), placeholders))
+			args = append(args, values...)
 		}
 	}
-	return idWorkspace
+
+	selected := "*"
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = quoteIdentifier(column)
+		}
+		selected = strings.Join(quoted, ", ")
+	}
+	query := "SELECT " + selected + " FROM " + quoteIdentifier(tableId)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if options != nil {
+		query += sqlOrderBy(options.Sort)
+		if options.Limit > 0 {
+			query += fmt.Sprintf(" LIMIT %d", options.Limit)
+		}
+	}
+	return query, args
 }
 
-// Export doc in Grist format (Sqlite) in fileName file
-func ExportDocGrist(docId string, fileName string) {
-	url := fmt.Sprintf("docs/%s/download", docId)
-	export, returnCode := httpGet(url, "")
-	if returnCode == http.StatusOK {
-		// #nosec G304 - fileName is user-provided CLI argument for export destination
-		f, e := os.Create(fileName)
-		if e != nil {
-			panic(e)
-		}
-		defer func() {
-			if err := f.Close(); err != nil {
-				log.Printf("Error closing file: %v", err)
+// IterateRecordsKeyset reads a whole table page by page, calling fn on each
+// page of DefaultBatchSize records, ordered by keyColumn.
+// Pages are selected with "WHERE key > lastSeen", which stays fast on huge
+// tables where deep offsets do not. keyColumn must be unique and monotonic
+// (e.g. "id" or a creation timestamp); records with an empty key are skipped.
+// The SQL endpoint only selects the ids of each page: the records themselves
+// come from the records API, encoded as by GetRecords. If the SQL endpoint is
+// unavailable (HTTP 403 or 404, e.g. for documents with access rules), the
+// whole table is fetched at once, sorted by keyColumn, with a warning.
+// Iteration stops at the first error, returned as is when it comes from fn
+func IterateRecordsKeyset(docId string, tableId string, keyColumn string, fn func([]Record) error) error {
+	if err := validateDocTable(docId, tableId); err != nil {
+		return err
+	}
+	if err := validatePathSegment("keyColumn", keyColumn); err != nil {
+		return err
+	}
+	key := quoteIdentifier(keyColumn)
+	columns := []string{"id"}
+	if keyColumn != "id" {
+		columns = append(columns, keyColumn)
+	}
+	var lastSeen interface{}
+	for {
+		conditions := []string{key + " IS NOT NULL"}
+		args := []interface{}{}
+		if lastSeen != nil {
+			conditions = append(conditions, key+" > ?")
+			args = append(args, lastSeen)
+		}
+		query, args := recordsSQL(tableId, columns, &GetRecordsOptions{Sort: keyColumn, Limit: DefaultBatchSize}, conditions, args)
+		keys, status, err := defaultClient.querySQL(docId, query, args, true)
+		if lastSeen == nil && (status == http.StatusForbidden || status == http.StatusNotFound) {
+			return iterateRecordsUnpaged(docId, tableId, keyColumn, status, fn)
+		}
+		if err != nil {
+			return err
+		}
+		if len(keys.Records) == 0 {
+			return nil
+		}
+		ids := make([]int, len(keys.Records))
+		for i, record := range keys.Records {
+			ids[i] = record.Id
+		}
+		page, _, err := defaultClient.recordsByIds(docId, tableId, ids, nil)
+		if err != nil {
+			return err
+		}
+		if len(page) > 0 {
+			if err := fn(page); err != nil {
+				return err
 			}
-		}()
-		if _, err := fmt.Fprintln(f, export); err != nil {
-			log.Printf("Error writing to file: %v", err)
+		}
+		last := keys.Records[len(keys.Records)-1]
+		if keyColumn == "id" {
+			lastSeen = last.Id
+		} else {
+			lastSeen = last.Fields[keyColumn]
+		}
+		if len(keys.Records) < DefaultBatchSize {
+			return nil
 		}
 	}
 }
 
-// Export doc in Excel format (XLSX) in fileName file
-func ExportDocExcel(docId string, fileName string) {
-	url := fmt.Sprintf("docs/%s/download/xlsx", docId)
-	export, returnCode := httpGet(url, "")
-	if returnCode == http.StatusOK {
-		// #nosec G304 - fileName is user-provided CLI argument for export destination
-		f, e := os.Create(fileName)
-		if e != nil {
-			panic(e)
-		}
-		defer func() {
-			if err := f.Close(); err != nil {
-				log.Printf("Error closing file: %v", err)
-			}
-		}()
-		if _, err := fmt.Fprintln(f, export); err != nil {
-			log.Printf("Error writing to file: %v", err)
+// iterateRecordsUnpaged is the fallback of IterateRecordsKeyset without the
+// SQL endpoint: the table is fetched sorted by keyColumn, then split in pages
+func iterateRecordsUnpaged(docId string, tableId string, keyColumn string, status int, fn func([]Record) error) error {
+	log.Printf("Warning: SQL endpoint unavailable on %s (HTTP %d), reading %s at once: all its records are downloaded", docId, status, tableId)
+	all, _, err := defaultClient.getRecords(docId, tableId, &GetRecordsOptions{Sort: keyColumn})
+	if err != nil {
+		return err
+	}
+	records := all.Records
+	if keyColumn != "id" {
+		records = slices.DeleteFunc(records, func(record Record) bool { return record.Fields[keyColumn] == nil })
+	}
+	for len(records) > 0 {
+		page := records[:min(DefaultBatchSize, len(records))]
+		if err := fn(page); err != nil {
+			return err
+		}
+		records = records[len(page):]
+	}
+	return nil
+}
+
+// Records fetched per request by recordsByIds, keeping the ?filter= parameter
+// listing their ids well within URL length limits
+const recordsByIdsBatch = 200
+
+// recordsByIds fetches records by id through the records API, in the order
+// of ids. The records API is used rather than the SQL endpoint, which returns
+// storage values (0/1 for Bool, JSON text for ChoiceList and RefList, helper
+// columns such as manualSort) instead of the encoding of GetRecords. Only the
+// Hidden and UseNumber options apply; records deleted meanwhile are missing
+func (c *Client) recordsByIds(docId string, tableId string, ids []int, options *GetRecordsOptions) ([]Record, int, error) {
+	found := make(map[int]Record, len(ids))
+	status := http.StatusOK
+	for start := 0; start < len(ids); start += recordsByIdsBatch {
+		batch := ids[start:min(start+recordsByIdsBatch, len(ids))]
+		values := make([]interface{}, len(batch))
+		for i, id := range batch {
+			values[i] = id
+		}
+		byIds := GetRecordsOptions{Filter: map[string][]interface{}{"id": values}}
+		if options != nil {
+			byIds.Hidden, byIds.UseNumber = options.Hidden, options.UseNumber
+		}
+		page, pageStatus, err := c.getRecords(docId, tableId, &byIds)
+		status = pageStatus
+		if err != nil {
+			return nil, status, err
+		}
+		for _, record := range page.Records {
+			found[record.Id] = record
+		}
+	}
+	records := make([]Record, 0, len(ids))
+	for _, id := range ids {
+		if record, ok := found[id]; ok {
+			records = append(records, record)
 		}
 	}
+	return records, status, nil
 }
 
-// Returns table content as Dataframe
-func GetTableContent(docId string, tableName string) {
-	url := fmt.Sprintf("docs/%s/download/csv?tableId=%s", docId, tableName)
-	csvFile, _ := httpGet(url, "")
-	fmt.Println(csvFile)
+// Grist stores Date and DateTime cells as seconds since the Unix epoch
+func timeToGrist(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
 }
 
-// Retrieves information on a specific organization
-func GetOrgUsageSummary(orgId string) OrgUsage {
-	usage := OrgUsage{}
-	response, _ := httpGet("orgs/"+orgId+"/usage", "")
-	json.Unmarshal([]byte(response), &usage)
-	return usage
+func gristToTime(seconds float64) time.Time {
+	whole := int64(seconds)
+	return time.Unix(whole, int64((seconds-float64(whole))*1e9)).UTC()
 }
 
-// buildRecordsQueryParams builds the query string for records API endpoints
-func buildRecordsQueryParams(params map[string]string) string {
-	if len(params) == 0 {
-		return ""
+// condition combines Where and UpdatedSince into a single expression, nil if none
+func (o *GetRecordsOptions) condition() (*FilterExpr, error) {
+	if o.UpdatedSince.IsZero() {
+		return o.Where, nil
 	}
-	parts := []string{}
-	for key, value := range params {
-		if value != "" {
-			parts = append(parts, fmt.Sprintf("%s=%s", key, value))
-		}
+	if o.UpdatedColumn == "" {
+		return nil, errors.New("UpdatedSince requires an UpdatedColumn")
 	}
-	if len(parts) == 0 {
-		return ""
+	since := Gt(o.UpdatedColumn, timeToGrist(o.UpdatedSince))
+	if o.Where == nil {
+		return &since, nil
 	}
-	return "?" + strings.Join(parts, "&")
+	combined := And(since, *o.Where)
+	return &combined, nil
 }
 
-// GetRecords fetches records from a table
-// GET /docs/{docId}/tables/{tableId}/records
-func GetRecords(docId string, tableId string, options *GetRecordsOptions) (RecordsList, int) {
-	records := RecordsList{}
-	params := make(map[string]string)
-
-	if options != nil {
-		if options.Filter != nil {
-			filterJSON, err := json.Marshal(options.Filter)
-			if err == nil {
-				params["filter"] = string(filterJSON)
-			}
-		}
-		if options.Sort != "" {
-			params["sort"] = options.Sort
+// getRecordsWhere selects the ids of the records matching a condition through
+// the SQL endpoint, then fetches the records through the records API (see
+// recordsByIds), so that their fields are encoded as without a condition.
+// Records fetched with UpdatedSince are sorted by UpdatedColumn unless
+// another sort is given.
+// If the SQL endpoint is unavailable (HTTP 403 or 404, e.g. for documents with
+// access rules or older Grist versions), all records are fetched and filtered
+// client-side, with a performance warning
+func (c *Client) getRecordsWhere(docId string, tableId string, options *GetRecordsOptions, where FilterExpr) (RecordsList, int, error) {
+	sorted := *options
+	if sorted.Sort == "" && !options.UpdatedSince.IsZero() {
+		sorted.Sort = options.UpdatedColumn
+	}
+	conditions, args := []string{}, []interface{}{}
+	for _, term := range where.terms() {
+		condition, termArgs := term.sql()
+		conditions = append(conditions, condition)
+		args = append(args, termArgs...)
+	}
+	query, args := recordsSQL(tableId, []string{"id"}, &sorted, conditions, args)
+	matching, status, err := c.querySQL(docId, query, args, false)
+	if status != http.StatusForbidden && status != http.StatusNotFound {
+		if err != nil {
+			return matching, status, err
 		}
-		if options.Limit > 0 {
-			params["limit"] = strconv.Itoa(options.Limit)
+		ids := make([]int, len(matching.Records))
+		for i, record := range matching.Records {
+			ids[i] = record.Id
 		}
-		if options.Hidden {
-			params["hidden"] = "true"
+		found, status, err := c.recordsByIds(docId, tableId, ids, options)
+		if err != nil {
+			return RecordsList{Records: []Record{}}, status, err
 		}
+		return RecordsList{Records: found}, status, nil
 	}
 
-	url := fmt.Sprintf("docs/%s/tables/%s/records%s", docId, tableId, buildRecordsQueryParams(params))
-	response, status := httpGet(url, "")
-	if status == http.StatusOK {
-		json.Unmarshal([]byte(response), &records)
+	log.Printf("Warning: SQL endpoint unavailable on %s (HTTP %d), filtering %s client-side: all its records are downloaded", docId, status, tableId)
+	unfiltered := sorted
+	unfiltered.Where, unfiltered.UpdatedSince, unfiltered.Limit = nil, time.Time{}, 0
+	all, status, err := c.getRecords(docId, tableId, &unfiltered)
+	if err != nil {
+		return all, status, err
 	}
-	return records, status
+	records := RecordsList{Records: []Record{}}
+	for _, record := range all.Records {
+		if options.Limit > 0 && len(records.Records) == options.Limit {
+			break
+		}
+		if where.Match(record.Fields) {
+			records.Records = append(records.Records, record)
+		}
+	}
+	return records, status, nil
 }
 
-// AddRecords adds records to a table
-// POST /docs/{docId}/tables/{tableId}/records
-func AddRecords(docId string, tableId string, records []map[string]interface{}, options *AddRecordsOptions) (RecordsWithoutFields, int) {
-	result := RecordsWithoutFields{}
-	params := make(map[string]string)
+// FilterExpr is a condition on the fields of records, built with Eq, Ne, Lt,
+// Le, Gt, Ge, Contains, And and Or, and used through GetRecordsOptions.Where.
+// Conditions made only of Eq (on distinct columns) are pushed down to Grist's
+// ?filter= parameter, which ANDs its columns; the others, including any Or
+// (e.g. name = X OR email = Y), are translated to SQL, or evaluated
+// client-side when the SQL endpoint is unavailable
+type FilterExpr struct {
+	op       string // "in", "!=", "<", "<=", ">", ">=", "contains", "and" or "or"
+	column   string
+	values   []interface{}
+	children []FilterExpr
+}
 
-	if options != nil && options.NoParse {
-		params["noparse"] = "true"
-	}
+// Eq matches records whose column equals one of the values
+func Eq(column string, values ...interface{}) FilterExpr {
+	return FilterExpr{op: "in", column: column, values: values}
+}
 
-	// Build request body
-	body := struct {
-		Records []struct {
-			Fields map[string]interface{} `json:"fields"`
-		} `json:"records"`
-	}{}
-	for _, fields := range records {
-		body.Records = append(body.Records, struct {
-			Fields map[string]interface{} `json:"fields"`
-		}{Fields: fields})
-	}
+// Ne matches records whose column differs from value
+func Ne(column string, value interface{}) FilterExpr {
+	return FilterExpr{op: "!=", column: column, values: []interface{}{value}}
+}
 
-	bodyJSON, err := json.Marshal(body)
-	if err != nil {
-		return result, -1
-	}
+// Lt matches records whose column is lower than value
+func Lt(column string, value interface{}) FilterExpr {
+	return FilterExpr{op: "<", column: column, values: []interface{}{value}}
+}
 
-	url := fmt.Sprintf("docs/%s/tables/%s/records%s", docId, tableId, buildRecordsQueryParams(params))
-	response, status := httpPost(url, string(bodyJSON))
-	if status == http.StatusOK {
-		json.Unmarshal([]byte(response), &result)
-	}
-	return result, status
+// Le matches records whose column is lower than or equal to value
+func Le(column string, value interface{}) FilterExpr {
+	return FilterExpr{op: "<=", column: column, values: []interface{}{value}}
 }
 
-// UpdateRecords modifies records in a table
-// PATCH /docs/{docId}/tables/{tableId}/records
-func UpdateRecords(docId string, tableId string, records []Record, options *UpdateRecordsOptions) (string, int) {
-	params := make(map[string]string)
+// Gt matches records whose column is greater than value
+func Gt(column string, value interface{}) FilterExpr {
+	return FilterExpr{op: ">", column: column, values: []interface{}{value}}
+}
 
-	if options != nil && options.NoParse {
-		params["noparse"] = "true"
-	}
+// Ge matches records whose column is greater than or equal to value
+func Ge(column string, value interface{}) FilterExpr {
+	return FilterExpr{op: ">=", column: column, values: []interface{}{value}}
+}
 
-	// Build request body
-	body := struct {
-		Records []Record `json:"records"`
-	}{Records: records}
+// Contains matches records whose text column contains text (case-sensitive)
+func Contains(column string, text string) FilterExpr {
+	return FilterExpr{op: "contains", column: column, values: []interface{}{text}}
+}
 
-	bodyJSON, err := json.Marshal(body)
-	if err != nil {
-		return "", -1
-	}
+// And matches records matching all the expressions
+func And(exprs ...FilterExpr) FilterExpr {
+	return FilterExpr{op: "and", children: exprs}
+}
 
-	url := fmt.Sprintf("docs/%s/tables/%s/records%s", docId, tableId, buildRecordsQueryParams(params))
-	response, status := httpPatch(url, string(bodyJSON))
-	return response, status
+// Or matches records matching any of the expressions
+func Or(exprs ...FilterExpr) FilterExpr {
+	return FilterExpr{op: "or", children: exprs}
 }
 
-// UpsertRecords adds or updates records in a table (upsert)
-// PUT /docs/{docId}/tables/{tableId}/records
-func UpsertRecords(docId string, tableId string, records []RecordWithRequire, options *UpsertRecordsOptions) (string, int) {
-	params := make(map[string]string)
+// terms returns the expressions ANDed at the top level
+func (e FilterExpr) terms() []FilterExpr {
+	if e.op != "and" {
+		return []FilterExpr{e}
+	}
+	terms := []FilterExpr{}
+	for _, child := range e.children {
+		terms = append(terms, child.terms()...)
+	}
+	return terms
+}
 
-	if options != nil {
-		if options.OnMany != "" {
-			params["onmany"] = options.OnMany
+// pushdown merges the expression into a ?filter= map, which only supports
+// membership tests ANDed on distinct columns. ok is false if it cannot,
+// e.g. for an Or
+func (e FilterExpr) pushdown(filter map[string][]interface{}) (map[string][]interface{}, bool) {
+	merged := make(map[string][]interface{}, len(filter))
+	for column, values := range filter {
+		merged[column] = values
+	}
+	for _, term := range e.terms() {
+		if term.op != "in" {
+			return nil, false
 		}
-		if options.NoAdd {
-			params["noadd"] = "true"
+		if _, found := merged[term.column]; found {
+			return nil, false
 		}
-		if options.NoUpdate {
-			params["noupdate"] = "true"
+		merged[term.column] = term.values
+	}
+	return merged, true
+}
+
+// sql translates the expression to a SQL condition and its arguments
+func (e FilterExpr) sql() (string, []interface{}) {
+	column := quoteIdentifier(e.column)
+	switch e.op {
+	case "and", "or":
+		conditions, args := []string{}, []interface{}{}
+		for _, child := range e.children {
+			condition, childArgs := child.sql()
+			conditions = append(conditions, condition)
+			args = append(args, childArgs...)
 		}
-		if options.AllowEmptyRequire {
-			params["allow_empty_require"] = "true"
+		if len(conditions) == 0 {
+			// An empty And matches everything, an empty Or nothing
+			if e.op == "or" {
+				return "0", nil
+			}
+			return "1", nil
 		}
-		if options.NoParse {
-			params["noparse"] = "true"
+		return "(" + strings.Join(conditions, " "+strings.ToUpper(e.op)+" ") + ")", args
+	case "in":
+		if len(e.values) == 0 {
+			return "0", nil
 		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(e.values)), ", ")
+		return fmt.Sprintf("%s IN (%s)", column, placeholders), e.values
+	case "contains":
+		return fmt.Sprintf("instr(%s, ?) > 0", column), e.values
 	}
+	return fmt.Sprintf("%s %s ?", column, e.op), e.values
+}
 
-	// Build request body
-	body := struct {
-		Records []RecordWithRequire `json:"records"`
-	}{Records: records}
-
-	bodyJSON, err := json.Marshal(body)
-	if err != nil {
-		return "", -1
+// Match evaluates the expression on the fields of a record
+func (e FilterExpr) Match(fields map[string]interface{}) bool {
+	value := fields[e.column]
+	switch e.op {
+	case "and":
+		for _, child := range e.children {
+			if !child.Match(fields) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, child := range e.children {
+			if child.Match(fields) {
+				return true
+			}
+		}
+		return false
+	case "in":
+		for _, candidate := range e.values {
+			if valuesEqual(value, candidate) {
+				return true
+			}
+		}
+		return false
+	case "!=":
+		return !valuesEqual(value, e.values[0])
+	case "contains":
+		text, ok := value.(string)
+		return ok && strings.Contains(text, fmt.Sprint(e.values[0]))
+	}
+	order, ok := compareValues(value, e.values[0])
+	if !ok {
+		return false
 	}
+	switch e.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	}
+	return false
+}
 
-	url := fmt.Sprintf("docs/%s/tables/%s/records%s", docId, tableId, buildRecordsQueryParams(params))
-	response, status := httpPut(url, string(bodyJSON))
-	return response, status
+// compareValues orders two numbers or two strings; ok is false otherwise
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	if textA, ok := a.(string); ok {
+		if textB, ok := b.(string); ok {
+			return strings.Compare(textA, textB), true
+		}
+		return 0, false
+	}
+	numberA, okA := toFloat(normalizeValue(a))
+	numberB, okB := toFloat(normalizeValue(b))
+	if !okA || !okB {
+		return 0, false
+	}
+	switch {
+	case numberA < numberB:
+		return -1, true
+	case numberA > numberB:
+		return 1, true
+	}
+	return 0, true
 }
 
-// DeleteRecords deletes records from a table
-// POST /docs/{docId}/tables/{tableId}/records/delete
-func DeleteRecords(docId string, tableId string, recordIds []int) (string, int) {
-	bodyJSON, err := json.Marshal(recordIds)
-	if err != nil {
-		return "", -1
+// toFloat converts a normalized number (see normalizeValue) to a float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
 	}
+	return 0, false
+}
 
-	url := fmt.Sprintf("docs/%s/tables/%s/records/delete", docId, tableId)
-	response, status := httpPost(url, string(bodyJSON))
-	return response, status
+// UpdatedSinceTracker fetches the records of a table modified since the
+// previous call, keeping track of the high-water mark between calls.
+// UpdatedColumn must be a DateTime (or Date) column updated on each change
+type UpdatedSinceTracker struct {
+	DocId         string
+	TableId       string
+	UpdatedColumn string
+	Since         time.Time // Latest modification time seen; zero fetches everything
+}
+
+// Next fetches the records modified since the last call and advances Since
+// to the latest modification time among them
+func (t *UpdatedSinceTracker) Next() (RecordsList, int) {
+	var records RecordsList
+	var status int
+	if t.Since.IsZero() {
+		records, status = GetRecords(t.DocId, t.TableId, &GetRecordsOptions{Sort: t.UpdatedColumn})
+	} else {
+		records, status = GetRecords(t.DocId, t.TableId, &GetRecordsOptions{
+			UpdatedSince:  t.Since,
+			UpdatedColumn: t.UpdatedColumn,
+		})
+	}
+	if status != http.StatusOK {
+		return records, status
+	}
+	for _, record := range records.Records {
+		if seconds, ok := record.Fields[t.UpdatedColumn].(float64); ok {
+			if updated := gristToTime(seconds); updated.After(t.Since) {
+				t.Since = updated
+			}
+		}
+	}
+	return records, status
 }
 
 // SCIM v2 Bulk Operations
@@ -845,9 +6359,78 @@ const (
 	SCIMErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
 )
 
+// SCIMUserSchema is the schema of SCIM users
+const SCIMUserSchema = "urn:ietf:params:scim:schemas:core:2.0:User"
+
+// SCIMUser is a SCIM v2 user
+type SCIMUser struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id,omitempty"` // Set by Grist
+	UserName    string      `json:"userName"`     // The user's email
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []SCIMEmail `json:"emails,omitempty"`
+}
+
+// SCIMEmail is an email of a SCIM user
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// ErrUserExists is returned by SCIMCreateUser when the userName is taken
+var ErrUserExists = errors.New("user already exists")
+
+// SCIMCreateUser creates a user and returns it with its id. Emails are
+// normalized first. A userName already in use gives ErrUserExists (HTTP 409).
+// Being a POST, the request isn't retried by the retry policy
+// POST /scim/v2/Users
+func SCIMCreateUser(user SCIMUser) (SCIMUser, error) {
+	if err := checkEmailDomains(scimUserEmails(user)...); err != nil {
+		return SCIMUser{}, err
+	}
+	if len(user.Schemas) == 0 {
+		user.Schemas = []string{SCIMUserSchema}
+	}
+	bodyJSON, err := json.Marshal(user)
+	if err != nil {
+		return SCIMUser{}, err
+	}
+	response, status, err := executeSCIMRequest("POST", "scim/v2/Users", string(normalizeSCIMUserEmails(bodyJSON)))
+	if err := checkResponse(status, response, err); err != nil {
+		if status == http.StatusConflict {
+			return SCIMUser{}, fmt.Errorf("%w: %s: %w", ErrUserExists, user.UserName, err)
+		}
+		return SCIMUser{}, err
+	}
+	created := SCIMUser{}
+	if err := json.Unmarshal([]byte(response), &created); err != nil {
+		return SCIMUser{}, fmt.Errorf("invalid SCIM response: %w", err)
+	}
+	return created, nil
+}
+
+// scimUserEmails returns the userName and emails of a SCIM user
+func scimUserEmails(user SCIMUser) []string {
+	emails := []string{user.UserName}
+	for _, email := range user.Emails {
+		emails = append(emails, email.Value)
+	}
+	return emails
+}
+
 // SCIMBulk performs SCIM v2 bulk operations
 // POST /scim/v2/Bulk
 func SCIMBulk(request SCIMBulkRequest) (SCIMBulkResponse, int) {
+	return SCIMBulkResume(request, nil)
+}
+
+// SCIMBulkResume performs SCIM v2 bulk operations, skipping the operations
+// whose bulkId is in completed. This makes large provisioning runs resumable:
+// after an interruption, re-run the same request with the bulkIds returned by
+// CompletedBulkIds on the previous (partial) responses. Skipped operations are
+// not part of the returned response. Operations without a bulkId are always run.
+// Nothing is persisted: keeping track of completed bulkIds is up to the caller
+func SCIMBulkResume(request SCIMBulkRequest, completed map[string]bool) (SCIMBulkResponse, int) {
 	response := SCIMBulkResponse{
 		Schemas:    []string{SCIMBulkResponseSchema},
 		Operations: []SCIMBulkOperationResponse{},
@@ -867,6 +6450,9 @@ func SCIMBulk(request SCIMBulkRequest) (SCIMBulkResponse, int) {
 
 	errorCount := 0
 	for _, op := range request.Operations {
+		if op.BulkId != "" && completed[op.BulkId] {
+			continue
+		}
 		opResponse := executeSCIMOperation(op)
 		response.Operations = append(response.Operations, opResponse)
 
@@ -884,6 +6470,19 @@ func SCIMBulk(request SCIMBulkRequest) (SCIMBulkResponse, int) {
 	return response, http.StatusOK
 }
 
+// CompletedBulkIds returns the bulkIds of the operations that succeeded (2xx status)
+func (r SCIMBulkResponse) CompletedBulkIds() map[string]bool {
+	completed := make(map[string]bool)
+	for _, op := range r.Operations {
+		statusCode := 0
+		_, _ = fmt.Sscanf(op.Status, "%d", &statusCode) // Ignore error - statusCode stays 0 on parse failure
+		if op.BulkId != "" && statusCode >= 200 && statusCode < 300 {
+			completed[op.BulkId] = true
+		}
+	}
+	return completed
+}
+
 // createSCIMError creates a SCIM error response
 func createSCIMError(detail, status, scimType string) SCIMError {
 	return SCIMError{
@@ -894,140 +6493,652 @@ func createSCIMError(detail, status, scimType string) SCIMError {
 	}
 }
 
-// validateSCIMMethod validates the HTTP method for SCIM operations
-func validateSCIMMethod(method string) error {
-	validMethods := map[string]bool{
-		"POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+// validateSCIMMethod validates the HTTP method for SCIM operations
+func validateSCIMMethod(method string) error {
+	validMethods := map[string]bool{
+		"POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+	}
+	if !validMethods[method] {
+		return fmt.Errorf("invalid method: %s", method)
+	}
+	return nil
+}
+
+// marshalSCIMData marshals operation data to JSON
+func marshalSCIMData(data interface{}) ([]byte, error) {
+	if data == nil {
+		return []byte{}, nil
+	}
+	return json.Marshal(data)
+}
+
+// scimRetryable tells whether a SCIM request failing with status may be
+// retried: rate limiting (429) and unavailability (503) mean the request
+// wasn't processed, whereas a conflict (409, e.g. a duplicate userName) or an
+// invalid request (400) would fail again
+func scimRetryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// executeSCIMRequest performs the HTTP request for a SCIM operation. It
+// follows the retry policy (see SetRetryPolicy) like other requests, only
+// retrying the statuses accepted by scimRetryable
+func executeSCIMRequest(method, scimPath, bodyJSON string) (string, int, error) {
+	if err := validateSCIMMethod(method); err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	return defaultClient.requestWith(method, scimPath, []byte(bodyJSON), RetryOptions{retryable: scimRetryable})
+}
+
+// normalizeSCIMUserEmails normalizes the userName (when it is an email) and
+// the emails of a SCIM user payload. Other payloads are returned unchanged
+func normalizeSCIMUserEmails(bodyJSON []byte) []byte {
+	var user map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(bodyJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&user); err != nil {
+		return bodyJSON
+	}
+	if userName, ok := user["userName"].(string); ok && common.IsValidEmail(userName) {
+		user["userName"] = common.NormalizeEmail(userName)
+	}
+	if emails, ok := user["emails"].([]interface{}); ok {
+		for _, email := range emails {
+			if entry, ok := email.(map[string]interface{}); ok {
+				if value, ok := entry["value"].(string); ok {
+					entry["value"] = common.NormalizeEmail(value)
+				}
+			}
+		}
+	}
+	normalized, err := json.Marshal(user)
+	if err != nil {
+		return bodyJSON
+	}
+	return normalized
+}
+
+// parseSCIMResponse parses the response body into the appropriate type
+func parseSCIMResponse(respBody string) interface{} {
+	if respBody == "" {
+		return nil
+	}
+	var respData interface{}
+	if err := json.Unmarshal([]byte(respBody), &respData); err == nil {
+		return respData
+	}
+	return respBody
+}
+
+// setLocationHeader constructs the location header for successful operations
+func setLocationHeader(response *SCIMBulkOperationResponse, statusCode int, method, opPath string) {
+	if statusCode >= 200 && statusCode < 300 && (method == "POST" || method == "PUT") {
+		if respMap, ok := response.Response.(map[string]interface{}); ok {
+			if id, ok := respMap["id"]; ok {
+				response.Location = fmt.Sprintf("%s/api/scim/v2%s/%v", gristBaseURL(), opPath, id)
+			}
+		}
+	}
+}
+
+// executeSCIMOperation executes a single SCIM bulk operation
+func executeSCIMOperation(op SCIMBulkOperation) SCIMBulkOperationResponse {
+	response := SCIMBulkOperationResponse{
+		Method: op.Method,
+		BulkId: op.BulkId,
+	}
+
+	// Validate method
+	if err := validateSCIMMethod(op.Method); err != nil {
+		response.Status = "400"
+		response.Response = createSCIMError(err.Error(), "400", "invalidSyntax")
+		return response
+	}
+
+	// Validate path
+	if op.Path == "" {
+		response.Status = "400"
+		response.Response = createSCIMError("Path is required", "400", "invalidSyntax")
+		return response
+	}
+
+	// Build the SCIM API path
+	scimPath := "scim/v2" + op.Path
+
+	// Marshal request data
+	bodyJSON, err := marshalSCIMData(op.Data)
+	if err != nil {
+		response.Status = "400"
+		response.Response = createSCIMError("Invalid request data", "400", "invalidSyntax")
+		return response
+	}
+	if strings.HasPrefix(op.Path, "/Users") {
+		bodyJSON = normalizeSCIMUserEmails(bodyJSON)
+		if op.Method == "POST" || op.Method == "PUT" {
+			var user SCIMUser
+			json.Unmarshal(bodyJSON, &user)
+			if err := checkEmailDomains(scimUserEmails(user)...); err != nil {
+				response.Status = "400"
+				response.Response = createSCIMError(err.Error(), "400", "invalidValue")
+				return response
+			}
+		}
+	}
+
+	// Execute the HTTP request
+	respBody, statusCode, err := executeSCIMRequest(op.Method, scimPath, string(bodyJSON))
+	response.Status = fmt.Sprintf("%d", statusCode)
+	if err != nil && statusCode < 0 {
+		// No response from Grist
+		response.Response = createSCIMError(err.Error(), response.Status, "")
+		return response
+	}
+
+	// Parse the response body
+	response.Response = parseSCIMResponse(respBody)
+
+	// Set location header for successful operations
+	setLocationHeader(&response, statusCode, op.Method, op.Path)
+
+	return response
+}
+
+// SCIMBulkFromJSON parses a JSON request body and performs bulk operations
+func SCIMBulkFromJSON(jsonBody string) (SCIMBulkResponse, int) {
+	var request SCIMBulkRequest
+	if err := json.Unmarshal([]byte(jsonBody), &request); err != nil {
+		return SCIMBulkResponse{
+			Schemas: []string{SCIMBulkResponseSchema},
+			Operations: []SCIMBulkOperationResponse{
+				{
+					Status: "400",
+					Response: SCIMError{
+						Schemas:  []string{SCIMErrorSchema},
+						Detail:   "Invalid JSON in request body",
+						Status:   "400",
+						ScimType: "invalidSyntax",
+					},
+				},
+			},
+		}, http.StatusBadRequest
+	}
+
+	return SCIMBulk(request)
+}
+
+// Document dump and load
+// A dump is a directory holding schema.json, one {tableId}.jsonl file of
+// records per table, and progress.json listing the tables completely dumped
+
+// DumpOptions contains settings for DumpDoc
+type DumpOptions struct {
+	RequestsPerSecond float64  // Maximum request rate; 0 means unlimited
+	Restart           bool     // Ignore the progress of a previous run
+	IncludeTables     []string // Only dump the tables matching these ids or glob patterns (e.g. "Staging_*")
+	ExcludeTables     []string // Skip the tables matching these ids or glob patterns
+}
+
+// selectTables returns the ids of the tables matching the include patterns
+// (all tables when there are none) but none of the exclude patterns.
+// A table id without glob characters must name an existing table; a glob
+// pattern matching no table only logs a warning
+func selectTables(tableIds []string, include []string, exclude []string) ([]string, error) {
+	matching := func(patterns []string) (map[string]bool, error) {
+		matched := map[string]bool{}
+		for _, pattern := range patterns {
+			found := false
+			for _, tableId := range tableIds {
+				ok, err := filepath.Match(pattern, tableId)
+				if err != nil {
+					return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+				}
+				if ok {
+					matched[tableId], found = true, true
+				}
+			}
+			if !found {
+				if !strings.ContainsAny(pattern, "*?[\\") {
+					return nil, fmt.Errorf("unknown table %q", pattern)
+				}
+				log.Printf("Warning: table pattern %q matches no table", pattern)
+			}
+		}
+		return matched, nil
+	}
+	included, err := matching(include)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := matching(exclude)
+	if err != nil {
+		return nil, err
+	}
+	selected := []string{}
+	for _, tableId := range tableIds {
+		if (len(include) == 0 || included[tableId]) && !excluded[tableId] {
+			selected = append(selected, tableId)
+		}
+	}
+	return selected, nil
+}
+
+// DocSchema describes the tables of a dumped document
+type DocSchema struct {
+	DocId  string        `json:"docId"`
+	Tables []TableSchema `json:"tables"`
+}
+
+// TableSchema describes a table and its columns
+type TableSchema struct {
+	Id      string        `json:"id"`
+	Columns []TableColumn `json:"columns"`
+}
+
+// dumpProgress lists the tables completely written to a dump directory
+type dumpProgress struct {
+	Completed []string `json:"completed"`
+}
+
+const (
+	dumpSchemaFile   = "schema.json"
+	dumpProgressFile = "progress.json"
+)
+
+// rateLimiter spaces out requests to stay under a number of requests per second
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	limiter := &rateLimiter{}
+	if perSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return limiter
+}
+
+// wait blocks until the next request is allowed
+func (l *rateLimiter) wait() {
+	if l.interval == 0 {
+		return
+	}
+	if now := time.Now(); now.Before(l.next) {
+		time.Sleep(l.next.Sub(now))
+	}
+	l.next = time.Now().Add(l.interval)
+}
+
+// DumpDoc writes the records of every table of a document to dir, as JSON
+// lines, along with the document schema. opts.IncludeTables and
+// opts.ExcludeTables select the tables to dump, and the schema only lists
+// those. Requests are throttled to opts.RequestsPerSecond. The progress is
+// recorded after each table, so that a re-run after an interruption skips
+// the tables already dumped
+func DumpDoc(docId string, dir string, opts DumpOptions) error {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	progress := dumpProgress{Completed: []string{}}
+	if !opts.Restart {
+		if err := readJSONFile(filepath.Join(dir, dumpProgressFile), &progress); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("reading progress: %w", err)
+		}
+	}
+	completed := map[string]bool{}
+	for _, tableId := range progress.Completed {
+		completed[tableId] = true
+	}
+
+	limiter := newRateLimiter(opts.RequestsPerSecond)
+	limiter.wait()
+	tables, err := defaultClient.getDocTables(docId)
+	if err != nil {
+		return fmt.Errorf("fetching tables: %w", err)
+	}
+	tableIds := []string{}
+	for _, table := range tables.Tables {
+		tableIds = append(tableIds, table.Id)
+	}
+	tableIds, err = selectTables(tableIds, opts.IncludeTables, opts.ExcludeTables)
+	if err != nil {
+		return err
+	}
+	schema := DocSchema{DocId: docId, Tables: []TableSchema{}}
+	for _, tableId := range tableIds {
+		limiter.wait()
+		columns, _, err := defaultClient.getTableColumns(docId, tableId)
+		if err != nil {
+			return fmt.Errorf("fetching columns of %s: %w", tableId, err)
+		}
+		schema.Tables = append(schema.Tables, TableSchema{Id: tableId, Columns: columns.Columns})
+	}
+	if err := writeJSONFile(filepath.Join(dir, dumpSchemaFile), schema); err != nil {
+		return fmt.Errorf("writing schema: %w", err)
+	}
+
+	for _, table := range schema.Tables {
+		if completed[table.Id] {
+			continue
+		}
+		limiter.wait()
+		if err := dumpTable(docId, table, filepath.Join(dir, table.Id+".jsonl"), limiter); err != nil {
+			return fmt.Errorf("dumping %s: %w", table.Id, err)
+		}
+		progress.Completed = append(progress.Completed, table.Id)
+		if err := writeJSONFile(filepath.Join(dir, dumpProgressFile), progress); err != nil {
+			return fmt.Errorf("writing progress: %w", err)
+		}
+	}
+	return nil
+}
+
+// dumpTable writes the records of a table to a JSON lines file, keeping
+// only the fields of the table's columns
+func dumpTable(docId string, table TableSchema, fileName string, limiter *rateLimiter) error {
+	return writeFile(fileName, 0o666, func(w io.Writer) error {
+		return dumpRecords(docId, table, json.NewEncoder(w), limiter)
+	})
+}
+
+// dumpRecords encodes the records of a table, one JSON object per line
+func dumpRecords(docId string, table TableSchema, encoder *json.Encoder, limiter *rateLimiter) error {
+	return IterateRecordsKeyset(docId, table.Id, "id", func(records []Record) error {
+		for _, record := range records {
+			if err := encoder.Encode(table.record(record)); err != nil {
+				return err
+			}
+		}
+		limiter.wait()
+		return nil
+	})
+}
+
+// record returns a record keeping only the fields of the table's columns
+func (table TableSchema) record(record Record) Record {
+	fields := make(map[string]interface{}, len(table.Columns))
+	for _, column := range table.Columns {
+		if value, found := record.Fields[column.Id]; found {
+			fields[column.Id] = value
+		}
+	}
+	return Record{Id: record.Id, Fields: fields}
+}
+
+// ExportJSONOptions contains settings for ExportDocJSON
+type ExportJSONOptions struct {
+	Schema        bool     // Start with the document schema (a DocSchema) under the "_schema" key
+	IncludeTables []string // Only export the tables matching these ids or glob patterns
+	ExcludeTables []string // Skip the tables matching these ids or glob patterns
+}
+
+// ExportDocJSON writes the records of every table of a document to w as a
+// single JSON object mapping each table id to the array of its records:
+// {"_schema": {...}, "Table1": [{"id": 1, "fields": {...}}, ...], ...}
+// Records are fetched page by page and encoded as they come, so the document
+// is never held in memory. "_schema" can't clash with a table id, which
+// starts with an uppercase letter. On error, w may have received part of
+// the export
+func ExportDocJSON(docId string, w io.Writer, opts ExportJSONOptions) error {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return err
+	}
+	tables, err := defaultClient.getDocTables(docId)
+	if err != nil {
+		return err
+	}
+	tableIds := []string{}
+	for _, table := range tables.Tables {
+		tableIds = append(tableIds, table.Id)
+	}
+	tableIds, err = selectTables(tableIds, opts.IncludeTables, opts.ExcludeTables)
+	if err != nil {
+		return err
+	}
+	schema := DocSchema{DocId: docId, Tables: []TableSchema{}}
+	for _, tableId := range tableIds {
+		columns, _, err := defaultClient.getTableColumns(docId, tableId)
+		if err != nil {
+			return fmt.Errorf("fetching columns of %s: %w", tableId, err)
+		}
+		schema.Tables = append(schema.Tables, TableSchema{Id: tableId, Columns: columns.Columns})
+	}
+
+	// The encoder ends every value with a newline, which is valid whitespace
+	// between the tokens written here
+	encoder := json.NewEncoder(w)
+	separator := "{"
+	writeKey := func(key string) error {
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		separator = ","
+		if err := encoder.Encode(key); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, ":")
+		return err
+	}
+	if opts.Schema {
+		if err := writeKey("_schema"); err != nil {
+			return err
+		}
+		if err := encoder.Encode(schema); err != nil {
+			return err
+		}
+	}
+	for _, table := range schema.Tables {
+		if err := writeKey(table.Id); err != nil {
+			return err
+		}
+		if err := exportTableJSON(docId, table, w, encoder); err != nil {
+			return fmt.Errorf("exporting %s: %w", table.Id, err)
+		}
+	}
+	if separator == "{" {
+		_, err = io.WriteString(w, "{}\n")
+	} else {
+		_, err = io.WriteString(w, "}\n")
+	}
+	return err
+}
+
+// exportTableJSON writes the records of a table as a JSON array
+func exportTableJSON(docId string, table TableSchema, w io.Writer, encoder *json.Encoder) error {
+	separator := "["
+	err := IterateRecordsKeyset(docId, table.Id, "id", func(records []Record) error {
+		for _, record := range records {
+			if _, err := io.WriteString(w, separator); err != nil {
+				return err
+			}
+			separator = ","
+			if err := encoder.Encode(table.record(record)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	if !validMethods[method] {
-		return fmt.Errorf("invalid method: %s", method)
+	if separator == "[" {
+		_, err = io.WriteString(w, "[]")
+	} else {
+		_, err = io.WriteString(w, "]")
 	}
-	return nil
+	return err
 }
 
-// marshalSCIMData marshals operation data to JSON
-func marshalSCIMData(data interface{}) ([]byte, error) {
-	if data == nil {
-		return []byte{}, nil
+// readJSONFile decodes a JSON file into v
+func readJSONFile(fileName string, v interface{}) error {
+	// #nosec G304 - fileName is built from the user-provided dump directory
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
 	}
-	return json.Marshal(data)
+	return json.Unmarshal(content, v)
 }
 
-// executeSCIMRequest performs the HTTP request for a SCIM operation
-func executeSCIMRequest(method, scimPath, bodyJSON string) (string, int) {
-	switch method {
-	case "POST":
-		return httpPost(scimPath, bodyJSON)
-	case "PUT":
-		return httpPut(scimPath, bodyJSON)
-	case "PATCH":
-		return httpPatch(scimPath, bodyJSON)
-	case "DELETE":
-		return httpDelete(scimPath, bodyJSON)
-	default:
-		return "", 400
+// writeJSONFile writes v as indented JSON to a file
+func writeJSONFile(fileName string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(fileName, content, 0o600)
 }
 
-// parseSCIMResponse parses the response body into the appropriate type
-func parseSCIMResponse(respBody string) interface{} {
-	if respBody == "" {
-		return nil
+// Ways LoadDoc handles tables that already hold records
+const (
+	LoadSkipExisting = "skip"    // Leave the table untouched (default)
+	LoadReplace      = "replace" // Delete its records before loading
+)
+
+// LoadOptions contains settings for LoadDoc
+type LoadOptions struct {
+	Mode              string  // LoadSkipExisting or LoadReplace
+	BatchSize         int     // Records per request, DefaultBatchSize if 0
+	RequestsPerSecond float64 // Maximum request rate; 0 means unlimited
+
+	// Called after each table with the number of records loaded
+	OnTableLoaded func(tableId string, count int)
+}
+
+// LoadDoc loads a dump written by DumpDoc into a document: tables and
+// columns are created as needed, then the records are added in batches,
+// keeping their ids so that references between tables stay valid.
+// Formula columns are recreated but their values are left to Grist
+func LoadDoc(docId string, dir string, opts LoadOptions) error {
+	if err := validatePathSegment("docId", docId); err != nil {
+		return err
 	}
-	var respData interface{}
-	if err := json.Unmarshal([]byte(respBody), &respData); err == nil {
-		return respData
+	if opts.Mode != "" && opts.Mode != LoadSkipExisting && opts.Mode != LoadReplace {
+		return fmt.Errorf("unknown load mode %q", opts.Mode)
+	}
+	var schema DocSchema
+	if err := readJSONFile(filepath.Join(dir, dumpSchemaFile), &schema); err != nil {
+		return fmt.Errorf("reading schema: %w", err)
 	}
-	return respBody
-}
 
-// setLocationHeader constructs the location header for successful operations
-func setLocationHeader(response *SCIMBulkOperationResponse, statusCode int, method, opPath string) {
-	if statusCode >= 200 && statusCode < 300 && (method == "POST" || method == "PUT") {
-		if respMap, ok := response.Response.(map[string]interface{}); ok {
-			if id, ok := respMap["id"]; ok {
-				response.Location = fmt.Sprintf("%s/api/scim/v2%s/%v", os.Getenv("GRIST_URL"), opPath, id)
+	limiter := newRateLimiter(opts.RequestsPerSecond)
+	batchSize := (&BatchOptions{BatchSize: opts.BatchSize}).size()
+	for _, table := range schema.Tables {
+		limiter.wait()
+		if _, err := EnsureTable(docId, table.Id, table.Columns); err != nil {
+			return fmt.Errorf("creating %s: %w", table.Id, err)
+		}
+		limiter.wait()
+		existing, _, err := defaultClient.getRecords(docId, table.Id, nil)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", table.Id, err)
+		}
+		if len(existing.Records) > 0 {
+			if opts.Mode != LoadReplace {
+				if opts.OnTableLoaded != nil {
+					opts.OnTableLoaded(table.Id, 0)
+				}
+				continue
+			}
+			ids := make([]int, len(existing.Records))
+			for i, record := range existing.Records {
+				ids[i] = record.Id
+			}
+			for start := 0; start < len(ids); start += batchSize {
+				limiter.wait()
+				if _, _, err := defaultClient.deleteRecords(docId, table.Id, ids[start:min(start+batchSize, len(ids))]); err != nil {
+					return fmt.Errorf("emptying %s: %w", table.Id, err)
+				}
 			}
 		}
-	}
-}
-
-// executeSCIMOperation executes a single SCIM bulk operation
-func executeSCIMOperation(op SCIMBulkOperation) SCIMBulkOperationResponse {
-	response := SCIMBulkOperationResponse{
-		Method: op.Method,
-		BulkId: op.BulkId,
-	}
 
-	// Validate method
-	if err := validateSCIMMethod(op.Method); err != nil {
-		response.Status = "400"
-		response.Response = createSCIMError(err.Error(), "400", "invalidSyntax")
-		return response
+		count, err := loadTable(docId, table, filepath.Join(dir, table.Id+".jsonl"), batchSize, limiter)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", table.Id, err)
+		}
+		if opts.OnTableLoaded != nil {
+			opts.OnTableLoaded(table.Id, count)
+		}
 	}
+	return nil
+}
 
-	// Validate path
-	if op.Path == "" {
-		response.Status = "400"
-		response.Response = createSCIMError("Path is required", "400", "invalidSyntax")
-		return response
+// loadTable adds the records of a JSON lines file to a table, with their ids,
+// and returns the number of records added
+func loadTable(docId string, table TableSchema, fileName string, batchSize int, limiter *rateLimiter) (int, error) {
+	dataColumns := []string{}
+	for _, column := range table.Columns {
+		if !column.Fields.IsFormula {
+			dataColumns = append(dataColumns, column.Id)
+		}
 	}
-
-	// Build the SCIM API path
-	scimPath := "scim/v2" + op.Path
-
-	// Marshal request data
-	bodyJSON, err := marshalSCIMData(op.Data)
+	// #nosec G304 - fileName is built from the user-provided dump directory
+	f, err := os.Open(fileName)
 	if err != nil {
-		response.Status = "400"
-		response.Response = createSCIMError("Invalid request data", "400", "invalidSyntax")
-		return response
+		return 0, err
 	}
+	defer f.Close()
 
-	// Execute the HTTP request
-	respBody, statusCode := executeSCIMRequest(op.Method, scimPath, string(bodyJSON))
-	response.Status = fmt.Sprintf("%d", statusCode)
-
-	// Parse the response body
-	response.Response = parseSCIMResponse(respBody)
-
-	// Set location header for successful operations
-	setLocationHeader(&response, statusCode, op.Method, op.Path)
-
-	return response
-}
-
-// SCIMBulkFromJSON parses a JSON request body and performs bulk operations
-func SCIMBulkFromJSON(jsonBody string) (SCIMBulkResponse, int) {
-	var request SCIMBulkRequest
-	if err := json.Unmarshal([]byte(jsonBody), &request); err != nil {
-		return SCIMBulkResponse{
-			Schemas: []string{SCIMBulkResponseSchema},
-			Operations: []SCIMBulkOperationResponse{
-				{
-					Status: "400",
-					Response: SCIMError{
-						Schemas:  []string{SCIMErrorSchema},
-						Detail:   "Invalid JSON in request body",
-						Status:   "400",
-						ScimType: "invalidSyntax",
-					},
-				},
-			},
-		}, http.StatusBadRequest
+	loaded := 0
+	batch := []Record{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]int, len(batch))
+		values := make(map[string][]interface{}, len(dataColumns))
+		for _, column := range dataColumns {
+			values[column] = make([]interface{}, len(batch))
+		}
+		for i, record := range batch {
+			ids[i] = record.Id
+			for _, column := range dataColumns {
+				values[column][i] = record.Fields[column]
+			}
+		}
+		limiter.wait()
+		action := []interface{}{"BulkAddRecord", table.Id, ids, values}
+		response, status, err := applyUserActions(docId, []UserAction{action})
+		if err := checkResponse(status, response, err); err != nil {
+			return err
+		}
+		loaded += len(batch)
+		batch = batch[:0]
+		return nil
 	}
 
-	return SCIMBulk(request)
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	decoder.UseNumber()
+	for {
+		var record Record
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return loaded, fmt.Errorf("record %d: %w", loaded+len(batch)+1, err)
+		}
+		batch = append(batch, record)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return loaded, err
+			}
+		}
+	}
+	return loaded, flush()
 }
 
 // Attachment APIs
 // See: https://support.getgrist.com/api/#tag/attachments
 
 // httpMultipartUpload sends a multipart form upload request to Grist's REST API
-func httpMultipartUpload(endpoint string, fieldName string, files []string) (string, int) {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s/api/%s", os.Getenv("GRIST_URL"), endpoint)
-	bearer := "Bearer " + os.Getenv("GRIST_TOKEN")
+func httpMultipartUpload(endpoint string, fieldName string, files []string) (string, int, error) {
+	return defaultClient.multipartUpload(endpoint, fieldName, files)
+}
+
+// multipartUpload uploads files with the client, see httpMultipartUpload
+func (c *Client) multipartUpload(endpoint string, fieldName string, files []string) (string, int, error) {
+	url := c.url(endpoint)
 
 	// Create multipart form body
 	body := &bytes.Buffer{}
@@ -1037,7 +7148,7 @@ func httpMultipartUpload(endpoint string, fieldName string, files []string) (str
 		// #nosec G304 - filePath is user-provided CLI argument for file upload
 		file, err := os.Open(filePath)
 		if err != nil {
-			return fmt.Sprintf("Error opening file %s: %s", filePath, err), -1
+			return fmt.Sprintf("Error opening file %s: %s", filePath, err), -1, &RequestError{"POST", endpoint, fmt.Errorf("opening file %s: %w", filePath, err)}
 		}
 
 		// Get filename from path
@@ -1047,13 +7158,13 @@ func httpMultipartUpload(endpoint string, fieldName string, files []string) (str
 		part, err := writer.CreateFormFile(fieldName, fileName)
 		if err != nil {
 			_ = file.Close()
-			return fmt.Sprintf("Error creating form file: %s", err), -1
+			return fmt.Sprintf("Error creating form file: %s", err), -1, &RequestError{"POST", endpoint, fmt.Errorf("creating form file: %w", err)}
 		}
 
 		// Copy file content to form field
 		if _, err := io.Copy(part, file); err != nil {
 			_ = file.Close()
-			return fmt.Sprintf("Error copying file content: %s", err), -1
+			return fmt.Sprintf("Error copying file content: %s", err), -1, &RequestError{"POST", endpoint, fmt.Errorf("copying file content: %w", err)}
 		}
 
 		// Close file immediately after reading
@@ -1063,20 +7174,27 @@ func httpMultipartUpload(endpoint string, fieldName string, files []string) (str
 	}
 
 	if err := writer.Close(); err != nil {
-		return fmt.Sprintf("Error closing multipart writer: %s", err), -1
+		return fmt.Sprintf("Error closing multipart writer: %s", err), -1, &RequestError{"POST", endpoint, fmt.Errorf("closing multipart writer: %w", err)}
 	}
 
+	info := RequestInfo{Method: "POST", Path: endpoint, BytesSent: body.Len()}
+	start := time.Now()
+	defer func() {
+		info.Duration = time.Since(start)
+		observeRequest(info)
+	}()
+
 	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
-		return fmt.Sprintf("Error creating request: %s", err), -1
+		return fmt.Sprintf("Error creating request: %s", err), -1, &RequestError{"POST", endpoint, err}
 	}
 
-	req.Header.Add("Authorization", bearer)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := client.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
-		return fmt.Sprintf("Error sending request: %s", err), -10
+		info.Status = -10
+		return fmt.Sprintf("Error sending request: %s", err), -10, &RequestError{"POST", endpoint, err}
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -1085,18 +7203,22 @@ func httpMultipartUpload(endpoint string, fieldName string, files []string) (str
 	}()
 
 	respBody, err := io.ReadAll(resp.Body)
+	info.Status, info.BytesReceived = resp.StatusCode, len(respBody)
 	if err != nil {
-		return fmt.Sprintf("Error reading response: %s", err), resp.StatusCode
+		return fmt.Sprintf("Error reading response: %s", err), resp.StatusCode, &RequestError{"POST", endpoint, fmt.Errorf("reading response: %w", timeoutError(err))}
 	}
 
-	return string(respBody), resp.StatusCode
+	return string(respBody), resp.StatusCode, nil
 }
 
 // httpMultipartUploadReader sends a multipart form upload request using an io.Reader
-func httpMultipartUploadReader(endpoint string, fieldName string, fileName string, reader io.Reader) (string, int) {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s/api/%s", os.Getenv("GRIST_URL"), endpoint)
-	bearer := "Bearer " + os.Getenv("GRIST_TOKEN")
+func httpMultipartUploadReader(endpoint string, fieldName string, fileName string, reader io.Reader) (string, int, error) {
+	return defaultClient.multipartUploadReader(endpoint, fieldName, fileName, reader)
+}
+
+// multipartUploadReader uploads content with the client, see httpMultipartUploadReader
+func (c *Client) multipartUploadReader(endpoint string, fieldName string, fileName string, reader io.Reader) (string, int, error) {
+	url := c.url(endpoint)
 
 	// Create multipart form body
 	body := &bytes.Buffer{}
@@ -1105,29 +7227,36 @@ func httpMultipartUploadReader(endpoint string, fieldName string, fileName strin
 	// Create form file field
 	part, err := writer.CreateFormFile(fieldName, fileName)
 	if err != nil {
-		return fmt.Sprintf("Error creating form file: %s", err), -1
+		return fmt.Sprintf("Error creating form file: %s", err), -1, &RequestError{"POST", endpoint, fmt.Errorf("creating form file: %w", err)}
 	}
 
 	// Copy reader content to form field
 	if _, err := io.Copy(part, reader); err != nil {
-		return fmt.Sprintf("Error copying content: %s", err), -1
+		return fmt.Sprintf("Error copying content: %s", err), -1, &RequestError{"POST", endpoint, fmt.Errorf("copying content: %w", err)}
 	}
 
 	if err := writer.Close(); err != nil {
-		return fmt.Sprintf("Error closing multipart writer: %s", err), -1
+		return fmt.Sprintf("Error closing multipart writer: %s", err), -1, &RequestError{"POST", endpoint, fmt.Errorf("closing multipart writer: %w", err)}
 	}
 
+	info := RequestInfo{Method: "POST", Path: endpoint, BytesSent: body.Len()}
+	start := time.Now()
+	defer func() {
+		info.Duration = time.Since(start)
+		observeRequest(info)
+	}()
+
 	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
-		return fmt.Sprintf("Error creating request: %s", err), -1
+		return fmt.Sprintf("Error creating request: %s", err), -1, &RequestError{"POST", endpoint, err}
 	}
 
-	req.Header.Add("Authorization", bearer)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := client.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
-		return fmt.Sprintf("Error sending request: %s", err), -10
+		info.Status = -10
+		return fmt.Sprintf("Error sending request: %s", err), -10, &RequestError{"POST", endpoint, err}
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -1136,29 +7265,40 @@ func httpMultipartUploadReader(endpoint string, fieldName string, fileName strin
 	}()
 
 	respBody, err := io.ReadAll(resp.Body)
+	info.Status, info.BytesReceived = resp.StatusCode, len(respBody)
 	if err != nil {
-		return fmt.Sprintf("Error reading response: %s", err), resp.StatusCode
+		return fmt.Sprintf("Error reading response: %s", err), resp.StatusCode, &RequestError{"POST", endpoint, fmt.Errorf("reading response: %w", timeoutError(err))}
 	}
 
-	return string(respBody), resp.StatusCode
+	return string(respBody), resp.StatusCode, nil
 }
 
 // httpGetBinary sends a GET request and returns raw binary response
-func httpGetBinary(endpoint string) ([]byte, string, int) {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s/api/%s", os.Getenv("GRIST_URL"), endpoint)
-	bearer := "Bearer " + os.Getenv("GRIST_TOKEN")
+func httpGetBinary(endpoint string) ([]byte, string, int, error) {
+	return defaultClient.getBinary(endpoint)
+}
+
+// getBinary fetches binary content with the client, see httpGetBinary
+func (c *Client) getBinary(endpoint string) ([]byte, string, int, error) {
+	url := c.url(endpoint)
+
+	info := RequestInfo{Method: "GET", Path: endpoint}
+	start := time.Now()
+	defer func() {
+		info.Duration = time.Since(start)
+		observeRequest(info)
+	}()
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, "", -1
+		info.Status = -1
+		return nil, "", -1, &RequestError{"GET", endpoint, err}
 	}
 
-	req.Header.Add("Authorization", bearer)
-
-	resp, err := client.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
-		return nil, "", -10
+		info.Status = -10
+		return nil, "", -10, &RequestError{"GET", endpoint, err}
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -1167,26 +7307,131 @@ func httpGetBinary(endpoint string) ([]byte, string, int) {
 	}()
 
 	body, err := io.ReadAll(resp.Body)
+	info.Status, info.BytesReceived = resp.StatusCode, len(body)
 	if err != nil {
-		return nil, "", resp.StatusCode
+		return nil, "", resp.StatusCode, &RequestError{"GET", endpoint, fmt.Errorf("reading response: %w", timeoutError(err))}
 	}
 
 	contentType := resp.Header.Get("Content-Type")
-	return body, contentType, resp.StatusCode
+	return body, contentType, resp.StatusCode, nil
+}
+
+// download streams the response to a GET request into w without holding it
+// in memory. It is exempt from ConnectionOptions.Timeout, so that large
+// exports aren't cut off, but not from ResponseHeaderTimeout.
+// The error is an *APIError for a non-success status, whose body isn't
+// written to w, and a *RequestError when the response couldn't be received
+// or copied
+func (c *Client) download(endpoint string, w io.Writer) (int, error) {
+	info := RequestInfo{Method: "GET", Path: endpoint}
+	start := time.Now()
+	defer func() {
+		info.Duration = time.Since(start)
+		observeRequest(info)
+	}()
+
+	req, err := http.NewRequest("GET", c.url(endpoint), nil)
+	if err != nil {
+		info.Status = -1
+		return -1, &RequestError{"GET", endpoint, err}
+	}
+	resp, err := c.send(withoutTimeout(req))
+	if err != nil {
+		info.Status = -10
+		return -10, &RequestError{"GET", endpoint, err}
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+	info.Status = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		info.BytesReceived = len(body)
+		return resp.StatusCode, checkStatus(resp.StatusCode, string(body))
+	}
+	copied, err := io.Copy(w, resp.Body)
+	info.BytesReceived = int(copied)
+	if err != nil {
+		return resp.StatusCode, &RequestError{"GET", endpoint, fmt.Errorf("copying response: %w", timeoutError(err))}
+	}
+	return resp.StatusCode, nil
+}
+
+// DoRaw sends a request to any endpoint of Grist's API and returns the raw
+// response, for endpoints without a dedicated function or whose response
+// isn't JSON (downloads, custom reports). path is relative to /api, e.g.
+// "docs/{docId}/download/csv?tableId=Table1"; the API key, base URL and
+// organization (see SetOrg), the circuit breaker and request logging are
+// those of the other functions. A body is sent as JSON.
+// Parsing the response is up to the caller. The error is an *APIError for a
+// non-success status, with the response still returned
+func DoRaw(method string, path string, body io.Reader) ([]byte, http.Header, int, error) {
+	return defaultClient.DoRaw(method, path, body)
+}
+
+// DoRaw sends a request to any endpoint of the client's server, see DoRaw
+func (c *Client) DoRaw(method string, path string, body io.Reader) ([]byte, http.Header, int, error) {
+	path = strings.TrimPrefix(path, "/")
+	info := RequestInfo{Method: method, Path: path}
+	start := time.Now()
+	defer func() {
+		info.Duration = time.Since(start)
+		observeRequest(info)
+	}()
+
+	req, err := http.NewRequest(method, c.url(path), body)
+	if err != nil {
+		info.Status = -1
+		return nil, nil, -1, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		info.Status = -10
+		return nil, nil, -10, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+	content, tooLarge, err := readResponseBody(path, resp.Body)
+	if tooLarge {
+		info.Status = -10
+		return nil, resp.Header, -10, fmt.Errorf("%w: %s exceeds %d bytes (see SetMaxResponseBytes)", ErrResponseTooLarge, path, maxResponseBytes.Load())
+	}
+	info.Status, info.BytesReceived = resp.StatusCode, len(content)
+	if err != nil {
+		return content, resp.Header, resp.StatusCode, fmt.Errorf("reading response of %s: %w", path, timeoutError(err))
+	}
+	return content, resp.Header, resp.StatusCode, checkStatus(resp.StatusCode, string(content))
 }
 
 // ListAttachments retrieves all attachments for a document
 // GET /docs/{docId}/attachments
 func ListAttachments(docId string, options *GetAttachmentsOptions) (AttachmentList, int) {
+	attachments, status, _ := ListAttachmentsWithError(docId, options)
+	return attachments, status
+}
+
+// ListAttachmentsWithError retrieves the attachments of a document, see
+// ListAttachments, also returning the request error
+func ListAttachmentsWithError(docId string, options *GetAttachmentsOptions) (AttachmentList, int, error) {
 	attachments := AttachmentList{}
 	params := make(map[string]string)
 
 	if options != nil {
-		if options.Filter != nil {
-			filterJSON, err := json.Marshal(options.Filter)
-			if err == nil {
-				params["filter"] = string(filterJSON)
-			}
+		filter, err := filterParam(options.Filter)
+		if err != nil {
+			return attachments, -1, err
+		}
+		if filter != "" {
+			params["filter"] = filter
 		}
 		if options.Sort != "" {
 			params["sort"] = options.Sort
@@ -1197,11 +7442,14 @@ func ListAttachments(docId string, options *GetAttachmentsOptions) (AttachmentLi
 	}
 
 	url := fmt.Sprintf("docs/%s/attachments%s", docId, buildRecordsQueryParams(params))
-	response, status := httpGet(url, "")
+	response, status, err := httpGet(url, "")
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &attachments)
 	}
-	return attachments, status
+	if attachments.Records == nil {
+		attachments.Records = []AttachmentMetadata{}
+	}
+	return attachments, status, checkResponse(status, response, err)
 }
 
 // UploadAttachments uploads files as attachments to a document
@@ -1215,7 +7463,7 @@ func UploadAttachments(docId string, filePaths []string) (UploadAttachmentsRespo
 	}
 
 	endpoint := fmt.Sprintf("docs/%s/attachments", docId)
-	response, status := httpMultipartUpload(endpoint, "upload", filePaths)
+	response, status, _ := httpMultipartUpload(endpoint, "upload", filePaths)
 
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &result)
@@ -1230,7 +7478,7 @@ func UploadAttachmentsFromReader(docId string, fileName string, reader io.Reader
 	var result UploadAttachmentsResponse
 
 	endpoint := fmt.Sprintf("docs/%s/attachments", docId)
-	response, status := httpMultipartUploadReader(endpoint, "upload", fileName, reader)
+	response, status, _ := httpMultipartUploadReader(endpoint, "upload", fileName, reader)
 
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &result)
@@ -1241,31 +7489,46 @@ func UploadAttachmentsFromReader(docId string, fileName string, reader io.Reader
 // GetAttachmentMetadata retrieves metadata for a specific attachment
 // GET /docs/{docId}/attachments/{attachmentId}
 func GetAttachmentMetadata(docId string, attachmentId int) (AttachmentMetadata, int) {
+	attachment, status, _ := GetAttachmentMetadataWithError(docId, attachmentId)
+	return attachment, status
+}
+
+// GetAttachmentMetadataWithError retrieves the metadata of an attachment,
+// also returning the request error
+func GetAttachmentMetadataWithError(docId string, attachmentId int) (AttachmentMetadata, int, error) {
 	attachment := AttachmentMetadata{}
 	url := fmt.Sprintf("docs/%s/attachments/%d", docId, attachmentId)
-	response, status := httpGet(url, "")
+	response, status, err := httpGet(url, "")
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &attachment)
 	}
-	return attachment, status
+	return attachment, status, checkResponse(status, response, err)
 }
 
 // DownloadAttachment downloads the content of an attachment
 // GET /docs/{docId}/attachments/{attachmentId}/download
 // Returns the raw bytes and content type
 func DownloadAttachment(docId string, attachmentId int) ([]byte, string, int) {
-	url := fmt.Sprintf("docs/%s/attachments/%d/download", docId, attachmentId)
-	return httpGetBinary(url)
+	content, contentType, status, _ := httpGetBinary(attachmentDownloadPath(docId, attachmentId))
+	return content, contentType, status
+}
+
+// attachmentDownloadPath is the endpoint of an attachment's content
+func attachmentDownloadPath(docId string, attachmentId int) string {
+	return fmt.Sprintf("docs/%s/attachments/%d/download", docId, attachmentId)
 }
 
 // DownloadAttachmentToFile downloads an attachment and saves it to a file
 func DownloadAttachmentToFile(docId string, attachmentId int, destPath string) error {
-	content, _, status := DownloadAttachment(docId, attachmentId)
-	if status != http.StatusOK {
-		return fmt.Errorf("failed to download attachment: HTTP %d", status)
+	content, _, status, err := httpGetBinary(attachmentDownloadPath(docId, attachmentId))
+	if err := checkResponse(status, string(content), err); err != nil {
+		return fmt.Errorf("failed to download attachment: %w", err)
 	}
 
-	return os.WriteFile(destPath, content, 0600)
+	return writeFile(destPath, 0o600, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
 }
 
 // RestoreAttachments uploads a .tar archive to restore missing attachments
@@ -1274,7 +7537,7 @@ func RestoreAttachments(docId string, tarFilePath string) (RestoreAttachmentsRes
 	var result RestoreAttachmentsResponse
 
 	endpoint := fmt.Sprintf("docs/%s/attachments/archive", docId)
-	response, status := httpMultipartUpload(endpoint, "upload", []string{tarFilePath})
+	response, status, _ := httpMultipartUpload(endpoint, "upload", []string{tarFilePath})
 
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &result)
@@ -1288,7 +7551,7 @@ func RestoreAttachmentsFromReader(docId string, fileName string, reader io.Reade
 	var result RestoreAttachmentsResponse
 
 	endpoint := fmt.Sprintf("docs/%s/attachments/archive", docId)
-	response, status := httpMultipartUploadReader(endpoint, "upload", fileName, reader)
+	response, status, _ := httpMultipartUploadReader(endpoint, "upload", fileName, reader)
 
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &result)
@@ -1299,8 +7562,16 @@ func RestoreAttachmentsFromReader(docId string, fileName string, reader io.Reade
 // DeleteUnusedAttachments removes attachments not referenced by any cell
 // POST /docs/{docId}/attachments/removeUnused
 func DeleteUnusedAttachments(docId string) (string, int) {
+	response, status, _ := DeleteUnusedAttachmentsWithError(docId)
+	return response, status
+}
+
+// DeleteUnusedAttachmentsWithError removes the unused attachments of a
+// document, also returning the request error
+func DeleteUnusedAttachmentsWithError(docId string) (string, int, error) {
 	url := fmt.Sprintf("docs/%s/attachments/removeUnused", docId)
-	return httpPost(url, "")
+	response, status, err := httpPost(url, "")
+	return response, status, checkResponse(status, response, err)
 }
 
 // Webhook API Types
@@ -1331,10 +7602,12 @@ type WebhookPartialFields struct {
 
 // WebhookBatchStatus contains status of the last event batch
 type WebhookBatchStatus struct {
-	Size      int    `json:"size"`
-	ErroredAt *int64 `json:"erroredAt,omitempty"`
-	Status    string `json:"status"`
-	Attempts  int    `json:"attempts"`
+	Size         int     `json:"size"`
+	ErroredAt    *int64  `json:"erroredAt,omitempty"`
+	ErrorMessage *string `json:"errorMessage,omitempty"`
+	HttpStatus   *int    `json:"httpStatus,omitempty"`
+	Status       string  `json:"status"`
+	Attempts     int     `json:"attempts"`
 }
 
 // WebhookUsage contains operational metrics for a webhook
@@ -1389,18 +7662,35 @@ type WebhookDeleteResponse struct {
 // GetWebhooks retrieves all webhooks for a document
 // GET /docs/{docId}/webhooks
 func GetWebhooks(docId string) (WebhooksList, int) {
+	webhooks, status, _ := GetWebhooksWithError(docId)
+	return webhooks, status
+}
+
+// GetWebhooksWithError retrieves the webhooks of a document, also
+// returning the request error
+func GetWebhooksWithError(docId string) (WebhooksList, int, error) {
 	webhooks := WebhooksList{}
 	url := fmt.Sprintf("docs/%s/webhooks", docId)
-	response, status := httpGet(url, "")
+	response, status, err := httpGet(url, "")
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &webhooks)
 	}
-	return webhooks, status
+	if webhooks.Webhooks == nil {
+		webhooks.Webhooks = []Webhook{}
+	}
+	return webhooks, status, checkResponse(status, response, err)
 }
 
 // CreateWebhooks creates one or more webhooks for a document
 // POST /docs/{docId}/webhooks
 func CreateWebhooks(docId string, webhooks []WebhookPartialFields) (WebhooksCreateResponse, int) {
+	result, status, _ := CreateWebhooksWithError(docId, webhooks)
+	return result, status
+}
+
+// CreateWebhooksWithError creates webhooks for a document, also returning
+// the request error
+func CreateWebhooksWithError(docId string, webhooks []WebhookPartialFields) (WebhooksCreateResponse, int, error) {
 	result := WebhooksCreateResponse{}
 
 	// Build request body
@@ -1413,55 +7703,194 @@ func CreateWebhooks(docId string, webhooks []WebhookPartialFields) (WebhooksCrea
 
 	bodyJSON, err := json.Marshal(request)
 	if err != nil {
-		return result, -1
+		return result, -1, err
 	}
 
 	url := fmt.Sprintf("docs/%s/webhooks", docId)
-	response, status := httpPost(url, string(bodyJSON))
+	response, status, err := httpPost(url, string(bodyJSON))
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &result)
 	}
-	return result, status
+	return result, status, checkResponse(status, response, err)
 }
 
 // UpdateWebhook modifies an existing webhook
 // PATCH /docs/{docId}/webhooks/{webhookId}
 func UpdateWebhook(docId string, webhookId string, fields WebhookPartialFields) (string, int) {
+	response, status, _ := UpdateWebhookWithError(docId, webhookId, fields)
+	return response, status
+}
+
+// UpdateWebhookWithError modifies a webhook, also returning the request error
+func UpdateWebhookWithError(docId string, webhookId string, fields WebhookPartialFields) (string, int, error) {
 	bodyJSON, err := json.Marshal(fields)
 	if err != nil {
-		return "", -1
+		return "", -1, err
 	}
 
 	url := fmt.Sprintf("docs/%s/webhooks/%s", docId, webhookId)
-	response, status := httpPatch(url, string(bodyJSON))
-	return response, status
+	response, status, err := httpPatch(url, string(bodyJSON))
+	return response, status, checkResponse(status, response, err)
+}
+
+// SetWebhookEnabled enables or disables a webhook, leaving its other fields untouched
+// PATCH /docs/{docId}/webhooks/{webhookId}
+func SetWebhookEnabled(docId string, webhookId string, enabled bool) (int, error) {
+	_, status, err := UpdateWebhookWithError(docId, webhookId, WebhookPartialFields{Enabled: &enabled})
+	return status, err
 }
 
 // DeleteWebhook removes a webhook from a document
 // DELETE /docs/{docId}/webhooks/{webhookId}
 func DeleteWebhook(docId string, webhookId string) (WebhookDeleteResponse, int) {
+	result, status, _ := DeleteWebhookWithError(docId, webhookId)
+	return result, status
+}
+
+// DeleteWebhookWithError removes a webhook from a document, also returning
+// the request error
+func DeleteWebhookWithError(docId string, webhookId string) (WebhookDeleteResponse, int, error) {
 	result := WebhookDeleteResponse{}
 	url := fmt.Sprintf("docs/%s/webhooks/%s", docId, webhookId)
-	response, status := httpDelete(url, "")
+	response, status, err := httpDelete(url, "")
 	if status == http.StatusOK {
 		json.Unmarshal([]byte(response), &result)
 	}
-	return result, status
+	return result, status, checkResponse(status, response, err)
+}
+
+// DeleteResult reports the outcome of one deletion in a batch
+type DeleteResult struct {
+	Id     string // Identifier of the item to delete
+	Status int    // HTTP status returned by Grist
+	Err    error  // nil when the item was deleted
+}
+
+// DeleteWebhooks removes several webhooks from a document, continuing past
+// individual failures. Returns one result per webhook id, and an error
+// joining every failure (nil when all webhooks were deleted)
+func DeleteWebhooks(docId string, webhookIds []string) ([]DeleteResult, error) {
+	results := make([]DeleteResult, 0, len(webhookIds))
+	var errs []error
+	for _, webhookId := range webhookIds {
+		url := fmt.Sprintf("docs/%s/webhooks/%s", docId, webhookId)
+		response, status, err := httpDelete(url, "")
+		err = checkResponse(status, response, err)
+		if err != nil {
+			err = fmt.Errorf("webhook %s: %w", webhookId, err)
+			errs = append(errs, err)
+		}
+		results = append(results, DeleteResult{Id: webhookId, Status: status, Err: err})
+	}
+	return results, errors.Join(errs...)
 }
 
 // ClearWebhookQueue empties the webhook queue for a document
 // DELETE /docs/{docId}/webhooks/queue
 func ClearWebhookQueue(docId string) (string, int) {
-	url := fmt.Sprintf("docs/%s/webhooks/queue", docId)
-	response, status := httpDelete(url, "")
+	response, status, _ := ClearWebhookQueueWithError(docId)
 	return response, status
 }
 
+// ClearWebhookQueueWithError empties the webhook queue of a document, also
+// returning the request error
+func ClearWebhookQueueWithError(docId string) (string, int, error) {
+	url := fmt.Sprintf("docs/%s/webhooks/queue", docId)
+	response, status, err := httpDelete(url, "")
+	return response, status, checkResponse(status, response, err)
+}
+
+// WebhookDelivery describes a delivery attempt of a webhook
+type WebhookDelivery struct {
+	Time       time.Time `json:"time"`
+	Status     string    `json:"status"`               // "success" or "failure"
+	HttpStatus int       `json:"httpStatus,omitempty"` // Status returned by the webhook endpoint
+	Response   string    `json:"response,omitempty"`   // Start of the error message
+	Attempts   int       `json:"attempts,omitempty"`   // Attempts of the last batch
+}
+
+// Maximum length of the response snippet of a webhook delivery
+const webhookResponseSnippet = 200
+
+// GetWebhookDeliveries returns the recent deliveries of a webhook, newest first,
+// at most limit of them (all if limit <= 0).
+// Grist keeps no delivery log: only the last success and the last failure
+// reported in the webhook usage (Grist 1.1.0 or later) are available.
+// Returns status 404 if the webhook does not exist
+func GetWebhookDeliveries(docId string, webhookId string, limit int) ([]WebhookDelivery, int) {
+	deliveries := []WebhookDelivery{}
+	webhooks, status := GetWebhooks(docId)
+	if status != http.StatusOK {
+		return deliveries, status
+	}
+	var usage *WebhookUsage
+	found := false
+	for _, webhook := range webhooks.Webhooks {
+		if webhook.Id == webhookId {
+			usage, found = webhook.Usage, true
+			break
+		}
+	}
+	if !found {
+		return deliveries, http.StatusNotFound
+	}
+	if usage == nil {
+		return deliveries, status
+	}
+
+	if usage.LastFailureTime != nil {
+		failure := WebhookDelivery{Time: time.UnixMilli(*usage.LastFailureTime).UTC(), Status: "failure"}
+		if usage.LastHttpStatus != nil {
+			failure.HttpStatus = *usage.LastHttpStatus
+		}
+		if usage.LastErrorMessage != nil {
+			failure.Response = truncate(*usage.LastErrorMessage, webhookResponseSnippet)
+		}
+		if usage.LastEventBatch != nil && usage.LastEventBatch.Status != "success" {
+			failure.Attempts = usage.LastEventBatch.Attempts
+		}
+		deliveries = append(deliveries, failure)
+	}
+	if usage.LastSuccessTime != nil {
+		success := WebhookDelivery{Time: time.UnixMilli(*usage.LastSuccessTime).UTC(), Status: "success"}
+		if usage.LastEventBatch != nil && usage.LastEventBatch.Status == "success" {
+			success.Attempts = usage.LastEventBatch.Attempts
+		}
+		deliveries = append(deliveries, success)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Time.After(deliveries[j].Time)
+	})
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, status
+}
+
+// truncate shortens s to at most max characters
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "…"
+}
+
 // Retrieves the list of webhooks for a document
 func GetDocWebhooks(docId string) []Webhook {
+	webhooks, _ := GetDocWebhooksWithError(docId)
+	return webhooks
+}
+
+// GetDocWebhooksWithError retrieves the webhooks of a document, also
+// returning the request error
+func GetDocWebhooksWithError(docId string) ([]Webhook, error) {
 	webhooks := WebhooksList{}
 	url := fmt.Sprintf("docs/%s/webhooks", docId)
-	response, _ := httpGet(url, "")
+	response, status, err := httpGet(url, "")
 	json.Unmarshal([]byte(response), &webhooks)
-	return webhooks.Webhooks
+	if webhooks.Webhooks == nil {
+		webhooks.Webhooks = []Webhook{}
+	}
+	return webhooks.Webhooks, checkResponse(status, response, err)
 }
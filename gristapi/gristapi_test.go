@@ -5,14 +5,24 @@
 package gristapi
 
 import (
+	"archive/zip"
 	"bytes"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestConnect(t *testing.T) {
@@ -108,21 +118,23 @@ func TestBuildRecordsQueryParams(t *testing.T) {
 			params:   map[string]string{"limit": "", "sort": "name"},
 			expected: "?sort=name",
 		},
+		{
+			name:     "sorted by key",
+			params:   map[string]string{"sort": "-name", "limit": "5", "hidden": "true"},
+			expected: "?hidden=true&limit=5&sort=-name",
+		},
+		{
+			name:     "filter encoded",
+			params:   map[string]string{"filter": `{"Name":["A&B=C d"]}`},
+			expected: "?filter=%7B%22Name%22%3A%5B%22A%26B%3DC+d%22%5D%7D",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result := buildRecordsQueryParams(tt.params)
-			// For single param case, exact match
-			if len(tt.params) <= 1 {
-				if result != tt.expected {
-					t.Errorf("buildRecordsQueryParams() = %q, want %q", result, tt.expected)
-				}
-			} else {
-				// For multiple params, just check it starts with ? and contains expected parts
-				if tt.expected != "" && (result == "" || result[0] != '?') {
-					t.Errorf("buildRecordsQueryParams() = %q, expected to start with '?'", result)
-				}
+			if result != tt.expected {
+				t.Errorf("buildRecordsQueryParams() = %q, want %q", result, tt.expected)
 			}
 		})
 	}
@@ -609,6 +621,61 @@ func TestSCIMBulk_FailOnErrors(t *testing.T) {
 	}
 }
 
+func TestSCIMBulkResume(t *testing.T) {
+	created := []string{}
+	interrupted := true
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		var user map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&user)
+		userName := user["userName"].(string)
+		if interrupted && userName == "user3" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		created = append(created, userName)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": len(created), "userName": userName})
+	})
+	defer cleanup()
+
+	request := SCIMBulkRequest{
+		Schemas:      []string{SCIMBulkRequestSchema},
+		FailOnErrors: 1,
+	}
+	for i := 1; i <= 4; i++ {
+		request.Operations = append(request.Operations, SCIMBulkOperation{
+			Method: "POST",
+			Path:   "/Users",
+			BulkId: fmt.Sprintf("bulk%d", i),
+			Data:   map[string]interface{}{"userName": fmt.Sprintf("user%d", i)},
+		})
+	}
+
+	// First run is interrupted on user3
+	partial, _ := SCIMBulk(request)
+	if len(partial.Operations) != 3 {
+		t.Fatalf("Expected the run to stop after 3 operations, got %d", len(partial.Operations))
+	}
+	completed := partial.CompletedBulkIds()
+	if len(completed) != 2 || !completed["bulk1"] || !completed["bulk2"] {
+		t.Fatalf("Expected bulk1 and bulk2 to be completed, got %v", completed)
+	}
+
+	// Resumed run must not recreate user1 and user2
+	interrupted = false
+	resumed, status := SCIMBulkResume(request, completed)
+	if status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+	if len(resumed.Operations) != 2 || resumed.Operations[0].BulkId != "bulk3" || resumed.Operations[1].BulkId != "bulk4" {
+		t.Errorf("Expected only bulk3 and bulk4 to run, got %+v", resumed.Operations)
+	}
+	expected := []string{"user1", "user2", "user3", "user4"}
+	if strings.Join(created, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected each user to be created once, got %v", created)
+	}
+}
+
 func TestSCIMBulkFromJSON_ValidJSON(t *testing.T) {
 	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusCreated)
@@ -1278,6 +1345,55 @@ func TestUpdateWebhook_ChangeURL(t *testing.T) {
 	}
 }
 
+func TestSetWebhookEnabled(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" {
+			t.Errorf("Expected PATCH request, got %s", r.Method)
+		}
+		if r.URL.Path != "/api/docs/doc123/webhooks/webhook-456" {
+			t.Errorf("Expected /api/docs/doc123/webhooks/webhook-456, got %s", r.URL.Path)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if len(body) != 1 {
+			t.Errorf("Expected only the enabled field, got %v", body)
+		}
+		if body["enabled"] != false {
+			t.Errorf("Expected enabled=false, got %v", body["enabled"])
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+	defer cleanup()
+
+	status, err := SetWebhookEnabled("doc123", "webhook-456", false)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+}
+
+func TestSetWebhookEnabled_NotFound(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Webhook not found"})
+	})
+	defer cleanup()
+
+	status, err := SetWebhookEnabled("doc123", "nonexistent", true)
+	if status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+	if err == nil || !contains(err.Error(), "Webhook not found") {
+		t.Errorf("Expected error mentioning the server message, got %v", err)
+	}
+}
+
 func TestDeleteWebhook(t *testing.T) {
 	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "DELETE" {
@@ -1314,6 +1430,68 @@ func TestDeleteWebhook_NotFound(t *testing.T) {
 	}
 }
 
+func TestDeleteWebhooks_MixedResults(t *testing.T) {
+	deleted := []string{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("Expected DELETE request, got %s", r.Method)
+		}
+		webhookId := strings.TrimPrefix(r.URL.Path, "/api/docs/doc123/webhooks/")
+		if webhookId == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Webhook not found"})
+			return
+		}
+		deleted = append(deleted, webhookId)
+		json.NewEncoder(w).Encode(WebhookDeleteResponse{Success: true})
+	})
+	defer cleanup()
+
+	results, err := DeleteWebhooks("doc123", []string{"hook-1", "missing", "hook-2"})
+	if err == nil {
+		t.Fatal("Expected an error for the missing webhook")
+	}
+	if !contains(err.Error(), "missing") || !contains(err.Error(), "Webhook not found") {
+		t.Errorf("Expected error naming the failed webhook, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if len(deleted) != 2 {
+		t.Errorf("Expected deletion to continue past the failure, deleted %v", deleted)
+	}
+
+	expected := []struct {
+		id     string
+		status int
+		failed bool
+	}{
+		{"hook-1", http.StatusOK, false},
+		{"missing", http.StatusNotFound, true},
+		{"hook-2", http.StatusOK, false},
+	}
+	for i, want := range expected {
+		if results[i].Id != want.id || results[i].Status != want.status || (results[i].Err != nil) != want.failed {
+			t.Errorf("Result %d: got %+v, want id=%s status=%d failed=%v", i, results[i], want.id, want.status, want.failed)
+		}
+	}
+}
+
+func TestDeleteWebhooks_AllSucceed(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(WebhookDeleteResponse{Success: true})
+	})
+	defer cleanup()
+
+	results, err := DeleteWebhooks("doc123", []string{"hook-1", "hook-2"})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+}
+
 func TestClearWebhookQueue(t *testing.T) {
 	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "DELETE" {
@@ -1398,3 +1576,4951 @@ func TestWebhookUsage_WithAllFields(t *testing.T) {
 		t.Errorf("Expected lastEventBatch.size=10, got %v", usage.LastEventBatch)
 	}
 }
+
+// Workspace Tests
+
+func TestWorkspaceUnmarshal_IsSupportWorkspaceShapes(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected bool
+	}{
+		{"bool true", `{"id": 1, "isSupportWorkspace": true}`, true},
+		{"bool false", `{"id": 1, "isSupportWorkspace": false}`, false},
+		{"string true", `{"id": 1, "isSupportWorkspace": "true"}`, true},
+		{"string false", `{"id": 1, "isSupportWorkspace": "false"}`, false},
+		{"missing", `{"id": 1}`, false},
+		{"null", `{"id": 1, "isSupportWorkspace": null}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ws Workspace
+			if err := json.Unmarshal([]byte(tt.payload), &ws); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ws.Id != 1 {
+				t.Errorf("Expected id 1, got %d", ws.Id)
+			}
+			if ws.IsSupportWorkspace != tt.expected {
+				t.Errorf("Expected IsSupportWorkspace=%v, got %v", tt.expected, ws.IsSupportWorkspace)
+			}
+		})
+	}
+}
+
+func TestGetOrgWorkspacesWithOptions_ExcludeSupport(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/orgs/42/workspaces" {
+			t.Errorf("Expected /api/orgs/42/workspaces, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"id": 1, "name": "Home", "isSupportWorkspace": false},
+			{"id": 2, "name": "Examples & Templates", "isSupportWorkspace": true},
+			{"id": 3, "name": "Support", "isSupportWorkspace": "true"},
+			{"id": 4, "name": "Projects"}
+		]`))
+	})
+	defer cleanup()
+
+	all := GetOrgWorkspaces(42)
+	if len(all) != 4 {
+		t.Errorf("Expected 4 workspaces without options, got %d", len(all))
+	}
+
+	filtered := GetOrgWorkspacesWithOptions(42, &GetWorkspacesOptions{ExcludeSupport: true})
+	if len(filtered) != 2 {
+		t.Fatalf("Expected 2 workspaces after filtering, got %d", len(filtered))
+	}
+	if filtered[0].Id != 1 || filtered[1].Id != 4 {
+		t.Errorf("Expected workspaces 1 and 4, got %d and %d", filtered[0].Id, filtered[1].Id)
+	}
+}
+
+// List functions must return empty, non-nil slices when nothing is found
+func TestListFunctions_EmptyOnNotFound(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+	})
+	defer cleanup()
+
+	records, _ := GetRecords("doc123", "Table1", nil)
+	attachments, _ := ListAttachments("doc123", nil)
+	webhooks, _ := GetWebhooks("doc123")
+
+	tests := []struct {
+		name  string
+		isNil bool
+		len   int
+	}{
+		{"GetOrgs", GetOrgs() == nil, len(GetOrgs())},
+		{"GetOrgAccess", GetOrgAccess("1") == nil, len(GetOrgAccess("1"))},
+		{"GetOrgWorkspaces", GetOrgWorkspaces(1) == nil, len(GetOrgWorkspaces(1))},
+		{"GetWorkspaceAccess", GetWorkspaceAccess(1).Users == nil, len(GetWorkspaceAccess(1).Users)},
+		{"GetDocTables", GetDocTables("doc123").Tables == nil, len(GetDocTables("doc123").Tables)},
+		{"GetTableColumns", GetTableColumns("doc123", "Table1").Columns == nil, len(GetTableColumns("doc123", "Table1").Columns)},
+		{"GetTableRows", GetTableRows("doc123", "Table1").Id == nil, len(GetTableRows("doc123", "Table1").Id)},
+		{"GetDocAccess", GetDocAccess("doc123").Users == nil, len(GetDocAccess("doc123").Users)},
+		{"GetRecords", records.Records == nil, len(records.Records)},
+		{"ListAttachments", attachments.Records == nil, len(attachments.Records)},
+		{"GetWebhooks", webhooks.Webhooks == nil, len(webhooks.Webhooks)},
+		{"GetDocWebhooks", GetDocWebhooks("doc123") == nil, len(GetDocWebhooks("doc123"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.isNil {
+				t.Errorf("%s returned a nil slice", tt.name)
+			}
+			if tt.len != 0 {
+				t.Errorf("%s returned %d items, expected 0", tt.name, tt.len)
+			}
+		})
+	}
+}
+
+func TestNewList(t *testing.T) {
+	empty := NewList[Org](nil)
+	if empty.Items == nil || empty.Count != 0 {
+		t.Errorf("Expected an empty non-nil list, got %+v", empty)
+	}
+	data, _ := json.Marshal(empty)
+	if string(data) != `{"items":[],"count":0}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+
+	orgs := NewList([]Org{{Id: 1}, {Id: 2}})
+	if orgs.Count != 2 || len(orgs.Items) != 2 {
+		t.Errorf("Expected 2 orgs, got %+v", orgs)
+	}
+}
+
+func TestRecordFunctions_InvalidPathSegments(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("No request should be sent, got %s %s", r.Method, r.URL.Path)
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name    string
+		docId   string
+		tableId string
+		field   string
+	}{
+		{"empty docId", "", "Table1", "docId"},
+		{"blank docId", "  ", "Table1", "docId"},
+		{"empty tableId", "doc123", "", "tableId"},
+		{"slash in tableId", "doc123", "Table1/records", "tableId"},
+		{"slash in docId", "doc/123", "Table1", "docId"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, status := GetRecords(tt.docId, tt.tableId, nil); status != -1 {
+				t.Errorf("GetRecords: expected status -1, got %d", status)
+			}
+			if _, status := AddRecords(tt.docId, tt.tableId, []map[string]interface{}{{"a": 1}}, nil); status != -1 {
+				t.Errorf("AddRecords: expected status -1, got %d", status)
+			}
+			msg, status := UpdateRecords(tt.docId, tt.tableId, []Record{{Id: 1}}, nil)
+			if status != -1 || !contains(msg, tt.field) {
+				t.Errorf("UpdateRecords: expected status -1 and message naming %s, got %d %q", tt.field, status, msg)
+			}
+			if _, status := UpsertRecords(tt.docId, tt.tableId, []RecordWithRequire{}, nil); status != -1 {
+				t.Errorf("UpsertRecords: expected status -1, got %d", status)
+			}
+			if _, status := DeleteRecords(tt.docId, tt.tableId, []int{1}); status != -1 {
+				t.Errorf("DeleteRecords: expected status -1, got %d", status)
+			}
+		})
+	}
+}
+
+func TestValidatePathSegment(t *testing.T) {
+	if err := validatePathSegment("docId", "abc123"); err != nil {
+		t.Errorf("Expected valid segment, got %v", err)
+	}
+	err := validatePathSegment("docId", "")
+	if !errors.Is(err, ErrInvalidPathSegment) {
+		t.Errorf("Expected ErrInvalidPathSegment, got %v", err)
+	}
+}
+
+// Document copy Tests
+
+func TestCreateDocFromTemplate(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		if r.URL.Path != "/api/docs/tmplLeadTracker/copy" {
+			t.Errorf("Expected /api/docs/tmplLeadTracker/copy, got %s", r.URL.Path)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if body["workspaceId"] != float64(12) {
+			t.Errorf("Expected workspaceId=12, got %v", body["workspaceId"])
+		}
+		if body["documentName"] != "Sales CRM" {
+			t.Errorf("Expected documentName='Sales CRM', got %v", body["documentName"])
+		}
+		if body["asTemplate"] != false {
+			t.Errorf("Expected asTemplate=false, got %v", body["asTemplate"])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"newDoc456"`))
+	})
+	defer cleanup()
+
+	docId, status := CreateDocFromTemplate(12, "tmplLeadTracker", "Sales CRM")
+	if status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+	if docId != "newDoc456" {
+		t.Errorf("Expected doc id 'newDoc456', got %q", docId)
+	}
+}
+
+func TestCreateDocFromTemplate_NotFound(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "document not found"})
+	})
+	defer cleanup()
+
+	docId, status := CreateDocFromTemplate(12, "missing", "Sales CRM")
+	if status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+	if docId != "" {
+		t.Errorf("Expected empty doc id, got %q", docId)
+	}
+}
+
+// Batched record Tests
+
+func TestAddRecordsBatched(t *testing.T) {
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var body struct {
+			Records []struct {
+				Fields map[string]interface{} `json:"fields"`
+			} `json:"records"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if len(body.Records) > 2 {
+			t.Errorf("Expected at most 2 records per batch, got %d", len(body.Records))
+		}
+		if requests == 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ids := []map[string]int{}
+		for range body.Records {
+			ids = append(ids, map[string]int{"id": requests})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"records": ids})
+	})
+	defer cleanup()
+
+	records := []map[string]interface{}{{"n": 1}, {"n": 2}, {"n": 3}, {"n": 4}, {"n": 5}}
+	result, err := AddRecordsBatched("doc123", "Table1", records, &BatchOptions{BatchSize: 2})
+	if err == nil || !contains(err.Error(), "batch 2") {
+		t.Errorf("Expected an error for batch 2, got %v", err)
+	}
+	if len(result.Records) != 4 {
+		t.Errorf("Expected the 4 records of the successful batches, got %d", len(result.Records))
+	}
+}
+
+// replaceMock serves a table whose current content is existing,
+// recording the ids deleted, the records updated and the records added
+type replaceMock struct {
+	existing []Record
+	deleted  []int
+	updated  []Record
+	added    []map[string]interface{}
+	requests map[string]int
+}
+
+func (m *replaceMock) handler(t *testing.T) http.HandlerFunc {
+	m.requests = map[string]int{}
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.requests[r.Method+" "+r.URL.Path]++
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/docs/doc123/tables/Table1/records":
+			json.NewEncoder(w).Encode(RecordsList{Records: m.existing})
+		case r.Method == "POST" && r.URL.Path == "/api/docs/doc123/tables/Table1/records/delete":
+			var ids []int
+			json.NewDecoder(r.Body).Decode(&ids)
+			m.deleted = append(m.deleted, ids...)
+		case r.Method == "PATCH" && r.URL.Path == "/api/docs/doc123/tables/Table1/records":
+			var body RecordsList
+			json.NewDecoder(r.Body).Decode(&body)
+			m.updated = append(m.updated, body.Records...)
+		case r.Method == "POST" && r.URL.Path == "/api/docs/doc123/tables/Table1/records":
+			var body RecordsList
+			json.NewDecoder(r.Body).Decode(&body)
+			ids := []map[string]int{}
+			for _, record := range body.Records {
+				m.added = append(m.added, record.Fields)
+				ids = append(ids, map[string]int{"id": 100 + len(m.added)})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"records": ids})
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestReplaceAllRecords_Truncate(t *testing.T) {
+	mock := &replaceMock{existing: []Record{
+		{Id: 1, Fields: map[string]interface{}{"name": "Alice"}},
+		{Id: 2, Fields: map[string]interface{}{"name": "Bob"}},
+		{Id: 3, Fields: map[string]interface{}{"name": "Carol"}},
+	}}
+	_, cleanup := setupMockServer(mock.handler(t))
+	defer cleanup()
+
+	records := []map[string]interface{}{{"name": "Dave"}, {"name": "Eve"}, {"name": "Frank"}}
+	result, err := ReplaceAllRecords("doc123", "Table1", records, &ReplaceRecordsOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Deleted != 3 || len(mock.deleted) != 3 {
+		t.Errorf("Expected 3 deleted records, got %d (%v)", result.Deleted, mock.deleted)
+	}
+	if len(result.Added.Records) != 3 || len(mock.added) != 3 {
+		t.Errorf("Expected 3 added records, got %d", len(result.Added.Records))
+	}
+	if result.Updated != 0 {
+		t.Errorf("Expected no update in truncate mode, got %d", result.Updated)
+	}
+	if mock.requests["POST /api/docs/doc123/tables/Table1/records/delete"] != 2 {
+		t.Errorf("Expected deletions in 2 batches, got %d", mock.requests["POST /api/docs/doc123/tables/Table1/records/delete"])
+	}
+	if mock.requests["POST /api/docs/doc123/tables/Table1/records"] != 2 {
+		t.Errorf("Expected additions in 2 batches, got %d", mock.requests["POST /api/docs/doc123/tables/Table1/records"])
+	}
+}
+
+func TestReplaceAllRecords_DiffByKey(t *testing.T) {
+	mock := &replaceMock{existing: []Record{
+		{Id: 1, Fields: map[string]interface{}{"email": "a@x.org", "name": "Alice"}},
+		{Id: 2, Fields: map[string]interface{}{"email": "b@x.org", "name": "Bob"}},
+		{Id: 3, Fields: map[string]interface{}{"email": "c@x.org", "name": "Carol"}},
+	}}
+	_, cleanup := setupMockServer(mock.handler(t))
+	defer cleanup()
+
+	records := []map[string]interface{}{
+		{"email": "a@x.org", "name": "Alice"},
+		{"email": "b@x.org", "name": "Robert"},
+		{"email": "d@x.org", "name": "Dave"},
+	}
+	result, err := ReplaceAllRecords("doc123", "Table1", records, &ReplaceRecordsOptions{KeyColumn: "email"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Updated != 1 || len(mock.updated) != 1 || mock.updated[0].Id != 2 {
+		t.Errorf("Expected record 2 to be updated, got %+v", mock.updated)
+	}
+	if result.Deleted != 1 || len(mock.deleted) != 1 || mock.deleted[0] != 3 {
+		t.Errorf("Expected record 3 to be deleted, got %v", mock.deleted)
+	}
+	if len(mock.added) != 1 || mock.added[0]["email"] != "d@x.org" {
+		t.Errorf("Expected d@x.org to be added, got %v", mock.added)
+	}
+}
+
+func TestFetchTable(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables/People/columns":
+			w.Write([]byte(`{"columns": [
+				{"id": "Name", "fields": {"label": "Full name", "type": "Text"}},
+				{"id": "Age", "fields": {"label": "Age", "type": "Numeric"}},
+				{"id": "Team", "fields": {"label": "Team", "type": "Ref:Teams"}}
+			]}`))
+		case "/api/docs/doc123/tables/People/records":
+			w.Write([]byte(`{"records": [
+				{"id": 1, "fields": {"Team": 2, "Age": 30, "Name": "Alice"}}
+			]}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+	})
+	defer cleanup()
+
+	data, status := FetchTable("doc123", "People")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if data.TableId != "People" {
+		t.Errorf("Expected table id People, got %s", data.TableId)
+	}
+	expectedColumns := []struct{ id, label, colType string }{
+		{"Name", "Full name", "Text"},
+		{"Age", "Age", "Numeric"},
+		{"Team", "Team", "Ref:Teams"},
+	}
+	if len(data.Columns) != len(expectedColumns) {
+		t.Fatalf("Expected %d columns, got %d", len(expectedColumns), len(data.Columns))
+	}
+	for i, col := range expectedColumns {
+		got := data.Columns[i]
+		if got.Id != col.id || got.Fields.Label != col.label || got.Fields.Type != col.colType {
+			t.Errorf("Column %d: got %+v, want %+v", i, got, col)
+		}
+	}
+	if len(data.Records) != 1 || data.Records[0].Fields["Name"] != "Alice" {
+		t.Errorf("Expected Alice's record, got %+v", data.Records)
+	}
+}
+
+func TestFetchTable_SchemaError(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/columns") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(RecordsList{Records: []Record{}})
+	})
+	defer cleanup()
+
+	data, status := FetchTable("doc123", "Missing")
+	if status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+	if data.Columns == nil || data.Records == nil {
+		t.Error("Expected empty, non-nil columns and records")
+	}
+}
+
+func TestUpdateRecordsByKey(t *testing.T) {
+	var patched []Record
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			var filter map[string][]interface{}
+			if err := json.Unmarshal([]byte(r.URL.Query().Get("filter")), &filter); err != nil {
+				t.Errorf("Failed to parse filter: %v", err)
+			}
+			if len(filter["email"]) != 3 {
+				t.Errorf("Expected a filter on the 3 emails, got %v", filter)
+			}
+			json.NewEncoder(w).Encode(RecordsList{Records: []Record{
+				{Id: 7, Fields: map[string]interface{}{"email": "a@x.org", "name": "Alice"}},
+				{Id: 9, Fields: map[string]interface{}{"email": "b@x.org", "name": "Bob"}},
+			}})
+		case "PATCH":
+			var body RecordsList
+			json.NewDecoder(r.Body).Decode(&body)
+			patched = append(patched, body.Records...)
+		default:
+			t.Errorf("Unexpected %s request", r.Method)
+		}
+	})
+	defer cleanup()
+
+	records := []map[string]interface{}{
+		{"email": "a@x.org", "name": "Alicia"},
+		{"email": "b@x.org", "name": "Robert"},
+		{"email": "z@x.org", "name": "Nobody"},
+	}
+	updated, err := UpdateRecordsByKey("doc123", "Table1", "email", records)
+	if updated != 2 {
+		t.Errorf("Expected 2 updated records, got %d", updated)
+	}
+	var unmatched *UnmatchedKeysError
+	if !errors.As(err, &unmatched) {
+		t.Fatalf("Expected an UnmatchedKeysError, got %v", err)
+	}
+	if len(unmatched.Keys) != 1 || unmatched.Keys[0] != "z@x.org" {
+		t.Errorf("Expected z@x.org to be reported, got %v", unmatched.Keys)
+	}
+	if len(patched) != 2 || patched[0].Id != 7 || patched[1].Id != 9 {
+		t.Errorf("Expected records 7 and 9 to be patched, got %+v", patched)
+	}
+	if patched[0].Fields["name"] != "Alicia" {
+		t.Errorf("Expected new name Alicia, got %v", patched[0].Fields["name"])
+	}
+}
+
+// captureStdout returns what fn prints on the standard output
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	fn()
+	os.Stdout = stdout
+	writer.Close()
+
+	var buf bytes.Buffer
+	buf.ReadFrom(reader)
+	return buf.String()
+}
+
+func TestStatusMessages_ASCIIMode(t *testing.T) {
+	t.Setenv("GRISTCTL_ASCII", "1")
+	failing := false
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "access denied"}`))
+		}
+	})
+	defer cleanup()
+
+	output := captureStdout(t, func() {
+		DeleteDoc("doc123")
+		DeleteWorkspace(12)
+		MoveDoc("doc123", 12)
+		PurgeDoc("doc123", 3)
+		failing = true
+		DeleteDoc("doc123")
+		DeleteOrg(1, "example")
+	})
+
+	for i, b := range []byte(output) {
+		if b >= 0x80 {
+			t.Fatalf("Output contains a multibyte character at offset %d: %q", i, output)
+		}
+	}
+	if !contains(output, "[OK]") || !contains(output, "[FAIL]") {
+		t.Errorf("Expected [OK] and [FAIL] markers, got %q", output)
+	}
+}
+
+// Access Tests
+
+func TestUpdateDocAccess_NormalizesEmails(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" || r.URL.Path != "/api/docs/doc123/access" {
+			t.Errorf("Expected PATCH /api/docs/doc123/access, got %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			Delta struct {
+				Users map[string]interface{} `json:"users"`
+			} `json:"delta"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		users := body.Delta.Users
+		if len(users) != 2 {
+			t.Errorf("Expected 2 users, got %v", users)
+		}
+		if users["alice@example.com"] != "editors" {
+			t.Errorf("Expected alice@example.com as editor, got %v", users)
+		}
+		if role, found := users["bob@example.com"]; !found || role != nil {
+			t.Errorf("Expected bob@example.com access to be removed, got %v", users)
+		}
+	})
+	defer cleanup()
+
+	status, err := UpdateDocAccess("doc123", map[string]string{
+		"  Alice@Example.COM ": "editors",
+		"BOB@example.com":      "",
+	})
+	if err != nil || status != http.StatusOK {
+		t.Errorf("Expected success, got %d %v", status, err)
+	}
+}
+
+func TestImportUsers_NormalizesEmails(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`[{"id": 5, "name": "Team"}]`))
+		case "PATCH":
+			var body struct {
+				Delta struct {
+					Users map[string]interface{} `json:"users"`
+				} `json:"delta"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Delta.Users["carol@example.com"] != "viewers" {
+				t.Errorf("Expected normalized carol@example.com, got %v", body.Delta.Users)
+			}
+		}
+	})
+	defer cleanup()
+
+	captureStdout(t, func() {
+		ImportUsers(1, "Team", []UserRole{{Email: " Carol@Example.com", Role: "viewers"}})
+	})
+}
+
+func TestSCIMBulk_NormalizesUserEmails(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		var user map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&user)
+		if user["userName"] != "dave@example.com" {
+			t.Errorf("Expected normalized userName, got %v", user["userName"])
+		}
+		emails := user["emails"].([]interface{})
+		if emails[0].(map[string]interface{})["value"] != "dave@example.com" {
+			t.Errorf("Expected normalized email, got %v", emails)
+		}
+		if user["displayName"] != "Dave SMITH" {
+			t.Errorf("Expected displayName to be kept as is, got %v", user["displayName"])
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer cleanup()
+
+	SCIMBulk(SCIMBulkRequest{
+		Schemas: []string{SCIMBulkRequestSchema},
+		Operations: []SCIMBulkOperation{{
+			Method: "POST",
+			Path:   "/Users",
+			Data: map[string]interface{}{
+				"userName":    "Dave@Example.com ",
+				"displayName": "Dave SMITH",
+				"emails":      []map[string]interface{}{{"value": " DAVE@example.com", "primary": true}},
+			},
+		}},
+	})
+}
+
+func TestDocExists(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantExists bool
+		wantErr    bool
+	}{
+		{"exists", http.StatusOK, true, false},
+		{"other 2xx", http.StatusNonAuthoritativeInfo, true, false},
+		{"not found", http.StatusNotFound, false, false},
+		{"forbidden", http.StatusForbidden, false, true},
+		{"server error", http.StatusInternalServerError, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/docs/doc123" {
+					t.Errorf("Expected path /api/docs/doc123, got %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"id": "doc123"}`))
+			})
+			defer cleanup()
+
+			exists, err := DocExists("doc123")
+			if exists != tt.wantExists {
+				t.Errorf("Expected exists %v, got %v", tt.wantExists, exists)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGetDocForms(t *testing.T) {
+	server, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables/_grist_Views_section/records":
+			if !contains(r.URL.RawQuery, "parentKey") {
+				t.Errorf("Expected a parentKey filter, got %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"records": [
+				{"id": 7, "fields": {"title": "Signup", "tableRef": 2, "parentId": 3, "shareOptions": "{\"publish\": true, \"form\": true}"}},
+				{"id": 8, "fields": {"title": "Draft", "tableRef": 2, "parentId": 4, "shareOptions": ""}}
+			]}`))
+		case "/api/docs/doc123/tables/_grist_Tables/records":
+			w.Write([]byte(`{"records": [{"id": 2, "fields": {"tableId": "Contacts"}}]}`))
+		case "/api/docs/doc123/tables/_grist_Pages/records":
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"viewRef": 3, "shareRef": 1}}, {"id": 2, "fields": {"viewRef": 4, "shareRef": 0}}]}`))
+		case "/api/docs/doc123/tables/_grist_Shares/records":
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"linkId": "abc123", "options": "{\"publish\": true}"}}]}`))
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+	})
+	defer cleanup()
+
+	forms, status := GetDocForms("doc123")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if len(forms) != 2 {
+		t.Fatalf("Expected 2 forms, got %d", len(forms))
+	}
+	published := forms[0]
+	if published.Title != "Signup" || published.TableId != "Contacts" || !published.Published {
+		t.Errorf("Unexpected published form: %+v", published)
+	}
+	if published.ShareUrl != server.URL+"/forms/abc123/7" {
+		t.Errorf("Expected share URL %s/forms/abc123/7, got %s", server.URL, published.ShareUrl)
+	}
+	if forms[1].Published || forms[1].ShareUrl != "" {
+		t.Errorf("Expected unpublished draft form, got %+v", forms[1])
+	}
+}
+
+func TestReorderColumns(t *testing.T) {
+	var patched []map[string]interface{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`{"columns": [{"id": "A"}, {"id": "B"}, {"id": "C"}]}`))
+		case "PATCH":
+			var body struct {
+				Columns []map[string]interface{} `json:"columns"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			patched = body.Columns
+		}
+	})
+	defer cleanup()
+
+	status, err := ReorderColumns("doc123", "Table1", []string{"C", "A", "B"})
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Expected success, got %d %v", status, err)
+	}
+	if len(patched) != 3 || patched[0]["id"] != "C" {
+		t.Fatalf("Unexpected PATCH body: %v", patched)
+	}
+	if pos := patched[0]["fields"].(map[string]interface{})["parentPos"]; pos != float64(1) {
+		t.Errorf("Expected parentPos 1 for C, got %v", pos)
+	}
+
+	invalid := [][]string{
+		{"C", "A", "X"},
+		{"C", "A", "A"},
+		{"C", "A"},
+	}
+	for _, order := range invalid {
+		patched = nil
+		status, err := ReorderColumns("doc123", "Table1", order)
+		if err == nil || status != -1 {
+			t.Errorf("Expected error for order %v, got %d %v", order, status, err)
+		}
+		if patched != nil {
+			t.Errorf("Expected no PATCH for order %v", order)
+		}
+	}
+}
+
+// SQL Tests
+
+// writeRecordsByIds answers a records API request with the records whose ids
+// are listed in its ?filter=, as fetched by recordsByIds. fields returns the
+// JSON fields of a record, "" for a missing one
+func writeRecordsByIds(t *testing.T, w http.ResponseWriter, r *http.Request, fields func(id int) string) {
+	t.Helper()
+	var filter struct {
+		Id []int `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("filter")), &filter); err != nil || len(filter.Id) == 0 {
+		t.Errorf("Expected records to be fetched by id, got filter %q", r.URL.Query().Get("filter"))
+	}
+	rows := []string{}
+	for _, id := range filter.Id {
+		if recordFields := fields(id); recordFields != "" {
+			rows = append(rows, fmt.Sprintf(`{"id": %d, "fields": %s}`, id, recordFields))
+		}
+	}
+	fmt.Fprintf(w, `{"records": [%s]}`, strings.Join(rows, ","))
+}
+
+func TestGetRecords_UpdatedSince(t *testing.T) {
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/api/docs/doc123/tables/Orders/records" {
+			writeRecordsByIds(t, w, r, func(id int) string {
+				return `{"Status": "open", "Paid": true, "Tags": ["L", "urgent"], "UpdatedAt": 1714567000}`
+			})
+			return
+		}
+		if r.Method != "POST" || r.URL.Path != "/api/docs/doc123/sql" {
+			t.Errorf("Expected POST /api/docs/doc123/sql, got %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			SQL  string        `json:"sql"`
+			Args []interface{} `json:"args"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		expected := `SELECT "id" FROM "Orders" WHERE "UpdatedAt" > ? AND "Status" IN (?, ?) ORDER BY "UpdatedAt" LIMIT 10`
+		if body.SQL != expected {
+			t.Errorf("Expected SQL %s, got %s", expected, body.SQL)
+		}
+		if len(body.Args) != 3 || body.Args[0] != float64(since.Unix()) {
+			t.Errorf("Unexpected args %v", body.Args)
+		}
+		w.Write([]byte(`{"statement": "", "records": [{"fields": {"id": 4}}]}`))
+	})
+	defer cleanup()
+
+	records, status := GetRecords("doc123", "Orders", &GetRecordsOptions{
+		Filter:        map[string][]interface{}{"Status": {"open", "late"}},
+		Limit:         10,
+		UpdatedSince:  since,
+		UpdatedColumn: "UpdatedAt",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if len(records.Records) != 1 || records.Records[0].Id != 4 {
+		t.Fatalf("Unexpected records %+v", records.Records)
+	}
+	if _, found := records.Records[0].Fields["id"]; found {
+		t.Errorf("Expected id to be moved out of the fields")
+	}
+	// Fields are encoded by the records API, not as SQLite stores them
+	if records.Records[0].Fields["Paid"] != true || fmt.Sprint(records.Records[0].Fields["Tags"]) != "[L urgent]" {
+		t.Errorf("Expected records API values, got %v", records.Records[0].Fields)
+	}
+
+	_, status = GetRecords("doc123", "Orders", &GetRecordsOptions{UpdatedSince: since})
+	if status != -1 {
+		t.Errorf("Expected status -1 without UpdatedColumn, got %d", status)
+	}
+}
+
+func TestUpdatedSinceTracker(t *testing.T) {
+	calls := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			if r.Method != "GET" {
+				t.Errorf("Expected a full fetch first, got %s", r.Method)
+			}
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"UpdatedAt": 1700000000}}, {"id": 2, "fields": {"UpdatedAt": 1700000500}}]}`))
+		case 2:
+			var body struct {
+				Args []interface{} `json:"args"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if len(body.Args) != 1 || body.Args[0] != float64(1700000500) {
+				t.Errorf("Expected high-water mark 1700000500, got %v", body.Args)
+			}
+			w.Write([]byte(`{"records": []}`))
+		}
+	})
+	defer cleanup()
+
+	tracker := &UpdatedSinceTracker{DocId: "doc123", TableId: "Orders", UpdatedColumn: "UpdatedAt"}
+	records, _ := tracker.Next()
+	if len(records.Records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records.Records))
+	}
+	if !tracker.Since.Equal(time.Unix(1700000500, 0)) {
+		t.Errorf("Expected Since to advance to 1700000500, got %v", tracker.Since)
+	}
+	records, _ = tracker.Next()
+	if len(records.Records) != 0 || calls != 2 {
+		t.Errorf("Expected no new records after 2 calls, got %d records, %d calls", len(records.Records), calls)
+	}
+}
+
+func TestGetRecords_WherePushdown(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/api/docs/doc123/tables/Orders/records" {
+			t.Errorf("Expected GET on records, got %s %s", r.Method, r.URL.Path)
+		}
+		var filter map[string][]interface{}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filter")), &filter); err != nil {
+			t.Fatalf("Invalid filter parameter: %v", err)
+		}
+		if len(filter) != 2 || len(filter["Status"]) != 2 || filter["Region"][0] != "EU" {
+			t.Errorf("Unexpected filter %v", filter)
+		}
+		w.Write([]byte(`{"records": [{"id": 1, "fields": {"Status": "open", "Region": "EU"}}]}`))
+	})
+	defer cleanup()
+
+	where := Eq("Region", "EU")
+	records, status := GetRecords("doc123", "Orders", &GetRecordsOptions{
+		Filter: map[string][]interface{}{"Status": {"open", "late"}},
+		Where:  &where,
+	})
+	if status != http.StatusOK || len(records.Records) != 1 {
+		t.Fatalf("Unexpected result %d %+v", status, records.Records)
+	}
+}
+
+func TestGetRecords_WhereFallback(t *testing.T) {
+	var sqlCalls, getCalls int
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			sqlCalls++
+			var body struct {
+				SQL string `json:"sql"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			expected := `SELECT "id" FROM "Orders" WHERE "Amount" >= ? AND instr("Name", ?) > 0 LIMIT 2`
+			if body.SQL != expected {
+				t.Errorf("Expected SQL %s, got %s", expected, body.SQL)
+			}
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "No view access"}`))
+		case "GET":
+			getCalls++
+			if r.URL.Query().Get("limit") != "" {
+				t.Errorf("Expected no limit on the unfiltered fetch")
+			}
+			w.Write([]byte(`{"records": [
+				{"id": 1, "fields": {"Amount": 50, "Name": "widget"}},
+				{"id": 2, "fields": {"Amount": 150, "Name": "gadget"}},
+				{"id": 3, "fields": {"Amount": 200, "Name": "widget XL"}},
+				{"id": 4, "fields": {"Amount": 100, "Name": "widget S"}},
+				{"id": 5, "fields": {"Amount": 300, "Name": "widget XXL"}}
+			]}`))
+		}
+	})
+	defer cleanup()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	where := And(Ge("Amount", 100), Contains("Name", "widget"))
+	records, status := GetRecords("doc123", "Orders", &GetRecordsOptions{Where: &where, Limit: 2})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if sqlCalls != 1 || getCalls != 1 {
+		t.Errorf("Expected one SQL then one GET request, got %d and %d", sqlCalls, getCalls)
+	}
+	if len(records.Records) != 2 || records.Records[0].Id != 3 || records.Records[1].Id != 4 {
+		t.Errorf("Unexpected records %+v", records.Records)
+	}
+	if !contains(logs.String(), "client-side") {
+		t.Errorf("Expected a performance warning, got %q", logs.String())
+	}
+}
+
+func TestWebURLs(t *testing.T) {
+	oldURL := os.Getenv("GRIST_URL")
+	defer os.Setenv("GRIST_URL", oldURL)
+	os.Setenv("GRIST_URL", "https://grist.example.com/api/")
+
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"default domain org", OrgWebURL(Org{Domain: "team"}), "https://grist.example.com/o/team"},
+		{"custom domain org", OrgWebURL(Org{Domain: "team", Host: "grist.team.org"}), "https://grist.team.org"},
+		{"no org", OrgWebURL(Org{}), "https://grist.example.com"},
+		{"workspace", WorkspaceWebURL(Org{Domain: "team"}, 12), "https://grist.example.com/o/team/ws/12/"},
+		{"doc", docWebURL(Org{Domain: "team"}, "doc123"), "https://grist.example.com/o/team/doc/doc123"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, tt.got)
+		}
+	}
+
+	os.Setenv("GRIST_URL", "http://grist.local:8484")
+	if got := OrgWebURL(Org{Domain: "team", Host: "team.grist.local"}); got != "http://team.grist.local" {
+		t.Errorf("Expected the scheme of GRIST_URL, got %s", got)
+	}
+}
+
+func TestDocWebURL(t *testing.T) {
+	server, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "doc123", "workspace": {"id": 3, "org": {"id": 1, "domain": "team"}}}`))
+	})
+	defer cleanup()
+
+	expected := server.URL + "/o/team/doc/doc123"
+	if got := DocWebURL("doc123"); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestIterateRecordsKeyset(t *testing.T) {
+	const total = 2*DefaultBatchSize + 3
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			writeRecordsByIds(t, w, r, func(id int) string { return fmt.Sprintf(`{"Serial": %d}`, id) })
+			return
+		}
+		requests++
+		var body struct {
+			SQL  string        `json:"sql"`
+			Args []interface{} `json:"args"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if !strings.HasPrefix(body.SQL, `SELECT "id", "Serial" FROM`) || !contains(body.SQL, `ORDER BY "Serial"`) || !contains(body.SQL, fmt.Sprintf("LIMIT %d", DefaultBatchSize)) {
+			t.Errorf("Unexpected SQL %s", body.SQL)
+		}
+		lastSeen := 0
+		if len(body.Args) == 1 {
+			lastSeen = int(body.Args[0].(float64))
+		}
+		rows := []string{}
+		for serial := lastSeen + 1; serial <= total && len(rows) < DefaultBatchSize; serial++ {
+			rows = append(rows, fmt.Sprintf(`{"fields": {"id": %d, "Serial": %d}}`, serial, serial))
+		}
+		fmt.Fprintf(w, `{"records": [%s]}`, strings.Join(rows, ","))
+	})
+	defer cleanup()
+
+	seen := map[int]int{}
+	err := IterateRecordsKeyset("doc123", "Events", "Serial", func(page []Record) error {
+		for _, record := range page {
+			seen[int(record.Fields["Serial"].(float64))]++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(seen) != total {
+		t.Errorf("Expected %d distinct records, got %d", total, len(seen))
+	}
+	for serial := 1; serial <= total; serial++ {
+		if seen[serial] != 1 {
+			t.Errorf("Record %d seen %d times", serial, seen[serial])
+		}
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 pages, got %d", requests)
+	}
+
+	stop := errors.New("stop")
+	err = IterateRecordsKeyset("doc123", "Events", "Serial", func(page []Record) error { return stop })
+	if err != stop {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+}
+
+// Without the SQL endpoint, the table is read at once and split in pages
+func TestIterateRecordsKeyset_Fallback(t *testing.T) {
+	const total = DefaultBatchSize + 10
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "No full access"}`))
+			return
+		}
+		if r.URL.Query().Get("sort") != "Serial" || r.URL.Query().Get("filter") != "" {
+			t.Errorf("Expected the whole table sorted by Serial, got %s", r.URL.RawQuery)
+		}
+		rows := []string{`{"id": 9999, "fields": {"Serial": null, "Done": false}}`}
+		for id := 1; id <= total; id++ {
+			rows = append(rows, fmt.Sprintf(`{"id": %d, "fields": {"Serial": %d, "Done": true}}`, id, id))
+		}
+		fmt.Fprintf(w, `{"records": [%s]}`, strings.Join(rows, ","))
+	})
+	defer cleanup()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	pages, records := 0, 0
+	err := IterateRecordsKeyset("doc123", "Events", "Serial", func(page []Record) error {
+		pages++
+		for _, record := range page {
+			records++
+			if record.Fields["Done"] != true {
+				t.Errorf("Unexpected record %+v", record)
+			}
+		}
+		return nil
+	})
+	if err != nil || pages != 2 || records != total {
+		t.Errorf("Expected %d records in 2 pages, got %d in %d: %v", total, records, pages, err)
+	}
+	if !contains(logs.String(), "SQL endpoint unavailable") {
+		t.Errorf("Expected a warning, got %q", logs.String())
+	}
+}
+
+func TestRecordsByIds(t *testing.T) {
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("hidden") != "true" {
+			t.Errorf("Expected the Hidden option to be kept, got %s", r.URL.RawQuery)
+		}
+		writeRecordsByIds(t, w, r, func(id int) string {
+			if id == 7 {
+				return "" // Deleted meanwhile
+			}
+			return fmt.Sprintf(`{"N": %d}`, id)
+		})
+	})
+	defer cleanup()
+
+	ids := []int{}
+	for id := 2*recordsByIdsBatch + 50; id > 0; id-- {
+		ids = append(ids, id)
+	}
+	records, _, err := defaultClient.recordsByIds("doc123", "Table1", ids, &GetRecordsOptions{Hidden: true})
+	if err != nil || requests != 3 {
+		t.Fatalf("Expected 3 requests, got %d: %v", requests, err)
+	}
+	if len(records) != len(ids)-1 || records[0].Id != ids[0] || records[len(records)-1].Id != 1 {
+		t.Errorf("Expected the records in the order of the ids, without the missing one")
+	}
+}
+
+// Document settings Tests
+
+func TestDocSettings(t *testing.T) {
+	var applied []interface{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/docs/doc123/tables/_grist_DocInfo/records":
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"timezone": "America/New_York", "documentSettings": "{\"locale\": \"en-US\", \"engine\": \"python3\"}"}}]}`))
+		case r.Method == "POST" && r.URL.Path == "/api/docs/doc123/apply":
+			json.NewDecoder(r.Body).Decode(&applied)
+			w.Write([]byte(`{"actionNum": 2}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer cleanup()
+
+	settings, status := GetDocSettings("doc123")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	expected := DocSettings{Timezone: "America/New_York", Locale: "en-US"}
+	if settings != expected {
+		t.Errorf("Expected %+v, got %+v", expected, settings)
+	}
+
+	status, err := UpdateDocSettings("doc123", DocSettings{Timezone: "Europe/Paris", Currency: "EUR"})
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Expected success, got %d %v", status, err)
+	}
+	if len(applied) != 1 {
+		t.Fatalf("Expected one action, got %v", applied)
+	}
+	action := applied[0].([]interface{})
+	if action[0] != "UpdateRecord" || action[1] != "_grist_DocInfo" {
+		t.Errorf("Unexpected action %v", action)
+	}
+	fields := action[3].(map[string]interface{})
+	if fields["timezone"] != "Europe/Paris" {
+		t.Errorf("Expected timezone Europe/Paris, got %v", fields["timezone"])
+	}
+	var documentSettings map[string]interface{}
+	json.Unmarshal([]byte(fields["documentSettings"].(string)), &documentSettings)
+	if documentSettings["currency"] != "EUR" || documentSettings["locale"] != "en-US" || documentSettings["engine"] != "python3" {
+		t.Errorf("Expected merged document settings, got %v", documentSettings)
+	}
+}
+
+func TestGetRecords_UseNumber(t *testing.T) {
+	// 2^53 + 1 cannot be represented exactly as a float64
+	const big = int64(9007199254740993)
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"records": [{"id": 1, "fields": {"counter": %d, "ratio": 0.5}}]}`, big)
+	})
+	defer cleanup()
+
+	records, _ := GetRecords("doc123", "Table1", nil)
+	if value, _ := records.Records[0].GetInt("counter"); value == big {
+		t.Errorf("Expected float64 decoding to lose precision")
+	}
+
+	records, status := GetRecords("doc123", "Table1", &GetRecordsOptions{UseNumber: true})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	record := records.Records[0]
+	if value, ok := record.GetInt("counter"); !ok || value != big {
+		t.Errorf("Expected exact value %d, got %d (%v)", big, value, ok)
+	}
+	if value, ok := record.GetFloat("ratio"); !ok || value != 0.5 {
+		t.Errorf("Expected ratio 0.5, got %v (%v)", value, ok)
+	}
+	if _, ok := record.GetInt("ratio"); ok {
+		t.Errorf("Expected GetInt to fail on a decimal value")
+	}
+	if _, ok := record.GetInt("missing"); ok {
+		t.Errorf("Expected GetInt to fail on a missing field")
+	}
+}
+
+func TestProvisionProject(t *testing.T) {
+	tests := []struct {
+		name            string
+		workspaces      string
+		docStatus       int
+		wantErr         bool
+		wantWorkspaceId int
+		wantDeleted     bool
+	}{
+		{"new workspace", `[]`, http.StatusOK, false, 42, false},
+		{"existing workspace", `[{"id": 7, "name": "Project"}]`, http.StatusOK, false, 7, false},
+		{"rollback on doc failure", `[]`, http.StatusForbidden, true, 0, true},
+		{"no rollback of existing workspace", `[{"id": 7, "name": "Project"}]`, http.StatusForbidden, true, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deleted := false
+			_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == "GET" && r.URL.Path == "/api/orgs/1/workspaces":
+					w.Write([]byte(tt.workspaces))
+				case r.Method == "POST" && r.URL.Path == "/api/orgs/1/workspaces":
+					w.Write([]byte(`42`))
+				case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/docs"):
+					w.WriteHeader(tt.docStatus)
+					w.Write([]byte(`"newdoc"`))
+				case r.Method == "DELETE" && r.URL.Path == "/api/workspaces/42":
+					deleted = true
+				default:
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+				}
+			})
+			defer cleanup()
+
+			workspaceId, docId, err := ProvisionProject(1, "Project", "Main")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if workspaceId != tt.wantWorkspaceId {
+				t.Errorf("Expected workspace %d, got %d", tt.wantWorkspaceId, workspaceId)
+			}
+			if !tt.wantErr && docId != "newdoc" {
+				t.Errorf("Expected doc newdoc, got %q", docId)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("Expected workspace deleted %v, got %v", tt.wantDeleted, deleted)
+			}
+		})
+	}
+}
+
+func TestGetDocTables_Titles(t *testing.T) {
+	sqlForbidden, metadataFails := false, false
+	var requests []string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables":
+			w.Write([]byte(`{"tables": [
+				{"id": "Client_list", "fields": {"primaryViewId": 1, "rawViewSectionRef": 2}},
+				{"id": "Orders", "fields": {"primaryViewId": 3, "rawViewSectionRef": 4}},
+				{"id": "Summary_Orders", "fields": {"primaryViewId": 0, "rawViewSectionRef": 5, "summarySourceTable": 2}}
+			]}`))
+		case "/api/docs/doc123/sql":
+			if sqlForbidden {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error": "Only owners can use SQL"}`))
+				return
+			}
+			var body struct {
+				SQL string `json:"sql"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			switch body.SQL {
+			case `SELECT id, "title" FROM "_grist_Views_section"`:
+				w.Write([]byte(`{"records": [{"fields": {"id": 2, "title": "Client list (2024)"}}, {"fields": {"id": 4, "title": ""}}]}`))
+			case `SELECT id, "name" FROM "_grist_Views"`:
+				w.Write([]byte(`{"records": [{"fields": {"id": 1, "name": "Clients"}}, {"fields": {"id": 3, "name": "Sales orders"}}]}`))
+			default:
+				t.Errorf("Unexpected query %s", body.SQL)
+			}
+		case "/api/docs/doc123/tables/_grist_Views_section/records":
+			if metadataFails {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "metadata unavailable"}`))
+				return
+			}
+			w.Write([]byte(`{"records": [{"id": 2, "fields": {"title": "Client list (2024)"}}, {"id": 4, "fields": {"title": ""}}]}`))
+		case "/api/docs/doc123/tables/_grist_Views/records":
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"name": "Clients"}}, {"id": 3, "fields": {"name": "Sales orders"}}]}`))
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+	})
+	defer cleanup()
+
+	// GetDocTables doesn't read the metadata
+	if tables := GetDocTables("doc123").Tables; len(tables) != 3 || tables[0].Title != "" || len(requests) != 1 {
+		t.Errorf("Expected the tables without titles in one request, got %+v after %v", tables, requests)
+	}
+
+	expected := map[string]string{
+		"Client_list":    "Client list (2024)",
+		"Orders":         "Sales orders",
+		"Summary_Orders": "Summary_Orders",
+	}
+	for _, forbidden := range []bool{false, true} {
+		sqlForbidden = forbidden
+		tables, err := GetDocTableTitles("doc123")
+		if err != nil || len(tables.Tables) != len(expected) {
+			t.Fatalf("SQL forbidden %v: unexpected result %+v, %v", forbidden, tables, err)
+		}
+		for _, table := range tables.Tables {
+			if table.Title != expected[table.Id] {
+				t.Errorf("SQL forbidden %v: table %s: expected title %q, got %q", forbidden, table.Id, expected[table.Id], table.Title)
+			}
+		}
+	}
+
+	// Unreadable metadata is reported, and the titles fall back to page names
+	metadataFails = true
+	tables, err := GetDocTableTitles("doc123")
+	if err == nil || !contains(err.Error(), "metadata unavailable") || tables.Tables[0].Title != "Clients" {
+		t.Errorf("Expected the metadata error and the page names as titles, got %+v, %v", tables, err)
+	}
+}
+
+func TestUnauthorizedErrors(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "Bad API key"}`))
+	})
+	defer cleanup()
+
+	calls := map[string]func() error{
+		"DocExists": func() error {
+			_, err := DocExists("doc123")
+			return err
+		},
+		"UpdateDocAccess": func() error {
+			_, err := UpdateDocAccess("doc123", map[string]string{"a@example.com": "viewers"})
+			return err
+		},
+		"ReorderColumns": func() error {
+			_, err := ReorderColumns("doc123", "Table1", []string{"A"})
+			return err
+		},
+		"UpdateDocSettings": func() error {
+			_, err := UpdateDocSettings("doc123", DocSettings{Timezone: "UTC"})
+			return err
+		},
+		"AddRecordsBatched": func() error {
+			_, err := AddRecordsBatched("doc123", "Table1", []map[string]interface{}{{"A": 1}}, nil)
+			return err
+		},
+		"ReplaceAllRecords": func() error {
+			_, err := ReplaceAllRecords("doc123", "Table1", nil, nil)
+			return err
+		},
+		"IterateRecordsKeyset": func() error {
+			return IterateRecordsKeyset("doc123", "Table1", "id", func([]Record) error { return nil })
+		},
+		"SetWebhookEnabled": func() error {
+			_, err := SetWebhookEnabled("doc123", "hook1", false)
+			return err
+		},
+		"GetOrgsWithError": func() error {
+			_, err := GetOrgsWithError()
+			return err
+		},
+		"GetOrgAccessWithError": func() error {
+			_, err := GetOrgAccessWithError("1")
+			return err
+		},
+		"GetOrgWorkspacesWithError": func() error {
+			_, err := GetOrgWorkspacesWithError(1)
+			return err
+		},
+		"GetWorkspaceOK": func() error {
+			_, _, err := GetWorkspaceOK(1)
+			return err
+		},
+		"GetWorkspaceAccessWithError": func() error {
+			_, err := GetWorkspaceAccessWithError(1)
+			return err
+		},
+		"GetDocOK": func() error {
+			_, _, err := GetDocOK("doc123")
+			return err
+		},
+		"GetDocTablesWithError": func() error {
+			_, err := GetDocTablesWithError("doc123")
+			return err
+		},
+		"GetTableColumnsWithError": func() error {
+			_, err := GetTableColumnsWithError("doc123", "Table1")
+			return err
+		},
+		"GetTableRowsWithError": func() error {
+			_, err := GetTableRowsWithError("doc123", "Table1")
+			return err
+		},
+		"GetDocAccessWithError": func() error {
+			_, err := GetDocAccessWithError("doc123")
+			return err
+		},
+		"GetDocWebhooksWithError": func() error {
+			_, err := GetDocWebhooksWithError("doc123")
+			return err
+		},
+		"GetOrgUsageSummaryWithError": func() error {
+			_, err := GetOrgUsageSummaryWithError("1")
+			return err
+		},
+		"DeleteDoc": func() error {
+			return DeleteDoc("doc123")
+		},
+		"MoveDoc": func() error {
+			return MoveDoc("doc123", 1)
+		},
+		"MoveAllDocs": func() error {
+			return MoveAllDocs(1, 2)
+		},
+		"ExportWorkspaceArchive": func() error {
+			return ExportWorkspaceArchive(1, io.Discard, "grist")
+		},
+		"PurgeDoc": func() error {
+			return PurgeDoc("doc123", 3)
+		},
+		"ImportUsers": func() error {
+			return ImportUsers(1, "Team", []UserRole{{Email: "a@example.com", Role: "viewers"}})
+		},
+		"EnsureWorkspace": func() error {
+			_, _, err := EnsureWorkspace(1, "Team")
+			return err
+		},
+		"CreateOrgWithError": func() error {
+			_, err := CreateOrgWithError("Team", "team")
+			return err
+		},
+		"GetMyApiKeyWithError": func() error {
+			_, _, err := GetMyApiKeyWithError()
+			return err
+		},
+		"RegenerateMyApiKeyWithError": func() error {
+			_, _, err := RegenerateMyApiKeyWithError()
+			return err
+		},
+		"GetDocUsageWithError": func() error {
+			_, _, err := GetDocUsageWithError("doc123")
+			return err
+		},
+		"CopyDocWithError": func() error {
+			_, _, err := CopyDocWithError("doc123", 1, "Copy", false)
+			return err
+		},
+		"GetTableContentWithError": func() error {
+			_, _, err := GetTableContentWithError("doc123", "Table1")
+			return err
+		},
+		"DeleteRecordsBatched": func() error {
+			_, err := DeleteRecordsBatched("doc123", "Table1", []int{1}, nil)
+			return err
+		},
+		"ListAttachmentsWithError": func() error {
+			_, _, err := ListAttachmentsWithError("doc123", nil)
+			return err
+		},
+		"GetAttachmentMetadataWithError": func() error {
+			_, _, err := GetAttachmentMetadataWithError("doc123", 1)
+			return err
+		},
+		"DeleteUnusedAttachmentsWithError": func() error {
+			_, _, err := DeleteUnusedAttachmentsWithError("doc123")
+			return err
+		},
+		"GetWebhooksWithError": func() error {
+			_, _, err := GetWebhooksWithError("doc123")
+			return err
+		},
+		"CreateWebhooksWithError": func() error {
+			_, _, err := CreateWebhooksWithError("doc123", []WebhookPartialFields{{}})
+			return err
+		},
+		"DeleteWebhookWithError": func() error {
+			_, _, err := DeleteWebhookWithError("doc123", "hook1")
+			return err
+		},
+		"ClearWebhookQueueWithError": func() error {
+			_, _, err := ClearWebhookQueueWithError("doc123")
+			return err
+		},
+	}
+	for name, call := range calls {
+		err := call()
+		if !IsUnauthorized(err) {
+			t.Errorf("%s: expected an unauthorized error, got %v", name, err)
+			continue
+		}
+		if !contains(err.Error(), "Bad API key") {
+			t.Errorf("%s: expected the server message in %q", name, err.Error())
+		}
+	}
+
+	if IsUnauthorized(&APIError{Status: http.StatusForbidden}) || IsUnauthorized(nil) {
+		t.Errorf("Expected only 401 errors to be unauthorized")
+	}
+}
+
+func TestTouchRecords(t *testing.T) {
+	var patched []Record
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/columns"):
+			w.Write([]byte(`{"columns": [{"id": "Name", "fields": {"isFormula": false}}, {"id": "Total", "fields": {"isFormula": true}}]}`))
+		case r.Method == "GET":
+			if filter := r.URL.Query().Get("filter"); !contains(filter, `"id"`) {
+				t.Errorf("Expected an id filter, got %s", filter)
+			}
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"Name": "Alice", "Total": 10}}, {"id": 2, "fields": {"Name": "Bob", "Total": 20}}]}`))
+		case r.Method == "PATCH":
+			if !contains(r.URL.RawQuery, "noparse=true") {
+				t.Errorf("Expected noparse, got %s", r.URL.RawQuery)
+			}
+			var body RecordsList
+			json.NewDecoder(r.Body).Decode(&body)
+			patched = body.Records
+		}
+	})
+	defer cleanup()
+
+	touched, err := TouchRecords("doc123", "People", []int{1, 2})
+	if err != nil || touched != 2 {
+		t.Fatalf("Expected 2 records touched, got %d %v", touched, err)
+	}
+	if len(patched) != 2 || patched[0].Fields["Name"] != "Alice" {
+		t.Fatalf("Unexpected PATCH body %+v", patched)
+	}
+	if _, found := patched[0].Fields["Total"]; found {
+		t.Errorf("Expected formula columns not to be written")
+	}
+
+	patched = nil
+	if _, err := TouchRecords("doc123", "People", []int{1, 3}); err == nil || !contains(err.Error(), "3") {
+		t.Errorf("Expected an error naming record 3, got %v", err)
+	}
+	if patched != nil {
+		t.Errorf("Expected nothing written when ids are missing")
+	}
+}
+
+func TestExportWorkspaceArchive(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/workspaces/3":
+			w.Write([]byte(`{"id": 3, "name": "Backups", "docs": [
+				{"id": "doc1", "name": "Budget"},
+				{"id": "doc2", "name": "Budget"},
+				{"id": "doc3", "name": "Plans/2024"},
+				{"id": "doc4", "name": "Broken"}
+			]}`))
+		case "/api/docs/doc4/download":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": "export failed"}`))
+		default:
+			w.Write([]byte("SQLite format 3\x00" + r.URL.Path))
+		}
+	})
+	defer cleanup()
+
+	var buffer bytes.Buffer
+	err := ExportWorkspaceArchive(3, &buffer, "grist")
+	if err == nil || !contains(err.Error(), "doc4") {
+		t.Errorf("Expected an error reporting doc4, got %v", err)
+	}
+
+	archive, zipErr := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if zipErr != nil {
+		t.Fatalf("Expected a valid zip archive, got %v", zipErr)
+	}
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(content)
+	}
+	expected := map[string]string{
+		"Budget-doc1.grist": "/api/docs/doc1/download",
+		"Budget-doc2.grist": "/api/docs/doc2/download",
+		"Plans_2024.grist":  "/api/docs/doc3/download",
+	}
+	if len(files) != len(expected) {
+		t.Errorf("Expected %d files, got %v", len(expected), files)
+	}
+	for name, path := range expected {
+		if files[name] != "SQLite format 3\x00"+path {
+			t.Errorf("Unexpected content for %s: %q", name, files[name])
+		}
+	}
+
+	if err := ExportWorkspaceArchive(3, &buffer, "pdf"); err == nil {
+		t.Errorf("Expected an error for an unsupported format")
+	}
+}
+
+func TestGetWebhookDeliveries(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"webhooks": [
+			{"id": "hook1", "fields": {"name": "sync"}, "usage": {
+				"numWaiting": 3, "status": "retrying",
+				"lastSuccessTime": 1700000000000, "lastFailureTime": 1700000600000,
+				"lastErrorMessage": "connect ECONNREFUSED", "lastHttpStatus": 502,
+				"lastEventBatch": {"size": 3, "status": "failure", "attempts": 4}
+			}},
+			{"id": "hook2", "fields": {"name": "new"}}
+		]}`))
+	})
+	defer cleanup()
+
+	deliveries, status := GetWebhookDeliveries("doc123", "hook1", 0)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %d", len(deliveries))
+	}
+	failure := deliveries[0]
+	if failure.Status != "failure" || failure.HttpStatus != 502 || failure.Response != "connect ECONNREFUSED" || failure.Attempts != 4 {
+		t.Errorf("Unexpected failure delivery %+v", failure)
+	}
+	if !failure.Time.Equal(time.UnixMilli(1700000600000)) {
+		t.Errorf("Unexpected failure time %v", failure.Time)
+	}
+	if deliveries[1].Status != "success" {
+		t.Errorf("Expected the success last, got %+v", deliveries[1])
+	}
+
+	if deliveries, _ := GetWebhookDeliveries("doc123", "hook1", 1); len(deliveries) != 1 {
+		t.Errorf("Expected limit to keep 1 delivery, got %d", len(deliveries))
+	}
+	if deliveries, status := GetWebhookDeliveries("doc123", "hook2", 0); status != http.StatusOK || len(deliveries) != 0 {
+		t.Errorf("Expected no deliveries for hook2, got %d %v", status, deliveries)
+	}
+	if _, status := GetWebhookDeliveries("doc123", "missing", 0); status != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown webhook, got %d", status)
+	}
+}
+
+func TestGetDocsAccess_Concurrent(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		docId := strings.Split(r.URL.Path, "/")[3]
+		if docId == "doc7" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "No view access"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"maxInheritedRole": "owners", "users": [{"id": 1, "email": "%s@example.com"}]}`, docId)
+	})
+	defer cleanup()
+
+	docIds := []string{}
+	for i := 0; i < 20; i++ {
+		docIds = append(docIds, fmt.Sprintf("doc%d", i))
+	}
+	accesses, err := GetDocsAccess(docIds)
+	if err == nil || !contains(err.Error(), "doc7") {
+		t.Errorf("Expected an error for doc7, got %v", err)
+	}
+	if len(accesses) != 19 {
+		t.Errorf("Expected 19 documents, got %d", len(accesses))
+	}
+	if accesses["doc3"].Users[0].Email != "doc3@example.com" {
+		t.Errorf("Unexpected access for doc3: %+v", accesses["doc3"])
+	}
+	if maxInFlight < 2 || maxInFlight > docsAccessWorkers {
+		t.Errorf("Expected between 2 and %d concurrent requests, got %d", docsAccessWorkers, maxInFlight)
+	}
+}
+
+func TestGetOKVariants(t *testing.T) {
+	statuses := map[string]int{
+		"found":     http.StatusOK,
+		"missing":   http.StatusNotFound,
+		"forbidden": http.StatusForbidden,
+	}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.URL.Path, "/")
+		w.WriteHeader(statuses[parts[len(parts)-1]])
+		w.Write([]byte(`{"name": "Entity"}`))
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name      string
+		wantFound bool
+		wantErr   bool
+	}{
+		{"found", true, false},
+		{"missing", false, false},
+		{"forbidden", false, true},
+	}
+	for _, tt := range tests {
+		_, found, err := GetDocOK(tt.name)
+		if found != tt.wantFound || (err != nil) != tt.wantErr {
+			t.Errorf("GetDocOK(%s): expected found=%v err=%v, got %v %v", tt.name, tt.wantFound, tt.wantErr, found, err)
+		}
+		org, found, err := GetOrgOK(tt.name)
+		if found != tt.wantFound || (err != nil) != tt.wantErr {
+			t.Errorf("GetOrgOK(%s): expected found=%v err=%v, got %v %v", tt.name, tt.wantFound, tt.wantErr, found, err)
+		}
+		if !found && org.Id != 0 {
+			t.Errorf("GetOrgOK(%s): expected a zero value when not found, got %+v", tt.name, org)
+		}
+	}
+
+	statuses["404"] = http.StatusNotFound
+	if _, found, err := GetWorkspaceOK(404); found || err != nil {
+		t.Errorf("GetWorkspaceOK: expected not found without error, got %v %v", found, err)
+	}
+}
+
+func TestGristURLWithAPISuffix(t *testing.T) {
+	server, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/orgs" {
+			t.Errorf("Expected path /api/orgs, got %s", r.URL.Path)
+		}
+		w.Write([]byte(`[{"id": 1, "name": "Org"}]`))
+	})
+	defer cleanup()
+
+	for _, url := range []string{server.URL + "/api", server.URL + "/api/", server.URL + "/"} {
+		os.Setenv("GRIST_URL", url)
+		if orgs := GetOrgs(); len(orgs) != 1 {
+			t.Errorf("GRIST_URL=%s: expected 1 organization, got %d", url, len(orgs))
+		}
+	}
+}
+
+func TestRecordFieldsEqual(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        map[string]interface{}
+		b        map[string]interface{}
+		expected bool
+	}{
+		{"int vs float64", map[string]interface{}{"n": 3}, map[string]interface{}{"n": float64(3)}, true},
+		{"int64 vs json.Number", map[string]interface{}{"n": int64(9007199254740993)}, map[string]interface{}{"n": json.Number("9007199254740993")}, true},
+		{"different numbers", map[string]interface{}{"n": 3}, map[string]interface{}{"n": 3.5}, false},
+		{"nil vs missing", map[string]interface{}{"a": "x", "b": nil}, map[string]interface{}{"a": "x"}, true},
+		{"missing vs nil", map[string]interface{}{"a": "x"}, map[string]interface{}{"a": "x", "b": nil}, true},
+		{"missing vs value", map[string]interface{}{"a": "x"}, map[string]interface{}{"a": "x", "b": 0}, false},
+		{"string vs number", map[string]interface{}{"n": "3"}, map[string]interface{}{"n": 3}, false},
+		{"lists", map[string]interface{}{"l": []interface{}{"L", 1, 2}}, map[string]interface{}{"l": []interface{}{"L", float64(1), float64(2)}}, true},
+		{"empty", map[string]interface{}{}, nil, true},
+	}
+	for _, tt := range tests {
+		if got := RecordFieldsEqual(tt.a, tt.b); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+// Dump Tests
+
+func TestDumpDoc_Resume(t *testing.T) {
+	failB := true
+	sqlCalls := map[string]int{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/docs/doc123/tables":
+			w.Write([]byte(`{"tables": [{"id": "A"}, {"id": "B"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/columns"):
+			w.Write([]byte(`{"columns": [{"id": "Name", "fields": {"type": "Text"}}]}`))
+		case r.URL.Path == "/api/docs/doc123/sql":
+			var body struct {
+				SQL string `json:"sql"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			table := "A"
+			if contains(body.SQL, `FROM "B"`) {
+				table = "B"
+			}
+			sqlCalls[table]++
+			if table == "B" && failB {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(`{"records": [{"fields": {"id": 1}}, {"fields": {"id": 2}}]}`))
+		case strings.HasSuffix(r.URL.Path, "/records") && !contains(r.URL.Path, "_grist_"):
+			table := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/docs/doc123/tables/"), "/records")
+			writeRecordsByIds(t, w, r, func(id int) string {
+				return fmt.Sprintf(`{"Name": "%s%d", "manualSort": %d}`, table, id, id)
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	dir := t.TempDir()
+	if err := DumpDoc("doc123", dir, DumpOptions{}); err == nil {
+		t.Fatalf("Expected the dump of B to fail")
+	}
+	failB = false
+	if err := DumpDoc("doc123", dir, DumpOptions{}); err != nil {
+		t.Fatalf("Expected the resumed dump to succeed, got %v", err)
+	}
+	if sqlCalls["A"] != 1 {
+		t.Errorf("Expected table A to be dumped once, got %d", sqlCalls["A"])
+	}
+
+	content, err := os.ReadFile(dir + "/B.jsonl")
+	if err != nil {
+		t.Fatalf("Expected B.jsonl, got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 || lines[0] != `{"id":1,"fields":{"Name":"B1"}}` {
+		t.Errorf("Unexpected B.jsonl content %q", content)
+	}
+	var schema DocSchema
+	schemaContent, _ := os.ReadFile(dir + "/schema.json")
+	json.Unmarshal(schemaContent, &schema)
+	if len(schema.Tables) != 2 || schema.Tables[1].Columns[0].Fields.Type != "Text" {
+		t.Errorf("Unexpected schema %+v", schema)
+	}
+}
+
+func TestDumpDoc_TablesError(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "invalid API key"}`))
+	})
+	defer cleanup()
+
+	dir := t.TempDir()
+	err := DumpDoc("doc123", dir, DumpOptions{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("Expected the 401 to be returned, got %v", err)
+	}
+	if _, err := os.Stat(dir + "/schema.json"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no schema.json to be written, got %v", err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(50)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.wait()
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("Expected 3 requests at 50/s to take at least 40ms, took %v", elapsed)
+	}
+}
+
+func TestLoadDoc(t *testing.T) {
+	dir := t.TempDir()
+	schema := `{"docId": "src", "tables": [
+		{"id": "A", "columns": [{"id": "Name", "fields": {"type": "Text"}}, {"id": "Upper", "fields": {"type": "Text", "isFormula": true, "formula": "$Name.upper()"}}]},
+		{"id": "B", "columns": [{"id": "Ref", "fields": {"type": "Ref:A"}}]}
+	]}`
+	os.WriteFile(dir+"/schema.json", []byte(schema), 0o600)
+	os.WriteFile(dir+"/A.jsonl", []byte("{\"id\":3,\"fields\":{\"Name\":\"x\",\"Upper\":\"X\"}}\n{\"id\":7,\"fields\":{\"Name\":\"y\",\"Upper\":\"Y\"}}\n"), 0o600)
+	os.WriteFile(dir+"/B.jsonl", []byte("{\"id\":1,\"fields\":{\"Ref\":7}}\n"), 0o600)
+
+	for _, mode := range []string{LoadSkipExisting, LoadReplace} {
+		t.Run(mode, func(t *testing.T) {
+			var created, addedColumns, deleted bool
+			actions := [][]interface{}{}
+			_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == "GET" && r.URL.Path == "/api/docs/doc123/tables":
+					w.Write([]byte(`{"tables": [{"id": "A"}]}`))
+				case r.Method == "POST" && r.URL.Path == "/api/docs/doc123/tables":
+					created = true
+					w.Write([]byte(`{"tables": [{"id": "B"}]}`))
+				case r.Method == "GET" && r.URL.Path == "/api/docs/doc123/tables/A/columns":
+					w.Write([]byte(`{"columns": [{"id": "Name"}]}`))
+				case r.Method == "POST" && r.URL.Path == "/api/docs/doc123/tables/A/columns":
+					addedColumns = true
+				case r.Method == "GET" && r.URL.Path == "/api/docs/doc123/tables/A/records":
+					w.Write([]byte(`{"records": [{"id": 1, "fields": {"Name": "old"}}]}`))
+				case r.Method == "GET" && r.URL.Path == "/api/docs/doc123/tables/B/records":
+					w.Write([]byte(`{"records": []}`))
+				case r.Method == "POST" && r.URL.Path == "/api/docs/doc123/tables/A/records/delete":
+					deleted = true
+				case r.Method == "POST" && r.URL.Path == "/api/docs/doc123/apply":
+					var body [][]interface{}
+					json.NewDecoder(r.Body).Decode(&body)
+					actions = append(actions, body...)
+				default:
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+				}
+			})
+			defer cleanup()
+
+			counts := map[string]int{}
+			err := LoadDoc("doc123", dir, LoadOptions{
+				Mode:          mode,
+				OnTableLoaded: func(tableId string, count int) { counts[tableId] = count },
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !created || !addedColumns {
+				t.Errorf("Expected table B and column Upper to be created, got %v %v", created, addedColumns)
+			}
+			if deleted != (mode == LoadReplace) {
+				t.Errorf("Expected deletion only in replace mode, got %v", deleted)
+			}
+			expectedA := 0
+			if mode == LoadReplace {
+				expectedA = 2
+			}
+			if counts["A"] != expectedA || counts["B"] != 1 {
+				t.Errorf("Unexpected counts %v", counts)
+			}
+
+			last := actions[len(actions)-1]
+			if last[0] != "BulkAddRecord" || last[1] != "B" || last[2].([]interface{})[0] != float64(1) {
+				t.Errorf("Unexpected action for B: %v", last)
+			}
+			if mode == LoadReplace {
+				values := actions[0][3].(map[string]interface{})
+				if _, found := values["Upper"]; found {
+					t.Errorf("Expected formula column values not to be loaded")
+				}
+			}
+		})
+	}
+}
+
+func TestObserver_PayloadSizes(t *testing.T) {
+	response := `{"records": [{"id": 1}, {"id": 2}]}`
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	})
+	defer cleanup()
+
+	var infos []RequestInfo
+	SetObserver(func(info RequestInfo) { infos = append(infos, info) })
+	defer SetObserver(nil)
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	SetPayloadWarningThreshold(50)
+	defer SetPayloadWarningThreshold(DefaultPayloadWarningBytes)
+
+	records := []map[string]interface{}{{"Name": "Alice"}, {"Name": "Bob"}}
+	AddRecords("doc123", "People", records, nil)
+	if len(infos) != 1 {
+		t.Fatalf("Expected 1 observed request, got %d", len(infos))
+	}
+	info := infos[0]
+	sent := len(`{"records":[{"fields":{"Name":"Alice"}},{"fields":{"Name":"Bob"}}]}`)
+	if info.Method != "POST" || info.Path != "docs/doc123/tables/People/records" || info.Status != http.StatusOK {
+		t.Errorf("Unexpected request info %+v", info)
+	}
+	if info.BytesSent != sent || info.BytesReceived != len(response) {
+		t.Errorf("Expected %d bytes sent and %d received, got %d and %d", sent, len(response), info.BytesSent, info.BytesReceived)
+	}
+	if !contains(logs.String(), "consider smaller batches") {
+		t.Errorf("Expected a warning for a body over the threshold, got %q", logs.String())
+	}
+
+	logs.Reset()
+	GetRecords("doc123", "People", nil)
+	if len(infos) != 2 || infos[1].BytesSent != 0 || infos[1].BytesReceived != len(response) {
+		t.Errorf("Unexpected GET request info %+v", infos[len(infos)-1])
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected no warning for a small request, got %q", logs.String())
+	}
+}
+
+func TestGetRecords_NullVersusMissing(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"records": [{"id": 1, "fields": {"Name": "Alice", "Email": null}}, {"id": 2, "fields": {"Name": "Bob"}}]}`))
+	})
+	defer cleanup()
+
+	records, _ := GetRecords("doc123", "People", nil)
+	withNull, withoutColumn := records.Records[0], records.Records[1]
+	if !withNull.HasField("Email") || withNull.Fields["Email"] != nil {
+		t.Errorf("Expected Email to be present and null in record 1")
+	}
+	if withoutColumn.HasField("Email") {
+		t.Errorf("Expected Email to be missing from record 2")
+	}
+	if string(withNull.RawFields) != `{"Name": "Alice", "Email": null}` {
+		t.Errorf("Unexpected raw fields %s", withNull.RawFields)
+	}
+	if string(withoutColumn.RawFields) != `{"Name": "Bob"}` {
+		t.Errorf("Unexpected raw fields %s", withoutColumn.RawFields)
+	}
+
+	body, _ := json.Marshal(withNull)
+	if string(body) != `{"id":1,"fields":{"Email":null,"Name":"Alice"}}` {
+		t.Errorf("Expected RawFields not to be sent, got %s", body)
+	}
+}
+
+func TestDescribeDoc_PartialResults(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123":
+			w.Write([]byte(`{"id": "doc123", "name": "Budget"}`))
+		case "/api/docs/doc123/tables":
+			w.Write([]byte(`{"tables": [{"id": "Expenses"}]}`))
+		case "/api/docs/doc123/tables/Expenses/columns":
+			w.Write([]byte(`{"columns": [{"id": "Amount", "fields": {"type": "Numeric", "label": "Amount (€)"}}]}`))
+		case "/api/docs/doc123/access":
+			w.Write([]byte(`{"maxInheritedRole": "owners", "users": [{"id": 1, "email": "a@example.com"}]}`))
+		case "/api/docs/doc123/webhooks":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "Only owners can list webhooks"}`))
+		case "/api/docs/doc123/attachments":
+			w.Write([]byte(`{"records": [{"id": 1, "fileSize": 100}, {"id": 2, "fileSize": 250}]}`))
+		case "/api/docs/doc123/sql":
+			w.Write([]byte(`{"records": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	description, err := DescribeDoc("doc123")
+	if err != nil {
+		t.Fatalf("Expected partial results without error, got %v", err)
+	}
+	if description.Doc.Name != "Budget" || len(description.Access.Users) != 1 {
+		t.Errorf("Unexpected doc or access: %+v", description)
+	}
+	if len(description.Tables) != 1 || description.Tables[0].Title != "Expenses" || description.Tables[0].Columns[0] != (ColumnDescription{Id: "Amount", Type: "Numeric", Label: "Amount (€)"}) {
+		t.Errorf("Unexpected tables %+v", description.Tables)
+	}
+	if description.AttachmentCount != 2 || description.AttachmentBytes != 350 {
+		t.Errorf("Expected 2 attachments of 350 bytes, got %d %d", description.AttachmentCount, description.AttachmentBytes)
+	}
+	if len(description.Errors) != 1 || !contains(description.Errors["webhooks"], "Only owners can list webhooks") {
+		t.Errorf("Expected only the webhooks part to fail with Grist's message, got %v", description.Errors)
+	}
+	if _, err := json.Marshal(description); err != nil {
+		t.Errorf("Expected the description to be JSON-serializable, got %v", err)
+	}
+
+	if _, err := DescribeDoc("missing"); err == nil {
+		t.Errorf("Expected an error for a missing document")
+	}
+}
+
+func TestSetColumnOptions(t *testing.T) {
+	stored := ""
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PATCH":
+			var body struct {
+				Columns []TableColumn `json:"columns"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if len(body.Columns) != 1 || body.Columns[0].Id != "Price" {
+				t.Errorf("Unexpected PATCH body %+v", body)
+			}
+			stored = body.Columns[0].Fields.WidgetOptions
+		case "GET":
+			column := TableColumn{Id: "Price", Fields: ColumnFields{Type: "Numeric", WidgetOptions: stored}}
+			json.NewEncoder(w).Encode(TableColumns{Columns: []TableColumn{column}})
+		}
+	})
+	defer cleanup()
+
+	options := map[string]interface{}{"numMode": "currency", "decimals": 2, "currency": "EUR"}
+	status, err := SetColumnOptions("doc123", "Products", "Price", options)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Expected success, got %d %v", status, err)
+	}
+
+	columns := GetTableColumns("doc123", "Products")
+	var roundTrip map[string]interface{}
+	if err := json.Unmarshal([]byte(columns.Columns[0].Fields.WidgetOptions), &roundTrip); err != nil {
+		t.Fatalf("Expected JSON widget options, got %q", columns.Columns[0].Fields.WidgetOptions)
+	}
+	if roundTrip["numMode"] != "currency" || roundTrip["decimals"] != float64(2) || roundTrip["currency"] != "EUR" {
+		t.Errorf("Unexpected options after round trip: %v", roundTrip)
+	}
+
+	if _, err := SetColumnOptions("doc123", "Products", "Price", map[string]interface{}{"bad": make(chan int)}); err == nil {
+		t.Errorf("Expected an error for options that are not JSON-serializable")
+	}
+}
+
+func TestListPinnedDocs(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id": 1, "name": "Home", "docs": [
+				{"id": "doc1", "name": "Budget", "isPinned": true},
+				{"id": "doc2", "name": "Drafts", "isPinned": false}
+			]},
+			{"id": 2, "name": "Projects", "docs": [
+				{"id": "doc3", "name": "Roadmap", "isPinned": true}
+			]},
+			{"id": 3, "name": "Empty", "docs": []}
+		]`))
+	})
+	defer cleanup()
+
+	docs, status := ListPinnedDocs(1)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 pinned docs, got %d", len(docs))
+	}
+	if docs[0].Id != "doc1" || docs[0].Workspace.Name != "Home" {
+		t.Errorf("Unexpected first pinned doc %+v", docs[0])
+	}
+	if docs[1].Id != "doc3" || docs[1].Workspace.Id != 2 || docs[1].Workspace.Docs != nil {
+		t.Errorf("Unexpected second pinned doc %+v", docs[1])
+	}
+}
+
+func TestSetOrg(t *testing.T) {
+	var paths []string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`[]`))
+	})
+	defer cleanup()
+
+	SetOrg("team")
+	GetOrgWorkspaces(1)
+	SetOrg("")
+	GetOrgWorkspaces(1)
+
+	if len(paths) != 2 || paths[0] != "/o/team/api/orgs/1/workspaces" || paths[1] != "/api/orgs/1/workspaces" {
+		t.Errorf("Unexpected paths %v", paths)
+	}
+}
+
+func TestDataLimitExceeded(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": "Document is in delete-only mode"}`))
+	})
+	defer cleanup()
+
+	_, err := AddRecordsBatched("doc123", "Table1", []map[string]interface{}{{"A": 1}}, nil)
+	if !errors.Is(err, ErrDataLimitExceeded) {
+		t.Fatalf("Expected ErrDataLimitExceeded, got %v", err)
+	}
+	if !contains(err.Error(), "upgrade the plan") {
+		t.Errorf("Expected guidance in the message, got %q", err.Error())
+	}
+	_, err = SetColumnOptions("doc123", "Table1", "A", map[string]interface{}{"alignment": "left"})
+	if !errors.Is(err, ErrDataLimitExceeded) {
+		t.Errorf("Expected ErrDataLimitExceeded, got %v", err)
+	}
+
+	accessDenied := checkStatus(http.StatusForbidden, `{"error": "No write access"}`)
+	if errors.Is(accessDenied, ErrDataLimitExceeded) {
+		t.Errorf("Expected access denials not to match ErrDataLimitExceeded")
+	}
+}
+
+func TestExportDocExcel_WriteErrors(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/docs/missing/download/xlsx" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "document not found"}`))
+			return
+		}
+		w.Write(bytes.Repeat([]byte("x"), 64*1024))
+	})
+	defer cleanup()
+
+	fileName := t.TempDir() + "/export.xlsx"
+	if err := ExportDocExcel("doc123", fileName); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stat, err := os.Stat(fileName); err != nil || stat.Size() != 64*1024 {
+		t.Errorf("Expected the whole export to be written, got %v %v", stat, err)
+	}
+
+	if err := ExportDocExcel("missing", t.TempDir()+"/missing.xlsx"); err == nil {
+		t.Errorf("Expected an error for a failed download")
+	}
+
+	// Writes to /dev/full fail once the buffer is flushed: the export must
+	// report it instead of leaving a silently truncated file
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full not available")
+	}
+	if err := ExportDocExcel("doc123", "/dev/full"); err == nil {
+		t.Errorf("Expected a short write to surface an error")
+	}
+}
+
+func TestDisableUsers(t *testing.T) {
+	var paths []string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/api/users/2/disable" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "user not found"}`))
+			return
+		}
+		w.Write([]byte(`null`))
+	})
+	defer cleanup()
+
+	results, err := DisableUsers([]int{1, 2, 3})
+	if err == nil || !contains(err.Error(), "user 2") {
+		t.Errorf("Expected an error for user 2, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].Err != nil || results[1].Status != http.StatusNotFound || results[1].Err == nil || results[2].Err != nil {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if len(paths) != 3 || paths[2] != "POST /api/users/3/disable" {
+		t.Errorf("Expected to continue past the failure, got %v", paths)
+	}
+
+	results, err = EnableUsers([]int{1})
+	if err != nil || len(results) != 1 || paths[3] != "POST /api/users/1/enable" {
+		t.Errorf("Unexpected enable result %+v %v %v", results, err, paths)
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		have, required Role
+		expected       bool
+	}{
+		{RoleOwners, RoleEditors, true},
+		{RoleEditors, RoleEditors, true},
+		{RoleViewers, RoleEditors, false},
+		{RoleEditors, RoleOwners, false},
+		{RoleViewers, RoleMembers, true},
+		{RoleNone, RoleViewers, false},
+		{RoleNone, RoleNone, true},
+		{RoleGuests, RoleNone, true},
+		{Role("unknown"), RoleGuests, false},
+	}
+	for _, tt := range tests {
+		if got := RoleAtLeast(tt.have, tt.required); got != tt.expected {
+			t.Errorf("RoleAtLeast(%q, %q) = %v, expected %v", tt.have, tt.required, got, tt.expected)
+		}
+	}
+}
+
+func TestEffectiveRole(t *testing.T) {
+	tests := []struct {
+		name             string
+		user             User
+		maxInheritedRole string
+		expected         Role
+	}{
+		{"own access only", User{Access: "editors"}, "owners", RoleEditors},
+		{"inherited stronger", User{Access: "viewers", ParentAccess: "owners"}, "owners", RoleOwners},
+		{"inherited capped", User{ParentAccess: "owners"}, "viewers", RoleViewers},
+		{"no inheritance", User{ParentAccess: "owners"}, "", RoleNone},
+		{"own access beats cap", User{Access: "editors", ParentAccess: "owners"}, "", RoleEditors},
+		{"no access", User{}, "owners", RoleNone},
+	}
+	for _, tt := range tests {
+		if got := EffectiveRole(tt.user, tt.maxInheritedRole); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestRecordsByLabel(t *testing.T) {
+	ClearLabelCache()
+	defer ClearLabelCache()
+	columnCalls := 0
+	var added map[string][]map[string]map[string]interface{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/docs/doc123/tables/People/columns":
+			columnCalls++
+			w.Write([]byte(`{"columns": [
+				{"id": "First_Name", "fields": {"label": "First Name"}},
+				{"id": "Notes", "fields": {"label": "Notes"}},
+				{"id": "Notes2", "fields": {"label": "Notes"}},
+				{"id": "Age", "fields": {"label": ""}}
+			]}`))
+		case r.Method == "GET":
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"First_Name": "Ada", "Notes": "a", "Notes2": "b", "Age": 36}}]}`))
+		case r.Method == "POST":
+			json.NewDecoder(r.Body).Decode(&added)
+			w.Write([]byte(`{"records": [{"id": 2}]}`))
+		}
+	})
+	defer cleanup()
+
+	records, status := GetRecordsByLabel("doc123", "People", nil)
+	if status != http.StatusOK || len(records.Records) != 1 {
+		t.Fatalf("Unexpected result %d %+v", status, records)
+	}
+	fields := records.Records[0].Fields
+	if fields["First Name"] != "Ada" || fields["Age"] != float64(36) {
+		t.Errorf("Expected fields keyed by label, got %v", fields)
+	}
+	// Colliding labels keep their column ids
+	if fields["Notes"] != "a" || fields["Notes2"] != "b" {
+		t.Errorf("Expected colliding columns keyed by id, got %v", fields)
+	}
+
+	_, status = AddRecordsByLabel("doc123", "People", []map[string]interface{}{{"First Name": "Grace", "Age": 45}}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	sent := added["records"][0]["fields"]
+	if sent["First_Name"] != "Grace" || sent["Age"] != float64(45) || len(sent) != 2 {
+		t.Errorf("Expected fields keyed by id, got %v", sent)
+	}
+	if columnCalls != 1 {
+		t.Errorf("Expected the labels to be fetched once, got %d calls", columnCalls)
+	}
+}
+
+func TestSetConnectionOptions(t *testing.T) {
+	defer SetConnectionOptions(DefaultConnectionOptions)
+	var mutex sync.Mutex
+	connections := map[string]bool{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		connections[r.RemoteAddr] = true
+		mutex.Unlock()
+		w.Write([]byte(`[]`))
+	})
+	defer cleanup()
+
+	SetConnectionOptions(ConnectionOptions{MaxIdleConns: 10, MaxIdleConnsPerHost: 4, IdleConnTimeout: time.Minute})
+	transport := sharedClient().Transport.(*timeoutTransport).base
+	if transport.MaxIdleConns != 10 || transport.MaxIdleConnsPerHost != 4 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("Options not applied: %d %d %v", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	for i := 0; i < 5; i++ {
+		GetOrgWorkspaces(1)
+	}
+	if len(connections) != 1 {
+		t.Errorf("Expected sequential requests to reuse one connection, got %d", len(connections))
+	}
+}
+
+// BenchmarkConcurrentRequests compares the connections opened by 16
+// concurrent callers with Go's default pool size and with the default options:
+// run with -bench ConcurrentRequests and compare the conns/op metrics
+func BenchmarkConcurrentRequests(b *testing.B) {
+	defer SetConnectionOptions(DefaultConnectionOptions)
+	var mutex sync.Mutex
+	connections := map[string]bool{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		connections[r.RemoteAddr] = true
+		mutex.Unlock()
+		time.Sleep(time.Millisecond)
+		w.Write([]byte(`[]`))
+	})
+	defer cleanup()
+
+	pools := map[string]ConnectionOptions{
+		"GoDefaults":     {MaxIdleConns: 100, MaxIdleConnsPerHost: 2, IdleConnTimeout: 90 * time.Second},
+		"DefaultOptions": DefaultConnectionOptions,
+	}
+	for name, options := range pools {
+		b.Run(name, func(b *testing.B) {
+			SetConnectionOptions(options)
+			mutex.Lock()
+			connections = map[string]bool{}
+			mutex.Unlock()
+			b.SetParallelism(16)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					GetOrgWorkspaces(1)
+				}
+			})
+			b.ReportMetric(float64(len(connections))/float64(b.N), "conns/op")
+		})
+	}
+}
+
+func TestUpdateRecords_InvalidIds(t *testing.T) {
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`null`))
+	})
+	defer cleanup()
+
+	records := []Record{
+		{Id: 1, Fields: map[string]interface{}{"A": 1}},
+		{Fields: map[string]interface{}{"A": 2}},
+		{Id: 3, Fields: map[string]interface{}{"B": 3}},
+		{Id: -4, Fields: map[string]interface{}{"A": 4}},
+	}
+	response, status := UpdateRecords("doc123", "Table1", records, nil)
+	if status != -1 || !contains(response, "indexes 1, 3") {
+		t.Errorf("Expected status -1 listing indexes 1 and 3, got %d %q", status, response)
+	}
+
+	_, err := UpdateRecordsBatched("doc123", "Table1", records, &BatchOptions{BatchSize: 1})
+	var invalid *InvalidRecordIdsError
+	if !errors.As(err, &invalid) || len(invalid.Indexes) != 2 || invalid.Indexes[1] != 3 {
+		t.Errorf("Expected an InvalidRecordIdsError, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected nothing to be sent, got %d requests", requests)
+	}
+
+	if _, status := UpdateRecords("doc123", "Table1", []Record{records[0], records[2]}, nil); status != http.StatusOK {
+		t.Errorf("Expected valid records to be sent, got status %d", status)
+	}
+}
+
+func TestBatched_ContinueOnError(t *testing.T) {
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 || requests == 4 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid value"}`))
+			return
+		}
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/records") {
+			fmt.Fprintf(w, `{"records": [{"id": %d}]}`, requests)
+			return
+		}
+		w.Write([]byte(`null`))
+	})
+	defer cleanup()
+
+	records := []map[string]interface{}{{"A": 1}, {"A": 2}, {"A": 3}, {"A": 4}, {"A": 5}}
+
+	// Default: stop at the first failing batch
+	added, err := AddRecordsBatched("doc123", "Table1", records, &BatchOptions{BatchSize: 1})
+	if err == nil || requests != 2 || len(added.Records) != 1 {
+		t.Errorf("Expected to stop after batch 1, got %d requests, %d added, %v", requests, len(added.Records), err)
+	}
+
+	requests = 0
+	added, err = AddRecordsBatched("doc123", "Table1", records, &BatchOptions{BatchSize: 1, ContinueOnError: true})
+	if requests != 5 || len(added.Records) != 3 {
+		t.Errorf("Expected every batch to be sent, got %d requests, %d added", requests, len(added.Records))
+	}
+	if err == nil || !contains(err.Error(), "batch 1 ") || !contains(err.Error(), "batch 3 ") || !contains(err.Error(), "HTTP 400") {
+		t.Errorf("Expected the failures of batches 1 and 3, got %v", err)
+	}
+
+	requests = 0
+	deleted, err := DeleteRecordsBatched("doc123", "Table1", []int{1, 2, 3, 4, 5}, &BatchOptions{BatchSize: 2, ContinueOnError: true})
+	if deleted != 3 || err == nil || !contains(err.Error(), "batch 1 (records 2 to 3)") {
+		t.Errorf("Expected 3 records deleted and batch 1 reported, got %d %v", deleted, err)
+	}
+}
+
+func TestSetDocReadOnly(t *testing.T) {
+	var applied [][]interface{}
+	locked := false
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables/_grist_ACLRules/records":
+			if locked {
+				w.Write([]byte(`{"records": [{"id": 1, "fields": {"rulePos": 1, "memo": ""}}, {"id": 7, "fields": {"rulePos": -1, "memo": "gristle: read-only lock"}}]}`))
+				return
+			}
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"rulePos": 1, "memo": ""}}]}`))
+		case "/api/docs/doc123/tables/_grist_ACLResources/records":
+			w.Write([]byte(`{"records": []}`))
+		case "/api/docs/doc123/apply":
+			var actions [][]interface{}
+			json.NewDecoder(r.Body).Decode(&actions)
+			applied = append(applied, actions...)
+			w.Write([]byte(`{"actionNum": 1, "retValues": [5]}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer cleanup()
+
+	if status, err := SetDocReadOnly("doc123", true); err != nil || status != http.StatusOK {
+		t.Fatalf("Unexpected result %d %v", status, err)
+	}
+	if len(applied) != 2 || applied[0][1] != "_grist_ACLResources" || applied[1][1] != "_grist_ACLRules" {
+		t.Fatalf("Expected a resource then a rule to be added, got %v", applied)
+	}
+	rule := applied[1][3].(map[string]interface{})
+	if rule["resource"] != float64(5) || rule["permissionsText"] != "-CUD" || rule["aclFormula"] != "user.Access != OWNER" || rule["rulePos"] != float64(0) {
+		t.Errorf("Unexpected rule %v", rule)
+	}
+
+	locked, applied = true, nil
+	if _, err := SetDocReadOnly("doc123", true); err != nil || len(applied) != 0 {
+		t.Errorf("Expected locking a locked document to do nothing, got %v %v", applied, err)
+	}
+	if _, err := SetDocReadOnly("doc123", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(applied) != 1 || applied[0][0] != "BulkRemoveRecord" || fmt.Sprint(applied[0][2]) != "[7]" {
+		t.Errorf("Expected the lock rule to be removed, got %v", applied)
+	}
+}
+
+// Table and column rules are evaluated before the default ones: each
+// resource having rules gets its own lock
+func TestSetDocReadOnly_TableRules(t *testing.T) {
+	var applied [][]interface{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables/_grist_ACLRules/records":
+			w.Write([]byte(`{"records": [
+				{"id": 1, "fields": {"resource": 2, "rulePos": 1, "permissionsText": "+CUD", "memo": ""}},
+				{"id": 2, "fields": {"resource": 3, "rulePos": 2, "permissionsText": "+U", "memo": ""}},
+				{"id": 3, "fields": {"resource": 4, "rulePos": 3, "permissionsText": "+R", "memo": ""}},
+				{"id": 4, "fields": {"resource": 5, "rulePos": 4, "permissionsText": "-S", "memo": ""}}
+			]}`))
+		case "/api/docs/doc123/tables/_grist_ACLResources/records":
+			w.Write([]byte(`{"records": [
+				{"id": 1, "fields": {"tableId": "", "colIds": ""}},
+				{"id": 2, "fields": {"tableId": "Orders", "colIds": "*"}},
+				{"id": 3, "fields": {"tableId": "Orders", "colIds": "Status,Notes"}},
+				{"id": 4, "fields": {"tableId": "*", "colIds": "*"}},
+				{"id": 5, "fields": {"tableId": "*SPECIAL", "colIds": "SchemaEdit"}},
+				{"id": 6, "fields": {"tableId": "People", "colIds": "*"}}
+			]}`))
+		case "/api/docs/doc123/apply":
+			var actions [][]interface{}
+			json.NewDecoder(r.Body).Decode(&actions)
+			applied = append(applied, actions...)
+			w.Write([]byte(`{"actionNum": 1, "retValues": [10, 11, 12]}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer cleanup()
+
+	if _, err := SetDocReadOnly("doc123", true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	locks := map[float64]string{}
+	positions := map[float64]bool{}
+	for _, action := range applied {
+		rule := action[3].(map[string]interface{})
+		locks[rule["resource"].(float64)] = rule["permissionsText"].(string)
+		if pos := rule["rulePos"].(float64); pos >= 1 || positions[pos] {
+			t.Errorf("Expected distinct positions before the existing rules, got %v", pos)
+		} else {
+			positions[pos] = true
+		}
+	}
+	expected := map[float64]string{2: "-CUD", 3: "-U", 4: "-CUD"}
+	if fmt.Sprint(locks) != fmt.Sprint(expected) {
+		t.Errorf("Expected locks %v, got %v", expected, locks)
+	}
+}
+
+func TestRecordTypedGetters(t *testing.T) {
+	record := Record{Id: 1, Fields: map[string]interface{}{
+		"Name":    "Ada",
+		"Active":  true,
+		"Age":     float64(36),
+		"Score":   12.5,
+		"Born":    float64(-4039286400),
+		"Notes":   nil,
+		"Balance": json.Number("9007199254740993"),
+	}}
+
+	if value, ok := record.GetString("Name"); !ok || value != "Ada" {
+		t.Errorf("GetString: got %q %v", value, ok)
+	}
+	if value, ok := record.GetBool("Active"); !ok || !value {
+		t.Errorf("GetBool: got %v %v", value, ok)
+	}
+	if value, ok := record.GetInt("Age"); !ok || value != 36 {
+		t.Errorf("GetInt: got %v %v", value, ok)
+	}
+	if value, ok := record.GetInt("Balance"); !ok || value != 9007199254740993 {
+		t.Errorf("GetInt on json.Number: got %v %v", value, ok)
+	}
+	if value, ok := record.GetFloat("Score"); !ok || value != 12.5 {
+		t.Errorf("GetFloat: got %v %v", value, ok)
+	}
+	if value, ok := record.GetTime("Born"); !ok || !value.Equal(time.Date(1842, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("GetTime: got %v %v", value, ok)
+	}
+	if _, ok := record.GetString("Age"); ok {
+		t.Errorf("Expected GetString on a number to fail")
+	}
+
+	if value, err := record.GetTimeStrict("Born"); err != nil || value.Year() != 1842 {
+		t.Errorf("GetTimeStrict: got %v %v", value, err)
+	}
+	mismatches := map[string]error{
+		"float64": func() error { _, err := record.GetStringStrict("Age"); return err }(),
+		"string":  func() error { _, err := record.GetBoolStrict("Name"); return err }(),
+		"non-integral number 12.5": func() error {
+			_, err := record.GetIntStrict("Score")
+			return err
+		}(),
+		"null":    func() error { _, err := record.GetFloatStrict("Notes"); return err }(),
+		"missing": func() error { _, err := record.GetTimeStrict("Died"); return err }(),
+	}
+	for actual, err := range mismatches {
+		var typeErr *FieldTypeError
+		if !errors.As(err, &typeErr) || typeErr.Actual != actual {
+			t.Errorf("Expected a FieldTypeError with actual type %q, got %v", actual, err)
+		}
+	}
+	_, err := record.GetStringStrict("Age")
+	if err.Error() != "field Age: expected string, got float64" {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+}
+
+func TestListValues_RoundTrip(t *testing.T) {
+	var stored []byte
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			var body struct {
+				Records []json.RawMessage `json:"records"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			stored = body.Records[0]
+			w.Write([]byte(`{"records": [{"id": 1}]}`))
+		case "GET":
+			var record map[string]interface{}
+			json.Unmarshal(stored, &record)
+			record["id"] = 1
+			json.NewEncoder(w).Encode(map[string]interface{}{"records": []interface{}{record}})
+		}
+	})
+	defer cleanup()
+
+	_, status := AddRecords("doc123", "Items", []map[string]interface{}{{
+		"Colors":  ChoiceListValue("red", "blue"),
+		"Related": RefListValue(3, 5),
+		"Tags":    ChoiceListValue(),
+	}}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if !contains(string(stored), `"Colors":["L","red","blue"]`) || !contains(string(stored), `"Related":["L",3,5]`) {
+		t.Errorf("Unexpected encoding %s", stored)
+	}
+
+	records, _ := GetRecords("doc123", "Items", nil)
+	fields := records.Records[0].Fields
+	colors, ok := ParseChoiceList(fields["Colors"])
+	if !ok || len(colors) != 2 || colors[0] != "red" || colors[1] != "blue" {
+		t.Errorf("ParseChoiceList: got %v %v", colors, ok)
+	}
+	related, ok := ParseRefList(fields["Related"])
+	if !ok || len(related) != 2 || related[0] != 3 || related[1] != 5 {
+		t.Errorf("ParseRefList: got %v %v", related, ok)
+	}
+	if tags, ok := ParseChoiceList(fields["Tags"]); !ok || len(tags) != 0 {
+		t.Errorf("Expected an empty list, got %v %v", tags, ok)
+	}
+
+	if _, ok := ParseChoiceList(nil); !ok {
+		t.Errorf("Expected null to parse as an empty list")
+	}
+	if _, ok := ParseRefList([]interface{}{"L", "x"}); ok {
+		t.Errorf("Expected non-numeric ids to be rejected")
+	}
+	if _, ok := ParseChoiceList("red"); ok {
+		t.Errorf("Expected a plain string to be rejected")
+	}
+}
+
+func TestSetMaxResponseBytes(t *testing.T) {
+	defer SetMaxResponseBytes(DefaultMaxResponseBytes)
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"records": [{"id": 1, "fields": {"A": "` + strings.Repeat("x", 2000) + `"}}]}`))
+	})
+	defer cleanup()
+
+	SetMaxResponseBytes(1000)
+	_, status, err := defaultClient.getRecords("doc123", "Table1", nil)
+	if status != -10 || !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("Expected an ErrResponseTooLarge with status -10, got %d %v", status, err)
+	}
+
+	// Downloads are not limited
+	content, status, _ := httpGet("docs/doc123/download/csv?tableId=Table1", "")
+	if status != http.StatusOK || len(content) < 2000 {
+		t.Errorf("Expected the download to be read whole, got %d bytes, status %d", len(content), status)
+	}
+
+	SetMaxResponseBytes(10000)
+	if _, status, err := defaultClient.getRecords("doc123", "Table1", nil); err != nil || status != http.StatusOK {
+		t.Errorf("Expected a response within the limit to be read, got %d %v", status, err)
+	}
+}
+
+func TestGetDocTableStats(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables":
+			w.Write([]byte(`{"tables": [{"id": "People"}, {"id": "Broken"}, {"id": "Orders"}]}`))
+		case "/api/docs/doc123/sql":
+			var body struct {
+				SQL string `json:"sql"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			switch body.SQL {
+			case `SELECT COUNT(*) AS count FROM "People"`:
+				w.Write([]byte(`{"records": [{"fields": {"count": 12}}]}`))
+			case `SELECT COUNT(*) AS count FROM "Orders"`:
+				w.Write([]byte(`{"records": [{"fields": {"count": 3400}}]}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "no such table"}`))
+			}
+		}
+	})
+	defer cleanup()
+
+	stats, status := GetDocTableStats("doc123")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	expected := []TableStat{{"People", 12}, {"Broken", -1}, {"Orders", 3400}}
+	if len(stats) != len(expected) {
+		t.Fatalf("Expected %d stats, got %+v", len(expected), stats)
+	}
+	for i := range expected {
+		if stats[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], stats[i])
+		}
+	}
+}
+
+func TestMyApiKey(t *testing.T) {
+	key := "old-key"
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/profile/apikey" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(key))
+		case "POST":
+			body, _ := io.ReadAll(r.Body)
+			if !contains(string(body), `"force": true`) {
+				t.Errorf("Expected a forced regeneration, got %s", body)
+			}
+			key = "new-key"
+			w.Write([]byte(key))
+		case "DELETE":
+			key = ""
+			w.Write([]byte(`null`))
+		}
+	})
+	defer cleanup()
+
+	if current, status := GetMyApiKey(); status != http.StatusOK || current != "old-key" {
+		t.Errorf("Unexpected key %q (status %d)", current, status)
+	}
+	if regenerated, status := RegenerateMyApiKey(); status != http.StatusOK || regenerated != "new-key" {
+		t.Errorf("Unexpected regenerated key %q (status %d)", regenerated, status)
+	}
+	if _, err := DeleteMyApiKey(); err != nil || key != "" {
+		t.Errorf("Expected the key to be deleted, got %q %v", key, err)
+	}
+}
+
+func TestGetRecords_FilterValidation(t *testing.T) {
+	var queries []string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("filter"))
+		w.Write([]byte(`{"records": []}`))
+	})
+	defer cleanup()
+
+	GetRecords("doc123", "Table1", &GetRecordsOptions{Filter: map[string][]interface{}{}})
+	GetRecords("doc123", "Table1", &GetRecordsOptions{Filter: map[string][]interface{}{"A": {}}})
+	GetRecords("doc123", "Table1", &GetRecordsOptions{Filter: map[string][]interface{}{"A": {}, "B": {1}}})
+	if len(queries) != 3 || queries[0] != "" || queries[1] != "" {
+		t.Fatalf("Expected no filter parameter for empty filters, got %q", queries)
+	}
+	if !contains(queries[2], `"B":[1]`) || contains(queries[2], `"A"`) {
+		t.Errorf("Expected only column B in the filter, got %q", queries[2])
+	}
+
+	_, status, err := defaultClient.getRecords("doc123", "Table1", &GetRecordsOptions{Filter: map[string][]interface{}{"A": {make(chan int)}}})
+	if status != -1 || err == nil || !contains(err.Error(), "invalid filter") {
+		t.Errorf("Expected an invalid filter error, got %d %v", status, err)
+	}
+	if len(queries) != 3 {
+		t.Errorf("Expected nothing to be sent for an invalid filter")
+	}
+}
+
+func TestMoveDocs(t *testing.T) {
+	var moved []string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/workspaces/7":
+			w.Write([]byte(`{"id": 7, "name": "Archive"}`))
+		case r.URL.Path == "/api/workspaces/8":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "workspace not found"}`))
+		case r.URL.Path == "/api/docs/missing/move":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "document not found"}`))
+		case r.Method == "PATCH":
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != `{"workspace": 7}` {
+				t.Errorf("Unexpected body %s", body)
+			}
+			moved = append(moved, r.URL.Path)
+			w.Write([]byte(`null`))
+		}
+	})
+	defer cleanup()
+
+	results, err := MoveDocs([]string{"doc1", "missing", "bad/id", "doc2"}, 7)
+	if err == nil || !contains(err.Error(), "document missing") || !contains(err.Error(), "document bad/id") {
+		t.Errorf("Expected errors for the invalid documents, got %v", err)
+	}
+	if len(results) != 4 || results[0].Err != nil || results[1].Status != http.StatusNotFound || results[2].Status != -1 || results[3].Err != nil {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if len(moved) != 2 {
+		t.Errorf("Expected the valid documents to be moved, got %v", moved)
+	}
+
+	moved = nil
+	if _, err := MoveDocs([]string{"doc1"}, 8); err == nil || len(moved) != 0 {
+		t.Errorf("Expected nothing to be moved to a missing workspace, got %v %v", moved, err)
+	}
+}
+
+func TestMoveAllDocs(t *testing.T) {
+	var moved []string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/workspaces/7":
+			w.Write([]byte(`{"id": 7, "name": "Inbox", "docs": [{"id": "doc1"}, {"id": "doc2"}]}`))
+		case r.URL.Path == "/api/workspaces/9":
+			w.Write([]byte(`{"id": 9, "name": "Archive"}`))
+		case r.URL.Path == "/api/workspaces/8":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "workspace not found"}`))
+		case r.Method == "PATCH":
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != `{"workspace": 9}` {
+				t.Errorf("Unexpected body %s", body)
+			}
+			moved = append(moved, r.URL.Path)
+			w.Write([]byte(`null`))
+		}
+	})
+	defer cleanup()
+
+	if err := MoveAllDocs(7, 9); err != nil || len(moved) != 2 {
+		t.Errorf("Expected both documents to be moved, got %v %v", moved, err)
+	}
+	for _, ids := range [][2]int{{8, 9}, {7, 8}} {
+		moved = nil
+		err := MoveAllDocs(ids[0], ids[1])
+		if err == nil || !contains(err.Error(), "workspace 8 not found") || len(moved) != 0 {
+			t.Errorf("MoveAllDocs(%d, %d): expected a not found error, got %v %v", ids[0], ids[1], moved, err)
+		}
+	}
+}
+
+func TestGetWritableWorkspaces(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id": 1, "name": "Owned", "access": "owners"},
+			{"id": 2, "name": "Shared", "access": "editors"},
+			{"id": 3, "name": "Readonly", "access": "viewers"},
+			{"id": 4, "name": "Guest", "access": "guests"},
+			{"id": 5, "name": "None", "access": null}
+		]`))
+	})
+	defer cleanup()
+
+	workspaces := GetWritableWorkspaces(1)
+	if len(workspaces) != 2 || workspaces[0].Id != 1 || workspaces[1].Id != 2 {
+		t.Errorf("Expected the owned and shared workspaces, got %+v", workspaces)
+	}
+	viewable := GetOrgWorkspacesWithOptions(1, &GetWorkspacesOptions{MinRole: RoleViewers})
+	if len(viewable) != 3 {
+		t.Errorf("Expected 3 viewable workspaces, got %d", len(viewable))
+	}
+	if all := GetOrgWorkspacesWithOptions(1, &GetWorkspacesOptions{}); len(all) != 5 {
+		t.Errorf("Expected no access filter by default, got %d workspaces", len(all))
+	}
+}
+
+func TestFindUserIDByEmail(t *testing.T) {
+	scimAvailable := true
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/scim/v2/Users":
+			if !scimAvailable {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error": "Access denied"}`))
+				return
+			}
+			if filter := r.URL.Query().Get("filter"); filter != `userName eq "ada@example.com"` {
+				w.Write([]byte(`{"totalResults": 0, "Resources": []}`))
+				return
+			}
+			w.Write([]byte(`{"totalResults": 1, "Resources": [{"id": "42", "userName": "ada@example.com"}]}`))
+		case "/api/orgs":
+			w.Write([]byte(`[{"id": 1, "name": "Personal"}, {"id": 2, "name": "Team"}]`))
+		case "/api/orgs/1/access":
+			w.WriteHeader(http.StatusForbidden)
+		case "/api/orgs/2/access":
+			w.Write([]byte(`{"users": [{"id": 7, "email": "Grace@Example.com"}]}`))
+		}
+	})
+	defer cleanup()
+
+	if id, found, err := FindUserIDByEmail("  Ada@Example.com "); err != nil || !found || id != 42 {
+		t.Errorf("Expected user 42 through SCIM, got %d %v %v", id, found, err)
+	}
+	if _, found, err := FindUserIDByEmail("nobody@example.com"); err != nil || found {
+		t.Errorf("Expected no user, got %v %v", found, err)
+	}
+
+	scimAvailable = false
+	if id, found, err := FindUserIDByEmail("grace@example.com"); err != nil || !found || id != 7 {
+		t.Errorf("Expected user 7 through the org access lists, got %d %v %v", id, found, err)
+	}
+	if _, found, err := FindUserIDByEmail("nobody@example.com"); err != nil || found {
+		t.Errorf("Expected no user, got %v %v", found, err)
+	}
+}
+
+func TestFetchTableTyped(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables/Orders/columns":
+			w.Write([]byte(`{"columns": [
+				{"id": "Label", "fields": {"type": "Text"}},
+				{"id": "Amount", "fields": {"type": "Numeric"}},
+				{"id": "Due", "fields": {"type": "Date"}},
+				{"id": "Customer", "fields": {"type": "Ref:Customers"}},
+				{"id": "Paid", "fields": {"type": "Bool"}}
+			]}`))
+		case "/api/docs/doc123/tables/Orders/records":
+			w.Write([]byte(`{"records": [{"id": 1, "fields": {"Label": "A-1", "Amount": 12.5, "Due": 1714521600, "Customer": 3, "Paid": false, "manualSort": 1}}]}`))
+		}
+	})
+	defer cleanup()
+
+	table, err := FetchTableTyped("doc123", "Orders")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(table.Columns) != 5 || len(table.Records) != 1 {
+		t.Fatalf("Unexpected table %+v", table)
+	}
+	fields := table.Records[0].Fields
+	expected := map[string]string{"Label": "Text", "Amount": "Numeric", "Due": "Date", "Customer": "Ref:Customers", "Paid": "Bool", "manualSort": "Any"}
+	for colId, colType := range expected {
+		if fields[colId].Type != colType {
+			t.Errorf("Expected %s to be %s, got %s", colId, colType, fields[colId].Type)
+		}
+	}
+	if fields["Customer"].BaseType() != "Ref" || fields["Customer"].Value != float64(3) {
+		t.Errorf("Unexpected Customer field %+v", fields["Customer"])
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	SetCircuitBreaker(2, 50*time.Millisecond)
+	defer SetCircuitBreaker(0, 0)
+	hits, down := 0, true
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if down {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"records": []}`))
+	})
+	defer cleanup()
+
+	get := func() error {
+		_, _, err := defaultClient.getRecords("doc123", "Table1", nil)
+		return err
+	}
+	get()
+	get()
+	if err := get(); !errors.Is(err, ErrCircuitOpen) || hits != 2 {
+		t.Fatalf("Expected the circuit to open after 2 failures, got %v after %d hits", err, hits)
+	}
+
+	// A failing probe opens the circuit for another cooldown
+	time.Sleep(60 * time.Millisecond)
+	if err := get(); errors.Is(err, ErrCircuitOpen) || hits != 3 {
+		t.Fatalf("Expected a probe after the cooldown, got %v after %d hits", err, hits)
+	}
+	if err := get(); !errors.Is(err, ErrCircuitOpen) || hits != 3 {
+		t.Fatalf("Expected the circuit to reopen after a failed probe, got %v", err)
+	}
+
+	// A successful probe closes it
+	down = false
+	time.Sleep(60 * time.Millisecond)
+	if err := get(); err != nil {
+		t.Fatalf("Expected the probe to succeed, got %v", err)
+	}
+	if err := get(); err != nil || hits != 5 {
+		t.Errorf("Expected the circuit to be closed, got %v after %d hits", err, hits)
+	}
+
+	// The binary and multipart helpers report it as a RequestError too
+	down = true
+	get()
+	get()
+	var requestErr *RequestError
+	_, _, status, err := httpGetBinary("docs/doc123/attachments/1/download")
+	if status != -10 || !errors.As(err, &requestErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a RequestError wrapping ErrCircuitOpen from httpGetBinary, got %d %v", status, err)
+	}
+	_, status, err = httpMultipartUploadReader("docs/doc123/attachments", "upload", "a.txt", strings.NewReader("a"))
+	if status != -10 || !errors.As(err, &requestErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a RequestError wrapping ErrCircuitOpen from httpMultipartUploadReader, got %d %v", status, err)
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	var requests []string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+string(body))
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`{"records": [
+				{"id": 1, "fields": {"Code": "A", "Name": "Alpha", "Qty": 1}},
+				{"id": 2, "fields": {"Code": "B", "Name": "Beta", "Qty": 2}},
+				{"id": 3, "fields": {"Code": "C", "Name": "Gamma", "Qty": 3}}
+			]}`))
+		case "POST":
+			w.Write([]byte(`{"records": [{"id": 4}]}`))
+		default:
+			w.Write([]byte(`null`))
+		}
+	})
+	defer cleanup()
+
+	desired := []map[string]interface{}{
+		{"Code": "A", "Name": "Alpha", "Qty": 1},
+		{"Code": "B", "Name": "Beta", "Qty": 5},
+		{"Code": "D", "Name": "Delta", "Qty": 4},
+	}
+	plan, err := PlanSync("doc123", "Items", "Code", desired)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(plan.Add) != 1 || plan.Add[0]["Code"] != "D" {
+		t.Errorf("Expected D to be added, got %v", plan.Add)
+	}
+	if len(plan.Update) != 1 || plan.Update[0].Id != 2 || len(plan.Update[0].Fields) != 1 || plan.Update[0].Fields["Qty"] != 5 {
+		t.Errorf("Expected only the Qty of B to be updated, got %+v", plan.Update)
+	}
+	if len(plan.Delete) != 1 || plan.Delete[0].Id != 3 || plan.Delete[0].Fields["Name"] != "Gamma" {
+		t.Errorf("Expected C to be deleted, got %+v", plan.Delete)
+	}
+	if len(requests) != 1 {
+		t.Errorf("Expected planning to only read the table, got %v", requests)
+	}
+
+	result, err := ApplyPlan(plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Deleted != 1 || result.Updated != 1 || len(result.Added.Records) != 1 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if len(requests) != 4 || requests[1] != "POST [3]" || !contains(requests[2], `"fields":{"Qty":5}`) {
+		t.Errorf("Unexpected requests %v", requests)
+	}
+}
+
+func TestGetDocUsage(t *testing.T) {
+	usageEndpoint := true
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/usage":
+			if !usageEndpoint {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"usage": {"rowCount": {"total": 1250}, "dataSizeBytes": 40960, "attachmentsSizeBytes": "hidden", "dataLimitStatus": "approachingLimit"}}`))
+		case "/api/docs/doc123/tables":
+			w.Write([]byte(`{"tables": [{"id": "A"}, {"id": "B"}]}`))
+		case "/api/docs/doc123/sql":
+			w.Write([]byte(`{"records": [{"fields": {"count": 10}}]}`))
+		case "/api/docs/doc123/attachments":
+			w.Write([]byte(`{"records": [{"id": 1, "fileSize": 100}, {"id": 2, "fileSize": 250}]}`))
+		}
+	})
+	defer cleanup()
+
+	usage, status := GetDocUsage("doc123")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	expected := DocUsage{RowCount: 1250, DataSizeBytes: 40960, AttachmentsSizeBytes: -1, DataLimitStatus: "approachingLimit"}
+	if usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+
+	usageEndpoint = false
+	usage, status = GetDocUsage("doc123")
+	expected = DocUsage{RowCount: 20, DataSizeBytes: -1, AttachmentsSizeBytes: 350, Estimated: true}
+	if status != http.StatusOK || usage != expected {
+		t.Errorf("Expected estimated %+v, got %+v (status %d)", expected, usage, status)
+	}
+}
+
+func TestDownloadRedirects(t *testing.T) {
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Expected no API key sent to the storage, got %q", auth)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("stored content"))
+	}))
+	defer storage.Close()
+
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/attachments/1/download":
+			http.Redirect(w, r, storage.URL+"/bucket/attachment?signature=abc", http.StatusSeeOther)
+		case "/api/docs/doc123/attachments/2/download":
+			http.Redirect(w, r, "/api/internal/attachment/2", http.StatusSeeOther)
+		case "/api/internal/attachment/2":
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				t.Errorf("Expected the API key on a same-host redirect, got %q", r.Header.Get("Authorization"))
+			}
+			w.Write([]byte("local content"))
+		}
+	})
+	defer cleanup()
+
+	content, _, status := DownloadAttachment("doc123", 1)
+	if status != http.StatusOK || string(content) != "stored content" {
+		t.Errorf("Expected the storage content, got %d %q", status, content)
+	}
+	content, _, status = DownloadAttachment("doc123", 2)
+	if status != http.StatusOK || string(content) != "local content" {
+		t.Errorf("Expected the redirected content, got %d %q", status, content)
+	}
+}
+
+func TestSetExplain(t *testing.T) {
+	server, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"records": [{"id": 1}]}`))
+	})
+	defer cleanup()
+
+	var explained bytes.Buffer
+	SetExplain(&explained)
+	defer SetExplain(nil)
+
+	AddRecords("doc123", "Table1", []map[string]interface{}{{"Name": "O'Brien"}}, nil)
+	GetRecords("doc123", "Table1", nil)
+
+	lines := strings.Split(strings.TrimSpace(explained.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 commands, got %q", explained.String())
+	}
+	expected := `curl -X POST '` + server.URL + `/api/docs/doc123/tables/Table1/records' -H "Authorization: Bearer $GRIST_TOKEN" -H 'Content-Type: application/json' --data-raw '{"records":[{"fields":{"Name":"O'\''Brien"}}]}'`
+	if lines[0] != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `curl -X GET '`+server.URL+`/api/docs/doc123/tables/Table1/records'`) || contains(lines[1], "--data-raw") {
+		t.Errorf("Unexpected GET command %s", lines[1])
+	}
+	if contains(explained.String(), "test-token") {
+		t.Errorf("Expected the API key to be redacted")
+	}
+}
+
+func TestGetUserDocAccess(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/access":
+			w.Write([]byte(`{"maxInheritedRole": "editors", "users": [
+				{"id": 1, "email": "ada@example.com", "access": "viewers", "parentAccess": null},
+				{"id": 2, "email": "grace@example.com", "access": null, "parentAccess": "owners"},
+				{"id": 3, "email": "alan@example.com", "access": "owners", "parentAccess": "viewers"},
+				{"id": 4, "email": "edsger@example.com", "access": null, "parentAccess": null}
+			]}`))
+		case "/api/docs/public/access":
+			w.Write([]byte(`{"maxInheritedRole": "owners", "users": [
+				{"id": 5, "email": "everyone@getgrist.com", "access": "viewers"}
+			]}`))
+		}
+	})
+	defer cleanup()
+
+	tests := []struct {
+		docId, email string
+		role         Role
+		hasAccess    bool
+	}{
+		{"doc123", "Ada@Example.com", RoleViewers, true},     // explicit
+		{"doc123", "grace@example.com", RoleEditors, true},   // inherited, capped
+		{"doc123", "alan@example.com", RoleOwners, true},     // explicit beats inherited
+		{"doc123", "edsger@example.com", RoleNone, false},    // listed without access
+		{"doc123", "unknown@example.com", RoleNone, false},   // not listed
+		{"public", "unknown@example.com", RoleViewers, true}, // shared with everyone
+	}
+	for _, tt := range tests {
+		role, hasAccess, err := GetUserDocAccess(tt.docId, tt.email)
+		if err != nil || role != tt.role || hasAccess != tt.hasAccess {
+			t.Errorf("%s on %s: expected %q %v, got %q %v %v", tt.email, tt.docId, tt.role, tt.hasAccess, role, hasAccess, err)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	SetRetryBudget(0.5)
+	defer SetRetryBudget(0)
+	var failing sync.Map
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if _, found := failing.Load("on"); found {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+	defer cleanup()
+
+	if !defaultClient.retries.allowRetry() {
+		t.Fatalf("Expected retries to be allowed with a full budget")
+	}
+
+	// Concurrent failures drain the budget shared by all requests
+	failing.Store("on", true)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			GetOrgWorkspaces(1)
+		}()
+	}
+	wg.Wait()
+	if defaultClient.retries.allowRetry() {
+		t.Errorf("Expected retries to be throttled after 20 failures")
+	}
+
+	// Successes give tokens back: 5 tokens are needed to retry again
+	failing.Delete("on")
+	for i := 0; i < 10; i++ {
+		GetOrgWorkspaces(1)
+	}
+	if defaultClient.retries.allowRetry() {
+		t.Errorf("Expected retries to stay throttled at the threshold")
+	}
+	GetOrgWorkspaces(1)
+	GetOrgWorkspaces(1)
+	if !defaultClient.retries.allowRetry() {
+		t.Errorf("Expected retries to be allowed again after successes")
+	}
+
+	SetRetryBudget(0)
+	if !defaultClient.retries.allowRetry() {
+		t.Errorf("Expected no throttling without a budget")
+	}
+}
+
+func TestExportTableExcel(t *testing.T) {
+	readSheet := func(t *testing.T, content []byte) (string, string) {
+		archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatalf("Export is not a workbook: %v", err)
+		}
+		parts := map[string]string{}
+		for _, file := range archive.File {
+			f, _ := file.Open()
+			data, _ := io.ReadAll(f)
+			f.Close()
+			parts[file.Name] = string(data)
+		}
+		return parts["xl/workbook.xml"], parts["xl/worksheets/sheet1.xml"]
+	}
+
+	t.Run("server export", func(t *testing.T) {
+		var workbook bytes.Buffer
+		if err := writeWorkbook(&workbook, "Orders", [][]interface{}{{"Label"}}); err != nil {
+			t.Fatal(err)
+		}
+		var tableId string
+		_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+			tableId = r.URL.Query().Get("tableId")
+			w.Write(workbook.Bytes())
+		})
+		defer cleanup()
+
+		var out bytes.Buffer
+		status, err := ExportTableExcel("doc123", "Orders", &out)
+		if err != nil || status != http.StatusOK || tableId != "Orders" {
+			t.Fatalf("Unexpected result %d, %v for table %q", status, err, tableId)
+		}
+		if book, _ := readSheet(t, out.Bytes()); !strings.Contains(book, `name="Orders"`) {
+			t.Errorf("Expected an Orders sheet, got %s", book)
+		}
+	})
+
+	t.Run("built client-side", func(t *testing.T) {
+		_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/docs/doc123/download/xlsx":
+				w.WriteHeader(http.StatusNotFound)
+			case "/api/docs/doc123/tables/Orders/columns":
+				w.Write([]byte(`{"columns": [
+					{"id": "Label", "fields": {"type": "Text", "label": "Name"}},
+					{"id": "Amount", "fields": {"type": "Numeric"}},
+					{"id": "Due", "fields": {"type": "Date"}},
+					{"id": "Paid", "fields": {"type": "Bool"}},
+					{"id": "Tags", "fields": {"type": "ChoiceList"}}
+				]}`))
+			case "/api/docs/doc123/tables/Orders/records":
+				w.Write([]byte(`{"records": [{"id": 1, "fields": {"Label": "A&B", "Amount": 12.5, "Due": 1714521600, "Paid": true, "Tags": ["L", "x", "y"]}}]}`))
+			}
+		})
+		defer cleanup()
+
+		var out bytes.Buffer
+		status, err := ExportTableExcel("doc123", "Orders", &out)
+		if err != nil || status != http.StatusOK {
+			t.Fatalf("Unexpected result %d, %v", status, err)
+		}
+		book, sheet := readSheet(t, out.Bytes())
+		if !strings.Contains(book, `name="Orders"`) {
+			t.Errorf("Expected an Orders sheet, got %s", book)
+		}
+		for _, cell := range []string{
+			`<c r="A1" t="inlineStr"><is><t xml:space="preserve">Name</t></is></c>`,
+			`<c r="A2" t="inlineStr"><is><t xml:space="preserve">A&amp;B</t></is></c>`,
+			`<c r="B2"><v>12.5</v></c>`,
+			`<t xml:space="preserve">2024-05-01</t>`,
+			`<c r="D2" t="b"><v>1</v></c>`,
+			`<t xml:space="preserve">x, y</t>`,
+		} {
+			if !strings.Contains(sheet, cell) {
+				t.Errorf("Expected sheet to contain %s, got %s", cell, sheet)
+			}
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid API key"}`))
+		})
+		defer cleanup()
+
+		var out bytes.Buffer
+		status, err := ExportTableExcel("doc123", "Orders", &out)
+		if status != http.StatusUnauthorized || !IsUnauthorized(err) || out.Len() != 0 {
+			t.Errorf("Expected a 401 error and no output, got %d, %v, %d bytes", status, err, out.Len())
+		}
+	})
+
+	if columnLetters(0) != "A" || columnLetters(25) != "Z" || columnLetters(26) != "AA" {
+		t.Errorf("Unexpected column letters")
+	}
+}
+
+func TestExportTableCSV(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/docs/doc123/download/csv" || r.URL.Query().Get("tableId") != "Orders" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("Label,Amount,Note\r\nA-1,\"12,5\",\"say \"\"hi\"\"\"\r\nB;2,3,\r\n"))
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		options  *CSVOptions
+		expected string
+	}{
+		{"defaults", nil, "Label,Amount,Note\nA-1,\"12,5\",\"say \"\"hi\"\"\"\nB;2,3,\n"},
+		{"semicolon", &CSVOptions{Delimiter: ';'}, "Label;Amount;Note\nA-1;12,5;\"say \"\"hi\"\"\"\n\"B;2\";3;\n"},
+		{"BOM and CRLF", &CSVOptions{BOM: true, LineEnding: "\r\n"}, "\ufeffLabel,Amount,Note\r\nA-1,\"12,5\",\"say \"\"hi\"\"\"\r\nB;2,3,\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			status, err := ExportTableCSV("doc123", "Orders", tt.options, &out)
+			if err != nil || status != http.StatusOK {
+				t.Fatalf("Unexpected result %d, %v", status, err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, out.String())
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if status, err := ExportTableCSV("doc123", "Orders", &CSVOptions{Delimiter: '"'}, &out); err == nil || status != -1 || out.Len() != 0 {
+		t.Errorf("Expected an invalid delimiter to fail before writing, got %d, %v, %q", status, err, out.String())
+	}
+	if status, err := ExportTableCSV("doc123", "Orders", &CSVOptions{LineEnding: "\r"}, &out); err == nil || status != -1 {
+		t.Errorf("Expected an unsupported line ending to fail, got %d, %v", status, err)
+	}
+	if status, err := ExportTableCSV("doc123", "Missing", nil, &out); status != http.StatusNotFound || err == nil {
+		t.Errorf("Expected a 404 error, got %d, %v", status, err)
+	}
+}
+
+func TestValidateColumns_Duplicates(t *testing.T) {
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"tables": []}`))
+	})
+	defer cleanup()
+
+	columns := []TableColumn{
+		{Id: "Name", Fields: ColumnFields{Label: "Name"}},
+		{Id: "Email"},
+		{Id: "name", Fields: ColumnFields{Label: "Full name"}},
+		{Id: "Phone", Fields: ColumnFields{Label: "Full name"}},
+		{Fields: ColumnFields{Type: "Text"}},
+		{Fields: ColumnFields{Type: "Text"}},
+	}
+	status, err := AddColumns("doc123", "People", columns)
+	if !errors.Is(err, ErrDuplicateColumns) || status != -1 {
+		t.Fatalf("Expected ErrDuplicateColumns, got %d, %v", status, err)
+	}
+	if !contains(err.Error(), `id "name"`) || !contains(err.Error(), `label "Full name"`) {
+		t.Errorf("Expected the error to name the duplicates, got %v", err)
+	}
+	if _, err := EnsureTable("doc123", "People", columns); !errors.Is(err, ErrDuplicateColumns) {
+		t.Errorf("Expected EnsureTable to reject duplicates, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request, got %d", requests)
+	}
+	if err := validateColumns(columns[:2]); err != nil {
+		t.Errorf("Unexpected error for distinct columns: %v", err)
+	}
+}
+
+func TestGetOrgsWithRole(t *testing.T) {
+	accessRequests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/orgs":
+			w.Write([]byte(`[
+				{"id": 1, "name": "Personal", "domain": "docs-1", "access": "owners"},
+				{"id": 2, "name": "Team", "domain": "team"},
+				{"id": 3, "name": "Other", "domain": "other"}
+			]`))
+		case "/api/profile/user":
+			w.Write([]byte(`{"id": 5, "name": "Me", "email": "Me@Example.com"}`))
+		case "/api/orgs/2/access":
+			accessRequests++
+			w.Write([]byte(`{"users": [{"id": 4, "email": "boss@example.com", "access": "owners"}, {"id": 5, "email": "me@example.com", "access": "editors"}]}`))
+		case "/api/orgs/3/access":
+			accessRequests++
+			w.Write([]byte(`{"users": [{"id": 4, "email": "boss@example.com", "access": "owners"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	orgs, err := GetOrgsWithRole()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Role{RoleOwners, RoleEditors, RoleNone}
+	if len(orgs) != len(expected) {
+		t.Fatalf("Expected %d orgs, got %+v", len(expected), orgs)
+	}
+	for i, role := range expected {
+		if orgs[i].Role != role {
+			t.Errorf("Expected role %q in %s, got %q", role, orgs[i].Name, orgs[i].Role)
+		}
+	}
+	if accessRequests != 2 {
+		t.Errorf("Expected the access of orgs without role only, got %d requests", accessRequests)
+	}
+}
+
+func TestExportDocVerified(t *testing.T) {
+	defer func(delay time.Duration) { exportRetryDelay = delay }(exportRetryDelay)
+	exportRetryDelay = 0
+
+	database := make([]byte, 2*4096)
+	copy(database, "SQLite format 3\x00")
+	database[16], database[17] = 0x10, 0x00 // 4096-byte pages
+	database[27], database[95] = 1, 1       // Change counter, and the version it is valid for
+	database[31] = 2                        // 2 pages
+	var workbook bytes.Buffer
+	if err := writeWorkbook(&workbook, "Table1", [][]interface{}{{"A"}, {1.0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format   string
+		content  []byte
+		failures int
+		attempts int
+		wantErr  bool
+	}{
+		{"grist", database, 0, 3, false},
+		{"grist", database, 2, 3, false},
+		{"grist", database, 3, 3, true},
+		{"xlsx", workbook.Bytes(), 1, 0, false},
+		{"xlsx", workbook.Bytes(), 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s with %d truncated downloads", tt.format, tt.failures), func(t *testing.T) {
+			requests := 0
+			_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tt.failures {
+					w.Write(tt.content[:len(tt.content)-100])
+					return
+				}
+				w.Write(tt.content)
+			})
+			defer cleanup()
+
+			fileName := t.TempDir() + "/export." + tt.format
+			err := ExportDocVerified("doc123", tt.format, fileName, tt.attempts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCorruptExport) {
+					t.Fatalf("Expected ErrCorruptExport, got %v", err)
+				}
+				if _, statErr := os.Stat(fileName); !os.IsNotExist(statErr) {
+					t.Errorf("Expected no file after a failed export")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			written, _ := os.ReadFile(fileName)
+			if !bytes.Equal(written, tt.content) || requests != tt.failures+1 {
+				t.Errorf("Expected the complete file after %d requests, got %d bytes after %d", tt.failures+1, len(written), requests)
+			}
+		})
+	}
+
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer cleanup()
+	if err := ExportDocVerified("doc123", "grist", t.TempDir()+"/export.grist", 3); err == nil || requests != 1 {
+		t.Errorf("Expected a 404 to fail without retrying, got %v after %d requests", err, requests)
+	}
+}
+
+func TestDumpDoc_SelectTables(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/docs/doc123/tables":
+			w.Write([]byte(`{"tables": [{"id": "Orders"}, {"id": "Customers"}, {"id": "Logs_2024"}, {"id": "Logs_2025"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/columns"):
+			w.Write([]byte(`{"columns": [{"id": "Name", "fields": {"type": "Text"}}]}`))
+		case r.URL.Path == "/api/docs/doc123/sql":
+			w.Write([]byte(`{"records": [{"fields": {"id": 1}}]}`))
+		case strings.HasSuffix(r.URL.Path, "/records") && !contains(r.URL.Path, "_grist_"):
+			writeRecordsByIds(t, w, r, func(id int) string { return `{"Name": "x"}` })
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		opts     DumpOptions
+		expected []string
+	}{
+		{"include only", DumpOptions{IncludeTables: []string{"Orders", "Logs_*"}}, []string{"Orders", "Logs_2024", "Logs_2025"}},
+		{"exclude pattern", DumpOptions{ExcludeTables: []string{"Logs_*"}}, []string{"Orders", "Customers"}},
+		{"include and exclude", DumpOptions{IncludeTables: []string{"Logs_*"}, ExcludeTables: []string{"*2024"}}, []string{"Logs_2025"}},
+		{"unmatched pattern", DumpOptions{ExcludeTables: []string{"Staging_*"}}, []string{"Orders", "Customers", "Logs_2024", "Logs_2025"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := DumpDoc("doc123", dir, tt.opts); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			schema := DocSchema{}
+			if err := readJSONFile(dir+"/schema.json", &schema); err != nil {
+				t.Fatal(err)
+			}
+			dumped := []string{}
+			for _, table := range schema.Tables {
+				dumped = append(dumped, table.Id)
+			}
+			if strings.Join(dumped, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected tables %v, got %v", tt.expected, dumped)
+			}
+			files, _ := os.ReadDir(dir)
+			if len(files) != len(tt.expected)+2 {
+				t.Errorf("Expected %d table files, got %d files", len(tt.expected), len(files))
+			}
+		})
+	}
+
+	if err := DumpDoc("doc123", t.TempDir(), DumpOptions{IncludeTables: []string{"Order"}}); err == nil || !contains(err.Error(), `unknown table "Order"`) {
+		t.Errorf("Expected an unknown table error, got %v", err)
+	}
+	if err := DumpDoc("doc123", t.TempDir(), DumpOptions{ExcludeTables: []string{"Logs_["}}); err == nil {
+		t.Errorf("Expected an invalid pattern error")
+	}
+}
+
+func TestSCIMCreateUser(t *testing.T) {
+	defer SetRetryPolicy(0, 0)
+	SetRetryPolicy(3, time.Millisecond)
+
+	tests := []struct {
+		name     string
+		statuses []int // Statuses returned before creating the user
+		requests int
+		status   int // Status of the error, 0 when the user is created
+	}{
+		{"created", nil, 1, 0},
+		{"conflict", []int{http.StatusConflict}, 1, http.StatusConflict},
+		{"invalid", []int{http.StatusBadRequest}, 1, http.StatusBadRequest},
+		// A POST isn't retried, even with a retry policy
+		{"rate limited", []int{http.StatusTooManyRequests}, 1, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			var userName string
+			_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Method != "POST" || r.URL.Path != "/api/scim/v2/Users" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if requests <= len(tt.statuses) {
+					w.WriteHeader(tt.statuses[requests-1])
+					fmt.Fprintf(w, `{"schemas": [%q], "status": "%d", "detail": "failed"}`, SCIMErrorSchema, tt.statuses[requests-1])
+					return
+				}
+				var user SCIMUser
+				json.NewDecoder(r.Body).Decode(&user)
+				userName = user.UserName
+				user.Id = "42"
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(user)
+			})
+			defer cleanup()
+
+			user, err := SCIMCreateUser(SCIMUser{UserName: "Jane@Example.com", Emails: []SCIMEmail{{Value: "Jane@Example.com", Primary: true}}})
+			if requests != tt.requests {
+				t.Errorf("Expected %d requests, got %d", tt.requests, requests)
+			}
+			if tt.status != 0 {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+					t.Errorf("Expected an HTTP %d error, got %v", tt.status, err)
+				}
+				if errors.Is(err, ErrUserExists) != (tt.status == http.StatusConflict) {
+					t.Errorf("Expected ErrUserExists on conflicts only, got %v", err)
+				}
+				return
+			}
+			if err != nil || user.Id != "42" || userName != "jane@example.com" {
+				t.Errorf("Unexpected result %+v, %v (userName sent %q)", user, err, userName)
+			}
+		})
+	}
+}
+
+// SCIM requests follow the retry policy, with SCIM's own retryable statuses
+func TestSCIMRetries(t *testing.T) {
+	defer SetRetryPolicy(0, 0)
+	tests := []struct {
+		name       string
+		maxRetries int
+		method     string
+		statuses   []int // Statuses returned before succeeding
+		requests   int
+	}{
+		{"retries off by default", 0, "PUT", []int{http.StatusServiceUnavailable}, 1},
+		{"PUT rate limited", 3, "PUT", []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}, 3},
+		{"DELETE conflict", 3, "DELETE", []int{http.StatusConflict}, 1},
+		{"PUT bad gateway", 3, "PUT", []int{http.StatusBadGateway}, 1},
+		{"POST unavailable", 3, "POST", []int{http.StatusServiceUnavailable}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetRetryPolicy(tt.maxRetries, time.Millisecond)
+			requests := 0
+			_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= len(tt.statuses) {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.statuses[requests-1])
+					return
+				}
+				w.Write([]byte(`{}`))
+			})
+			defer cleanup()
+
+			response, _ := SCIMBulk(SCIMBulkRequest{
+				Schemas:    []string{SCIMBulkRequestSchema},
+				Operations: []SCIMBulkOperation{{Method: tt.method, Path: "/Users/1", Data: map[string]interface{}{"userName": "jane"}}},
+			})
+			if requests != tt.requests {
+				t.Errorf("Expected %d requests, got %d (%+v)", tt.requests, requests, response.Operations)
+			}
+		})
+	}
+}
+
+func TestUpsertDocMetadata(t *testing.T) {
+	var body struct {
+		Records []RecordWithRequire `json:"records"`
+	}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/api/docs/registry/tables/Docs/records" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+	})
+	defer cleanup()
+
+	status, err := UpsertDocMetadata("registry", "Docs", "doc123", map[string]interface{}{"Owner": "jane@example.com", "Project": "Budget"})
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Unexpected result %d, %v", status, err)
+	}
+	if len(body.Records) != 1 || body.Records[0].Require["DocId"] != "doc123" || body.Records[0].Fields["Project"] != "Budget" {
+		t.Errorf("Unexpected upsert %+v", body.Records)
+	}
+
+	if _, err := UpsertDocMetadata("registry", "Docs", "doc123", map[string]interface{}{"DocId": "other"}); err == nil {
+		t.Errorf("Expected an error when fields set the key column")
+	}
+	if status, err := UpsertDocMetadata("registry", "Missing", "doc123", nil); status != http.StatusNotFound || err == nil {
+		t.Errorf("Expected a 404 error, got %d, %v", status, err)
+	}
+}
+
+func TestUpsertRecordsWithResults(t *testing.T) {
+	failUpsert := false
+	fetches := 0
+	people := []Record{
+		{Id: 1, Fields: map[string]interface{}{"email": "alice@example.com", "n": 1}},
+		{Id: 2, Fields: map[string]interface{}{"email": "bob@example.com", "n": 2}},
+		{Id: 3, Fields: map[string]interface{}{"email": "bob@example.com", "n": 2}},
+	}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			// Apply the filter like Grist: ANDed across columns
+			filter := map[string][]interface{}{}
+			if f := r.URL.Query().Get("filter"); f != "" {
+				json.Unmarshal([]byte(f), &filter)
+			}
+			fetches++
+			matching := []Record{}
+			for _, record := range people {
+				keep := true
+				for colId, values := range filter {
+					found := false
+					for _, value := range values {
+						found = found || valuesEqual(record.Fields[colId], value)
+					}
+					keep = keep && found
+				}
+				if keep {
+					matching = append(matching, record)
+				}
+			}
+			json.NewEncoder(w).Encode(RecordsList{Records: matching})
+		case "PUT":
+			if failUpsert {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "Invalid column \"emial\""}`))
+			}
+		}
+	})
+	defer cleanup()
+
+	records := []RecordWithRequire{
+		{Require: map[string]interface{}{"email": "alice@example.com", "n": 1}, Fields: map[string]interface{}{"name": "Alice"}},
+		{Require: map[string]interface{}{"email": "carol@example.com"}, Fields: map[string]interface{}{"name": "Carol"}},
+		{Require: map[string]interface{}{"email": "bob@example.com"}, Fields: map[string]interface{}{"name": "Bob"}},
+	}
+	tests := []struct {
+		name     string
+		options  *UpsertRecordsOptions
+		expected []UpsertOutcome
+	}{
+		{"defaults", nil, []UpsertOutcome{UpsertUpdated, UpsertAdded, UpsertUpdated}},
+		{"no add", &UpsertRecordsOptions{NoAdd: true}, []UpsertOutcome{UpsertUpdated, UpsertSkipped, UpsertUpdated}},
+		{"no update", &UpsertRecordsOptions{NoUpdate: true}, []UpsertOutcome{UpsertSkipped, UpsertAdded, UpsertSkipped}},
+		{"on many none", &UpsertRecordsOptions{OnMany: "none"}, []UpsertOutcome{UpsertUpdated, UpsertAdded, UpsertSkipped}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := UpsertRecordsWithResults("doc123", "People", records, tt.options)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for i, outcome := range tt.expected {
+				if results[i].Outcome != outcome || results[i].Require["email"] != records[i].Require["email"] {
+					t.Errorf("Expected %s for %v, got %+v", outcome, records[i].Require, results[i])
+				}
+			}
+			if results[2].Matches != 2 {
+				t.Errorf("Expected 2 matches for bob, got %d", results[2].Matches)
+			}
+		})
+	}
+	// One request for {email,n} and one for {email}
+	if fetches != 2*len(tests) {
+		t.Errorf("Expected 2 fetches per upsert, got %d", fetches)
+	}
+
+	failUpsert = true
+	results, err := UpsertRecordsWithResults("doc123", "People", records, nil)
+	if err == nil {
+		t.Fatalf("Expected the upsert to fail")
+	}
+	for _, result := range results {
+		if result.Outcome != UpsertError || result.Err == nil {
+			t.Errorf("Expected an error outcome, got %+v", result)
+		}
+	}
+}
+
+func TestDoRaw(t *testing.T) {
+	payload := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, '\n', 0x00}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/docs/doc123/attachments/1/download":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(payload)
+		case "/api/docs/doc123/apply":
+			body, _ := io.ReadAll(r.Body)
+			if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || string(body) != `[]` {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"actionNum": 1}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not found"}`))
+		}
+	})
+	defer cleanup()
+
+	content, header, status, err := DoRaw("GET", "/docs/doc123/attachments/1/download", nil)
+	if err != nil || status != http.StatusOK || !bytes.Equal(content, payload) || header.Get("Content-Type") != "image/png" {
+		t.Fatalf("Unexpected response %v, %v, %d, %v", content, header, status, err)
+	}
+	if _, _, status, err := DoRaw("POST", "docs/doc123/apply", strings.NewReader(`[]`)); err != nil || status != http.StatusOK {
+		t.Errorf("Unexpected POST result %d, %v", status, err)
+	}
+	content, _, status, err = DoRaw("GET", "docs/doc123/report", nil)
+	var apiErr *APIError
+	if status != http.StatusNotFound || !errors.As(err, &apiErr) || string(content) != `{"error": "not found"}` {
+		t.Errorf("Expected a 404 error with its body, got %d, %v, %q", status, err, content)
+	}
+}
+
+func TestSetAllowedEmailDomains(t *testing.T) {
+	SetAllowedEmailDomains([]string{"Example.com", "@partner.org "})
+	defer SetAllowedEmailDomains(nil)
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/api/scim/v2/Users" {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": "7", "userName": "jane@example.com"}`))
+		}
+	})
+	defer cleanup()
+
+	if _, err := UpdateDocAccess("doc123", map[string]string{"Jane@EXAMPLE.com": "editors", "bob@partner.org": "viewers"}); err != nil {
+		t.Errorf("Expected allowed domains to be accepted, got %v", err)
+	}
+	if _, err := UpdateDocAccess("doc123", map[string]string{"jane@example.com": "editors", "eve@gmail.com": "owners", "mallory@example.com.evil": "viewers"}); !errors.Is(err, ErrEmailDomainNotAllowed) || !contains(err.Error(), "eve@gmail.com, mallory@example.com.evil") {
+		t.Errorf("Expected the external emails to be rejected, got %v", err)
+	}
+	if _, err := UpdateDocAccess("doc123", map[string]string{"eve@gmail.com": ""}); err != nil {
+		t.Errorf("Expected removing an external user to be allowed, got %v", err)
+	}
+	if _, err := SCIMCreateUser(SCIMUser{UserName: "jane@example.com"}); err != nil {
+		t.Errorf("Expected the SCIM user to be created, got %v", err)
+	}
+	if _, err := SCIMCreateUser(SCIMUser{UserName: "jane@example.com", Emails: []SCIMEmail{{Value: "jane@gmail.com"}}}); !errors.Is(err, ErrEmailDomainNotAllowed) {
+		t.Errorf("Expected the SCIM user to be rejected, got %v", err)
+	}
+	bulk, _ := SCIMBulk(SCIMBulkRequest{
+		Schemas:    []string{SCIMBulkRequestSchema},
+		Operations: []SCIMBulkOperation{{Method: "POST", Path: "/Users", Data: map[string]interface{}{"userName": "eve@gmail.com"}}},
+	})
+	if len(bulk.Operations) != 1 || bulk.Operations[0].Status != "400" {
+		t.Errorf("Expected the bulk creation to be rejected, got %+v", bulk.Operations)
+	}
+	if requests != 3 {
+		t.Errorf("Expected only the allowed requests to be sent, got %d", requests)
+	}
+
+	SetAllowedEmailDomains(nil)
+	if _, err := UpdateDocAccess("doc123", map[string]string{"eve@gmail.com": "owners"}); err != nil {
+		t.Errorf("Expected no restriction once cleared, got %v", err)
+	}
+}
+
+func TestGetDocViews(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables/_grist_Views/records":
+			w.Write([]byte(`{"records": [
+				{"id": 1, "fields": {"name": "Contacts"}},
+				{"id": 2, "fields": {"name": "Dashboard"}},
+				{"id": 3, "fields": {"name": "Empty"}}
+			]}`))
+		case "/api/docs/doc123/tables/_grist_Views_section/records":
+			w.Write([]byte(`{"records": [
+				{"id": 1, "fields": {"tableRef": 1, "parentId": 1}},
+				{"id": 2, "fields": {"tableRef": 1, "parentId": 0}},
+				{"id": 3, "fields": {"tableRef": 2, "parentId": 2}},
+				{"id": 4, "fields": {"tableRef": 1, "parentId": 2}},
+				{"id": 5, "fields": {"tableRef": 2, "parentId": 2}}
+			]}`))
+		case "/api/docs/doc123/tables/_grist_Tables/records":
+			w.Write([]byte(`{"records": [
+				{"id": 1, "fields": {"tableId": "Contacts", "primaryViewId": 1}},
+				{"id": 2, "fields": {"tableId": "Orders", "primaryViewId": 0}}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	views, status := GetDocViews("doc123")
+	if status != http.StatusOK || len(views) != 3 {
+		t.Fatalf("Unexpected result %d, %+v", status, views)
+	}
+	expected := []struct {
+		name     string
+		tableId  string
+		tableIds string
+	}{
+		{"Contacts", "Contacts", "Contacts"},
+		{"Dashboard", "Orders", "Orders,Contacts"},
+		{"Empty", "", ""},
+	}
+	for i, view := range expected {
+		got := views[i]
+		if got.Id != i+1 || got.Name != view.name || got.TableId != view.tableId || strings.Join(got.TableIds, ",") != view.tableIds {
+			t.Errorf("Expected view %+v, got %+v", view, got)
+		}
+	}
+}
+
+func TestRenameTable(t *testing.T) {
+	var patch string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/docs/doc123/tables" && r.Method == "GET":
+			w.Write([]byte(`{"tables": [{"id": "Orders"}, {"id": "Customers"}]}`))
+		case r.URL.Path == "/api/docs/doc123/tables" && r.Method == "PATCH":
+			body, _ := io.ReadAll(r.Body)
+			patch = string(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	status, err := RenameTable("doc123", "Orders", "Sales_2024")
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Unexpected result %d, %v", status, err)
+	}
+	if patch != `{"tables":[{"fields":{"tableId":"Sales_2024"},"id":"Orders"}]}` {
+		t.Errorf("Unexpected body %s", patch)
+	}
+
+	patch = ""
+	tests := []struct {
+		oldTableId string
+		newTableId string
+		status     int
+	}{
+		{"Orders", "sales", -1},
+		{"Orders", "2024_Sales", -1},
+		{"Orders", "Sales 2024", -1},
+		{"Orders", "Ventes_é", -1},
+		{"Orders", "customers", -1},
+		{"Orders", "CUSTOMERS", -1},
+		{"Missing", "Sales", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status, err := RenameTable("doc123", tt.oldTableId, tt.newTableId); err == nil || status != tt.status {
+			t.Errorf("Expected renaming %s to %q to fail with %d, got %d, %v", tt.oldTableId, tt.newTableId, tt.status, status, err)
+		}
+	}
+	if patch != "" {
+		t.Errorf("Expected no rename to be sent, got %s", patch)
+	}
+}
+
+func TestHTTPRequestErrors(t *testing.T) {
+	server, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer cleanup()
+
+	// An invalid request is reported instead of exiting
+	body, status, err := httpRequest("BAD METHOD", "orgs", nil)
+	var requestErr *RequestError
+	if status != -1 || !errors.As(err, &requestErr) || requestErr.Method != "BAD METHOD" || body == "" {
+		t.Errorf("Expected a RequestError with status -1, got %d, %v", status, err)
+	}
+
+	// Transport errors are returned by the functions returning an error
+	server.Close()
+	status, err = UpdateDocAccess("doc123", map[string]string{"jane@example.com": "editors"})
+	if status != -10 || !errors.As(err, &requestErr) || requestErr.Path != "docs/doc123/access" {
+		t.Errorf("Expected a RequestError with status -10, got %d, %v", status, err)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		t.Errorf("Expected no APIError without a response, got %v", apiErr)
+	}
+}
+
+func TestImportRecordsCSV(t *testing.T) {
+	// The mock parses numbers like Grist does for Numeric columns
+	stored := map[int]map[string]interface{}{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		parse := r.URL.Query().Get("noparse") != "true"
+		var body struct {
+			Records []Record `json:"records"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for i, record := range body.Records {
+			if r.Method == "POST" {
+				record.Id = len(stored) + 1
+				stored[record.Id] = map[string]interface{}{}
+				body.Records[i].Id = record.Id
+			}
+			for colId, value := range record.Fields {
+				if number, err := strconv.ParseFloat(value.(string), 64); err == nil && parse {
+					stored[record.Id][colId] = number
+				} else {
+					stored[record.Id][colId] = value
+				}
+			}
+		}
+		if r.Method == "POST" {
+			ids := []map[string]int{}
+			for _, record := range body.Records {
+				ids = append(ids, map[string]int{"id": record.Id})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"records": ids})
+		}
+	})
+	defer cleanup()
+
+	csvFile := "Name;Zip;Amount\nAlice;01234;12.50\nBob;75001;3\n"
+	ids, err := ImportRecordsCSV("doc123", "People", strings.NewReader(csvFile), &ImportCSVOptions{Delimiter: ';', RawColumns: []string{"Zip"}})
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("Unexpected result %v, %v", ids, err)
+	}
+	alice := stored[ids[0]]
+	if alice["Zip"] != "01234" || alice["Amount"] != 12.5 || alice["Name"] != "Alice" {
+		t.Errorf("Expected Zip kept as text and Amount parsed, got %v", alice)
+	}
+
+	stored = map[int]map[string]interface{}{}
+	ids, _ = ImportRecordsCSV("doc123", "People", strings.NewReader(csvFile), &ImportCSVOptions{Delimiter: ';'})
+	if stored[ids[0]]["Zip"] != float64(1234) {
+		t.Errorf("Expected Zip parsed without RawColumns, got %v", stored[ids[0]])
+	}
+
+	if _, err := ImportRecordsCSV("doc123", "People", strings.NewReader(csvFile), &ImportCSVOptions{Delimiter: ';', RawColumns: []string{"Phone"}}); err == nil {
+		t.Errorf("Expected an error for a raw column missing from the header")
+	}
+}
+
+func TestNotConfigured(t *testing.T) {
+	t.Setenv("GRIST_URL", "")
+	t.Setenv("GRIST_TOKEN", "")
+	t.Setenv("HOME", t.TempDir())
+
+	if err := CheckConfig(); !errors.Is(err, ErrNotConfigured) || !contains(err.Error(), "GRIST_URL and GRIST_TOKEN not set") {
+		t.Errorf("Expected ErrNotConfigured naming both variables, got %v", err)
+	}
+	if _, err := GetConfig(); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected GetConfig to report the missing configuration, got %v", err)
+	}
+	if _, status, err := defaultClient.getRecords("doc123", "Table1", nil); !errors.Is(err, ErrNotConfigured) || status != -10 {
+		t.Errorf("Expected requests to fail with ErrNotConfigured, got %d, %v", status, err)
+	}
+	if _, _, _, err := DoRaw("GET", "orgs", nil); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected DoRaw to fail with ErrNotConfigured, got %v", err)
+	}
+
+	configFile := os.Getenv("HOME") + "/.gristle"
+	os.WriteFile(configFile, []byte("GRIST_URL=\"https://grist.example.com\"\nGRIST_TOKEN=\"secret\"\n"), 0o600)
+	if file, err := GetConfig(); err != nil || file != configFile || os.Getenv("GRIST_URL") != "https://grist.example.com" {
+		t.Errorf("Expected the configuration file to be loaded, got %s, %v", file, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	newServer := func(name string, token string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+token {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.URL.Path {
+			case "/api/orgs":
+				fmt.Fprintf(w, `[{"id": 1, "name": %q}]`, name)
+			case "/api/docs/doc123/tables/Table1/records":
+				if r.Method == "POST" {
+					w.Write([]byte(`{"records": [{"id": 7}]}`))
+					return
+				}
+				fmt.Fprintf(w, `{"records": [{"id": 1, "fields": {"Server": %q}}]}`, name)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}
+	serverA, serverB := newServer("A", "token-a"), newServer("B", "token-b")
+	defer serverA.Close()
+	defer serverB.Close()
+	t.Setenv("GRIST_URL", "")
+	t.Setenv("GRIST_TOKEN", "")
+
+	clients := map[string]*Client{"A": NewClient(serverA.URL+"/api/", "token-a"), "B": NewClient(serverB.URL, "token-b")}
+	var wg sync.WaitGroup
+	errs := make(chan string, 40)
+	for i := 0; i < 10; i++ {
+		for name, client := range clients {
+			wg.Add(1)
+			go func(name string, client *Client) {
+				defer wg.Done()
+				if orgs := client.GetOrgs(); len(orgs) != 1 || orgs[0].Name != name {
+					errs <- fmt.Sprintf("client %s got orgs %v", name, orgs)
+				}
+				records, status := client.GetRecords("doc123", "Table1", nil)
+				if status != http.StatusOK || len(records.Records) != 1 || records.Records[0].Fields["Server"] != name {
+					errs <- fmt.Sprintf("client %s got records %v (%d)", name, records, status)
+				}
+			}(name, client)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if result, status := clients["A"].AddRecords("doc123", "Table1", []map[string]interface{}{{"A": 1}}, nil); status != http.StatusOK || len(result.Records) != 1 || result.Records[0].Id != 7 {
+		t.Errorf("Unexpected AddRecords result %v, %d", result, status)
+	}
+	if _, status := NewClient(serverA.URL, "token-b").GetRecords("doc123", "Table1", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected the client's own token to be sent, got %d", status)
+	}
+	if _, _, err := NewClient("", "token-a").GetOrgOK("1"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured for a client without URL, got %v", err)
+	}
+	if orgs := GetOrgs(); len(orgs) != 0 {
+		t.Errorf("Expected the package functions to keep using the environment, got %v", orgs)
+	}
+}
+
+func TestClientState(t *testing.T) {
+	var failing, paths sync.Map
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths.Store(name, r.Method+" "+r.URL.Path)
+			if _, found := failing.Load(name); found {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			switch r.URL.Path {
+			case "/o/team/api/docs/doc123/tables/Table1/records":
+				w.Write([]byte(`{}`))
+			case "/api/docs/doc123/tables/Table1/records/delete":
+				w.Write([]byte(`null`))
+			case "/api/docs/doc123/download":
+				w.Write([]byte("SQLite format 3"))
+			default:
+				w.Write([]byte(`[]`))
+			}
+		}))
+	}
+	serverA, serverB := newServer("A"), newServer("B")
+	defer serverA.Close()
+	defer serverB.Close()
+	clientA, clientB := NewClient(serverA.URL, "token"), NewClient(serverB.URL, "token")
+	clientA.SetCircuitBreaker(1, time.Minute)
+	clientB.SetCircuitBreaker(1, time.Minute)
+
+	// A failing server only opens the breaker of its client
+	failing.Store("A", true)
+	clientA.GetOrgs()
+	if _, _, _, err := clientA.DoRaw("GET", "orgs", nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the breaker of the failing server's client to open, got %v", err)
+	}
+	if _, _, status, err := clientB.DoRaw("GET", "orgs", nil); err != nil || status != http.StatusOK {
+		t.Errorf("Expected the other client to reach its server, got %d, %v", status, err)
+	}
+
+	clientB.Org = "team"
+	if _, status := clientB.UpdateRecords("doc123", "Table1", []Record{{Id: 1, Fields: map[string]interface{}{"A": 1}}}, nil); status != http.StatusOK {
+		t.Errorf("Unexpected UpdateRecords status %d", status)
+	}
+	if path, _ := paths.Load("B"); path != "PATCH /o/team/api/docs/doc123/tables/Table1/records" {
+		t.Errorf("Expected the request to be scoped to the client's org, got %v", path)
+	}
+	clientB.Org = ""
+	if _, status := clientB.DeleteRecords("doc123", "Table1", []int{1}); status != http.StatusOK {
+		t.Errorf("Unexpected DeleteRecords status %d", status)
+	}
+	var export bytes.Buffer
+	if err := clientB.ExportDocGristTo("doc123", &export); err != nil || export.String() != "SQLite format 3" {
+		t.Errorf("Unexpected export %q, %v", export.String(), err)
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	var query string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/tables/People/columns":
+			w.Write([]byte(`{"columns": [{"id": "Name"}, {"id": "Age"}]}`))
+		case "/api/docs/doc123/sql":
+			body := struct {
+				SQL string `json:"sql"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			query = body.SQL
+			w.Write([]byte(`{"records": [{"fields": {"Name": "Bob", "Age": 40}}, {"fields": {"Name": "Alice", "Age": 30}}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	tests := []struct {
+		columns  []SortColumn
+		expected string
+	}{
+		{[]SortColumn{Asc("Name")}, ` ORDER BY "Name"`},
+		{[]SortColumn{Desc("Age")}, ` ORDER BY "Age" DESC`},
+		{[]SortColumn{Desc("Age"), Asc("Name"), Asc("id")}, ` ORDER BY "Age" DESC, "Name", "id"`},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		orderBy, err := OrderBy("doc123", "People", tt.columns...)
+		if err != nil || orderBy != tt.expected {
+			t.Errorf("OrderBy(%v) = %q, %v, expected %q", tt.columns, orderBy, err, tt.expected)
+		}
+	}
+
+	orderBy, _ := OrderBy("doc123", "People", Desc("Age"))
+	records, status := QuerySQL("doc123", `SELECT * FROM "People"`+orderBy, nil)
+	if status != http.StatusOK || len(records.Records) != 2 || query != `SELECT * FROM "People" ORDER BY "Age" DESC` {
+		t.Errorf("Unexpected query %q (%d)", query, status)
+	}
+
+	for _, column := range []string{"Salary", `Name" ; DROP TABLE People; --`} {
+		if _, err := OrderBy("doc123", "People", Asc(column)); !errors.Is(err, ErrUnknownColumn) {
+			t.Errorf("Expected ErrUnknownColumn for %q, got %v", column, err)
+		}
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	var mutex sync.Mutex
+	connections := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		connections[r.RemoteAddr] = true
+		mutex.Unlock()
+		w.Write([]byte(`{"records": []}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token")
+	client.HTTPClient = NewHTTPClient(ConnectionOptions{MaxIdleConns: 4, MaxIdleConnsPerHost: 4, IdleConnTimeout: time.Minute})
+	for i := 0; i < 30; i++ {
+		if _, status := client.GetRecords("doc123", "Table1", nil); status != http.StatusOK {
+			t.Fatalf("Unexpected status %d", status)
+		}
+	}
+	if len(connections) != 1 {
+		t.Errorf("Expected sequential requests to reuse one connection, got %d", len(connections))
+	}
+	if client.HTTPClient.CheckRedirect == nil {
+		t.Errorf("Expected the API key to be guarded on redirects")
+	}
+}
+
+func TestApplyActions(t *testing.T) {
+	var received []interface{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/docs/doc123/apply" || r.Method != "POST" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"actionNum": 5, "retValues": [12, null, null, 4]}`))
+	})
+	defer cleanup()
+
+	actions := []UserAction{
+		AddRecord("People", map[string]interface{}{"Name": "Alice"}),
+		UpdateRecord("Orders", 3, map[string]interface{}{"Status": "paid"}),
+		RemoveRecord("Orders", 4),
+		AddColumn("People", "Email", ColumnFields{Type: "Text"}),
+	}
+	response, status := ApplyActions("doc123", actions)
+	if status != http.StatusOK || !contains(response, `"retValues"`) {
+		t.Fatalf("Unexpected response %s (%d)", response, status)
+	}
+	expected := `[["AddRecord","People",null,{"Name":"Alice"}],["UpdateRecord","Orders",3,{"Status":"paid"}],["RemoveRecord","Orders",4],["AddColumn","People","Email",{"formula":"","isFormula":false,"type":"Text"}]]`
+	if sent, _ := json.Marshal(received); string(sent) != expected {
+		t.Errorf("Unexpected actions sent:\n%s\nexpected:\n%s", sent, expected)
+	}
+
+	if _, status := ApplyActions("", actions); status != -1 {
+		t.Errorf("Expected -1 for an empty docId, got %d", status)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	if DefaultConnectionOptions.Timeout != 30*time.Second {
+		t.Errorf("Expected a default timeout of 30s, got %s", DefaultConnectionOptions.Timeout)
+	}
+	client := NewClient(server.URL, "test-token")
+	client.HTTPClient = NewHTTPClient(ConnectionOptions{Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	_, _, status, err := client.DoRaw("GET", "orgs", nil)
+	if !errors.Is(err, ErrTimeout) || status != -10 {
+		t.Errorf("Expected ErrTimeout, got %d, %v", status, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the request to give up after its timeout, took %s", elapsed)
+	}
+}
+
+func TestRequestTimeout_Downloads(t *testing.T) {
+	// The body is sent in chunks over 200ms, longer than the timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token")
+	client.HTTPClient = NewHTTPClient(ConnectionOptions{Timeout: 100 * time.Millisecond, ResponseHeaderTimeout: time.Second})
+
+	var buffer bytes.Buffer
+	if _, err := client.download("docs/doc123/download", &buffer); err != nil || buffer.String() != "chunkchunkchunkchunk" {
+		t.Errorf("Expected the download to outlast the timeout, got %q, %v", buffer.String(), err)
+	}
+	_, _, status, err := client.DoRaw("GET", "docs/doc123/download", nil)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected other requests reading a slow body to time out, got %d, %v", status, err)
+	}
+}
+
+func TestRequestTimeout_ResponseHeaders(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, "test-token")
+	client.HTTPClient = NewHTTPClient(ConnectionOptions{ResponseHeaderTimeout: 50 * time.Millisecond})
+	if status, err := client.download("docs/doc123/download", io.Discard); !errors.Is(err, ErrTimeout) || status != -10 {
+		t.Errorf("Expected a hung server to time out a download, got %d, %v", status, err)
+	}
+}
+
+// fakeSQLiteDriver stands for a SQLite driver: a database has the tables
+// whose names, starting with _grist_, appear in its file, and fails the
+// integrity check when its file contains "corrupt page"
+type fakeSQLiteDriver struct{}
+
+func (fakeSQLiteDriver) Open(name string) (driver.Conn, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	integrity := []string{"ok"}
+	if bytes.Contains(content, []byte("corrupt page")) {
+		integrity = []string{"*** in database main ***", "Page 2: btreeInitPage() returns error code 11"}
+	}
+	return &fakeSQLiteConn{
+		tables:    regexp.MustCompile(`_grist_\w+`).FindAllString(string(content), -1),
+		integrity: integrity,
+	}, nil
+}
+
+type fakeSQLiteConn struct {
+	tables    []string
+	integrity []string
+}
+
+func (c *fakeSQLiteConn) Prepare(query string) (driver.Stmt, error) {
+	if query == "PRAGMA integrity_check" {
+		return fakeSQLiteStmt(c.integrity), nil
+	}
+	return fakeSQLiteStmt(c.tables), nil
+}
+func (c *fakeSQLiteConn) Close() error              { return nil }
+func (c *fakeSQLiteConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+// fakeSQLiteStmt returns its values as rows of a single column
+type fakeSQLiteStmt []string
+
+func (s fakeSQLiteStmt) Close() error  { return nil }
+func (s fakeSQLiteStmt) NumInput() int { return 0 }
+func (s fakeSQLiteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeSQLiteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeSQLiteRows{values: s}, nil
+}
+
+type fakeSQLiteRows struct{ values []string }
+
+func (r *fakeSQLiteRows) Columns() []string { return []string{"name"} }
+func (r *fakeSQLiteRows) Close() error      { return nil }
+func (r *fakeSQLiteRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("fakesqlite", fakeSQLiteDriver{})
+}
+
+func TestSetSQLiteDriver(t *testing.T) {
+	defer func(delay time.Duration) { exportRetryDelay = delay }(exportRetryDelay)
+	exportRetryDelay = 0
+	if err := SetSQLiteDriver("nosuchdriver"); err == nil {
+		t.Errorf("Expected an error for an unregistered driver")
+	}
+	if err := SetSQLiteDriver("fakesqlite"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetSQLiteDriver("")
+
+	newDatabase := func(tables string) []byte {
+		database := make([]byte, 4096)
+		copy(database, "SQLite format 3\x00")
+		database[16], database[17] = 0x10, 0x00
+		copy(database[100:], tables)
+		return database
+	}
+	var content []byte
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	})
+	defer cleanup()
+
+	dir := t.TempDir()
+	content = newDatabase("_grist_DocInfo _grist_Tables _grist_Tables_column Table1")
+	if err := ExportDocVerified("doc123", "grist", dir+"/backup", 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(dir + "/backup.grist"); err != nil {
+		t.Errorf("Expected the .grist extension to be added: %v", err)
+	}
+
+	content = newDatabase("Table1")
+	err := ExportDocVerified("doc123", "grist", dir+"/other.grist", 1)
+	if !errors.Is(err, ErrCorruptExport) || !contains(err.Error(), "_grist_DocInfo") {
+		t.Errorf("Expected ErrCorruptExport naming the missing tables, got %v", err)
+	}
+
+	content = newDatabase("_grist_DocInfo _grist_Tables _grist_Tables_column corrupt page")
+	err = ExportDocVerified("doc123", "grist", dir+"/other.grist", 1)
+	if !errors.Is(err, ErrCorruptExport) || !contains(err.Error(), "integrity check") {
+		t.Errorf("Expected ErrCorruptExport from the integrity check, got %v", err)
+	}
+	if _, statErr := os.Stat(dir + "/other.grist"); !os.IsNotExist(statErr) {
+		t.Errorf("Expected no file after a failed integrity check")
+	}
+
+	SetSQLiteDriver("")
+	if err := ExportDocVerified("doc123", "grist", dir+"/other.grist", 1); err != nil {
+		t.Errorf("Expected only the structural check without driver, got %v", err)
+	}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	defer SetRetryPolicy(0, 0)
+	failures, requests := 0, map[string]int{}
+	server, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests[r.Method]++
+		if requests[r.Method] <= failures {
+			w.WriteHeader([]int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}[requests[r.Method]-1])
+			return
+		}
+		w.Write(body)
+	})
+	defer cleanup()
+
+	failures = 2
+	if _, status, _ := httpGet("orgs", ""); status != http.StatusTooManyRequests || requests["GET"] != 1 {
+		t.Errorf("Expected no retry by default, got %d after %d requests", status, requests["GET"])
+	}
+
+	SetRetryPolicy(3, time.Millisecond)
+	requests, failures = map[string]int{}, 4
+	if _, status, _ := httpGet("orgs", ""); status != http.StatusGatewayTimeout || requests["GET"] != 4 {
+		t.Errorf("Expected 3 retries, got %d after %d requests", status, requests["GET"])
+	}
+	requests, failures = map[string]int{}, 3
+	if response, status, err := httpPut("docs/doc123", `{"name": "x"}`); err != nil || status != http.StatusOK || response != `{"name": "x"}` || requests["PUT"] != 4 {
+		t.Errorf("Expected PUT to succeed with its body after 3 retries, got %d %q after %d requests", status, response, requests["PUT"])
+	}
+	requests, failures = map[string]int{}, 1
+	if _, status, _ := httpPost("docs/doc123/tables/T/records", `{}`); status != http.StatusTooManyRequests || requests["POST"] != 1 {
+		t.Errorf("Expected POST not to be retried, got %d after %d requests", status, requests["POST"])
+	}
+
+	client := NewClient(server.URL, "test-token")
+	client.MaxRetries, client.RetryBaseDelay = 1, time.Millisecond
+	requests, failures = map[string]int{}, 1
+	if _, status := client.GetRecords("doc123", "T", nil); status != http.StatusOK || requests["GET"] != 2 {
+		t.Errorf("Expected the client's policy to retry once, got %d after %d requests", status, requests["GET"])
+	}
+
+	for retry := 0; retry < 4; retry++ {
+		base := 100 * time.Millisecond << retry
+		if delay := backoffDelay(100*time.Millisecond, retry); delay < base/2 || delay > base {
+			t.Errorf("Retry %d: delay %s outside [%s, %s]", retry, delay, base/2, base)
+		}
+	}
+}
+
+func TestRetryOptions(t *testing.T) {
+	SetRetryPolicy(2, time.Millisecond)
+	defer SetRetryPolicy(0, 0)
+	requests := map[string]int{}
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method]++
+		if requests[r.Method] == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"records": [{"id": 1}]}`))
+	})
+	defer cleanup()
+
+	fields := []map[string]interface{}{{"A": 1}}
+	if _, status := AddRecords("doc123", "T", fields, nil); status != http.StatusServiceUnavailable || requests["POST"] != 1 {
+		t.Errorf("Expected POST not to be retried by default, got %d after %d requests", status, requests["POST"])
+	}
+	requests = map[string]int{}
+	if _, status := AddRecords("doc123", "T", fields, &AddRecordsOptions{RetryOptions: RetryOptions{IdempotentRetry: true}}); status != http.StatusOK || requests["POST"] != 2 {
+		t.Errorf("Expected an opted-in POST to be retried, got %d after %d requests", status, requests["POST"])
+	}
+	records := []Record{{Id: 1, Fields: map[string]interface{}{"A": 2}}}
+	if _, status := UpdateRecords("doc123", "T", records, &UpdateRecordsOptions{RetryOptions: RetryOptions{IdempotentRetry: true}}); status != http.StatusOK || requests["PATCH"] != 2 {
+		t.Errorf("Expected an opted-in PATCH to be retried, got %d after %d requests", status, requests["PATCH"])
+	}
+	upserts := []RecordWithRequire{{Require: map[string]interface{}{"A": 1}, Fields: map[string]interface{}{"B": 2}}}
+	if _, status := UpsertRecords("doc123", "T", upserts, &UpsertRecordsOptions{RetryOptions: RetryOptions{NoRetry: true}}); status != http.StatusServiceUnavailable || requests["PUT"] != 1 {
+		t.Errorf("Expected an opted-out PUT not to be retried, got %d after %d requests", status, requests["PUT"])
+	}
+	if _, status := UpsertRecords("doc123", "T", upserts, nil); status != http.StatusOK || requests["PUT"] != 2 {
+		t.Errorf("Expected PUT to follow the policy, got %d after %d requests", status, requests["PUT"])
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"Sun, 01 Mar 2026 12:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 01 Mar 2026 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if wait, ok := retryAfter(header, now); wait != tt.expected || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %v, expected %s, %v", tt.value, wait, ok, tt.expected, tt.ok)
+		}
+	}
+
+	SetRetryPolicy(1, time.Millisecond)
+	defer SetRetryPolicy(0, 0)
+	retryAfterValue, requests := "1", 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", retryAfterValue)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+	defer cleanup()
+
+	start := time.Now()
+	if _, status, _ := httpGet("orgs", ""); status != http.StatusOK || time.Since(start) < time.Second {
+		t.Errorf("Expected the retry to wait for Retry-After, got %d after %s", status, time.Since(start))
+	}
+	retryAfterValue, requests = "3600", 0
+	if _, status, _ := httpGet("orgs", ""); status != http.StatusTooManyRequests || requests != 1 {
+		t.Errorf("Expected no retry when asked to wait an hour, got %d after %d requests", status, requests)
+	}
+}
+
+func TestGetRecords_WhereOr(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			writeRecordsByIds(t, w, r, func(id int) string {
+				return map[int]string{1: `{"Name": "Alice"}`, 2: `{"Email": "bob@example.com"}`}[id]
+			})
+			return
+		}
+		if r.Method != "POST" || r.URL.Path != "/api/docs/doc123/sql" {
+			t.Errorf("Expected an Or to go through the SQL endpoint, got %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			SQL  string        `json:"sql"`
+			Args []interface{} `json:"args"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		expected := `SELECT "id" FROM "People" WHERE ("Name" IN (?) OR "Email" IN (?)) AND "Active" IN (?)`
+		if body.SQL != expected || len(body.Args) != 3 || body.Args[0] != "Alice" || body.Args[1] != "bob@example.com" {
+			t.Errorf("Expected SQL %s, got %s %v", expected, body.SQL, body.Args)
+		}
+		w.Write([]byte(`{"records": [{"fields": {"id": 1}}, {"fields": {"id": 2}}]}`))
+	})
+	defer cleanup()
+
+	where := And(Or(Eq("Name", "Alice"), Eq("Email", "bob@example.com")), Eq("Active", true))
+	if _, ok := where.pushdown(nil); ok {
+		t.Errorf("Expected an Or not to be pushed down to ?filter=")
+	}
+	records, status := GetRecords("doc123", "People", &GetRecordsOptions{Where: &where})
+	if status != http.StatusOK || len(records.Records) != 2 {
+		t.Fatalf("Unexpected result %d %+v", status, records.Records)
+	}
+
+	tests := []struct {
+		fields   map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"Name": "Alice", "Email": "a@example.com", "Active": true}, true},
+		{map[string]interface{}{"Name": "Bob", "Email": "bob@example.com", "Active": true}, true},
+		{map[string]interface{}{"Name": "Bob", "Email": "bob@example.com", "Active": false}, false},
+		{map[string]interface{}{"Name": "Carol", "Email": "carol@example.com", "Active": true}, false},
+	}
+	for _, tt := range tests {
+		if where.Match(tt.fields) != tt.expected {
+			t.Errorf("Match(%v) = %v, expected %v", tt.fields, !tt.expected, tt.expected)
+		}
+	}
+	if condition, _ := Or().sql(); condition != "0" {
+		t.Errorf("Expected an empty Or to match nothing, got %s", condition)
+	}
+}
+
+func TestExportDocGrist_Binary(t *testing.T) {
+	database := append([]byte("SQLite format 3\x00"), 0x00, 0xff, '\r', '\n', 0x80, 0xc3)
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/docs/doc123/download" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-sqlite3")
+		w.Write(database)
+	})
+	defer cleanup()
+
+	fileName := t.TempDir() + "/doc.grist"
+	if err := ExportDocGrist("doc123", fileName); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if written, _ := os.ReadFile(fileName); !bytes.Equal(written, database) {
+		t.Errorf("Expected the export to be written verbatim, got %q", written)
+	}
+	if err := ExportDocGrist("missing", t.TempDir()+"/missing.grist"); err == nil {
+		t.Errorf("Expected an error for a failed download")
+	}
+}
+
+func TestInvalidIdentifiers(t *testing.T) {
+	requests := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{}`))
+	})
+	defer cleanup()
+
+	if _, err := AddColumns("doc123", "Table1", []TableColumn{{Id: "Name"}, {Id: "2nd name"}}); !errors.Is(err, ErrInvalidIdentifier) || !contains(err.Error(), `"2nd name"`) {
+		t.Errorf("Expected ErrInvalidIdentifier naming the column, got %v", err)
+	}
+	if _, err := EnsureTable("doc123", "My Table", nil); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Expected ErrInvalidIdentifier for the table id, got %v", err)
+	}
+	if _, err := RenameTable("doc123", "Table1", "people"); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Expected ErrInvalidIdentifier for a lowercase table id, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected nothing to be sent, got %d requests", requests)
+	}
+}
+
+func TestExportDocGristTo(t *testing.T) {
+	export := bytes.Repeat([]byte{0x00, 0xff, '\n', 'x'}, 1<<20)
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/docs/doc123/download", "/api/docs/doc123/download/xlsx":
+			w.Write(export)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "document not found"}`))
+		}
+	})
+	defer cleanup()
+
+	var grist, excel bytes.Buffer
+	if err := ExportDocGristTo("doc123", &grist); err != nil || !bytes.Equal(grist.Bytes(), export) {
+		t.Errorf("Expected the export to be streamed verbatim, got %d bytes, %v", grist.Len(), err)
+	}
+	if err := ExportDocExcelTo("doc123", &excel); err != nil || !bytes.Equal(excel.Bytes(), export) {
+		t.Errorf("Expected the Excel export to be streamed verbatim, got %d bytes, %v", excel.Len(), err)
+	}
+
+	var missing bytes.Buffer
+	err := ExportDocGristTo("missing", &missing)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || missing.Len() != 0 {
+		t.Errorf("Expected a 404 error with nothing written, got %v and %d bytes", err, missing.Len())
+	}
+}
+
+func TestGetTableContent(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/docs/doc123/download/csv" || r.URL.Query().Get("tableId") != "Table1" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "table not found"}`))
+			return
+		}
+		w.Write([]byte("Name,Age\nAlice,30\n"))
+	})
+	defer cleanup()
+
+	content, status := GetTableContent("doc123", "Table1")
+	if status != http.StatusOK || content != "Name,Age\nAlice,30\n" {
+		t.Errorf("Expected the CSV to be returned, got %d %q", status, content)
+	}
+	if _, status := GetTableContent("doc123", "Missing"); status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+}
+
+func TestRecordsEncodingErrors(t *testing.T) {
+	writes := 0
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writes++
+		}
+		w.Write([]byte(`{"records": []}`))
+	})
+	defer cleanup()
+
+	fields := map[string]interface{}{"A": make(chan int)}
+	isEncodingError := func(err error) bool {
+		var unsupported *json.UnsupportedTypeError
+		return err != nil && strings.Contains(err.Error(), "encoding records") && errors.As(err, &unsupported)
+	}
+
+	if _, err := AddRecordsBatched("doc123", "T", []map[string]interface{}{fields}, nil); !isEncodingError(err) {
+		t.Errorf("AddRecordsBatched: expected an encoding error, got %v", err)
+	}
+	if _, err := UpdateRecordsBatched("doc123", "T", []Record{{Id: 1, Fields: fields}}, nil); !isEncodingError(err) {
+		t.Errorf("UpdateRecordsBatched: expected an encoding error, got %v", err)
+	}
+	upserts := []RecordWithRequire{{Require: map[string]interface{}{"A": 1}, Fields: fields}}
+	if _, err := UpsertRecordsWithResults("doc123", "T", upserts, nil); !isEncodingError(err) {
+		t.Errorf("UpsertRecordsWithResults: expected an encoding error, got %v", err)
+	}
+
+	// The legacy signatures report the same message with status -1
+	if response, status := UpdateRecords("doc123", "T", []Record{{Id: 1, Fields: fields}}, nil); status != -1 || !strings.Contains(response, "encoding records") {
+		t.Errorf("UpdateRecords: expected -1 and an encoding error, got %d %q", status, response)
+	}
+	if response, status := UpsertRecords("doc123", "T", upserts, nil); status != -1 || !strings.Contains(response, "unsupported type") {
+		t.Errorf("UpsertRecords: expected -1 and an encoding error, got %d %q", status, response)
+	}
+	if _, status := AddRecords("doc123", "T", []map[string]interface{}{fields}, nil); status != -1 {
+		t.Errorf("AddRecords: expected -1, got %d", status)
+	}
+	if writes != 0 {
+		t.Errorf("Expected nothing to be sent, got %d requests", writes)
+	}
+}
+
+func TestGetRecords_FilterEncoding(t *testing.T) {
+	var filter, limit string
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		filter, limit = r.URL.Query().Get("filter"), r.URL.Query().Get("limit")
+		w.Write([]byte(`{"records": []}`))
+	})
+	defer cleanup()
+
+	values := []interface{}{"Smith & Sons", `say "hi"`, "a=b+c", "Strasbourg – Eurométropole", "東京", "100%"}
+	_, status := GetRecords("doc123", "T", &GetRecordsOptions{
+		Filter: map[string][]interface{}{"Name": values},
+		Limit:  3,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if limit != "3" {
+		t.Errorf("Expected limit 3 alongside the filter, got %q", limit)
+	}
+	received := map[string][]interface{}{}
+	if err := json.Unmarshal([]byte(filter), &received); err != nil {
+		t.Fatalf("Expected the filter to be valid JSON, got %q: %v", filter, err)
+	}
+	if fmt.Sprint(received["Name"]) != fmt.Sprint(values) {
+		t.Errorf("Expected the filter values to round-trip, got %v", received["Name"])
+	}
+}
+
+func TestExportDocJSON(t *testing.T) {
+	_, cleanup := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/docs/doc123/tables":
+			w.Write([]byte(`{"tables": [{"id": "People"}, {"id": "Pets"}, {"id": "Empty"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/columns"):
+			w.Write([]byte(`{"columns": [{"id": "Name", "fields": {"type": "Text"}}]}`))
+		case r.URL.Path == "/api/docs/doc123/sql":
+			var body struct {
+				SQL string `json:"sql"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			switch {
+			case contains(body.SQL, `FROM "People"`):
+				w.Write([]byte(`{"records": [{"fields": {"id": 1}}, {"fields": {"id": 2}}]}`))
+			case contains(body.SQL, `FROM "Pets"`):
+				w.Write([]byte(`{"records": [{"fields": {"id": 1}}]}`))
+			default:
+				w.Write([]byte(`{"records": []}`))
+			}
+		case r.URL.Path == "/api/docs/doc123/tables/People/records":
+			writeRecordsByIds(t, w, r, func(id int) string {
+				return map[int]string{1: `{"Name": "Alice"}`, 2: `{"Name": "Bob \"B\""}`}[id]
+			})
+		case r.URL.Path == "/api/docs/doc123/tables/Pets/records":
+			writeRecordsByIds(t, w, r, func(id int) string { return `{"Name": "Rex"}` })
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	var out bytes.Buffer
+	if err := ExportDocJSON("doc123", &out, ExportJSONOptions{Schema: true}); err != nil {
+		t.Fatalf("Expected the export to succeed, got %v", err)
+	}
+	var export struct {
+		Schema DocSchema `json:"_schema"`
+		People []Record
+		Pets   []Record
+		Empty  []Record
+	}
+	if err := json.Unmarshal(out.Bytes(), &export); err != nil {
+		t.Fatalf("Expected valid JSON, got %v in %s", err, out.String())
+	}
+	if len(export.People) != 2 || export.People[1].Fields["Name"] != `Bob "B"` || export.People[1].Fields["manualSort"] != nil {
+		t.Errorf("Unexpected People records %v", export.People)
+	}
+	if len(export.Pets) != 1 || export.Pets[0].Id != 1 {
+		t.Errorf("Unexpected Pets records %v", export.Pets)
+	}
+	if export.Empty == nil || len(export.Empty) != 0 {
+		t.Errorf("Expected an empty array for Empty, got %v", export.Empty)
+	}
+	if export.Schema.DocId != "doc123" || len(export.Schema.Tables) != 3 {
+		t.Errorf("Unexpected schema %+v", export.Schema)
+	}
+
+	out.Reset()
+	if err := ExportDocJSON("doc123", &out, ExportJSONOptions{ExcludeTables: []string{"P*"}}); err != nil {
+		t.Fatalf("Expected the export to succeed, got %v", err)
+	}
+	if got := strings.Join(strings.Fields(out.String()), ""); got != `{"Empty":[]}` {
+		t.Errorf("Expected only the Empty table without schema, got %s", got)
+	}
+
+	out.Reset()
+	if err := ExportDocJSON("doc123", &out, ExportJSONOptions{IncludeTables: []string{"Missing*"}}); err != nil || strings.TrimSpace(out.String()) != "{}" {
+		t.Errorf("Expected an empty object when no table is selected, got %q %v", out.String(), err)
+	}
+}
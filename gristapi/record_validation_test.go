@@ -1083,7 +1083,7 @@ func createTestDocument(t *testing.T, workspaceID int, name string) string {
 		return ""
 	}
 
-	response, status := httpPost(url, string(bodyJSON))
+	response, status, _ := httpPost(url, string(bodyJSON))
 
 	if status != http.StatusOK {
 		t.Errorf("Failed to create document '%s': status %d, response: %s", name, status, response)
@@ -1118,7 +1118,7 @@ func createTestTable(t *testing.T, docID, tableID string) bool {
 	}
 
 	url := fmt.Sprintf("docs/%s/tables", docID)
-	response, status := httpPost(url, string(bodyJSON))
+	response, status, _ := httpPost(url, string(bodyJSON))
 
 	if status != http.StatusOK {
 		t.Errorf("Failed to create table '%s': status %d, response: %s", tableID, status, response)
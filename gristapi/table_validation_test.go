@@ -126,7 +126,7 @@ func createTableTestDocument(t *testing.T, workspaceID int, name string) string
 	url := fmt.Sprintf("workspaces/%d/docs", workspaceID)
 	data := fmt.Sprintf(`{"name":"%s"}`, name)
 
-	response, status := httpPost(url, data)
+	response, status, _ := httpPost(url, data)
 	t.Logf("Create document response: status=%d, body='%s'", status, response)
 
 	if status != http.StatusOK {
@@ -211,7 +211,7 @@ func testCreateTables(t *testing.T, docID string) {
 			}
 
 			url := fmt.Sprintf("docs/%s/tables", docID)
-			response, status := httpPost(url, string(bodyJSON))
+			response, status, _ := httpPost(url, string(bodyJSON))
 
 			if status != http.StatusOK {
 				t.Errorf("Failed to create table %s: HTTP %d - %s", tt.tableName, status, response)
@@ -304,10 +304,10 @@ func testModifyColumns(t *testing.T, docID string) {
 
 			if tt.operation == "add" {
 				url := fmt.Sprintf("docs/%s/tables/%s/columns", docID, tableName)
-				response, status = httpPost(url, string(bodyJSON))
+				response, status, _ = httpPost(url, string(bodyJSON))
 			} else {
 				url := fmt.Sprintf("docs/%s/tables/%s/columns", docID, tableName)
-				response, status = httpPatch(url, string(bodyJSON))
+				response, status, _ = httpPatch(url, string(bodyJSON))
 			}
 
 			if status != http.StatusOK {
@@ -389,7 +389,7 @@ func testAllColumnTypes(t *testing.T, docID string) {
 	}
 
 	url = fmt.Sprintf("docs/%s/tables", docID)
-	response, status := httpPost(url, string(bodyJSON))
+	response, status, _ := httpPost(url, string(bodyJSON))
 
 	if status != http.StatusOK {
 		t.Fatalf("Failed to create table with all types: HTTP %d - %s", status, response)
@@ -490,7 +490,7 @@ func testRenameAndDeleteColumns(t *testing.T, docID string) {
 
 		bodyJSON, _ := json.Marshal(columnData)
 		url := fmt.Sprintf("docs/%s/tables/%s/columns", docID, tableName)
-		response, status := httpPatch(url, string(bodyJSON))
+		response, status, _ := httpPatch(url, string(bodyJSON))
 
 		if status != http.StatusOK {
 			t.Errorf("Failed to rename column: HTTP %d - %s", status, response)
@@ -515,7 +515,7 @@ func testRenameAndDeleteColumns(t *testing.T, docID string) {
 
 		// Delete the Quantity column
 		url := fmt.Sprintf("docs/%s/tables/%s/columns/Quantity", docID, tableName)
-		response, status := httpDelete(url, "")
+		response, status, _ := httpDelete(url, "")
 
 		if status != http.StatusOK {
 			t.Errorf("Failed to delete column: HTTP %d - %s", status, response)
@@ -9,6 +9,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"slices"
 	"sort"
@@ -28,6 +29,15 @@ func SetOutput(out string) {
 	output = out
 }
 
+// reportError displays the failure of a request, telling how to set a new
+// API key when Grist rejected it
+func reportError(action string, err error) {
+	fmt.Printf("%s %s failed: %s\n", common.StatusMarker(false), action, err)
+	if gristapi.IsUnauthorized(err) {
+		fmt.Println("The API key is invalid or has expired: run 'gristle config' to set a new one")
+	}
+}
+
 // Display help message and quit
 func Help() {
 
@@ -88,7 +98,7 @@ Configure Grist envfile (url and api token)
 Interactive filling the `.gristctl` file
 */
 func Config() {
-	configFile := gristapi.GetConfig()
+	configFile, _ := gristapi.GetConfig()
 	common.DisplayTitle(fmt.Sprintf("%s (%s)", common.T("config.title"), configFile))
 	fmt.Printf("%s :\n- URL : %s\n", common.T("config.actual"), os.Getenv("GRIST_URL"))
 	token := ""
@@ -96,10 +106,7 @@ func Config() {
 		token += "•"
 	}
 	fmt.Printf("- %s : %s\n", common.T("config.token"), token)
-	testConnect := "❌"
-	if gristapi.TestConnection() {
-		testConnect = "✅"
-	}
+	testConnect := common.StatusMarker(gristapi.TestConnection())
 	fmt.Printf("%s : %s\n", common.T("config.connectTest"), testConnect)
 
 	if common.Confirm(common.T("config.config")) {
@@ -111,7 +118,7 @@ func Config() {
 			rawURL := common.Ask(common.T("config.urlSet"))
 			url, err = common.NormalizeURL(rawURL)
 			if err != nil {
-				fmt.Printf("❌ Invalid URL: %v. Please try again.\n", err)
+				fmt.Printf("%s Invalid URL: %v. Please try again.\n", common.StatusMarker(false), err)
 				continue
 			}
 			break
@@ -143,9 +150,13 @@ func Config() {
 			fmt.Printf("%s %s\n", common.T("config.savedIn"), configFile)
 
 			// Test the configuration by connecting to the server
-			nbOrgs := len(gristapi.GetOrgs())
+			orgs, err := gristapi.GetOrgsWithError()
+			nbOrgs := len(orgs)
 			fmt.Printf("Nb orgs : %d\n", nbOrgs)
-			if nbOrgs <= 0 {
+			if err != nil || nbOrgs <= 0 {
+				if err != nil {
+					fmt.Println(err)
+				}
 				fmt.Println(common.T("config.connectError"))
 				os.Exit(-1)
 			}
@@ -253,7 +264,11 @@ func ImportUsers() {
 // Displays the list of users witch access to an organization
 func DisplayOrgAccess(idOrg string) {
 
-	lstUsers := gristapi.GetOrgAccess(idOrg)
+	lstUsers, err := gristapi.GetOrgAccessWithError(idOrg)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading the access of organization %s", idOrg), err)
+		return
+	}
 
 	switch output {
 	case "table":
@@ -304,13 +319,19 @@ func DisplayDoc(docId string) {
 	}
 
 	// Getting the document
-	doc := gristapi.GetDoc(docId)
-	if doc.Id == "" {
-		fmt.Printf("❗️ Document %s not found ❗️\n", docId)
+	doc, found, err := gristapi.GetDocOK(docId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading document %s", docId), err)
+	} else if !found {
+		fmt.Printf("%s Document %s not found %s\n", common.StatusMarker(false), docId, common.StatusMarker(false))
 	} else {
 		// Document was found
 		// Getting the doc's tables
-		var tables gristapi.Tables = gristapi.GetDocTables(docId)
+		tables, err := gristapi.GetDocTablesWithError(docId)
+		if err != nil {
+			reportError(fmt.Sprintf("Reading the tables of document %s", docId), err)
+			return
+		}
 
 		myDoc := DocInfo{
 			Id:       doc.Id,
@@ -321,14 +342,28 @@ func DisplayDoc(docId string) {
 
 		// Getting the tables details
 		var wg sync.WaitGroup
+		var mutex sync.Mutex
 		var tables_details []TableDetails
+		var errs []error
 		for _, table := range tables.Tables {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
 				table_desc := ""
-				columns := gristapi.GetTableColumns(docId, table.Id)
-				rows := gristapi.GetTableRows(docId, table.Id)
+				columns, err := gristapi.GetTableColumnsWithError(docId, table.Id)
+				if err != nil {
+					mutex.Lock()
+					errs = append(errs, err)
+					mutex.Unlock()
+					return
+				}
+				rows, err := gristapi.GetTableRowsWithError(docId, table.Id)
+				if err != nil {
+					mutex.Lock()
+					errs = append(errs, err)
+					mutex.Unlock()
+					return
+				}
 
 				var cols_names []string
 				for _, col := range columns.Columns {
@@ -344,10 +379,16 @@ func DisplayDoc(docId string) {
 					Nb_cols:    len(columns.Columns),
 					Cols_names: cols_names,
 				}
+				mutex.Lock()
 				tables_details = append(tables_details, table_info)
+				mutex.Unlock()
 			}()
 		}
 		wg.Wait()
+		if len(errs) > 0 {
+			reportError(fmt.Sprintf("Reading the tables of document %s", docId), errs[0])
+			return
+		}
 
 		myDoc.Tables = tables_details
 
@@ -363,10 +404,7 @@ func DisplayDoc(docId string) {
 		case "table":
 			{
 				// Displaying the document name
-				pinned := ""
-				if myDoc.IsPinned {
-					pinned = "📌"
-				}
+				pinned := common.PinnedMarker(myDoc.IsPinned)
 				common.DisplayTitle(fmt.Sprintf("Document '%s' (%s) %s", myDoc.Name, myDoc.Id, pinned))
 				fmt.Printf("Contains %d tables :\n", myDoc.NbTables)
 				// Displaying the tables details
@@ -392,7 +430,11 @@ func DisplayDoc(docId string) {
 func DisplayOrgs() {
 
 	// Getting the list of organizations
-	lstOrgs := gristapi.GetOrgs()
+	lstOrgs, err := gristapi.GetOrgsWithError()
+	if err != nil {
+		reportError("Reading the organizations", err)
+		return
+	}
 	// Sorting the list of organizations by name (lowercase)
 	sort.Slice(lstOrgs, func(i, j int) bool {
 		return strings.ToLower(lstOrgs[i].Name) < strings.ToLower(lstOrgs[j].Name)
@@ -438,20 +480,29 @@ func DisplayOrg(orgId string) {
 
 	var lstWsDesc []WpDesc
 
-	org := gristapi.GetOrg(orgId)
-	if org.Id == 0 {
-		fmt.Printf("❗️ Organization %s not found ❗️\n", orgId)
+	org, found, err := gristapi.GetOrgOK(orgId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading organization %s", orgId), err)
+	} else if !found {
+		fmt.Printf("%s Organization %s not found %s\n", common.StatusMarker(false), orgId, common.StatusMarker(false))
 	} else {
 
 		// Org was found
-		worskspaces := gristapi.GetOrgWorkspaces(org.Id)
+		worskspaces, err := gristapi.GetOrgWorkspacesWithError(org.Id)
+		if err != nil {
+			reportError(fmt.Sprintf("Reading the workspaces of organization %s", orgId), err)
+			return
+		}
 		var wg sync.WaitGroup
 		// Retrieving the number of documents and users for each workspace
 		for _, ws := range worskspaces {
 			func() {
 				defer wg.Done()
 				wg.Add(1)
-				users := gristapi.GetWorkspaceAccess(ws.Id)
+				users, accessErr := gristapi.GetWorkspaceAccessWithError(ws.Id)
+				if accessErr != nil && err == nil {
+					err = accessErr
+				}
 				nbUsers := 0
 				for _, user := range users.Users {
 					if user.Access != "" {
@@ -462,6 +513,10 @@ func DisplayOrg(orgId string) {
 			}()
 		}
 		wg.Wait()
+		if err != nil {
+			reportError(fmt.Sprintf("Reading the access of the workspaces of organization %s", orgId), err)
+			return
+		}
 		// Sorting the list of workspaces by name
 		sort.Slice(lstWsDesc, func(i, j int) bool {
 			return lstWsDesc[i].Name < lstWsDesc[j].Name
@@ -517,9 +572,11 @@ func DisplayWorkspace(workspaceId int) {
 	}
 
 	// Getting the workspace
-	ws := gristapi.GetWorkspace(workspaceId)
-	if ws.Id == 0 {
-		fmt.Printf("❗️ Workspace %d not found ❗️\n", workspaceId)
+	ws, found, err := gristapi.GetWorkspaceOK(workspaceId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading workspace %d", workspaceId), err)
+	} else if !found {
+		fmt.Printf("%s Workspace %d not found %s\n", common.StatusMarker(false), workspaceId, common.StatusMarker(false))
 	} else {
 		// Workspace was found
 
@@ -558,11 +615,7 @@ func DisplayWorkspace(workspaceId int) {
 					table := tablewriter.NewWriter(os.Stdout)
 					table.SetHeader([]string{common.T("col.ident"), common.T("col.name"), common.T("col.pinned")})
 					for _, doc := range myWS.Docs {
-						pin := ""
-						if doc.IsPinned {
-							pin = "📌"
-						}
-						table.Append([]string{doc.Id, doc.Name, pin})
+						table.Append([]string{doc.Id, doc.Name, common.PinnedMarker(doc.IsPinned)})
 					}
 					table.Render()
 				} else {
@@ -602,12 +655,18 @@ func DisplayWorkspaceAccess(workspaceId int) {
 	}
 
 	// Getting the workspace
-	ws := gristapi.GetWorkspace((workspaceId))
-	if ws.Id == 0 {
-		fmt.Printf("❗️ Workspace %d not found ❗️\n", workspaceId)
+	ws, found, err := gristapi.GetWorkspaceOK(workspaceId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading workspace %d", workspaceId), err)
+	} else if !found {
+		fmt.Printf("%s Workspace %d not found %s\n", common.StatusMarker(false), workspaceId, common.StatusMarker(false))
 	} else {
 		// Workspace was found
-		wsa := gristapi.GetWorkspaceAccess(workspaceId)
+		wsa, err := gristapi.GetWorkspaceAccessWithError(workspaceId)
+		if err != nil {
+			reportError(fmt.Sprintf("Reading the access of workspace %d", workspaceId), err)
+			return
+		}
 
 		var myUsers []wsUser
 		nbUsers := 0
@@ -689,13 +748,19 @@ func DisplayDocAccess(docId string) {
 	var myDocAccess DocAcces
 
 	// Getting the document
-	doc := gristapi.GetDoc(docId)
-	if doc.Name == "" {
-		fmt.Printf("❗️ Document %s not found ❗️\n", docId)
+	doc, found, err := gristapi.GetDocOK(docId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading document %s", docId), err)
+	} else if !found {
+		fmt.Printf("%s Document %s not found %s\n", common.StatusMarker(false), docId, common.StatusMarker(false))
 	} else {
 		// Document was found
 		// Displaying the access rights
-		docAccess := gristapi.GetDocAccess(docId)
+		docAccess, err := gristapi.GetDocAccessWithError(docId)
+		if err != nil {
+			reportError(fmt.Sprintf("Reading the access of document %s", docId), err)
+			return
+		}
 		// Sorting users by email (lowercase)
 		sort.Slice(docAccess.Users, func(i, j int) bool {
 			return strings.ToLower(docAccess.Users[i].Email) < strings.ToLower(docAccess.Users[j].Email)
@@ -773,14 +838,22 @@ func DisplayDocWebhooks(docId string) {
 	}
 
 	// Getting the document
-	doc := gristapi.GetDoc(docId)
-	if doc.Name == "" {
-		fmt.Printf("❗️ Document %s not found ❗️\n", docId)
+	doc, found, err := gristapi.GetDocOK(docId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading document %s", docId), err)
+		return
+	}
+	if !found {
+		fmt.Printf("%s Document %s not found %s\n", common.StatusMarker(false), docId, common.StatusMarker(false))
 		return
 	}
 
 	// Getting the webhooks
-	webhooks := gristapi.GetDocWebhooks(docId)
+	webhooks, err := gristapi.GetDocWebhooksWithError(docId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading the webhooks of document %s", docId), err)
+		return
+	}
 
 	// Build the display structure
 	var webhookInfos []WebhookInfo
@@ -825,10 +898,7 @@ func DisplayDocWebhooks(docId string) {
 			table := tablewriter.NewWriter(os.Stdout)
 			table.SetHeader([]string{"ID", "Name", "Table", "Events", "Enabled", "Status", "Waiting"})
 			for _, wh := range webhookInfos {
-				enabled := "❌"
-				if wh.Enabled {
-					enabled = "✅"
-				}
+				enabled := common.StatusMarker(wh.Enabled)
 				events := strings.Join(wh.EventTypes, ", ")
 				table.Append([]string{
 					wh.Id,
@@ -861,10 +931,24 @@ func DisplayUserMatrix() {
 	}
 	lstUserAccess := []userAccess{}
 
-	lstOrg := gristapi.GetOrgs()
+	lstOrg, err := gristapi.GetOrgsWithError()
+	if err != nil {
+		reportError("Reading the organizations", err)
+		return
+	}
 	for _, org := range lstOrg {
-		for _, ws := range gristapi.GetOrgWorkspaces(org.Id) {
-			for _, access := range gristapi.GetWorkspaceAccess(ws.Id).Users {
+		workspaces, err := gristapi.GetOrgWorkspacesWithError(org.Id)
+		if err != nil {
+			reportError(fmt.Sprintf("Reading the workspaces of organization %d", org.Id), err)
+			return
+		}
+		for _, ws := range workspaces {
+			wsAccess, err := gristapi.GetWorkspaceAccessWithError(ws.Id)
+			if err != nil {
+				reportError(fmt.Sprintf("Reading the access of workspace %d", ws.Id), err)
+				return
+			}
+			for _, access := range wsAccess.Users {
 				tmpUserAccess := userAccess{
 					Id:            access.Id,
 					Email:         access.Email,
@@ -947,34 +1031,60 @@ func DeleteUser(userId int) {
 
 // Export a document as a Grist file
 func ExportDocGrist(docId string) {
-	doc := gristapi.GetDoc(docId)
-	if doc.Name != "" {
-		gristapi.ExportDocGrist(docId, doc.Workspace.Name+"_"+doc.Name+".grist")
+	doc, found, err := gristapi.GetDocOK(docId)
+	if err != nil {
+		reportError(fmt.Sprintf("Export of document %s", docId), err)
+	} else if found {
+		if err := gristapi.ExportDocGrist(docId, doc.Workspace.Name+"_"+doc.Name+".grist"); err != nil {
+			reportError(fmt.Sprintf("Export of document %s", docId), err)
+		}
 	} else {
-		fmt.Printf("❗️ Document %s not found ❗️\n", docId)
+		fmt.Printf("%s Document %s not found %s\n", common.StatusMarker(false), docId, common.StatusMarker(false))
 	}
 }
 
+// Display the content of a table as CSV
+func DisplayTableContent(docId string, tableName string) {
+	content, status := gristapi.GetTableContent(docId, tableName)
+	if status != http.StatusOK {
+		fmt.Printf("%s Export of table %s failed (HTTP %d): %s\n", common.StatusMarker(false), tableName, status, content)
+		return
+	}
+	fmt.Println(content)
+}
+
 // Export a document as an Excel file
 func ExportDocExcel(docId string) {
-	doc := gristapi.GetDoc(docId)
-	if doc.Name != "" {
-		gristapi.ExportDocExcel(docId, doc.Workspace.Name+"_"+doc.Name+".xlsx")
+	doc, found, err := gristapi.GetDocOK(docId)
+	if err != nil {
+		reportError(fmt.Sprintf("Export of document %s", docId), err)
+	} else if found {
+		if err := gristapi.ExportDocExcel(docId, doc.Workspace.Name+"_"+doc.Name+".xlsx"); err != nil {
+			reportError(fmt.Sprintf("Export of document %s", docId), err)
+		}
 	} else {
-		fmt.Printf("❗️ Document %s not found ❗️\n", docId)
+		fmt.Printf("%s Document %s not found %s\n", common.StatusMarker(false), docId, common.StatusMarker(false))
 	}
 }
 
 // Move a document to a workspace
 func MoveDoc(docId string, workspaceId int) {
-	doc := gristapi.GetDoc(docId)
-	ws := gristapi.GetWorkspace(workspaceId)
+	_, docFound, err := gristapi.GetDocOK(docId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading document %s", docId), err)
+		return
+	}
+	_, wsFound, err := gristapi.GetWorkspaceOK(workspaceId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading workspace %d", workspaceId), err)
+		return
+	}
 
-	if doc.Name == "" {
-		fmt.Printf("❗️ Document %s not found ❗️\n", docId)
+	if !docFound {
+		fmt.Printf("%s Document %s not found %s\n", common.StatusMarker(false), docId, common.StatusMarker(false))
 	} else {
-		if ws.Id == 0 {
-			fmt.Printf("❗️ Workspace %d not found ❗️\n", workspaceId)
+		if !wsFound {
+			fmt.Printf("%s Workspace %d not found %s\n", common.StatusMarker(false), workspaceId, common.StatusMarker(false))
 		} else {
 			gristapi.MoveDoc(docId, workspaceId)
 		}
@@ -983,25 +1093,41 @@ func MoveDoc(docId string, workspaceId int) {
 
 // Move all documents from a workspace to another
 func MoveAllDocs(fromWorkspaceId int, toWorkspaceId int) {
-	from_ws := gristapi.GetWorkspace(fromWorkspaceId)
-	to_ws := gristapi.GetWorkspace(toWorkspaceId)
+	_, fromFound, err := gristapi.GetWorkspaceOK(fromWorkspaceId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading workspace %d", fromWorkspaceId), err)
+		return
+	}
+	_, toFound, err := gristapi.GetWorkspaceOK(toWorkspaceId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading workspace %d", toWorkspaceId), err)
+		return
+	}
 
-	if from_ws.Id == 0 || to_ws.Id == 0 {
-		fmt.Printf("❗️ Workspace %d or %d not found ❗️\n", fromWorkspaceId, toWorkspaceId)
-	} else {
-		gristapi.MoveAllDocs(fromWorkspaceId, toWorkspaceId)
+	if !fromFound || !toFound {
+		fmt.Printf("%s Workspace %d or %d not found %s\n", common.StatusMarker(false), fromWorkspaceId, toWorkspaceId, common.StatusMarker(false))
+	} else if err := gristapi.MoveAllDocs(fromWorkspaceId, toWorkspaceId); err != nil {
+		reportError("Moving the documents", err)
 	}
 
 }
 
 // Create a new organization
 func CreateOrg(orgName string, orgDomain string) {
-	org := gristapi.GetOrg(orgDomain)
+	org, found, err := gristapi.GetOrgOK(orgDomain)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading organization %s", orgDomain), err)
+		return
+	}
 
-	if org.Id != 0 {
-		fmt.Printf("❗️ Organization %s already exists ❗️\n", org.Name)
+	if found {
+		fmt.Printf("%s Organization %s already exists %s\n", common.StatusMarker(false), org.Name, common.StatusMarker(false))
 	} else {
-		orgId := gristapi.CreateOrg(orgName, orgDomain)
+		orgId, err := gristapi.CreateOrgWithError(orgName, orgDomain)
+		if err != nil {
+			reportError(fmt.Sprintf("Creation of organization %s", orgName), err)
+			return
+		}
 		fmt.Printf("Organization %d : %s has been created\n", orgId, orgName)
 	}
 
@@ -1009,12 +1135,18 @@ func CreateOrg(orgName string, orgDomain string) {
 
 // Retrieve organization's usage
 func GetOrgUsageSummary(orgId string) {
-	org := gristapi.GetOrg(orgId)
+	_, found, err := gristapi.GetOrgOK(orgId)
 
-	if org.Id == 0 {
-		fmt.Printf("❗️ Organization %s not found ❗️\n", orgId)
+	if err != nil {
+		reportError(fmt.Sprintf("Reading organization %s", orgId), err)
+	} else if !found {
+		fmt.Printf("%s Organization %s not found %s\n", common.StatusMarker(false), orgId, common.StatusMarker(false))
 	} else {
-		usage := gristapi.GetOrgUsageSummary(orgId)
+		usage, err := gristapi.GetOrgUsageSummaryWithError(orgId)
+		if err != nil {
+			reportError(fmt.Sprintf("Reading the usage of organization %s", orgId), err)
+			return
+		}
 		jsonUsage, err := json.MarshalIndent(usage, "", "  ")
 		if err != nil {
 			fmt.Println("ERROR :", err)
@@ -44,7 +44,10 @@ func registerListOrgs(s *server.MCPServer) {
 	)
 
 	s.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		orgs := gristapi.GetOrgs()
+		orgs, err := gristapi.GetOrgsWithError()
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
 
 		type orgInfo struct {
 			ID     int    `json:"id"`
@@ -86,7 +89,10 @@ func registerListWorkspaces(s *server.MCPServer) {
 			return mcp.NewToolResultError("org_id is required"), nil
 		}
 
-		workspaces := gristapi.GetOrgWorkspaces(orgID)
+		workspaces, err := gristapi.GetOrgWorkspacesWithError(orgID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
 
 		type wsInfo struct {
 			ID       int    `json:"id"`
@@ -128,7 +134,13 @@ func registerListDocs(s *server.MCPServer) {
 			return mcp.NewToolResultError("workspace_id is required"), nil
 		}
 
-		workspace := gristapi.GetWorkspace(wsID)
+		workspace, found, err := gristapi.GetWorkspaceOK(wsID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if !found {
+			return mcp.NewToolResultError(fmt.Sprintf("workspace %d not found", wsID)), nil
+		}
 
 		type docInfo struct {
 			ID       string `json:"id"`
@@ -170,8 +182,17 @@ func registerGetDoc(s *server.MCPServer) {
 			return mcp.NewToolResultError("doc_id is required"), nil
 		}
 
-		doc := gristapi.GetDoc(docID)
-		tables := gristapi.GetDocTables(docID)
+		doc, found, err := gristapi.GetDocOK(docID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if !found {
+			return mcp.NewToolResultError("document " + docID + " not found"), nil
+		}
+		tables, err := gristapi.GetDocTablesWithError(docID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
 
 		type tableInfo struct {
 			ID string `json:"id"`
@@ -239,7 +260,13 @@ func registerExportDoc(s *server.MCPServer) {
 		}
 
 		// Get doc name for default filename
-		doc := gristapi.GetDoc(docID)
+		doc, found, err := gristapi.GetDocOK(docID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if !found {
+			return mcp.NewToolResultError("document " + docID + " not found"), nil
+		}
 		filename := req.GetString("filename", doc.Name)
 
 		switch format {
@@ -247,12 +274,16 @@ func registerExportDoc(s *server.MCPServer) {
 			if filename[len(filename)-5:] != ".xlsx" {
 				filename += ".xlsx"
 			}
-			gristapi.ExportDocExcel(docID, filename)
+			if err := gristapi.ExportDocExcel(docID, filename); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
 		case "grist":
 			if filename[len(filename)-6:] != ".grist" {
 				filename += ".grist"
 			}
-			gristapi.ExportDocGrist(docID, filename)
+			if err := gristapi.ExportDocGrist(docID, filename); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
 		default:
 			return mcp.NewToolResultError("invalid format: " + format), nil
 		}
@@ -277,7 +308,10 @@ func registerGetDocTables(s *server.MCPServer) {
 			return mcp.NewToolResultError("doc_id is required"), nil
 		}
 
-		tables := gristapi.GetDocTables(docID)
+		tables, err := gristapi.GetDocTablesWithError(docID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
 
 		type colInfo struct {
 			ID string `json:"id"`
@@ -290,7 +324,10 @@ func registerGetDocTables(s *server.MCPServer) {
 
 		result := make([]tableDetail, len(tables.Tables))
 		for i, t := range tables.Tables {
-			cols := gristapi.GetTableColumns(docID, t.Id)
+			cols, err := gristapi.GetTableColumnsWithError(docID, t.Id)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
 			colList := make([]colInfo, len(cols.Columns))
 			for j, c := range cols.Columns {
 				colList[j] = colInfo{ID: c.Id}
@@ -374,7 +411,10 @@ func registerGetDocWebhooks(s *server.MCPServer) {
 			return mcp.NewToolResultError("doc_id is required"), nil
 		}
 
-		webhooks := gristapi.GetDocWebhooks(docID)
+		webhooks, err := gristapi.GetDocWebhooksWithError(docID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
 
 		type webhookInfo struct {
 			ID         string   `json:"id"`
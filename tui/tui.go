@@ -2,6 +2,8 @@ package tui
 
 import (
 	"fmt"
+	"net/http"
+	"os"
 	"strings"
 
 	"github.com/bdmorin/gristle/gristapi"
@@ -127,49 +129,71 @@ type successMsg string
 
 // Commands
 func loadOrgs() tea.Msg {
-	orgs := gristapi.GetOrgs()
+	orgs, err := gristapi.GetOrgsWithError()
+	if err != nil {
+		return errMsg(err)
+	}
 	return orgsLoadedMsg(orgs)
 }
 
 func loadWorkspaces(orgID int) tea.Cmd {
 	return func() tea.Msg {
-		workspaces := gristapi.GetOrgWorkspaces(orgID)
+		workspaces, err := gristapi.GetOrgWorkspacesWithError(orgID)
+		if err != nil {
+			return errMsg(err)
+		}
 		return workspacesLoadedMsg(workspaces)
 	}
 }
 
 func loadDocs(workspaceID int) tea.Cmd {
 	return func() tea.Msg {
-		workspace := gristapi.GetWorkspace(workspaceID)
+		workspace, _, err := gristapi.GetWorkspaceOK(workspaceID)
+		if err != nil {
+			return errMsg(err)
+		}
 		return docsLoadedMsg{docs: workspace.Docs, workspace: workspace}
 	}
 }
 
 func loadTables(docID string) tea.Cmd {
 	return func() tea.Msg {
-		tables := gristapi.GetDocTables(docID)
+		tables, err := gristapi.GetDocTablesWithError(docID)
+		if err != nil {
+			return errMsg(err)
+		}
 		return tablesLoadedMsg(tables.Tables)
 	}
 }
 
 func exportExcel(docID, filename string) tea.Cmd {
 	return func() tea.Msg {
-		gristapi.ExportDocExcel(docID, filename)
+		if err := gristapi.ExportDocExcel(docID, filename); err != nil {
+			return errMsg(err)
+		}
 		return successMsg(fmt.Sprintf("Exported to %s", filename))
 	}
 }
 
 func exportGrist(docID, filename string) tea.Cmd {
 	return func() tea.Msg {
-		gristapi.ExportDocGrist(docID, filename)
+		if err := gristapi.ExportDocGrist(docID, filename); err != nil {
+			return errMsg(err)
+		}
 		return successMsg(fmt.Sprintf("Exported to %s", filename))
 	}
 }
 
 func loadTableData(docID, tableID string) tea.Cmd {
 	return func() tea.Msg {
-		columns := gristapi.GetTableColumns(docID, tableID)
-		rows := gristapi.GetTableRows(docID, tableID)
+		columns, err := gristapi.GetTableColumnsWithError(docID, tableID)
+		if err != nil {
+			return errMsg(err)
+		}
+		rows, err := gristapi.GetTableRowsWithError(docID, tableID)
+		if err != nil {
+			return errMsg(err)
+		}
 
 		// Fetch actual data using the records endpoint
 		data := make(map[string][]interface{})
@@ -185,22 +209,33 @@ func loadTableData(docID, tableID string) tea.Cmd {
 
 func loadDocAccess(docID string) tea.Cmd {
 	return func() tea.Msg {
-		access := gristapi.GetDocAccess(docID)
+		access, err := gristapi.GetDocAccessWithError(docID)
+		if err != nil {
+			return errMsg(err)
+		}
 		return docAccessLoadedMsg(access)
 	}
 }
 
 func deleteDoc(docID string) tea.Cmd {
 	return func() tea.Msg {
-		gristapi.DeleteDoc(docID)
+		if err := gristapi.DeleteDoc(docID); err != nil {
+			return errMsg(err)
+		}
 		return docDeletedMsg{}
 	}
 }
 
 func exportTableCSV(docID, tableID, filename string) tea.Cmd {
 	return func() tea.Msg {
-		gristapi.GetTableContent(docID, tableID)
-		return csvExportedMsg(fmt.Sprintf("Exported %s to CSV", tableID))
+		content, status := gristapi.GetTableContent(docID, tableID)
+		if status != http.StatusOK {
+			return errMsg(fmt.Errorf("export of %s failed (HTTP %d)", tableID, status))
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			return errMsg(err)
+		}
+		return csvExportedMsg(fmt.Sprintf("Exported %s to %s", tableID, filename))
 	}
 }
 